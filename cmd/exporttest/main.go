@@ -0,0 +1,89 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the go-evmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/holiman/goevmlab/fuzzing"
+	"github.com/urfave/cli/v2"
+)
+
+var (
+	forkFlag = &cli.StringSliceFlag{
+		Name:  "fork",
+		Usage: "Fork to export the test for (may be given several times). Defaults to the forks of the input test",
+	}
+	commentFlag = &cli.StringFlag{
+		Name:  "comment",
+		Usage: "Comment for the _info section, e.g. describing the client bug the test reproduces",
+	}
+	outFlag = &cli.StringFlag{
+		Name:  "out",
+		Usage: "File to write the exported test to (default: stdout)",
+	}
+)
+
+func initApp() *cli.App {
+	app := cli.NewApp()
+	app.Name = filepath.Base(os.Args[0])
+	app.Authors = []*cli.Author{{Name: "Martin Holst Swende"}}
+	app.Usage = "Exports a state test, e.g. a minimized consensus flaw, in the format of the official test suite (ethereum/tests).\n" +
+		"The expected post-states are filled by go-ethereum, for every fork and transaction index combination"
+	app.ArgsUsage = "<statetest>"
+	app.Flags = []cli.Flag{forkFlag, commentFlag, outFlag}
+	app.Action = exportTest
+	return app
+}
+
+var app = initApp()
+
+func main() {
+	log.SetDefault(log.NewLogger(log.NewTerminalHandlerWithLevel(os.Stderr, log.LevelInfo, true)))
+	if err := app.Run(os.Args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func exportTest(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return fmt.Errorf("input state test file needed")
+	}
+	path := c.Args().First()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	out, err := fuzzing.ExportStateTest(data, c.StringSlice(forkFlag.Name), fuzzing.ExportInfo{
+		Comment: c.String(commentFlag.Name),
+		Source:  filepath.Base(path),
+	})
+	if err != nil {
+		return err
+	}
+	out = append(out, '\n')
+	if dest := c.String(outFlag.Name); dest != "" {
+		log.Info("Exported test", "file", dest)
+		return os.WriteFile(dest, out, 0644)
+	}
+	_, err = os.Stdout.Write(out)
+	return err
+}
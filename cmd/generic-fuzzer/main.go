@@ -60,8 +60,51 @@ func initApp() *cli.App {
 		forkFlag,
 		common.VerbosityFlag,
 		common.NotifyFlag,
+		common.BlockTestFlag,
+		common.CompareStepsFlag,
+		common.MaxRateFlag,
+		common.PprofFlag,
+		common.MemLimitFlag,
+		common.CpuLimitFlag,
+		common.CaptureStderrFlag,
+		common.GoMaxProcsFlag,
+		common.CompareModeFlag,
+		common.OnCrashFlag,
+		common.WebhookFlag,
+		common.CsvFlag,
+		common.AdvisoryEvmFlag,
+		common.AutoMinimizeFlag,
+		common.MinimizeTimeoutFlag,
+		common.SortFieldsFlag,
+		common.RawOutputFlag,
+		common.MaxPendingFlag,
+		common.MaxDiskFlag,
+		common.ContinueOnDivergenceFlag,
+		common.MaxCrashersFlag,
+		common.DurationFlag,
+		common.MaxTestsFlag,
+		common.RamdiskFlag,
+		common.FullPostStateFlag,
+		common.CompareAccessSetFlag,
+		common.CompareRevertDataFlag,
+		common.VerboseDivergenceFlag,
+		common.ShuffleEvmsFlag,
+		common.SeedFlag,
+		common.DictFlag,
+		common.OpcodesFlag,
+		common.SeedCorpusFlag,
+		common.ValidateGeneratorFlag,
+		common.CampaignsFlag,
 	)
 	app.Action = startFuzzer
+	app.Commands = []*cli.Command{
+		{
+			Name:      "stats",
+			Usage:     "Summarizes the runs recorded with --campaigns: tests executed, distinct consensus flaws, and flaws per client",
+			ArgsUsage: "<campaigns.jsonl>",
+			Action:    campaignStats,
+		},
+	}
 	return app
 }
 
@@ -72,6 +115,13 @@ func main() {
 	}
 }
 
+func campaignStats(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return fmt.Errorf("campaigns file needed")
+	}
+	return common.CampaignStats(ctx.Args().First(), os.Stdout)
+}
+
 func startFuzzer(ctx *cli.Context) (err error) {
 	if topic := ctx.String(common.NotifyFlag.Name); topic != "" {
 		_, _ = http.Post(fmt.Sprintf("https://ntfy.sh/%v", topic), "text/plain",
@@ -84,6 +134,10 @@ func startFuzzer(ctx *cli.Context) (err error) {
 		fNames = ctx.StringSlice(engineFlag.Name)
 		fork   = ctx.String(forkFlag.Name)
 	)
+	if ctx.IsSet(common.SeedCorpusFlag.Name) && !ctx.IsSet(engineFlag.Name) {
+		// Only the mutation engine makes use of the seed corpus
+		fNames = []string{"mutate"}
+	}
 	if len(fNames) == 0 {
 		fmt.Printf("At least one fuzzer engine needed. ")
 		fmt.Printf("Available targets: %v\n", fuzzing.FactoryNames())
@@ -91,16 +145,17 @@ func startFuzzer(ctx *cli.Context) (err error) {
 	}
 	var factory common.GeneratorFn
 	if len(fNames) == 1 {
-		factory = fuzzing.Factory(fNames[0], fork)
-		if factory == nil {
-			return fmt.Errorf("unknown target %v", fNames[0])
+		f, err := fuzzing.LookupFactory(fNames[0], fork)
+		if err != nil {
+			return err
 		}
+		factory = f
 	} else {
 		// Need to put together a meta-factory
 		var factories []common.GeneratorFn
 		for _, fName := range fNames {
-			if f := fuzzing.Factory(fName, fork); f == nil {
-				return fmt.Errorf("unknown target %v", fName)
+			if f, err := fuzzing.LookupFactory(fName, fork); err != nil {
+				return err
 			} else {
 				factories = append(factories, f)
 			}
@@ -24,6 +24,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"time"
 
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/holiman/goevmlab/common"
@@ -42,6 +43,21 @@ var (
 		Usage: "What fork to use (London, Merge, Byzantium, Shanghai, etc)",
 		Value: "Merge",
 	}
+	wrongPostFlag = &cli.BoolFlag{
+		Name: "wrong-post",
+		Usage: "If set, the expected post-state embedded in the tests is deliberately wrong, so all clients fail the check.\n" +
+			"This is useful to verify the failure reporting of the fuzzer itself",
+	}
+	generatorFlag = &cli.StringFlag{
+		Name:  "generator",
+		Usage: "The generator (fuzzing-engine) to use",
+		Value: "naive",
+	}
+	provenanceFlag = &cli.StringFlag{
+		Name: "provenance",
+		Usage: "Provenance file (<test>.meta.json) of a test made by the fuzzer. If set, the test is made again,\n" +
+			"with the generator, fork, seed and name recorded in it, instead of the ones given",
+	}
 	app = initApp()
 )
 
@@ -57,8 +73,18 @@ func initApp() *cli.App {
 		common.TraceFlag,
 		engineFlag,
 		forkFlag,
+		wrongPostFlag,
 	}
 	app.Action = generate
+	app.Commands = []*cli.Command{
+		{
+			Name: "gen",
+			Usage: "Generates a single test with the given generator and seed, and writes it to stdout.\n" +
+				"The same generator, fork and seed always yield the same test, the same one the fuzzer makes",
+			Flags:  []cli.Flag{generatorFlag, forkFlag, common.SeedFlag, provenanceFlag},
+			Action: generateOne,
+		},
+	}
 	return app
 }
 
@@ -78,6 +104,7 @@ type config struct {
 	factory  func() *fuzzing.GstMaker
 	target   string
 	tracing  bool
+	wrong    bool
 }
 
 func generate(ctx *cli.Context) error {
@@ -101,16 +128,17 @@ func generate(ctx *cli.Context) error {
 	}
 	var factory common.GeneratorFn
 	if len(fNames) == 1 {
-		factory = fuzzing.Factory(fNames[0], fork)
-		if factory == nil {
-			return fmt.Errorf("unknown target %v", fNames[0])
+		f, err := fuzzing.LookupFactory(fNames[0], fork)
+		if err != nil {
+			return err
 		}
+		factory = f
 	} else {
 		// Need to put together a meta-factory
 		var factories []common.GeneratorFn
 		for _, fName := range fNames {
-			if f := fuzzing.Factory(fName, fork); f == nil {
-				return fmt.Errorf("unknown target %v", fName)
+			if f, err := fuzzing.LookupFactory(fName, fork); err != nil {
+				return err
 			} else {
 				factories = append(factories, f)
 			}
@@ -131,9 +159,38 @@ func generate(ctx *cli.Context) error {
 		factory:  factory,
 		target:   fNames[0],
 		tracing:  ctx.Bool(common.TraceFlag.Name),
+		wrong:    ctx.Bool(wrongPostFlag.Name),
 	})
 }
 
+func generateOne(ctx *cli.Context) error {
+	var (
+		name = ctx.String(generatorFlag.Name)
+		fork = ctx.String(forkFlag.Name)
+		seed = ctx.Int64(common.SeedFlag.Name)
+		test any
+	)
+	if path := ctx.String(provenanceFlag.Name); path != "" {
+		var err error
+		if test, err = common.RegenerateTest(path); err != nil {
+			return err
+		}
+	} else {
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+		log.Info("Seeding test generator", "seed", seed)
+		factory, err := fuzzing.LookupFactory(name, fork)
+		if err != nil {
+			return err
+		}
+		// Like the fuzzer, leave the post-state unfilled
+		test = common.GenerateTest(factory, seed).ToGeneralStateTest(fmt.Sprintf("%v-%d", name, seed))
+	}
+	// Encode the same way as the fuzzer stores tests
+	return json.NewEncoder(os.Stdout).Encode(test)
+}
+
 func createTests(conf *config) error {
 	log.Info("Generating tests",
 		"location", conf.location,
@@ -174,6 +231,9 @@ func createTests(conf *config) error {
 			close()
 			return err
 		}
+		if conf.wrong {
+			base.CorruptPost()
+		}
 		test := base.ToGeneralStateTest(testName)
 		// Write to file
 		encoder := json.NewEncoder(f)
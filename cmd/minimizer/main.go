@@ -17,12 +17,11 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
-	"sort"
 
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/holiman/goevmlab/common"
@@ -85,150 +84,15 @@ func startFuzzer(c *cli.Context) error {
 			return true, err
 		}
 	}
-	if consensus, err := compareFn(testPath, c); err != nil {
-		return err
-	} else if consensus {
-		msg := "No consensus failure -- the input statetest needs to be a test which produces a difference"
-		if !c.Bool(fullTraceFlag.Name) {
-			msg = "No consensus failure -- the input statetest needs to be a test which produces a difference.\n" +
-				"(Perhaps retry with --fulltrace enabled?)"
-		}
-		return errors.New(msg)
-	}
-	var (
-		gst      fuzzing.GeneralStateTest
-		testname string
-		good     = fmt.Sprintf("%v.min", testPath)
-		out      = fmt.Sprintf("%v.%v", testPath, "tmp")
-	)
-	if gstPtr, err := fuzzing.FromGeneralStateTest(testPath); err != nil {
-		return err
-	} else {
-		gst = (*gstPtr)
-		for t := range gst {
-			testname = t
-			break
-		}
-	}
-	var inConsensus = func() bool {
-		data, _ := json.MarshalIndent(gst, "", "  ")
-		if err := os.WriteFile(out, data, 0777); err != nil {
-			panic(err)
-		}
-		allAgree, err := compareFn(out, c)
-		if err != nil {
-			panic(err)
-		}
-		if !allAgree {
-			log.Info("Change ok")
-			if err := os.WriteFile(good, data, 0777); err != nil {
-				panic(err)
-			}
-		} else {
-			log.Info("Bad change, clients in consensus - reverting")
-		}
-		return allAgree
-	}
-
-	// Try decreasing gas
-	gas := sort.Search(int(gst[testname].Tx.GasLimit[0]), func(i int) bool {
-		gst[testname].Tx.GasLimit[0] = uint64(i)
-		log.Info("Mutating gas", "value", i)
-		return !inConsensus()
+	good, err := fuzzing.Minimize(context.Background(), testPath, func(path string) (bool, error) {
+		return compareFn(path, c)
 	})
-	// And restore the gas again
-	gst[testname].Tx.GasLimit[0] = uint64(gas)
-
-	// Try removing accounts
-	for target, acc := range gst[testname].Pre {
-		delete(gst[testname].Pre, target)
-		log.Info("Removing account", "target", target)
-		if !inConsensus() {
-			continue
-		}
-		log.Info("Restoring", "target", target)
-		gst[testname].Pre[target] = acc
-	}
-	// Try reducing code the naive way
-	for target, acc := range gst[testname].Pre {
-		if len(acc.Code) == 0 {
-			continue
-		}
-		log.Info("Reducing code #1", "target", target)
-		code := acc.Code
-		m := naiveCodeMutator{current: code, lastGood: code}
-		// Alright, we're in business
-		fails := 0
-		for {
-			if exhausted := m.proceed(); exhausted {
-				break
-			}
-			acc := gst[testname].Pre[target]
-			acc.Code = m.current
-			gst[testname].Pre[target] = acc
-			if !inConsensus() {
-				fails = 0
-				continue
-			} else {
-				log.Info("Restoring change")
-				fails++
-				m.undo()
-				// restore it
-				acc.Code = m.current
-				gst[testname].Pre[target] = acc
-				if fails > 5 {
-					break
-				}
-			}
-		}
+	if errors.Is(err, fuzzing.ErrNoDivergence) && !c.Bool(fullTraceFlag.Name) {
+		return fmt.Errorf("%w\n(Perhaps retry with --fulltrace enabled?)", err)
 	}
-
-	// Try reducing code
-	for target, acc := range gst[testname].Pre {
-		if len(acc.Code) == 0 {
-			continue
-		}
-		log.Info("Reducing code", "target", target)
-		code := acc.Code
-		m := codeMutator{current: code, lastGood: code}
-		// Alright, we're in business
-		fails := 0
-		for {
-			if exhausted := m.proceed(); exhausted {
-				break
-			}
-			acc := gst[testname].Pre[target]
-			acc.Code = m.current
-			gst[testname].Pre[target] = acc
-			if !inConsensus() {
-				fails = 0
-				continue
-			} else {
-				log.Info("Restoring change")
-				fails++
-				m.undo()
-				// restore it
-				acc.Code = m.current
-				gst[testname].Pre[target] = acc
-				if fails > 5 {
-					break
-				}
-			}
-		}
-	}
-	log.Info("Reducing slots")
-	// Try removing storage
-	for target, acc := range gst[testname].Pre {
-		for k, v := range acc.Storage {
-			delete(gst[testname].Pre[target].Storage, k)
-			log.Info("Reducing slot", "target", target, "slot", k)
-			if !inConsensus() {
-				continue
-			}
-			log.Info("Restoring change")
-			gst[testname].Pre[target].Storage[k] = v
-		}
+	if err != nil {
+		return err
 	}
-	log.Info("Done", "result", good)
+	log.Info("Minimized", "result", good)
 	return nil
 }
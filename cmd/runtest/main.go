@@ -21,15 +21,44 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync/atomic"
 
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/holiman/goevmlab/common"
+	"github.com/holiman/goevmlab/fuzzing"
 	"github.com/urfave/cli/v2"
 	"golang.org/x/exp/slog"
 )
 
-var app = initApp()
+var (
+	splitFlag = &cli.BoolFlag{
+		Name: "split",
+		Usage: "If set, filled state tests with several forks and (data, gas, value) combinations are split up,\n" +
+			"so that each combination is executed and compared as a test of its own",
+	}
+	captureBaselineFlag = &cli.StringFlag{
+		Name:  "capture-baseline",
+		Usage: "If set, the tests are executed on a single vm, and the outputs are stored in the given directory, as a baseline",
+	}
+	baselineFlag = &cli.StringFlag{
+		Name: "baseline",
+		Usage: "If set, the tests are executed on a single vm, and the outputs are compared with the baseline\n" +
+			"previously captured (with --capture-baseline) in the given directory",
+	}
+	replayFlag = &cli.IntFlag{
+		Name: "replay",
+		Usage: "If set, the (single) test is executed this many times, reporting how often the clients diverge,\n" +
+			"and whether the divergence is stable or caused by nondeterminism",
+	}
+	checkTracingFlag = &cli.BoolFlag{
+		Name: "check-tracing",
+		Usage: "If set, the tests are executed on each vm with and without tracing, and the stateroots compared:\n" +
+			"a difference is reported as a tracer inconsistency in that client",
+	}
+	app = initApp()
+)
 
 func initApp() *cli.App {
 	app := cli.NewApp()
@@ -41,7 +70,55 @@ func initApp() *cli.App {
 	app.Flags = append(app.Flags, common.ThreadFlag)
 	app.Flags = append(app.Flags, common.LocationFlag)
 	app.Flags = append(app.Flags, common.VerbosityFlag)
+	app.Flags = append(app.Flags, common.BlockTestFlag)
+	app.Flags = append(app.Flags, common.CompareStepsFlag)
+	app.Flags = append(app.Flags, common.MaxRateFlag)
+	app.Flags = append(app.Flags, common.PprofFlag)
+	app.Flags = append(app.Flags, common.MemLimitFlag)
+	app.Flags = append(app.Flags, common.CpuLimitFlag)
+	app.Flags = append(app.Flags, common.CaptureStderrFlag)
+	app.Flags = append(app.Flags, common.GoMaxProcsFlag)
+	app.Flags = append(app.Flags, common.CompareModeFlag)
+	app.Flags = append(app.Flags, common.OnCrashFlag)
+	app.Flags = append(app.Flags, common.WebhookFlag)
+	app.Flags = append(app.Flags, common.CsvFlag)
+	app.Flags = append(app.Flags, common.AdvisoryEvmFlag)
+	app.Flags = append(app.Flags, common.AutoMinimizeFlag)
+	app.Flags = append(app.Flags, common.MinimizeTimeoutFlag)
+	app.Flags = append(app.Flags, common.SortFieldsFlag)
+	app.Flags = append(app.Flags, common.RawOutputFlag)
+	app.Flags = append(app.Flags, common.MaxPendingFlag)
+	app.Flags = append(app.Flags, common.ContinueOnDivergenceFlag)
+	app.Flags = append(app.Flags, common.MaxCrashersFlag)
+	app.Flags = append(app.Flags, common.DurationFlag)
+	app.Flags = append(app.Flags, common.MaxTestsFlag)
+	app.Flags = append(app.Flags, common.FullPostStateFlag)
+	app.Flags = append(app.Flags, common.CompareAccessSetFlag)
+	app.Flags = append(app.Flags, common.CompareRevertDataFlag)
+	app.Flags = append(app.Flags, common.VerboseDivergenceFlag)
+	app.Flags = append(app.Flags, common.ShuffleEvmsFlag)
+	app.Flags = append(app.Flags, splitFlag)
+	app.Flags = append(app.Flags, captureBaselineFlag)
+	app.Flags = append(app.Flags, baselineFlag)
+	app.Flags = append(app.Flags, replayFlag)
+	app.Flags = append(app.Flags, checkTracingFlag)
 	app.Action = startFuzzer
+	app.Commands = []*cli.Command{
+		{
+			Name:      "suite",
+			Usage:     "Executes the reference state tests in a directory, and reports a pass/fail matrix per test, fork and vm",
+			ArgsUsage: "<dir>",
+			Flags:     append(common.VmFlags, common.ThreadFlag, common.LocationFlag, common.VerbosityFlag),
+			Action:    runSuite,
+		},
+		{
+			Name:      "coverage",
+			Usage:     "Executes the tests of two corpora on the (first) vm, and compares the (op, depth) coverage they achieve",
+			ArgsUsage: "<dirA> <dirB>",
+			Flags:     append(common.VmFlags, common.ThreadFlag, common.VerbosityFlag),
+			Action:    compareCoverage,
+		},
+	}
 	return app
 }
 
@@ -59,10 +136,42 @@ func startFuzzer(c *cli.Context) error {
 	if c.NArg() != 1 {
 		return fmt.Errorf("file (or regexp) needed")
 	}
-	files, err := filepath.Glob(c.Args().First())
+	matches, err := filepath.Glob(c.Args().First())
 	if err != nil {
 		return err
 	}
+	var files []string
+	for _, file := range matches {
+		if !common.IsProvenanceFile(file) {
+			files = append(files, file)
+		}
+	}
+	if c.Bool(splitFlag.Name) {
+		dir, err := os.MkdirTemp(c.String(common.LocationFlag.Name), "split-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+		if files, err = splitTests(files, dir); err != nil {
+			return err
+		}
+		log.Info("Split tests", "count", len(files), "dir", dir)
+	}
+	if dir := c.String(captureBaselineFlag.Name); dir != "" {
+		return common.CaptureBaseline(c, dir, files)
+	}
+	if dir := c.String(baselineFlag.Name); dir != "" {
+		return common.CompareBaseline(c, dir, files)
+	}
+	if runs := c.Int(replayFlag.Name); runs > 0 {
+		if len(files) != 1 {
+			return fmt.Errorf("replay needs a single test, have %d", len(files))
+		}
+		return common.ReplayTest(c, files[0], runs)
+	}
+	if c.Bool(checkTracingFlag.Name) {
+		return common.CheckTracing(c, files)
+	}
 	var nextFile atomic.Int64
 	return common.ExecuteFuzzer(c, true, func(_, _ int) (string, error) {
 		index := int(nextFile.Add(1)) - 1
@@ -72,3 +181,52 @@ func startFuzzer(c *cli.Context) error {
 		return "", io.EOF
 	}, false)
 }
+
+func runSuite(c *cli.Context) error {
+	loglevel := slog.Level(c.Int(common.VerbosityFlag.Name))
+	log.SetDefault(log.NewLogger(log.NewTerminalHandlerWithLevel(os.Stderr, loglevel, true)))
+
+	if c.NArg() != 1 {
+		return fmt.Errorf("reference test directory needed")
+	}
+	return common.RunSuite(c, c.Args().First())
+}
+
+func compareCoverage(c *cli.Context) error {
+	loglevel := slog.Level(c.Int(common.VerbosityFlag.Name))
+	log.SetDefault(log.NewLogger(log.NewTerminalHandlerWithLevel(os.Stderr, loglevel, true)))
+
+	if c.NArg() != 2 {
+		return fmt.Errorf("two test directories needed")
+	}
+	return common.CompareCoverage(c, c.Args().Get(0), c.Args().Get(1))
+}
+
+// splitTests splits the given state test files into single-subtest tests, in
+// the given directory, and returns the paths of the new files.
+func splitTests(files []string, dir string) ([]string, error) {
+	var out []string
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		tests, err := fuzzing.SplitStateTest(data)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", file, err)
+		}
+		var names []string
+		for name := range tests {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			path := filepath.Join(dir, fmt.Sprintf("%v.json", strings.ReplaceAll(name, string(filepath.Separator), "_")))
+			if err := os.WriteFile(path, tests[name], 0644); err != nil {
+				return nil, err
+			}
+			out = append(out, path)
+		}
+	}
+	return out, nil
+}
@@ -22,6 +22,7 @@ import (
 	"os"
 	"strconv"
 
+	"github.com/holiman/goevmlab/evms"
 	"github.com/holiman/goevmlab/traces"
 	"github.com/holiman/goevmlab/ui"
 )
@@ -29,9 +30,13 @@ import (
 func init() {
 	flag.Usage = func() {
 		fmt.Fprintln(os.Stderr, "Usage:", os.Args[0], "filename1 filename2")
+		fmt.Fprintln(os.Stderr, "      ", os.Args[0], "diffdir dir1 dir2")
 		flag.PrintDefaults()
 		fmt.Fprintln(os.Stderr, `
-Reads the given trace-files, and displays the traces side by side in a nice CLI user interface`)
+Reads the given trace-files, and displays the traces side by side in a nice CLI user interface.
+
+The 'diffdir' subcommand instead matches the files in the two directories by name,
+compares each pair, and summarizes how many of them differ`)
 	}
 }
 
@@ -45,6 +50,13 @@ func main() {
 	}
 
 	flag.Parse()
+	if flag.NArg() == 3 && flag.Arg(0) == "diffdir" {
+		if err := diffDirs(flag.Arg(1), flag.Arg(2)); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 	if flag.NArg() != 2 {
 		fmt.Printf("Expected two arguments\n")
 		flag.Usage()
@@ -76,3 +88,24 @@ func main() {
 		trace1, trace2,
 	})
 }
+
+// diffDirs compares the outputs in the two directories, and prints the
+// differences along with a summary.
+func diffDirs(dirA, dirB string) error {
+	res, err := evms.CompareDirs(dirA, dirB, os.Stdout)
+	if err != nil {
+		return err
+	}
+	for _, name := range res.OnlyA {
+		fmt.Printf("Only in %v: %v\n", dirA, name)
+	}
+	for _, name := range res.OnlyB {
+		fmt.Printf("Only in %v: %v\n", dirB, name)
+	}
+	fmt.Printf("Compared %d files: %d differ, %d only in %v, %d only in %v\n",
+		res.Compared, len(res.Differ), len(res.OnlyA), dirA, len(res.OnlyB), dirB)
+	if len(res.Differ) > 0 {
+		os.Exit(2)
+	}
+	return nil
+}
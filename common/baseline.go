@@ -0,0 +1,153 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/holiman/goevmlab/evms"
+	"github.com/urfave/cli/v2"
+)
+
+// baselineName returns the name of the baseline output for the given test:
+// the test filename, with the extension replaced by '.jsonl'.
+func baselineName(testfile string) string {
+	return strings.TrimSuffix(filepath.Base(testfile), ".json") + ".jsonl"
+}
+
+// CaptureBaseline executes the tests on the (single) vm, and stores the
+// outputs in the given directory, keyed by test name. The outputs serve as
+// baseline for a later CompareBaseline, e.g. using another version of the
+// same client.
+func CaptureBaseline(c *cli.Context, dir string, files []string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if err := runToDir(c, dir, files); err != nil {
+		return err
+	}
+	log.Info("Captured baseline", "tests", len(files), "dir", dir)
+	return nil
+}
+
+// CompareBaseline executes the tests on the (single) vm, and compares the
+// outputs with the ones captured in the baseline directory. The changes are
+// printed, and an error is returned if any test output changed.
+func CompareBaseline(c *cli.Context, dir string, files []string) error {
+	outdir, err := os.MkdirTemp(c.String(LocationFlag.Name), "baseline-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(outdir)
+	if err := runToDir(c, outdir, files); err != nil {
+		return err
+	}
+	res, err := evms.CompareDirs(dir, outdir, stdout)
+	if err != nil {
+		return err
+	}
+	// Baseline outputs of tests which were not executed this time (OnlyA)
+	// are ignored, but new tests are pointed out.
+	for _, name := range res.OnlyB {
+		fmt.Fprintf(stdout, "No baseline for %v\n", name)
+	}
+	log.Info("Compared with baseline", "tests", res.Compared, "changed", len(res.Differ), "missing", len(res.OnlyB))
+	if len(res.Differ) > 0 {
+		return fmt.Errorf("%d test outputs differ from the baseline", len(res.Differ))
+	}
+	return nil
+}
+
+// runToDir executes the tests on the vm, using the configured number of
+// threads, and writes the outputs to the directory.
+func runToDir(c *cli.Context, dir string, files []string) error {
+	vms := initVMs(c)
+	if len(vms) != 1 {
+		return fmt.Errorf("baseline mode needs exactly one vm, have %d", len(vms))
+	}
+	defer vms[0].Close()
+	var (
+		threads    = c.Int(ThreadFlag.Name)
+		blockTest  = c.Bool(BlockTestFlag.Name)
+		sortFields = c.StringSlice(SortFieldsFlag.Name)
+		next       atomic.Int64
+		wg         sync.WaitGroup
+		errMu      sync.Mutex
+		firstErr   error
+	)
+	if threads < 1 {
+		threads = 1
+	}
+	for i := 0; i < threads; i++ {
+		wg.Add(1)
+		go func(threadId int) {
+			defer wg.Done()
+			vm := vms[0].Instance(threadId)
+			for {
+				index := int(next.Add(1)) - 1
+				if index >= len(files) {
+					return
+				}
+				err := runToFile(vm, files[index], filepath.Join(dir, baselineName(files[index])), blockTest, sortFields)
+				if err != nil {
+					errMu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					errMu.Unlock()
+					// Make the other threads stop too
+					next.Store(int64(len(files)))
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// runToFile executes the test on the vm, and writes the (normalized) output
+// to the given path.
+func runToFile(vm evms.Evm, testfile, path string, blockTest bool, sortFields []string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var (
+		buf = bufio.NewWriter(f)
+		out = evms.NewFieldSorter(buf, sortFields)
+		run = vm.RunStateTest
+	)
+	if blockTest {
+		run = vm.(evms.BlockTester).RunBlockTest
+	}
+	if _, err := run(testfile, out, false); err != nil {
+		return fmt.Errorf("error executing %v on %v: %w", testfile, vm.Name(), err)
+	}
+	if err := out.Flush(); err != nil {
+		return err
+	}
+	return buf.Flush()
+}
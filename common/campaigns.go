@@ -0,0 +1,167 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/holiman/goevmlab/evms"
+)
+
+// campaignRecord is the summary of a fuzzing run, appended to the campaigns
+// file (one json object per line) when the run ends.
+type campaignRecord struct {
+	Start    time.Time        `json:"start"`
+	Duration float64          `json:"duration"` // in seconds
+	Tests    uint64           `json:"tests"`
+	Clients  []campaignClient `json:"clients"`
+	// Flaws holds the consensus flaws found, by signature.
+	Flaws map[string]*campaignFlaw `json:"flaws,omitempty"`
+}
+
+type campaignClient struct {
+	Name    string `json:"name"`
+	Version string `json:"version"` // binary and its hash, see clientVersion
+}
+
+type campaignFlaw struct {
+	Divergence *evms.Divergence `json:"divergence"`
+	Tests      int              `json:"tests"` // the tests hitting the flaw
+}
+
+func newCampaignRecord(vms []evms.Evm) *campaignRecord {
+	rec := &campaignRecord{
+		Start: time.Now(),
+		Flaws: make(map[string]*campaignFlaw),
+	}
+	for _, vm := range vms {
+		rec.Clients = append(rec.Clients, campaignClient{Name: vm.Name(), Version: clientVersion(vm)})
+	}
+	return rec
+}
+
+// addFlaw records a consensus flaw.
+func (rec *campaignRecord) addFlaw(div *evms.Divergence) {
+	sig := div.Signature()
+	if flaw, ok := rec.Flaws[sig]; ok {
+		flaw.Tests++
+		return
+	}
+	rec.Flaws[sig] = &campaignFlaw{Divergence: div, Tests: 1}
+}
+
+// appendTo completes the record, and appends it to the file at path.
+func (rec *campaignRecord) appendTo(path string, tests uint64) error {
+	rec.Duration = time.Since(rec.Start).Seconds()
+	rec.Tests = tests
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// CampaignStats reads the campaigns file at path, and writes a summary of all
+// the runs in it: the tests executed, the distinct consensus flaws found, and
+// per client the distinct flaws it was part of.
+func CampaignStats(path string, w io.Writer) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var (
+		scanner  = bufio.NewScanner(f)
+		runs     int
+		tests    uint64
+		duration float64
+		flaws    = make(map[string]*campaignFlaw)
+		first    time.Time
+		last     time.Time
+	)
+	scanner.Buffer(make([]byte, 1024*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var rec campaignRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return fmt.Errorf("%v:%d: %v", path, line, err)
+		}
+		runs++
+		tests += rec.Tests
+		duration += rec.Duration
+		if first.IsZero() || rec.Start.Before(first) {
+			first = rec.Start
+		}
+		if rec.Start.After(last) {
+			last = rec.Start
+		}
+		for sig, flaw := range rec.Flaws {
+			if seen, ok := flaws[sig]; ok {
+				seen.Tests += flaw.Tests
+			} else {
+				flaws[sig] = flaw
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Runs: %d", runs)
+	if runs > 0 {
+		fmt.Fprintf(w, " (%v - %v)", first.Format("2006-01-02 15:04"), last.Format("2006-01-02 15:04"))
+	}
+	fmt.Fprintf(w, "\nTests: %d, in %v\n", tests, time.Duration(duration*float64(time.Second)).Round(time.Second))
+	fmt.Fprintf(w, "Distinct consensus flaws: %d\n", len(flaws))
+	if len(flaws) == 0 {
+		return nil
+	}
+	// The flaws, and the tests hitting them, per client
+	var (
+		perClient = make(map[string][2]int)
+		clients   []string
+	)
+	for _, flaw := range flaws {
+		for _, name := range flaw.Divergence.Clients {
+			c, ok := perClient[name]
+			if !ok {
+				clients = append(clients, name)
+			}
+			perClient[name] = [2]int{c[0] + 1, c[1] + flaw.Tests}
+		}
+	}
+	sort.Strings(clients)
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "client\tflaws\ttests\n")
+	for _, name := range clients {
+		fmt.Fprintf(tw, "%v\t%d\t%d\n", name, perClient[name][0], perClient[name][1])
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,63 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/holiman/goevmlab/evms"
+)
+
+func TestCampaignStats(t *testing.T) {
+	var (
+		path = filepath.Join(t.TempDir(), "campaigns.jsonl")
+		divA = &evms.Divergence{Clients: [2]string{"besu", "geth"}, Op: "SSTORE", Pc: "0x1", Depth: "1", Field: "gas"}
+		divB = &evms.Divergence{Clients: [2]string{"geth", "nethermind"}, Op: "CALL", Pc: "0x2", Depth: "1", Field: "stack"}
+	)
+	// Two runs, both hitting the first flaw
+	rec := newCampaignRecord(nil)
+	rec.addFlaw(divA)
+	rec.addFlaw(divA)
+	if err := rec.appendTo(path, 100); err != nil {
+		t.Fatal(err)
+	}
+	rec = newCampaignRecord(nil)
+	rec.addFlaw(divA)
+	rec.addFlaw(divB)
+	if err := rec.appendTo(path, 50); err != nil {
+		t.Fatal(err)
+	}
+	out := new(strings.Builder)
+	if err := CampaignStats(path, out); err != nil {
+		t.Fatal(err)
+	}
+	have := out.String()
+	for _, want := range []string{
+		"Runs: 2 (",
+		"Tests: 150, in ",
+		"Distinct consensus flaws: 2\n",
+		"besu        1      3\n",
+		"geth        2      4\n",
+		"nethermind  1      1\n",
+	} {
+		if !strings.Contains(have, want) {
+			t.Errorf("missing %q in:\n%v", want, have)
+		}
+	}
+}
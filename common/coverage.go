@@ -0,0 +1,214 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/holiman/goevmlab/evms"
+	"github.com/urfave/cli/v2"
+)
+
+// coveragePoint is a unit of coverage: an op executed at a call depth.
+type coveragePoint struct {
+	Op    string
+	Depth int
+}
+
+func (p coveragePoint) String() string {
+	return fmt.Sprintf("%v@%d", p.Op, p.Depth)
+}
+
+// coverageSet is the set of coverage points reached by a corpus.
+type coverageSet map[coveragePoint]struct{}
+
+// coverageCollector is a writer which collects the coverage points from the
+// canonical output written to it.
+type coverageCollector struct {
+	line []byte
+	set  coverageSet
+}
+
+func newCoverageCollector() *coverageCollector {
+	return &coverageCollector{set: make(coverageSet)}
+}
+
+func (c *coverageCollector) Write(p []byte) (int, error) {
+	for _, b := range p {
+		if b != '\n' {
+			c.line = append(c.line, b)
+			continue
+		}
+		c.flush()
+	}
+	return len(p), nil
+}
+
+// flush handles the line collected so far.
+func (c *coverageCollector) flush() {
+	if bytes.Contains(c.line, []byte(`"opName"`)) {
+		var step struct {
+			Op    string `json:"opName"`
+			Depth int    `json:"depth"`
+		}
+		if err := json.Unmarshal(c.line, &step); err == nil && step.Op != "" {
+			c.set[coveragePoint{step.Op, step.Depth}] = struct{}{}
+		}
+	}
+	c.line = c.line[:0]
+}
+
+// CompareCoverage executes the tests of two corpora on the reference vm (the
+// first one given), and reports the coverage each corpus achieves, and the
+// coverage which is unique to either.
+func CompareCoverage(c *cli.Context, dirA, dirB string) error {
+	vms := initVMs(c)
+	if len(vms) == 0 {
+		return fmt.Errorf("need a reference vm")
+	}
+	defer func() {
+		for _, vm := range vms {
+			vm.Close()
+		}
+	}()
+	if len(vms) > 1 {
+		log.Warn("Only the first vm is used for coverage", "vm", vms[0].Name())
+	}
+	var (
+		sets  [2]coverageSet
+		tests [2]int
+	)
+	for i, dir := range []string{dirA, dirB} {
+		files, err := corpusFiles(dir)
+		if err != nil {
+			return err
+		}
+		tests[i] = len(files)
+		sets[i] = corpusCoverage(vms[0], files, c.Int(ThreadFlag.Name))
+		log.Info("Collected coverage", "dir", dir, "tests", len(files), "points", len(sets[i]))
+	}
+	reportCoverage(stdout, [2]string{dirA, dirB}, tests, sets)
+	return nil
+}
+
+// corpusFiles returns the tests in the directory, recursively.
+func corpusFiles(dir string) ([]string, error) {
+	if finfo, err := os.Stat(dir); err != nil {
+		return nil, err
+	} else if !finfo.IsDir() {
+		return nil, fmt.Errorf("%v is not a directory", dir)
+	}
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && strings.HasSuffix(path, ".json") && !IsProvenanceFile(path) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// corpusCoverage executes the tests on the vm, using the given number of
+// threads, and returns the union of the coverage reached.
+func corpusCoverage(vm evms.Evm, files []string, threads int) coverageSet {
+	var (
+		set  = make(coverageSet)
+		mu   sync.Mutex
+		next = make(chan string)
+		wg   sync.WaitGroup
+	)
+	if threads < 1 {
+		threads = 1
+	}
+	for i := 0; i < threads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range next {
+				out := newCoverageCollector()
+				if _, err := vm.RunStateTest(path, out, false); err != nil {
+					log.Warn("Error running test", "evm", vm.Name(), "file", path, "err", err)
+					continue
+				}
+				out.flush()
+				mu.Lock()
+				for p := range out.set {
+					set[p] = struct{}{}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, path := range files {
+		next <- path
+	}
+	close(next)
+	wg.Wait()
+	return set
+}
+
+// reportCoverage writes the coverage of the two corpora: the points reached
+// by each, their union and intersection, and the points which are unique to
+// either corpus.
+func reportCoverage(w io.Writer, names [2]string, tests [2]int, sets [2]coverageSet) {
+	var (
+		union  = make(coverageSet)
+		both   int
+		unique [2][]coveragePoint
+	)
+	for i, set := range sets {
+		other := sets[1-i]
+		for p := range set {
+			union[p] = struct{}{}
+			if _, ok := other[p]; !ok {
+				unique[i] = append(unique[i], p)
+			} else if i == 0 {
+				both++
+			}
+		}
+	}
+	for i, name := range names {
+		fmt.Fprintf(w, "%v: %d tests, %d points\n", name, tests[i], len(sets[i]))
+	}
+	fmt.Fprintf(w, "Union: %d points\n", len(union))
+	fmt.Fprintf(w, "Intersection: %d points\n", both)
+	for i, name := range names {
+		sort.Slice(unique[i], func(a, b int) bool {
+			pa, pb := unique[i][a], unique[i][b]
+			if pa.Op != pb.Op {
+				return pa.Op < pb.Op
+			}
+			return pa.Depth < pb.Depth
+		})
+		fmt.Fprintf(w, "Unique to %v: %d points\n", name, len(unique[i]))
+		for _, p := range unique[i] {
+			fmt.Fprintf(w, "  %v\n", p)
+		}
+	}
+}
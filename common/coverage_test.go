@@ -0,0 +1,72 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCoverageCollector(t *testing.T) {
+	c := newCoverageCollector()
+	output := `{"pc":0,"op":96,"gas":"0x1","opName":"PUSH1","depth":1}
+{"pc":2,"op":241,"gas":"0x1","opName":"CALL","depth":1}
+{"pc":0,"op":96,"gas":"0x1","opName":"PUSH1","depth":2}
+{"pc":2,"op":96,"gas":"0x1","opName":"PUSH1","depth":2}
+{"output":"","gasUsed":"0x1"}
+{"stateRoot":"0x01"}`
+	// Written in pieces, which do not end at line boundaries
+	for len(output) > 0 {
+		n := 7
+		if n > len(output) {
+			n = len(output)
+		}
+		c.Write([]byte(output[:n]))
+		output = output[n:]
+	}
+	c.flush()
+	if len(c.set) != 3 {
+		t.Fatalf("expected 3 points, have %d: %v", len(c.set), c.set)
+	}
+	for _, p := range []coveragePoint{{"PUSH1", 1}, {"CALL", 1}, {"PUSH1", 2}} {
+		if _, ok := c.set[p]; !ok {
+			t.Errorf("missing %v", p)
+		}
+	}
+}
+
+func TestReportCoverage(t *testing.T) {
+	var (
+		a   = coverageSet{{"PUSH1", 1}: {}, {"CALL", 1}: {}, {"SSTORE", 1}: {}}
+		b   = coverageSet{{"PUSH1", 1}: {}, {"PUSH1", 2}: {}}
+		out = new(strings.Builder)
+	)
+	reportCoverage(out, [2]string{"a", "b"}, [2]int{4, 2}, [2]coverageSet{a, b})
+	want := `a: 4 tests, 3 points
+b: 2 tests, 2 points
+Union: 4 points
+Intersection: 1 points
+Unique to a: 2 points
+  CALL@1
+  SSTORE@1
+Unique to b: 1 points
+  PUSH1@2
+`
+	if out.String() != want {
+		t.Fatalf("wrong report\nhave:\n%v\nwant:\n%v", out, want)
+	}
+}
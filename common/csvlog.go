@@ -0,0 +1,179 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// csvFlushInterval is how often the csv log is flushed to disk.
+const csvFlushInterval = 5 * time.Second
+
+// csvLog writes one row per executed test: the file, the execution time of
+// each client (empty for clients which did not execute the test), the result,
+// the number of lines of output and, for divergent tests, the pc of the first
+// diverging step.
+type csvLog struct {
+	mu        sync.Mutex
+	f         *os.File
+	w         *csv.Writer
+	numVMs    int
+	lastFlush time.Time
+	held      map[string][]string // rows of divergent tests, awaiting the pc
+	err       error               // the first write error
+}
+
+// csvHeader returns the header row for the given clients.
+func csvHeader(vmNames []string) []string {
+	header := []string{"file"}
+	for _, name := range vmNames {
+		header = append(header, fmt.Sprintf("%v (s)", name))
+	}
+	return append(header, "result", "lines", "pc")
+}
+
+// newCSVLog opens (or creates) the csv file at path for appending. A header
+// is written if the file is empty, otherwise the existing header must match
+// the clients, so the columns of the rows appended line up.
+func newCSVLog(path string, vmNames []string) (*csvLog, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	header := csvHeader(vmNames)
+	existing, err := csv.NewReader(f).Read()
+	switch {
+	case errors.Is(err, io.EOF):
+		// A new file
+	case err != nil:
+		f.Close()
+		return nil, fmt.Errorf("failed reading csv header of %v: %w", path, err)
+	case strings.Join(existing, ",") != strings.Join(header, ","):
+		f.Close()
+		return nil, fmt.Errorf("csv file %v has a different header (%v), expected %v",
+			path, strings.Join(existing, ","), strings.Join(header, ","))
+	}
+	l := &csvLog{
+		f:         f,
+		w:         csv.NewWriter(f),
+		numVMs:    len(vmNames),
+		lastFlush: time.Now(),
+		held:      make(map[string][]string),
+	}
+	if existing == nil {
+		if err := l.w.Write(header); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// row assembles a row, without the pc. The durations are indexed by vm.
+func (l *csvLog) row(file string, durations map[int]time.Duration, result string, lines int) []string {
+	row := make([]string, 0, l.numVMs+4)
+	row = append(row, file)
+	for i := 0; i < l.numVMs; i++ {
+		if d, ok := durations[i]; ok {
+			row = append(row, fmt.Sprintf("%.6f", d.Seconds()))
+		} else {
+			row = append(row, "")
+		}
+	}
+	return append(row, result, fmt.Sprint(lines))
+}
+
+// add writes a row. The durations are indexed by vm.
+func (l *csvLog) add(file string, durations map[int]time.Duration, result string, lines int) {
+	row := l.row(file, durations, result, lines)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.write(append(row, ""))
+}
+
+// hold holds back the row of a divergent test, until the diverging pc is
+// known from investigating the flaw.
+func (l *csvLog) hold(file string, durations map[int]time.Duration, result string, lines int) {
+	row := l.row(file, durations, result, lines)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.held[file] = row
+}
+
+// release writes the held back row of the test, with the pc of the first
+// diverging step (empty if unknown). The test may have been moved since it was
+// held, in which case path is where it is now.
+func (l *csvLog) release(file, path string, pc string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if row, ok := l.held[file]; ok {
+		delete(l.held, file)
+		row[0] = path
+		l.write(append(row, pc))
+	}
+}
+
+// write writes a row, flushing periodically. The first error is logged and
+// kept, to be returned by Close. The lock must be held.
+func (l *csvLog) write(row []string) {
+	err := l.w.Write(row)
+	if err == nil && time.Since(l.lastFlush) > csvFlushInterval {
+		l.w.Flush()
+		l.lastFlush = time.Now()
+		err = l.w.Error()
+	}
+	if err != nil && l.err == nil {
+		log.Error("Failed writing csv file", "file", l.f.Name(), "err", err)
+		l.err = err
+	}
+}
+
+// Close writes any rows still held back, flushes and closes the csv file.
+func (l *csvLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var files []string
+	for file := range l.held {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		l.write(append(l.held[file], ""))
+	}
+	l.held = nil
+	l.w.Flush()
+	if err := l.w.Error(); err != nil && l.err == nil {
+		l.err = err
+	}
+	if l.err != nil {
+		l.f.Close()
+		return l.err
+	}
+	return l.f.Close()
+}
@@ -0,0 +1,82 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCSVLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.csv")
+	l, err := newCSVLog(path, []string{"geth", "besu"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.add("a.json", map[int]time.Duration{0: time.Second, 1: time.Millisecond}, "equal", 10)
+	l.hold("b.json", map[int]time.Duration{0: time.Second}, "divergent", 12)
+	l.hold("c.json", map[int]time.Duration{1: time.Second}, "divergent", 3)
+	l.release("b.json", "b.json", "42")
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// Appending with the same clients is fine
+	if l, err = newCSVLog(path, []string{"geth", "besu"}); err != nil {
+		t.Fatal(err)
+	}
+	l.add("d.json", nil, "empty", 0)
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		"file,geth (s),besu (s),result,lines,pc",
+		"a.json,1.000000,0.001000,equal,10,",
+		"b.json,1.000000,,divergent,12,42",
+		"c.json,,1.000000,divergent,3,",
+		"d.json,,,empty,0,",
+		"",
+	}, "\n")
+	if string(data) != want {
+		t.Fatalf("wrong csv:\nhave\n%v\nwant\n%v", string(data), want)
+	}
+	// Appending with other clients is not
+	if _, err := newCSVLog(path, []string{"geth", "nethermind"}); err == nil {
+		t.Fatal("expected error for mismatching header")
+	}
+}
+
+func TestCSVLogWriteError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.csv")
+	l, err := newCSVLog(path, []string{"geth"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Make the writes fail
+	l.f.Close()
+	l.lastFlush = time.Time{}
+	l.add("a.json", nil, "equal", 1)
+	if err := l.Close(); err == nil {
+		t.Fatal("expected write error")
+	}
+}
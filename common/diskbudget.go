@@ -0,0 +1,142 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// diskSizeUnits are the units accepted by parseDiskSize, as powers of 1024.
+var diskSizeUnits = []struct {
+	suffix string
+	size   float64
+}{
+	{"tib", 1 << 40}, {"tb", 1 << 40}, {"t", 1 << 40},
+	{"gib", 1 << 30}, {"gb", 1 << 30}, {"g", 1 << 30},
+	{"mib", 1 << 20}, {"mb", 1 << 20}, {"m", 1 << 20},
+	{"kib", 1 << 10}, {"kb", 1 << 10}, {"k", 1 << 10},
+	{"b", 1},
+}
+
+// parseDiskSize parses a size such as "50GB", "1.5T" or "4096". The units
+// are powers of 1024.
+func parseDiskSize(s string) (int64, error) {
+	var (
+		num  = strings.ToLower(strings.TrimSpace(s))
+		unit = 1.0
+	)
+	for _, u := range diskSizeUnits {
+		if strings.HasSuffix(num, u.suffix) {
+			num, unit = strings.TrimSpace(strings.TrimSuffix(num, u.suffix)), u.size
+			break
+		}
+	}
+	v, err := strconv.ParseFloat(num, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(v * unit), nil
+}
+
+// diskLowWater is the disk usage, as a fraction of the budget, below which a
+// paused generation resumes. Above it, slow and exhausted tests are no
+// longer kept.
+const diskLowWater = 0.9
+
+// fileSize returns the size of the test, along with its provenance file.
+func fileSize(path string) int64 {
+	var size int64
+	for _, p := range []string{path, provenancePath(path)} {
+		if info, err := os.Stat(p); err == nil {
+			size += info.Size()
+		}
+	}
+	return size
+}
+
+// trackTest adds the test to the disk usage, if a disk budget is set.
+func (meta *testMeta) trackTest(path string) {
+	if meta.maxDisk == 0 {
+		return
+	}
+	size := fileSize(path)
+	meta.diskMu.Lock()
+	defer meta.diskMu.Unlock()
+	if meta.diskFiles == nil {
+		meta.diskFiles = make(map[string]int64)
+	}
+	meta.diskUsage.Add(size - meta.diskFiles[path])
+	meta.diskFiles[path] = size
+}
+
+// untrackTest removes the test from the disk usage. This is done when it is
+// deleted, and when it is kept as a consensus flaw, which the budget does not
+// cover.
+func (meta *testMeta) untrackTest(path string) {
+	meta.diskMu.Lock()
+	defer meta.diskMu.Unlock()
+	if size, ok := meta.diskFiles[path]; ok {
+		meta.diskUsage.Add(-size)
+		delete(meta.diskFiles, path)
+	}
+}
+
+// removeTrackedTest deletes the test and removes it from the disk usage.
+func (meta *testMeta) removeTrackedTest(path string) error {
+	err := removeTest(path)
+	meta.untrackTest(path)
+	return err
+}
+
+// diskTight returns whether the disk usage is close to the budget.
+func (meta *testMeta) diskTight() bool {
+	return meta.maxDisk > 0 && meta.diskUsage.Load() >= int64(float64(meta.maxDisk)*diskLowWater)
+}
+
+// diskStats returns the disk usage, for the stats line.
+func (meta *testMeta) diskStats() string {
+	return fmt.Sprintf("%v/%v", common.StorageSize(meta.diskUsage.Load()), common.StorageSize(meta.maxDisk))
+}
+
+// waitForDiskBudget blocks while the disk usage is over the budget, until
+// enough tests have been cleaned up. If nothing is left to clean up, the
+// budget is spent, and the run is aborted.
+func (meta *testMeta) waitForDiskBudget() {
+	if meta.maxDisk == 0 || meta.diskUsage.Load() < meta.maxDisk {
+		return
+	}
+	log.Warn("Disk budget reached, pausing test generation", "disk", meta.diskStats())
+	for !meta.abort.Load() {
+		if !meta.diskTight() {
+			log.Info("Disk usage below budget, resuming test generation", "disk", meta.diskStats())
+			return
+		}
+		if meta.pending.Load() == 0 {
+			log.Warn("Disk budget spent, stopping", "disk", meta.diskStats())
+			meta.abort.Store(true)
+			return
+		}
+		time.Sleep(backlogPollInterval)
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"errors"
+	"syscall"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// diskFullRetryInterval is how often the test factories retry writing a test,
+// while the disk is full.
+var diskFullRetryInterval = 30 * time.Second
+
+// isDiskFull returns whether the error is due to the disk being out of space.
+func isDiskFull(err error) bool {
+	return errors.Is(err, syscall.ENOSPC)
+}
+
+// freeQueuedTests deletes the tests which were generated but not executed, to
+// make room for saving a consensus flaw. Tests which are not ours to delete
+// are left alone.
+func (meta *testMeta) freeQueuedTests() {
+	if !meta.deleteFilesWhenDone {
+		return
+	}
+	for {
+		select {
+		case path, ok := <-meta.testCh:
+			if !ok {
+				return
+			}
+			if err := meta.removeTrackedTest(path); err != nil {
+				log.Error("Error deleting file", "file", path, "err", err)
+			}
+		default:
+			return
+		}
+	}
+}
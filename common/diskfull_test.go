@@ -0,0 +1,156 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestFactoryPausesOnDiskFull(t *testing.T) {
+	defer func(interval time.Duration) { diskFullRetryInterval = interval }(diskFullRetryInterval)
+	diskFullRetryInterval = time.Millisecond
+
+	var (
+		meta     = &testMeta{testCh: make(chan string, 10)}
+		failures = 3
+		indexes  []int
+	)
+	meta.startTestFactories(1, func(index, threadId int) (string, error) {
+		indexes = append(indexes, index)
+		if failures > 0 {
+			failures--
+			return "", &fs.PathError{Op: "write", Path: "test.json", Err: syscall.ENOSPC}
+		}
+		if index == 2 {
+			return "", io.EOF
+		}
+		return fmt.Sprintf("test-%d.json", index), nil
+	})
+	var files []string
+	for file := range meta.testCh {
+		files = append(files, file)
+	}
+	meta.wg.Wait()
+	if want := []string{"test-0.json", "test-1.json"}; fmt.Sprint(files) != fmt.Sprint(want) {
+		t.Fatalf("wrong tests delivered: have %v, want %v", files, want)
+	}
+	// The failed index is retried
+	if want := []int{0, 0, 0, 0, 1, 2}; fmt.Sprint(indexes) != fmt.Sprint(want) {
+		t.Fatalf("wrong indexes generated: have %v, want %v", indexes, want)
+	}
+}
+
+func TestStoreTestWriteError(t *testing.T) {
+	dir := t.TempDir()
+	// A value which cannot be encoded fails the write midway
+	if _, err := storeTest(dir, map[string]any{"a": make(chan int)}, "failing"); err == nil {
+		t.Fatal("expected error")
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*")); len(files) != 0 {
+		t.Fatalf("partial test left behind: %v", files)
+	}
+	if !isDiskFull(fmt.Errorf("storing test: %w", &fs.PathError{Op: "write", Err: syscall.ENOSPC})) {
+		t.Fatal("wrapped ENOSPC not detected")
+	}
+}
+
+func TestParseDiskSize(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want int64
+	}{
+		{"4096", 4096},
+		{"10B", 10},
+		{"2k", 2048},
+		{"512MB", 512 << 20},
+		{"50GB", 50 << 30},
+		{"50 GiB", 50 << 30},
+		{"1.5T", 3 << 39},
+	} {
+		have, err := parseDiskSize(tt.in)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.in, err)
+		}
+		if have != tt.want {
+			t.Errorf("%q: have %d, want %d", tt.in, have, tt.want)
+		}
+	}
+	for _, in := range []string{"", "GB", "-1GB", "50XB"} {
+		if _, err := parseDiskSize(in); err == nil {
+			t.Errorf("%q: expected error", in)
+		}
+	}
+}
+
+func TestFactoryDiskBudget(t *testing.T) {
+	defer func(interval time.Duration) { backlogPollInterval = interval }(backlogPollInterval)
+	backlogPollInterval = time.Millisecond
+
+	var (
+		dir  = t.TempDir()
+		meta = &testMeta{testCh: make(chan string, 10), maxDisk: 250}
+	)
+	meta.startTestFactories(1, func(index, threadId int) (string, error) {
+		path := filepath.Join(dir, fmt.Sprintf("test-%d.json", index))
+		return path, os.WriteFile(path, make([]byte, 100), 0644)
+	})
+	// The third test exceeds the budget
+	var files []string
+	for i := 0; i < 3; i++ {
+		files = append(files, <-meta.testCh)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if n := len(meta.testCh); n != 0 {
+		t.Fatalf("factory exceeded the disk budget: %d more tests queued", n)
+	}
+	if have := meta.diskUsage.Load(); have != 300 {
+		t.Fatalf("wrong disk usage: have %d, want 300", have)
+	}
+	// Deleting a test brings the usage below the low water mark
+	if err := meta.removeTrackedTest(files[0]); err != nil {
+		t.Fatal(err)
+	}
+	meta.pending.Add(-1)
+	select {
+	case file := <-meta.testCh:
+		if filepath.Base(file) != "test-3.json" {
+			t.Fatalf("wrong test: %v", file)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("factory did not resume")
+	}
+	// With nothing left to clean up, a spent budget stops the run
+	meta.pending.Add(-3)
+	for range meta.testCh {
+	}
+	meta.wg.Wait()
+	if !meta.abort.Load() {
+		t.Fatal("run not aborted")
+	}
+	// Consensus flaws are not counted
+	meta.untrackTest(files[1])
+	if have := meta.diskUsage.Load(); have != 200 {
+		t.Fatalf("wrong disk usage: have %d, want 200", have)
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// readLines returns the lines of the file from the given (zero-based) index
+// up to, but not including, end. Lines past the end of the file are omitted.
+func readLines(path string, start, end int) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var (
+		lines   []string
+		scanner = bufio.NewScanner(f)
+	)
+	scanner.Buffer(make([]byte, 1024*1024), 32*1024*1024)
+	for i := 0; i < end && scanner.Scan(); i++ {
+		if i >= start {
+			lines = append(lines, scanner.Text())
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// writeDivergenceContext writes the n lines of output before and after the
+// diverging line (at the given zero-based index) from each client, line by
+// line, so the outputs can be compared side by side. It returns all the lines
+// written.
+func writeDivergenceContext(w io.Writer, names, files []string, index, n int) []string {
+	var (
+		start   = index - n
+		end     = index + n + 1
+		outputs = make([][]string, len(files))
+		all     []string
+	)
+	if start < 0 {
+		start = 0
+	}
+	for i, file := range files {
+		lines, err := readLines(file, start, end)
+		if err != nil {
+			fmt.Fprintf(w, "Failed reading output of %v: %v\n", names[i], err)
+		}
+		outputs[i] = lines
+		all = append(all, lines...)
+	}
+	// Lines past the end of all outputs are not shown
+	var longest int
+	for _, lines := range outputs {
+		if len(lines) > longest {
+			longest = len(lines)
+		}
+	}
+	if start+longest < end {
+		end = start + longest
+	}
+	if end <= index {
+		end = index + 1
+	}
+	fmt.Fprintf(w, "\nOutput lines %d to %d, the divergence at line %d:\n", start+1, end, index+1)
+	for line := start; line < end; line++ {
+		marker := " "
+		if line == index {
+			marker = ">"
+		}
+		fmt.Fprintf(w, "%v line %d:\n", marker, line+1)
+		for i, lines := range outputs {
+			text := "--  depleted --"
+			if line-start < len(lines) {
+				text = lines[line-start]
+			}
+			fmt.Fprintf(w, "%15v: %v\n", names[i], text)
+		}
+	}
+	return all
+}
+
+// writeTestContext writes the transaction of the state test, and the accounts
+// of the pre-state which are relevant to the divergence: the sender, the
+// recipient, and the accounts whose address appears in the given lines of
+// output.
+func writeTestContext(w io.Writer, testfile string, lines []string) error {
+	data, err := os.ReadFile(testfile)
+	if err != nil {
+		return err
+	}
+	var tests map[string]struct {
+		Pre         map[string]json.RawMessage `json:"pre"`
+		Transaction json.RawMessage            `json:"transaction"`
+	}
+	if err := json.Unmarshal(data, &tests); err != nil {
+		return err
+	}
+	for _, test := range tests {
+		indented := new(bytes.Buffer)
+		if err := json.Indent(indented, test.Transaction, "", "  "); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "\nTransaction:\n%v\n", indented)
+		relevant := relevantAccounts(test.Transaction, lines)
+		var addrs []string
+		for addr := range test.Pre {
+			if relevant[common.HexToAddress(addr)] {
+				addrs = append(addrs, addr)
+			}
+		}
+		sort.Strings(addrs)
+		fmt.Fprintf(w, "\nPre-state accounts:\n")
+		for _, addr := range addrs {
+			indented.Reset()
+			if err := json.Indent(indented, test.Pre[addr], "", "  "); err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "%v: %v\n", addr, indented)
+		}
+	}
+	return nil
+}
+
+// relevantAccounts returns the sender and recipient of the transaction, and
+// the addresses which appear as (stack) values in the lines. The matching is
+// loose: any non-zero quoted hex value is taken to be an address.
+func relevantAccounts(txJSON json.RawMessage, lines []string) map[common.Address]bool {
+	var (
+		relevant = make(map[common.Address]bool)
+		tx       struct {
+			To        string `json:"to"`
+			Sender    string `json:"sender"`
+			SecretKey string `json:"secretKey"`
+		}
+	)
+	if err := json.Unmarshal(txJSON, &tx); err == nil {
+		if tx.To != "" {
+			relevant[common.HexToAddress(tx.To)] = true
+		}
+		if tx.Sender != "" {
+			relevant[common.HexToAddress(tx.Sender)] = true
+		} else if key, err := crypto.HexToECDSA(strings.TrimPrefix(tx.SecretKey, "0x")); err == nil {
+			relevant[crypto.PubkeyToAddress(key.PublicKey)] = true
+		}
+	}
+	for _, line := range lines {
+		for _, field := range strings.Split(line, `"`) {
+			if !strings.HasPrefix(field, "0x") || len(field) > 42 || len(field) < 3 {
+				continue
+			}
+			if addr := common.HexToAddress(field); addr != (common.Address{}) {
+				relevant[addr] = true
+			}
+		}
+	}
+	return relevant
+}
@@ -0,0 +1,106 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDivergenceContext(t *testing.T) {
+	var (
+		dir   = t.TempDir()
+		fileA = filepath.Join(dir, "a.jsonl")
+		fileB = filepath.Join(dir, "b.jsonl")
+		out   = new(strings.Builder)
+		write = func(path, content string) {
+			t.Helper()
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	)
+	var linesA, linesB []string
+	for i := 0; i < 10; i++ {
+		line := fmt.Sprintf(`{"pc":%d,"stack":["0x1"]}`, i)
+		linesA = append(linesA, line)
+		if i == 6 {
+			line = `{"pc":6,"stack":["0xff000"]}`
+		}
+		if i < 8 {
+			linesB = append(linesB, line)
+		}
+	}
+	write(fileA, strings.Join(linesA, "\n")+"\n")
+	write(fileB, strings.Join(linesB, "\n")+"\n")
+
+	lines := writeDivergenceContext(out, []string{"a", "b"}, []string{fileA, fileB}, 6, 2)
+	if len(lines) != 5+4 {
+		t.Fatalf("expected 9 lines, have %d", len(lines))
+	}
+	report := out.String()
+	for _, want := range []string{
+		"Output lines 5 to 9, the divergence at line 7",
+		"> line 7:\n              a: {\"pc\":6,\"stack\":[\"0x1\"]}\n              b: {\"pc\":6,\"stack\":[\"0xff000\"]}",
+		"  line 9:\n              a: {\"pc\":8,\"stack\":[\"0x1\"]}\n              b: --  depleted --",
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("missing %q in report:\n%v", want, report)
+		}
+	}
+	if strings.Contains(report, "line 4:") || strings.Contains(report, "line 10:") {
+		t.Errorf("too many lines in report:\n%v", report)
+	}
+	// No lines past the end of the outputs
+	out.Reset()
+	writeDivergenceContext(out, []string{"a", "b"}, []string{fileA, fileB}, 8, 5)
+	if report := out.String(); !strings.Contains(report, "Output lines 4 to 10") {
+		t.Errorf("wrong lines in report:\n%v", report)
+	}
+
+	// The relevant accounts: the recipient, the sender (from the key), and
+	// the account seen on the stack
+	testfile := filepath.Join(dir, "test.json")
+	write(testfile, `{"test": {
+  "pre": {
+    "0x00000000000000000000000000000000000ff000": {"balance": "0x1"},
+    "0x00000000000000000000000000000000000ff001": {"balance": "0x2"},
+    "0x00000000000000000000000000000000000ff002": {"balance": "0x3"},
+    "0xa94f5374fce5edbc8e2a8697c15331677e6ebf0b": {"balance": "0x4"}
+  },
+  "transaction": {
+    "to": "0x00000000000000000000000000000000000ff001",
+    "secretKey": "0x45a915e4d060149eb4365960e6a7a45f334393093061116b197e3240065ff2d8"
+  }
+}}`)
+	out.Reset()
+	if err := writeTestContext(out, testfile, lines); err != nil {
+		t.Fatal(err)
+	}
+	report = out.String()
+	for _, want := range []string{"ff000", "ff001", "0xa94f5374fce5edbc8e2a8697c15331677e6ebf0b", "\"to\""} {
+		if !strings.Contains(report, want) {
+			t.Errorf("missing %q in report:\n%v", want, report)
+		}
+	}
+	if strings.Contains(report, "ff002") {
+		t.Errorf("irrelevant account in report:\n%v", report)
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/holiman/goevmlab/evms"
+	"github.com/holiman/goevmlab/ops"
+)
+
+// noStep is the name used for divergences which are not at a step, e.g. in
+// the stateroot, or where the output of a client ends.
+const noStep = "(no step)"
+
+// divergenceStats counts the consensus flaws of a run by the op at the first
+// diverging step.
+type divergenceStats struct {
+	total    map[string]int // per op, the flaws found
+	distinct map[string]int // per op, the flaws with a previously unseen signature
+	count    int
+}
+
+func newDivergenceStats() *divergenceStats {
+	return &divergenceStats{
+		total:    make(map[string]int),
+		distinct: make(map[string]int),
+	}
+}
+
+// divergenceOp returns the name of the op at the diverging step. The op is
+// given as a number by the clients, possibly hex-encoded.
+func divergenceOp(div *evms.Divergence) string {
+	if div.Op == "" {
+		return noStep
+	}
+	op, err := strconv.ParseUint(strings.Trim(div.Op, `"`), 0, 8)
+	if err != nil {
+		return div.Op
+	}
+	return ops.OpCode(op).String()
+}
+
+// add counts the divergence, which is distinct if its signature was not seen
+// before.
+func (s *divergenceStats) add(div *evms.Divergence, distinct bool) {
+	op := divergenceOp(div)
+	s.total[op]++
+	if distinct {
+		s.distinct[op]++
+	}
+	s.count++
+}
+
+// report writes the histogram of the divergences by op, most frequent first.
+func (s *divergenceStats) report(w io.Writer) {
+	var names []string
+	for op := range s.total {
+		names = append(names, op)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if s.total[names[i]] != s.total[names[j]] {
+			return s.total[names[i]] > s.total[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "OP\tFLAWS\tDISTINCT\tSHARE\t\n")
+	for _, op := range names {
+		share := float64(100*s.total[op]) / float64(s.count)
+		fmt.Fprintf(tw, "%v\t%d\t%d\t%.1f%%\t%v\n", op, s.total[op], s.distinct[op], share,
+			strings.Repeat("#", (s.total[op]*40+s.count-1)/s.count))
+	}
+	tw.Flush()
+}
@@ -0,0 +1,57 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/holiman/goevmlab/evms"
+)
+
+func TestDivergenceStats(t *testing.T) {
+	stats := newDivergenceStats()
+	stats.add(evms.NewDivergence("a", "b", []byte(`{"pc":1,"op":85,"gas":"0x1"}`), []byte(`{"pc":1,"op":85,"gas":"0x2"}`)), true)
+	stats.add(evms.NewDivergence("a", "b", []byte(`{"pc":1,"op":85,"gas":"0x1"}`), []byte(`{"pc":1,"op":85,"gas":"0x2"}`)), false)
+	stats.add(evms.NewDivergence("a", "b", []byte(`{"pc":7,"op":"0x55","gas":"0x1"}`), []byte(`{"pc":7,"op":"0x55","gas":"0x2"}`)), true)
+	stats.add(evms.NewDivergence("a", "b", []byte(`{"pc":2,"op":241,"gas":"0x1"}`), []byte(`{"pc":2,"op":241,"gas":"0x2"}`)), true)
+	stats.add(evms.NewDivergence("a", "b", []byte(`{"stateRoot":"0x01"}`), []byte(`{"stateRoot":"0x02"}`)), true)
+	out := new(strings.Builder)
+	stats.report(out)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	want := [][]string{
+		{"OP", "FLAWS", "DISTINCT", "SHARE"},
+		{"SSTORE", "3", "2", "60.0%"},
+		{noStep, "1", "1", "20.0%"},
+		{"CALL", "1", "1", "20.0%"},
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("expected %d lines, have %d:\n%v", len(want), len(lines), out)
+	}
+	for i, fields := range want {
+		have := strings.Fields(strings.Replace(lines[i], noStep, "(no-step)", 1))
+		for j, f := range fields {
+			if f == noStep {
+				f = "(no-step)"
+			}
+			if have[j] != f {
+				t.Errorf("line %d: expected %v, have %v", i, fields, have)
+				break
+			}
+		}
+	}
+}
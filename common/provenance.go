@@ -0,0 +1,173 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/holiman/goevmlab/fuzzing"
+)
+
+// provenance describes how a generated test was made, so that a test found
+// later can be traced back to the run which generated it.
+//
+// It is stored in a sidecar file next to the test, rather than as an extra
+// top-level key in the test: the clients treat every top-level key of a test
+// file as a test, and would try to execute it.
+//
+// The generator is the name of the factory which made the test, and the fork is
+// the one the factory was asked for. Along with the seed, they regenerate the
+// test: generic-generator gen --provenance <test>.meta.json
+type provenance struct {
+	Generator string `json:"generator"`
+	Fork      string `json:"fork"`
+	Seed      int64  `json:"seed"`
+	Test      string `json:"test"`                // the name of the test
+	BlockTest bool   `json:"blocktest,omitempty"` // whether it was made into a blockchain test
+	Version   string `json:"version"`
+	Timestamp string `json:"timestamp"`
+}
+
+// provenancePath returns the path of the provenance file of the given test.
+func provenancePath(testfile string) string {
+	return strings.TrimSuffix(testfile, ".json") + ".meta.json"
+}
+
+// IsProvenanceFile returns true if the file is a provenance file, and not a
+// test, so that globbing for '*.json' can skip it.
+func IsProvenanceFile(path string) bool {
+	return strings.HasSuffix(path, ".meta.json")
+}
+
+// storeProvenance writes the provenance of the test, as a `_meta` object, to
+// the sidecar file. The version and timestamp are filled in.
+func storeProvenance(testfile string, meta provenance) error {
+	meta.Version = goevmlabVersion
+	meta.Timestamp = time.Now().UTC().Format(time.RFC3339)
+	data, err := json.MarshalIndent(map[string]provenance{"_meta": meta}, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := provenancePath(testfile)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		os.Remove(path)
+		return err
+	}
+	return nil
+}
+
+// loadProvenance reads the provenance of the test. The path may be either the
+// test, or its provenance file.
+func loadProvenance(path string) (*provenance, error) {
+	if !IsProvenanceFile(path) {
+		path = provenancePath(path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var meta map[string]*provenance
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("invalid provenance file %v: %w", path, err)
+	}
+	p, ok := meta["_meta"]
+	if !ok || p == nil {
+		return nil, fmt.Errorf("invalid provenance file %v: no _meta", path)
+	}
+	if p.Generator == "" || p.Fork == "" {
+		return nil, fmt.Errorf("provenance file %v does not name the generator and fork", path)
+	}
+	return p, nil
+}
+
+// RegenerateTest makes the test described by the provenance again, the same
+// way as the fuzzer made it. The path may be either the test, or its
+// provenance file.
+//
+// Tests from campaigns with a dictionary, an opcode set or a seed corpus are
+// only made the same if those were loaded the same way.
+func RegenerateTest(path string) (any, error) {
+	p, err := loadProvenance(path)
+	if err != nil {
+		return nil, err
+	}
+	factory, err := fuzzing.LookupFactory(p.Generator, p.Fork)
+	if err != nil {
+		return nil, err
+	}
+	name := p.Test
+	if name == "" {
+		name = fmt.Sprintf("%v-%d", p.Generator, p.Seed)
+	}
+	gst := GenerateTest(factory, p.Seed)
+	if p.BlockTest {
+		return gst.ToBlockchainTest(name)
+	}
+	return gst.ToGeneralStateTest(name), nil
+}
+
+// removeTest deletes the test, along with its provenance file, if any.
+func removeTest(path string) error {
+	err := os.Remove(path)
+	if err2 := os.Remove(provenancePath(path)); !errors.Is(err2, fs.ErrNotExist) && err == nil {
+		err = err2
+	}
+	return err
+}
+
+// copyTest copies the test, along with its provenance file, if any.
+func copyTest(src, dst string) error {
+	if err := Copy(src, dst); err != nil {
+		return err
+	}
+	if _, err := os.Stat(provenancePath(src)); err != nil {
+		return nil
+	}
+	return Copy(provenancePath(src), provenancePath(dst))
+}
+
+// goevmlabVersion is the version of goevmlab, as recorded in the build info:
+// the module version, or the vcs revision for builds from a checkout.
+var goevmlabVersion = func() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	version := info.Main.Version
+	var revision, modified string
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			revision = s.Value
+		case "vcs.modified":
+			if s.Value == "true" {
+				modified = "-dirty"
+			}
+		}
+	}
+	if revision != "" {
+		version = fmt.Sprintf("%v (%v%v)", version, revision, modified)
+	}
+	return version
+}()
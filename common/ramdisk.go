@@ -0,0 +1,50 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"path/filepath"
+)
+
+// inScratch returns whether the test is in the scratch directory.
+func (meta *testMeta) inScratch(path string) bool {
+	return meta.scratchdir != "" && filepath.Clean(filepath.Dir(path)) == filepath.Clean(meta.scratchdir)
+}
+
+// durableDir returns the directory to keep the test, or copies of it, in: the
+// outdir for tests in the scratch directory, otherwise the directory of the
+// test itself.
+func (meta *testMeta) durableDir(path string) string {
+	if meta.inScratch(path) {
+		return meta.outdir
+	}
+	return filepath.Dir(path)
+}
+
+// promoteTest moves the test, along with its provenance file, out of the
+// scratch directory to the outdir, and returns its new path. Tests elsewhere
+// are left where they are.
+func (meta *testMeta) promoteTest(path string) (string, error) {
+	if !meta.inScratch(path) {
+		return path, nil
+	}
+	dst := filepath.Join(meta.outdir, filepath.Base(path))
+	if err := copyTest(path, dst); err != nil {
+		return path, err
+	}
+	return dst, removeTest(path)
+}
@@ -0,0 +1,160 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/holiman/goevmlab/evms"
+	"github.com/holiman/goevmlab/fuzzing"
+)
+
+func TestPromoteTest(t *testing.T) {
+	var (
+		outdir  = t.TempDir()
+		scratch = t.TempDir()
+		meta    = &testMeta{outdir: outdir, scratchdir: scratch}
+	)
+	path, err := storeTest(scratch, map[string]string{}, "00000001-naive-0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := storeProvenance(path, provenance{Generator: "naive", Fork: "Cancun", Seed: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if have := meta.durableDir(path); have != outdir {
+		t.Errorf("expected durable dir %v, have %v", outdir, have)
+	}
+	promoted, err := meta.promoteTest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(outdir, filepath.Base(path)); promoted != want {
+		t.Fatalf("expected test moved to %v, have %v", want, promoted)
+	}
+	for _, f := range []string{promoted, provenancePath(promoted)} {
+		if _, err := os.Stat(f); err != nil {
+			t.Errorf("expected %v in the outdir: %v", f, err)
+		}
+	}
+	for _, f := range []string{path, provenancePath(path)} {
+		if _, err := os.Stat(f); !os.IsNotExist(err) {
+			t.Errorf("expected %v removed from the scratch directory", f)
+		}
+	}
+	// Tests outside the scratch directory stay put
+	if have, err := meta.promoteTest(promoted); err != nil || have != promoted {
+		t.Errorf("expected test outside the scratch directory left in place, have %v, %v", have, err)
+	}
+	if have := meta.durableDir(promoted); have != outdir {
+		t.Errorf("expected durable dir %v, have %v", outdir, have)
+	}
+}
+
+// TestPromoteTestCSV checks that the csv row of a consensus flaw found in the
+// scratch directory gets the diverging pc, and the path it was moved to.
+func TestPromoteTestCSV(t *testing.T) {
+	var (
+		outdir  = t.TempDir()
+		scratch = t.TempDir()
+		bindir  = t.TempDir()
+		vms     []evms.Evm
+	)
+	// Two clients replaying diverging traces
+	for i, trace := range []string{"00000006-naivefuzz-0.json", "00000936-mixed-1.json"} {
+		path, err := filepath.Abs(filepath.Join("..", "evms", "testdata", "traces", trace+".geth.stderr.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		bin := filepath.Join(bindir, fmt.Sprintf("evm%d", i))
+		if err := os.WriteFile(bin, []byte(fmt.Sprintf("#!/bin/sh\ncat %v >&2\n", path)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		vms = append(vms, evms.NewGethEVM(bin, fmt.Sprintf("geth-%d", i)))
+	}
+	csvOut, err := newCSVLog(filepath.Join(outdir, "log.csv"), []string{"geth-0", "geth-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := &testMeta{
+		outdir:     outdir,
+		scratchdir: scratch,
+		vms:        vms,
+		advisory:   make([]bool, len(vms)),
+		signatures: make(map[string]bool),
+		divStats:   newDivergenceStats(),
+		csv:        csvOut,
+	}
+	path, err := storeTest(scratch, map[string]string{}, "00000001-naive-0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	csvOut.hold(path, map[int]time.Duration{0: time.Second, 1: time.Second}, "divergent", 10)
+	meta.handleConsensusFlaw(path)
+	if err := csvOut.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(outdir, "log.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	want := fmt.Sprintf("%v,1.000000,1.000000,divergent,10,", filepath.Join(outdir, filepath.Base(path)))
+	if len(lines) != 2 || !strings.HasPrefix(lines[1], want) || strings.HasSuffix(lines[1], ",") {
+		t.Fatalf("wrong csv row, want %v<pc>:\n%v", want, string(data))
+	}
+}
+
+// BenchmarkStoreTest measures storing and removing generated tests, on disk
+// and on a RAM-backed directory, if available.
+func BenchmarkStoreTest(b *testing.B) {
+	test := fuzzing.Factory("naive", "Cancun")().ToGeneralStateTest("test")
+	dirs := map[string]string{"disk": b.TempDir()}
+	if _, err := os.Stat("/dev/shm"); err == nil {
+		dir, err := os.MkdirTemp("/dev/shm", "goevmlab-bench-")
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		dirs["ramdisk"] = dir
+	}
+	for _, name := range []string{"disk", "ramdisk"} {
+		dir, ok := dirs[name]
+		if !ok {
+			continue
+		}
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				path, err := storeTest(dir, test, fmt.Sprintf("%08d-naive-0", i))
+				if err != nil {
+					b.Fatal(err)
+				}
+				if err := storeProvenance(path, provenance{Generator: "naive", Fork: "Cancun", Seed: 1}); err != nil {
+					b.Fatal(err)
+				}
+				if err := removeTest(path); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/holiman/goevmlab/evms"
+	"github.com/urfave/cli/v2"
+)
+
+// ReplayTest executes the single test on all vms, the given number of times,
+// and reports how often the outputs diverge. A divergence which happens every
+// run, at the same point, with each client producing the same output every
+// time, is a deterministic bug. Otherwise, some client is nondeterministic.
+func ReplayTest(c *cli.Context, path string, runs int) error {
+	vms := initVMs(c)
+	if len(vms) < 2 {
+		return fmt.Errorf("replay needs at least two vms, have %d", len(vms))
+	}
+	defer func() {
+		for _, vm := range vms {
+			vm.Close()
+		}
+	}()
+	outdir, err := os.MkdirTemp(c.String(LocationFlag.Name), "replay-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(outdir)
+	var (
+		blockTest  = c.Bool(BlockTestFlag.Name)
+		sortFields = c.StringSlice(SortFieldsFlag.Name)
+		maxLines   = c.Int(CompareStepsFlag.Name)
+		names      []string
+	)
+	for _, vm := range vms {
+		names = append(names, vm.Name())
+	}
+	stats := newReplayStats(names)
+	for run := 0; run < runs; run++ {
+		outputs, err := replayOnce(vms, path, outdir, blockTest, sortFields)
+		if err != nil {
+			return err
+		}
+		var readers []io.Reader
+		for _, output := range outputs {
+			readers = append(readers, bytes.NewReader(output))
+		}
+		div, _, _ := evms.CompareFilesDivergence(vms, readers, maxLines)
+		stats.add(div, outputs)
+		log.Info("Replayed test", "run", run+1, "diverged", div != nil, "divergences", stats.diverged)
+	}
+	stats.report(stdout)
+	return nil
+}
+
+// replayOnce executes the test on all vms in parallel, and returns their
+// (normalized) outputs. Errors from the clients are logged, but the outputs
+// are still compared, since intermittent failures are of interest too.
+func replayOnce(vms []evms.Evm, path, outdir string, blockTest bool, sortFields []string) ([][]byte, error) {
+	var (
+		wg      sync.WaitGroup
+		outputs = make([][]byte, len(vms))
+		errs    = make([]error, len(vms))
+	)
+	for i, vm := range vms {
+		wg.Add(1)
+		go func(i int, vm evms.Evm) {
+			defer wg.Done()
+			filename := filepath.Join(outdir, fmt.Sprintf("%v-output.jsonl", vm.Name()))
+			f, err := os.Create(filename)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			defer f.Close()
+			var (
+				buf = bufio.NewWriter(f)
+				out = evms.NewFieldSorter(buf, sortFields)
+				run = vm.RunStateTest
+			)
+			if blockTest {
+				run = vm.(evms.BlockTester).RunBlockTest
+			}
+			if _, err := run(path, out, false); err != nil {
+				log.Warn("Error running test", "evm", vm.Name(), "err", err)
+			}
+			_ = out.Flush()
+			_ = buf.Flush()
+			outputs[i], errs[i] = os.ReadFile(filename)
+		}(i, vm)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return outputs, nil
+}
+
+// replayStats collects the outcomes of replaying a test.
+type replayStats struct {
+	names       []string
+	runs        int
+	diverged    int
+	signatures  map[string]int               // number of divergences per signature
+	divergences map[string]*evms.Divergence  // an example per signature
+	outputs     []map[[sha256.Size]byte]bool // the distinct outputs per client
+}
+
+func newReplayStats(names []string) *replayStats {
+	stats := &replayStats{
+		names:       names,
+		signatures:  make(map[string]int),
+		divergences: make(map[string]*evms.Divergence),
+	}
+	for range names {
+		stats.outputs = append(stats.outputs, make(map[[sha256.Size]byte]bool))
+	}
+	return stats
+}
+
+// add records the outcome of one run: the divergence, if any, and the
+// outputs of the clients.
+func (s *replayStats) add(div *evms.Divergence, outputs [][]byte) {
+	s.runs++
+	for i, output := range outputs {
+		s.outputs[i][sha256.Sum256(output)] = true
+	}
+	if div == nil {
+		return
+	}
+	s.diverged++
+	sig := div.Signature()
+	s.signatures[sig]++
+	s.divergences[sig] = div
+}
+
+// nondeterministic returns the clients which produced differing outputs
+// between runs.
+func (s *replayStats) nondeterministic() []string {
+	var names []string
+	for i, outputs := range s.outputs {
+		if len(outputs) > 1 {
+			names = append(names, fmt.Sprintf("%v (%d distinct outputs)", s.names[i], len(outputs)))
+		}
+	}
+	return names
+}
+
+// stable returns true if every run had the same outcome.
+func (s *replayStats) stable() bool {
+	if len(s.nondeterministic()) > 0 {
+		return false
+	}
+	return s.diverged == 0 || (s.diverged == s.runs && len(s.signatures) == 1)
+}
+
+// report writes the reproduction rate, the divergences seen, and the verdict.
+func (s *replayStats) report(w io.Writer) {
+	rate := 0.0
+	if s.runs > 0 {
+		rate = 100 * float64(s.diverged) / float64(s.runs)
+	}
+	fmt.Fprintf(w, "Diverged in %d of %d runs (reproduction rate %.1f%%)\n", s.diverged, s.runs, rate)
+	var sigs []string
+	for sig := range s.signatures {
+		sigs = append(sigs, sig)
+	}
+	sort.Strings(sigs)
+	for _, sig := range sigs {
+		d := s.divergences[sig]
+		fmt.Fprintf(w, "- %v: %d runs, %v vs %v, op %v, pc %v, depth %v, field %v\n",
+			sig, s.signatures[sig], d.Clients[0], d.Clients[1], d.Op, d.Pc, d.Depth, d.Field)
+	}
+	if names := s.nondeterministic(); len(names) > 0 {
+		fmt.Fprintf(w, "Output differs between runs: %v\n", strings.Join(names, ", "))
+	}
+	switch {
+	case s.diverged == 0 && s.stable():
+		fmt.Fprintln(w, "Verdict: no divergence")
+	case s.stable():
+		fmt.Fprintln(w, "Verdict: stable divergence, deterministic bug")
+	default:
+		fmt.Fprintln(w, "Verdict: unstable, nondeterminism")
+	}
+}
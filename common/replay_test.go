@@ -0,0 +1,79 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/holiman/goevmlab/evms"
+)
+
+func TestReplayStats(t *testing.T) {
+	var (
+		divA = &evms.Divergence{Clients: [2]string{"a", "b"}, Op: "SSTORE", Pc: "4", Depth: "1", Field: "gas"}
+		divB = &evms.Divergence{Clients: [2]string{"a", "b"}, Op: "CALL", Pc: "9", Depth: "1", Field: "stack"}
+	)
+	for i, tc := range []struct {
+		divs    []*evms.Divergence
+		outputs [][2]string
+		verdict string
+	}{
+		{ // Never diverges
+			[]*evms.Divergence{nil, nil},
+			[][2]string{{"x", "x"}, {"x", "x"}},
+			"no divergence",
+		},
+		{ // Always diverges, the same way
+			[]*evms.Divergence{divA, divA, divA},
+			[][2]string{{"x", "y"}, {"x", "y"}, {"x", "y"}},
+			"stable divergence",
+		},
+		{ // Diverges now and then, client b is nondeterministic
+			[]*evms.Divergence{divA, nil, divA},
+			[][2]string{{"x", "y"}, {"x", "x"}, {"x", "y"}},
+			"unstable",
+		},
+		{ // Always diverges, but differently
+			[]*evms.Divergence{divA, divB},
+			[][2]string{{"x", "y"}, {"x", "z"}},
+			"unstable",
+		},
+	} {
+		stats := newReplayStats([]string{"a", "b"})
+		for j, div := range tc.divs {
+			stats.add(div, [][]byte{[]byte(tc.outputs[j][0]), []byte(tc.outputs[j][1])})
+		}
+		var out strings.Builder
+		stats.report(&out)
+		if !strings.Contains(out.String(), "Verdict: "+tc.verdict) {
+			t.Errorf("test %d: wrong verdict, want %q:\n%v", i, tc.verdict, out.String())
+		}
+	}
+	// The reproduction rate, and the nondeterministic client
+	stats := newReplayStats([]string{"a", "b"})
+	stats.add(divA, [][]byte{[]byte("x"), []byte("y")})
+	stats.add(nil, [][]byte{[]byte("x"), []byte("x")})
+	var out strings.Builder
+	stats.report(&out)
+	for _, want := range []string{"Diverged in 1 of 2 runs (reproduction rate 50.0%)",
+		divA.Signature() + ": 1 runs", "b (2 distinct outputs)"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("missing %q in report:\n%v", want, out.String())
+		}
+	}
+}
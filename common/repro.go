@@ -0,0 +1,131 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime/debug"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/holiman/goevmlab/evms"
+)
+
+// reproPath returns the path of the reproducer script for the given test.
+func reproPath(testfile string) string {
+	return strings.TrimSuffix(testfile, ".json") + ".repro.sh"
+}
+
+// writeReproScript writes a shell script next to the test, which executes
+// the test on each client using the same commands as the fuzzer.
+func writeReproScript(testfile string, clients []crashClient, vms []evms.Evm) error {
+	script := new(strings.Builder)
+	fmt.Fprintf(script, "#!/bin/sh\n")
+	fmt.Fprintf(script, "# Reproduces the client outputs for %v\n", testfile)
+	fmt.Fprintf(script, "#\n# Clients:\n")
+	for i, client := range clients {
+		fmt.Fprintf(script, "#   %v: %v\n", client.Name, clientVersion(vms[i]))
+	}
+	for i, client := range clients {
+		fmt.Fprintf(script, "\necho %v\n", evms.ShellQuote("== "+client.Name))
+		if _, ok := vms[i].(interface{ Binary() string }); !ok {
+			// The client is executed in-process, there is no command to run
+			fmt.Fprintf(script, "# %v\n", client.Command)
+			continue
+		}
+		fmt.Fprintf(script, "%v\n", client.Command)
+	}
+	return os.WriteFile(reproPath(testfile), []byte(script.String()), 0755)
+}
+
+// clientVersion describes the client build: the binary along with its hash,
+// or, for in-process clients, the go-ethereum version of the fuzzer.
+func clientVersion(vm evms.Evm) string {
+	if bin, ok := vm.(interface{ Binary() string }); ok {
+		path := bin.Binary()
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Sprintf("%v (%v)", path, err)
+		}
+		defer f.Close()
+		h := sha256.New()
+		if _, err := io.Copy(h, f); err != nil {
+			return fmt.Sprintf("%v (%v)", path, err)
+		}
+		return fmt.Sprintf("%v (sha256 %x)", path, h.Sum(nil))
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range info.Deps {
+			if dep.Path == "github.com/ethereum/go-ethereum" {
+				return fmt.Sprintf("in-process, go-ethereum %v", dep.Version)
+			}
+		}
+	}
+	return "in-process"
+}
+
+// clientOutputPath returns the path where the output of the client is saved
+// for the given test, kind being "raw" or "norm".
+func clientOutputPath(testfile, client, kind string) string {
+	return fmt.Sprintf("%v.%v.%v.jsonl", strings.TrimSuffix(testfile, ".json"), client, kind)
+}
+
+// writeClientOutputs saves the outputs of each client next to the test: the
+// normalized output, as it was compared, and the raw output, as emitted by the
+// client binary. The latter is obtained by executing the test once more.
+func writeClientOutputs(testfile string, clients []crashClient, vms []evms.Evm) {
+	for i, client := range clients {
+		normPath := clientOutputPath(testfile, client.Name, "norm")
+		if err := Copy(client.Output, normPath); err != nil {
+			log.Error("Failed saving normalized output", "client", client.Name, "err", err)
+		}
+		if _, ok := vms[i].(interface{ Binary() string }); !ok {
+			log.Warn("Raw output not available for in-process client", "client", client.Name)
+			continue
+		}
+		rawPath := clientOutputPath(testfile, client.Name, "raw")
+		if err := writeRawOutput(client.Command, rawPath); err != nil {
+			log.Error("Failed saving raw output", "client", client.Name, "err", err)
+			continue
+		}
+		log.Info("Saved client outputs", "client", client.Name, "raw", rawPath, "normalized", normPath)
+	}
+}
+
+// writeRawOutput executes the shell command, and writes everything it emits,
+// on both stdout and stderr, to the given path. A non-zero exit status is not
+// treated as an error, since crashing clients are of interest too.
+func writeRawOutput(command, path string) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	if err := cmd.Run(); err != nil {
+		if _, exited := err.(*exec.ExitError); !exited {
+			return err
+		}
+	}
+	return out.Sync()
+}
@@ -0,0 +1,61 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// stdout is where the reports (consensus flaws, statistics, diffs) are
+// written. If the consumer of the output goes away, e.g. when piped to head,
+// the output is discarded: the fuzzer keeps running, and the reports on disk
+// are unaffected.
+var stdout io.Writer = &pipeWriter{w: os.Stdout}
+
+// pipeWriter is a writer which discards everything once the underlying
+// writer has failed with EPIPE.
+type pipeWriter struct {
+	w      io.Writer
+	broken atomic.Bool
+}
+
+func (p *pipeWriter) Write(b []byte) (int, error) {
+	if p.broken.Load() {
+		return len(b), nil
+	}
+	n, err := p.w.Write(b)
+	if errors.Is(err, syscall.EPIPE) {
+		if !p.broken.Swap(true) {
+			log.Warn("Output pipe closed, discarding further output")
+		}
+		return len(b), nil
+	}
+	return n, err
+}
+
+// ignoreSigpipe makes writes to a closed stdout or stderr fail with EPIPE,
+// rather than the runtime killing the process with SIGPIPE.
+func ignoreSigpipe() {
+	signal.Ignore(syscall.SIGPIPE)
+}
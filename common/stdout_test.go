@@ -0,0 +1,46 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestPipeWriter(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	ignoreSigpipe()
+	out := &pipeWriter{w: w}
+	if _, err := fmt.Fprintln(out, "hello"); err != nil {
+		t.Fatal(err)
+	}
+	// The reader goes away
+	r.Close()
+	for i := 0; i < 2; i++ {
+		if n, err := fmt.Fprintln(out, "world"); err != nil || n != 6 {
+			t.Fatalf("write to closed pipe failed: %d, %v", n, err)
+		}
+	}
+	if !out.broken.Load() {
+		t.Fatal("broken pipe not detected")
+	}
+}
@@ -0,0 +1,227 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/holiman/goevmlab/evms"
+	"github.com/holiman/goevmlab/fuzzing"
+	"github.com/urfave/cli/v2"
+)
+
+// suiteCase is a single (test, fork, index) combination of a reference test,
+// split out into a file of its own.
+type suiteCase struct {
+	name     string // the test name, including fork and indexes
+	fork     string
+	path     string
+	expected string // the post-state root given in the test
+}
+
+// RunSuite executes the reference state tests in the directory on all vms,
+// and reports, for each test and fork, whether every client produced the
+// expected post-state root, and whether the clients agree with each other.
+// It returns an error if any client failed any test.
+func RunSuite(c *cli.Context, dir string) error {
+	vms := initVMs(c)
+	if len(vms) == 0 {
+		return fmt.Errorf("need at least one vm")
+	}
+	defer func() {
+		for _, vm := range vms {
+			vm.Close()
+		}
+	}()
+	if finfo, err := os.Stat(dir); err != nil {
+		return err
+	} else if !finfo.IsDir() {
+		return fmt.Errorf("%v is not a directory", dir)
+	}
+	outdir, err := os.MkdirTemp(c.String(LocationFlag.Name), "suite-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(outdir)
+	cases, err := splitSuite(dir, outdir)
+	if err != nil {
+		return err
+	}
+	log.Info("Split reference tests", "dir", dir, "cases", len(cases))
+	roots := runSuite(vms, cases, c.Int(ThreadFlag.Name))
+	var names []string
+	for _, vm := range vms {
+		names = append(names, vm.Name())
+	}
+	if failures := reportSuite(stdout, names, cases, roots); failures > 0 {
+		return fmt.Errorf("%d test failures", failures)
+	}
+	return nil
+}
+
+// splitSuite splits the state tests in the directory (recursively) into
+// single-subtest tests in the output directory, and returns them sorted by
+// name. Files which are not state tests are skipped.
+func splitSuite(dir, outdir string) ([]suiteCase, error) {
+	var cases []suiteCase
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(path, ".json") || IsProvenanceFile(path) {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		tests, err := fuzzing.SplitStateTest(data)
+		if err != nil {
+			log.Warn("Skipping file", "file", path, "err", err)
+			return nil
+		}
+		for name, test := range tests {
+			var parsed map[string]struct {
+				Post map[string][]struct {
+					Hash string `json:"hash"`
+				} `json:"post"`
+			}
+			if err := json.Unmarshal(test, &parsed); err != nil {
+				return fmt.Errorf("%v: %w", name, err)
+			}
+			sc := suiteCase{name: name}
+			for fork, posts := range parsed[name].Post {
+				sc.fork, sc.expected = fork, posts[0].Hash
+			}
+			sc.path = filepath.Join(outdir, fmt.Sprintf("%06d.json", len(cases)))
+			if err := os.WriteFile(sc.path, test, 0644); err != nil {
+				return err
+			}
+			cases = append(cases, sc)
+		}
+		return nil
+	})
+	sort.Slice(cases, func(i, j int) bool { return cases[i].name < cases[j].name })
+	return cases, err
+}
+
+// runSuite executes the cases on all vms, using the given number of threads,
+// and returns the post-state root produced by each vm for each case. The root
+// is empty if the vm failed to produce one.
+func runSuite(vms []evms.Evm, cases []suiteCase, threads int) [][]string {
+	var (
+		roots = make([][]string, len(cases))
+		next  = make(chan int)
+		wg    sync.WaitGroup
+	)
+	if threads < 1 {
+		threads = 1
+	}
+	for i := 0; i < threads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range next {
+				roots[index] = make([]string, len(vms))
+				for j, vm := range vms {
+					roots[index][j] = suiteRoot(vm, cases[index].path)
+				}
+			}
+		}()
+	}
+	for i := range cases {
+		next <- i
+		if (i+1)%1000 == 0 {
+			log.Info("Executing reference tests", "started", i+1, "total", len(cases))
+		}
+	}
+	close(next)
+	wg.Wait()
+	return roots
+}
+
+// suiteRoot executes the test on the vm, without tracing, and returns the
+// post-state root.
+func suiteRoot(vm evms.Evm, path string) string {
+	out := new(rootCollector)
+	if _, err := vm.RunStateTest(path, out, true); err != nil {
+		log.Warn("Error running test", "evm", vm.Name(), "file", path, "err", err)
+		return ""
+	}
+	out.flush()
+	if len(out.roots) == 0 {
+		return ""
+	}
+	return out.roots[len(out.roots)-1]
+}
+
+// reportSuite writes the pass/fail matrix, one row per case and one column
+// per client, followed by a summary per client, and returns the number of
+// failures.
+func reportSuite(w io.Writer, names []string, cases []suiteCase, roots [][]string) int {
+	var (
+		tw       = tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		passed   = make([]int, len(names))
+		agreed   int
+		failures int
+	)
+	fmt.Fprintf(tw, "TEST\tFORK\t%v\tCLIENTS AGREE\n", strings.Join(names, "\t"))
+	for i, sc := range cases {
+		var (
+			cells = make([]string, len(names))
+			agree = true
+		)
+		for j, root := range roots[i] {
+			switch {
+			case root == "":
+				cells[j] = "ERROR"
+				failures++
+			case strings.EqualFold(root, sc.expected):
+				cells[j] = "pass"
+				passed[j]++
+			default:
+				cells[j] = "FAIL"
+				failures++
+			}
+			if root == "" || !strings.EqualFold(root, roots[i][0]) {
+				agree = false
+			}
+		}
+		verdict := "no"
+		if agree {
+			verdict = "yes"
+			agreed++
+		}
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\n", sc.name, sc.fork, strings.Join(cells, "\t"), verdict)
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+	for j, name := range names {
+		fmt.Fprintf(w, "%v: %d/%d passed\n", name, passed[j], len(cases))
+	}
+	fmt.Fprintf(w, "Clients agree: %d/%d\n", agreed, len(cases))
+	return failures
+}
@@ -0,0 +1,92 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSuite(t *testing.T) {
+	var (
+		dir    = t.TempDir()
+		outdir = t.TempDir()
+		test   = `{"example": {
+  "env": {},
+  "pre": {},
+  "transaction": {"data": ["0x", "0x01"], "gasLimit": ["0x5208"], "value": ["0x0"]},
+  "post": {
+    "Cancun": [
+      {"hash": "0xaa", "indexes": {"data": 0, "gas": 0, "value": 0}},
+      {"hash": "0xbb", "indexes": {"data": 1, "gas": 0, "value": 0}}
+    ],
+    "Shanghai": [{"hash": "0xcc", "indexes": {"data": 0, "gas": 0, "value": 0}}]
+  }
+}}`
+	)
+	if err := os.MkdirAll(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "sub", "example.json"), []byte(test), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not a test"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cases, err := splitSuite(dir, outdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cases) != 3 {
+		t.Fatalf("expected 3 cases, have %d", len(cases))
+	}
+	want := map[string]string{
+		"example-Cancun-d0g0v0":   "0xaa",
+		"example-Cancun-d1g0v0":   "0xbb",
+		"example-Shanghai-d0g0v0": "0xcc",
+	}
+	for _, sc := range cases {
+		if want[sc.name] != sc.expected {
+			t.Errorf("case %v: expected root %v, have %v", sc.name, want[sc.name], sc.expected)
+		}
+		if !strings.Contains(sc.name, sc.fork) {
+			t.Errorf("case %v: wrong fork %v", sc.name, sc.fork)
+		}
+		if _, err := os.Stat(sc.path); err != nil {
+			t.Errorf("case %v: %v", sc.name, err)
+		}
+	}
+	// Client a passes everything, b fails one case and errors on another
+	var (
+		out   = new(bytes.Buffer)
+		roots = [][]string{{"0xAA", "0xaa"}, {"0xbb", "0xbd"}, {"0xcc", ""}}
+	)
+	if failures := reportSuite(out, []string{"a", "b"}, cases, roots); failures != 2 {
+		t.Errorf("expected 2 failures, have %d", failures)
+	}
+	for _, line := range []string{"a: 3/3 passed", "b: 1/3 passed", "Clients agree: 1/3"} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("missing %q in report:\n%v", line, out)
+		}
+	}
+	if !strings.Contains(out.String(), "FAIL") || !strings.Contains(out.String(), "ERROR") {
+		t.Errorf("missing failures in report:\n%v", out)
+	}
+}
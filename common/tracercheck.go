@@ -0,0 +1,151 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/holiman/goevmlab/evms"
+	"github.com/urfave/cli/v2"
+)
+
+// rootCollector is a writer which collects the stateroots from the canonical
+// output written to it, and discards the rest.
+type rootCollector struct {
+	line  []byte
+	roots []string
+}
+
+func (r *rootCollector) Write(p []byte) (int, error) {
+	for _, c := range p {
+		if c != '\n' {
+			r.line = append(r.line, c)
+			continue
+		}
+		r.flush()
+	}
+	return len(p), nil
+}
+
+// flush handles the line collected so far.
+func (r *rootCollector) flush() {
+	if bytes.Contains(r.line, []byte(`"stateRoot"`)) {
+		var root struct {
+			StateRoot string `json:"stateRoot"`
+		}
+		if err := json.Unmarshal(r.line, &root); err == nil && root.StateRoot != "" {
+			r.roots = append(r.roots, root.StateRoot)
+		}
+	}
+	r.line = r.line[:0]
+}
+
+// tracingRoots executes the test on the vm with and without tracing, and
+// returns the stateroots from both executions, along with the commands used.
+func tracingRoots(vm evms.Evm, path string, blockTest bool) (traced, untraced []string, commands [2]string, err error) {
+	run := vm.RunStateTest
+	if blockTest {
+		run = vm.(evms.BlockTester).RunBlockTest
+	}
+	for i, skipTrace := range []bool{false, true} {
+		out := new(rootCollector)
+		res, err := run(path, out, skipTrace)
+		if res != nil {
+			commands[i] = res.Cmd
+		}
+		if err != nil {
+			return nil, nil, commands, fmt.Errorf("error executing %v on %v: %w", path, vm.Name(), err)
+		}
+		out.flush()
+		if skipTrace {
+			untraced = out.roots
+		} else {
+			traced = out.roots
+		}
+	}
+	return traced, untraced, commands, nil
+}
+
+// CheckTracing executes each test on every vm twice: with full tracing, and
+// with tracing disabled. The stateroots must not depend on whether the
+// execution is traced, so a difference means that the tracer of the client
+// masks or introduces a bug. Such differences are reported as tracer
+// inconsistencies, and make it return an error.
+func CheckTracing(c *cli.Context, files []string) error {
+	vms := initVMs(c)
+	if len(vms) == 0 {
+		return fmt.Errorf("need at least one vm")
+	}
+	defer func() {
+		for _, vm := range vms {
+			vm.Close()
+		}
+	}()
+	n, err := checkTracing(vms, files, c.Bool(BlockTestFlag.Name), stdout)
+	if err != nil {
+		return err
+	}
+	log.Info("Checked tracing", "tests", len(files), "vms", len(vms), "inconsistencies", n)
+	if n > 0 {
+		return fmt.Errorf("%d tracer inconsistencies found", n)
+	}
+	return nil
+}
+
+// checkTracing checks the tracing of the tests on the vms, reports the
+// inconsistencies found to the writer, and returns their number.
+func checkTracing(vms []evms.Evm, files []string, blockTest bool, w io.Writer) (int, error) {
+	var inconsistencies int
+	for _, path := range files {
+		for _, vm := range vms {
+			traced, untraced, commands, err := tracingRoots(vm, path, blockTest)
+			if err != nil {
+				return inconsistencies, err
+			}
+			if len(traced) == 0 && len(untraced) == 0 {
+				log.Warn("No stateroot produced", "evm", vm.Name(), "file", path)
+				continue
+			}
+			if reportTracing(w, vm.Name(), path, traced, untraced, commands) {
+				inconsistencies++
+			}
+		}
+	}
+	return inconsistencies, nil
+}
+
+// reportTracing compares the stateroots of the traced and untraced executions
+// of the test on the vm, and reports a tracer inconsistency to the writer if
+// they differ. It returns whether they differ.
+func reportTracing(w io.Writer, name, path string, traced, untraced []string, commands [2]string) bool {
+	if strings.Join(traced, ",") == strings.Join(untraced, ",") {
+		log.Debug("Tracing consistent", "evm", name, "file", path, "roots", len(traced))
+		return false
+	}
+	fmt.Fprintf(w, "Tracer inconsistency\n")
+	fmt.Fprintf(w, "Testcase: %v\n", path)
+	fmt.Fprintf(w, "- %v traced: %v\n", name, strings.Join(traced, ", "))
+	fmt.Fprintf(w, "  - command: %v\n", commands[0])
+	fmt.Fprintf(w, "- %v untraced: %v\n", name, strings.Join(untraced, ", "))
+	fmt.Fprintf(w, "  - command: %v\n", commands[1])
+	return true
+}
@@ -0,0 +1,60 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/holiman/goevmlab/evms"
+)
+
+func TestRootCollector(t *testing.T) {
+	out := new(rootCollector)
+	fmt.Fprint(out, `{"pc":0,"op":0,"gas":"0x0","depth":1,"opName":"STOP"}`+"\n"+`{"stateRoot":"0x01"}`+"\n"+`{"stateRo`)
+	fmt.Fprint(out, `ot":"0x02"}`)
+	out.flush()
+	if have := fmt.Sprint(out.roots); have != "[0x01 0x02]" {
+		t.Fatalf("wrong roots: %v", have)
+	}
+}
+
+func TestCheckTracing(t *testing.T) {
+	var (
+		test = filepath.Join("..", "evms", "testdata", "cases", "statetest1.json")
+		out  = new(strings.Builder)
+	)
+	n, err := checkTracing([]evms.Evm{evms.NewGethNativeVM("native")}, []string{test}, false, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 || out.Len() != 0 {
+		t.Fatalf("unexpected inconsistency: %v", out)
+	}
+	if reportTracing(out, "geth", test, []string{"0x01"}, []string{"0x01"}, [2]string{}) || out.Len() != 0 {
+		t.Fatalf("unexpected inconsistency: %v", out)
+	}
+	if !reportTracing(out, "geth", test, []string{"0x01"}, []string{"0x02"}, [2]string{"traced", "untraced"}) {
+		t.Fatal("inconsistency not detected")
+	}
+	if have := out.String(); !strings.HasPrefix(have, "Tracer inconsistency\n") ||
+		!strings.Contains(have, "- geth traced: 0x01\n  - command: traced\n- geth untraced: 0x02\n") {
+		t.Fatalf("wrong report: %v", have)
+	}
+}
@@ -22,11 +22,16 @@ import (
 	"context"
 	"crypto/md5"
 	"encoding/json"
+	"errors"
+	"expvar"
 	"fmt"
 	"hash"
 	"io"
+	"io/fs"
 	"math/big"
+	"math/rand"
 	"os"
+	"os/exec"
 	"os/signal"
 	"path"
 	"path/filepath"
@@ -47,6 +52,7 @@ import (
 	"github.com/holiman/goevmlab/utils"
 	"github.com/urfave/cli/v2"
 	"net/http"
+	_ "net/http/pprof" // for the pprof server
 )
 
 var (
@@ -102,6 +108,29 @@ var (
 		Name:  "revme",
 		Usage: "Location of reth 'revme' binary",
 	}
+	MemLimitFlag = &cli.IntFlag{
+		Name: "mem-limit",
+		Usage: "Memory limit (in MB) for spawned evm processes (0 = no limit). A client failing an allocation crashes,\n" +
+			"which is reported like any other crash",
+	}
+	CpuLimitFlag = &cli.IntFlag{
+		Name: "cpu-limit",
+		Usage: "CPU time limit (in seconds) for spawned evm processes (0 = no limit). The batch-mode clients are exempt,\n" +
+			"as they execute all tests in a single process",
+	}
+	CaptureStderrFlag = &cli.StringSliceFlag{
+		Name: "capture-stderr",
+		Usage: "How to handle stderr of clients which trace to stdout (besu, and nethermind in speedtest-mode): " +
+			"'merge' into the compared output, keep 'separate', or 'ignore'. Use client=mode (e.g. besu=merge) to set it per client",
+		Action: func(_ *cli.Context, values []string) error {
+			_, err := evms.ParseStderrCapture(values)
+			return err
+		},
+	}
+	GethNativeFlag = &cli.BoolFlag{
+		Name:  "gethnative",
+		Usage: "If set, an in-process go-ethereum is added as a participant",
+	}
 	ThreadFlag = &cli.IntFlag{
 		Name:  "parallel",
 		Usage: "Number of parallel executions to use.",
@@ -136,6 +165,175 @@ var (
 			"This mode is faster, and can be used even if the clients-under-test has known errors in the trace-output, \n" +
 			"but has a very high chance of missing cases which could be exploitable.",
 	}
+	BlockTestFlag = &cli.BoolFlag{
+		Name: "blocktest",
+		Usage: "If set, tests are generated and executed as blockchain tests instead of state tests.\n" +
+			"Only clients which support blockchain tests participate.",
+	}
+	CompareStepsFlag = &cli.IntFlag{
+		Name: "compare-steps",
+		Usage: "If set to N > 0, only the first N lines of output are compared, and tests matching on those are considered equal.\n" +
+			"This speeds up comparison of long traces, but any difference occurring later, including in the final stateroot, goes undetected.\n" +
+			"The default (0) compares the full output.",
+	}
+	CompareModeFlag = &cli.StringFlag{
+		Name: "compare-mode",
+		Usage: "What to compare: 'trace' (the trace output), 'stateroot' (only the final stateroot, executing without tracing, like 'skiptrace'),\n" +
+			"or 'both' (the trace output, and always the final stateroot, even if 'compare-steps' limits the trace comparison)",
+		Value: compareTrace,
+	}
+	MaxRateFlag = &cli.IntFlag{
+		Name:  "max-rate",
+		Usage: "Maximum number of tests to execute per second (0 means unlimited)",
+	}
+	AdvisoryEvmFlag = &cli.StringSliceFlag{
+		Name: "advisory-evm",
+		Usage: "Name of a vm (e.g. 'besu-0') whose disagreement with the others is only reported, but not treated as a consensus flaw.\n" +
+			"Useful when bringing up a new client which is known to be incomplete",
+	}
+	OnCrashFlag = &cli.StringFlag{
+		Name: "on-crash",
+		Usage: "Command to run (via 'sh -c') when a consensus flaw is found. The path to the test is passed\n" +
+			"as the first argument, and a JSON report of the divergence on stdin",
+	}
+	WebhookFlag = &cli.StringFlag{
+		Name: "webhook",
+		Usage: "URL to POST a JSON report to (signature, clients and their versions, first diverging step, minimized test)\n" +
+			"for each distinct consensus flaw found. Posting happens in the background, with a short timeout",
+		Action: func(_ *cli.Context, value string) error {
+			return validateWebhookURL(value)
+		},
+	}
+	AutoMinimizeFlag = &cli.BoolFlag{
+		Name: "auto-minimize",
+		Usage: "If set, consensus flaws are minimized (like the minimizer does) before being reported.\n" +
+			"The minimized test is stored alongside the original, as '<test>.min'",
+	}
+	MinimizeTimeoutFlag = &cli.DurationFlag{
+		Name:  "minimize-timeout",
+		Usage: "Time budget for minimizing a consensus flaw (see --auto-minimize)",
+		Value: 10 * time.Minute,
+	}
+	SortFieldsFlag = &cli.StringSliceFlag{
+		Name: "sort-fields",
+		Usage: "Names of trace fields (arrays or objects) whose contents are sorted before the outputs are compared,\n" +
+			"so that clients listing the same elements in a different order are not reported as diverging",
+	}
+	RawOutputFlag = &cli.BoolFlag{
+		Name: "raw-output",
+		Usage: "If set, the output of each client on a consensus flaw is saved next to the test both raw, exactly as emitted\n" +
+			"by the client (<test>.<client>.raw.jsonl), and normalized, as compared (<test>.<client>.norm.jsonl)",
+	}
+	MaxPendingFlag = &cli.IntFlag{
+		Name: "max-pending",
+		Usage: "If non-zero, test generation pauses while this many generated tests are waiting to be\n" +
+			"executed or cleaned up, so that the generation does not outrun the execution",
+	}
+	MaxDiskFlag = &cli.StringFlag{
+		Name: "max-disk",
+		Usage: "If set (e.g. 50GB), the disk space the generated tests may take up in the output directory: generation pauses\n" +
+			"when the budget is reached, and stops if nothing is left to clean up. Consensus flaws are not counted",
+		Action: func(_ *cli.Context, value string) error {
+			_, err := parseDiskSize(value)
+			return err
+		},
+	}
+	ContinueOnDivergenceFlag = &cli.BoolFlag{
+		Name: "continue-on-divergence",
+		Usage: "If set, consensus flaws do not stop the run: each distinct divergence (by signature) is saved\n" +
+			"and reported, duplicates are discarded, and fuzzing goes on",
+	}
+	MaxCrashersFlag = &cli.IntFlag{
+		Name:  "max-crashers",
+		Usage: "With --continue-on-divergence, the number of distinct divergences after which the run stops (0 = no limit)",
+		Value: 10,
+	}
+	RamdiskFlag = &cli.StringFlag{
+		Name: "ramdisk",
+		Usage: "If set, the generated tests are written to this directory, which should be RAM-backed (e.g. tmpfs),\n" +
+			"instead of the outdir. Tests which are kept, such as consensus flaws, are moved out to the outdir",
+	}
+	DurationFlag = &cli.DurationFlag{
+		Name:  "duration",
+		Usage: "If non-zero, the run stops after executing tests for this long",
+	}
+	MaxTestsFlag = &cli.IntFlag{
+		Name:  "max-tests",
+		Usage: "If non-zero, the run stops after executing this many tests",
+	}
+	FullPostStateFlag = &cli.BoolFlag{
+		Name: "full-poststate",
+		Usage: "If set, the full post-state (accounts, balances, nonces, code and storage) of each test is dumped\n" +
+			"by every client and compared, in addition to the output. Requires at least two clients, all of which support\n" +
+			"dumping the state (geth and the in-process geth)",
+	}
+	CompareAccessSetFlag = &cli.BoolFlag{
+		Name: "compare-access-set",
+		Usage: "If set, the accounts and storage slots accessed by each test (those warm at the start of the transaction and\n" +
+			"those accessed by the opcodes executed) are compared as well, across the clients which can report them (geth,\n" +
+			"erigon and the in-process geth)",
+	}
+	CompareRevertDataFlag = &cli.BoolFlag{
+		Name: "compare-revert-data",
+		Usage: "If set, the data returned by the outermost call of each test which reverts (e.g. a Solidity Error(string))\n" +
+			"is compared as well, across the clients which can report it",
+	}
+	VerboseDivergenceFlag = &cli.IntFlag{
+		Name: "verbose-divergence",
+		Usage: "If set, a consensus flaw is reported along with this many lines of output before and after the divergence,\n" +
+			"from each client, and the transaction and relevant pre-state accounts of the test",
+	}
+	ShuffleEvmsFlag = &cli.BoolFlag{
+		Name: "shuffle-evms",
+		Usage: "Debug option: randomize the order in which the clients are handed each test, and executed when\n" +
+			"investigating a consensus flaw, to expose state leaking between executions in goevmlab itself",
+	}
+	DictFlag = &cli.StringFlag{
+		Name: "dict",
+		Usage: "If set, the test generators draw some of their operands from the dictionary of 'interesting' constants\n" +
+			"(e.g. addresses, magic numbers) in the given file: one hex or decimal value per line, '#' for comments",
+	}
+	OpcodesFlag = &cli.StringSliceFlag{
+		Name: "opcodes",
+		Usage: "If set, the random bytecode generator only uses the given opcodes (e.g. ADD,MSTORE,SLOAD), along with\n" +
+			"the push instructions for their operands",
+	}
+	SeedCorpusFlag = &cli.StringFlag{
+		Name: "seed-corpus",
+		Usage: "If set, the tests in the given directory (e.g. previous crashers) are loaded as the corpus of the\n" +
+			"'mutate' engine, which then explores their neighbourhood",
+	}
+	ValidateGeneratorFlag = &cli.IntFlag{
+		Name: "validate-generator",
+		Usage: "If non-zero, instead of fuzzing, execute this many generated tests on the first client only, and report\n" +
+			"the ones it fails to parse or execute (generator bugs, as opposed to consensus flaws)",
+	}
+	SeedFlag = &cli.Int64Flag{
+		Name: "seed",
+		Usage: "Seed for the test generators (0 = random). When fuzzing, the tests are generated from the seeds following it,\n" +
+			"each recorded in the provenance file of the test",
+	}
+	CsvFlag = &cli.StringFlag{
+		Name: "csv",
+		Usage: "If set, one row per executed test (file, execution time per client, result, lines of output and the pc of the\n" +
+			"first diverging step) is appended to the given csv file",
+	}
+	CampaignsFlag = &cli.StringFlag{
+		Name: "campaigns",
+		Usage: "If set, a summary of the run (start, duration, tests, consensus flaws by signature, client versions)\n" +
+			"is appended to the given jsonl file when the run ends. The 'stats' command summarizes the file",
+	}
+	PprofFlag = &cli.StringFlag{
+		Name: "pprof",
+		Usage: "If set, a pprof http server is started on the given address (e.g. ':6060'), for profiling the fuzzer.\n" +
+			"The state of the test pipeline is served at /debug/vars",
+	}
+	GoMaxProcsFlag = &cli.IntFlag{
+		Name: "gomaxprocs",
+		Usage: "If set, limits the number of OS threads executing Go code (GOMAXPROCS), independently of 'parallel'.\n" +
+			"The best setting depends on the host and the clients: measure it on the fuzzing host with\n" +
+			"'go test -run - -bench GoMaxProcs ./common/'",
+	}
 	VerbosityFlag = &cli.IntFlag{
 		Name:  "verbosity",
 		Usage: "sets the verbosity level (-4: DEBUG, 0: INFO, 4: WARN, 8: ERROR)",
@@ -156,6 +354,7 @@ var (
 		NimbusFlag,
 		EvmoneFlag,
 		RethFlag,
+		GethNativeFlag,
 	}
 	traceLengthSA = utils.NewSlidingAverage()
 )
@@ -178,6 +377,13 @@ func initVMs(c *cli.Context) []evms.Evm {
 
 		vms []evms.Evm
 	)
+	evms.SetResourceLimits(evms.ResourceLimits{
+		Memory: uint64(c.Int(MemLimitFlag.Name)) * 1024 * 1024,
+		CPU:    uint64(c.Int(CpuLimitFlag.Name)),
+	})
+	// The flag action has already validated the values
+	captureModes, _ := evms.ParseStderrCapture(c.StringSlice(CaptureStderrFlag.Name))
+	evms.SetStderrCapture(captureModes)
 	for i, bin := range gethBins {
 		vms = append(vms, evms.NewGethEVM(bin, fmt.Sprintf("geth-%d", i)))
 	}
@@ -217,6 +423,9 @@ func initVMs(c *cli.Context) []evms.Evm {
 	for i, bin := range revmBins {
 		vms = append(vms, evms.NewRethVM(bin, fmt.Sprintf("%d", i)))
 	}
+	if c.Bool(GethNativeFlag.Name) {
+		vms = append(vms, evms.NewGethNativeVM("gethnative"))
+	}
 	return vms
 
 }
@@ -224,8 +433,19 @@ func initVMs(c *cli.Context) []evms.Evm {
 // RootsEqual executes the test on the given path on all vms, and returns true
 // if they all report the same post stateroot.
 func RootsEqual(path string, c *cli.Context) (bool, error) {
+	vms := initVMs(c)
+	defer func() {
+		for _, vm := range vms {
+			vm.Close()
+		}
+	}()
+	return rootsEqual(vms, path)
+}
+
+// rootsEqual executes the test on the given vms, and returns true if they all
+// report the same post stateroot.
+func rootsEqual(vms []evms.Evm, path string) (bool, error) {
 	var (
-		vms   = initVMs(c)
 		wg    sync.WaitGroup
 		roots = make([]string, len(vms))
 		errs  = make([]error, len(vms))
@@ -239,7 +459,6 @@ func RootsEqual(path string, c *cli.Context) (bool, error) {
 			root, _, err := vm.GetStateRoot(path)
 			roots[index] = root
 			errs[index] = err
-			vm.Close()
 			wg.Done()
 		}(i, vm)
 	}
@@ -314,8 +533,8 @@ func RunSingleTest(path string, c *cli.Context) (bool, error) {
 		readers = append(readers, f)
 	}
 	// Compare outputs
-	if eq, _, diff := evms.CompareFiles(vms, readers); !eq {
-		fmt.Print(diff)
+	if eq, _, diff := evms.CompareFilesLimit(vms, readers, c.Int(CompareStepsFlag.Name)); !eq {
+		fmt.Fprint(stdout, diff)
 		out := new(strings.Builder)
 		fmt.Fprintf(out, "Consensus error\n")
 		fmt.Fprintf(out, "Testcase: %v\n", path)
@@ -324,7 +543,8 @@ func RunSingleTest(path string, c *cli.Context) (bool, error) {
 			fmt.Fprintf(out, "  - command: %v\n", commands[i])
 		}
 		fmt.Fprintf(out, "\nTo view the difference with tracediff:\n\ttracediff %v %v\n", outputs[0].Name(), outputs[0].Name())
-		fmt.Println(out)
+		comparePostStates(vms, path, out)
+		fmt.Fprintln(stdout, out)
 		return false, fmt.Errorf("Consensus error")
 	}
 
@@ -335,6 +555,106 @@ func RunSingleTest(path string, c *cli.Context) (bool, error) {
 	return true, nil
 }
 
+// countStateDumpers returns the number of vms which can report the full
+// post-state.
+func countStateDumpers(vms []evms.Evm) int {
+	var n int
+	for _, vm := range vms {
+		if _, ok := vm.(evms.StateDumper); ok {
+			n++
+		}
+	}
+	return n
+}
+
+// comparePostStates executes the test on the vms which can report the full
+// post-state, and writes any differences found to the given writer. Only geth
+// and the in-process geth can, so with fewer than two of them the comparison
+// is not made, which is noted in the output.
+func comparePostStates(vms []evms.Evm, path string, out io.Writer) {
+	var (
+		names  []string
+		states []evms.PostState
+	)
+	for _, vm := range vms {
+		dumper, ok := vm.(evms.StateDumper)
+		if !ok {
+			continue
+		}
+		post, err := dumper.DumpPostState(path)
+		if err != nil {
+			log.Warn("Failed to obtain post-state", "vm", vm.Name(), "err", err)
+			continue
+		}
+		names = append(names, vm.Name())
+		states = append(states, post)
+	}
+	if len(states) < 2 {
+		fmt.Fprintf(out, "Post-state not compared: %d client(s) could dump it, need two\n", len(states))
+		return
+	}
+	for _, diff := range evms.ComparePostStates(names, states) {
+		fmt.Fprintln(out, diff)
+	}
+}
+
+// compareAccessSets executes the test on the vms which can report the accessed
+// set, and writes any differences found to the given writer.
+func compareAccessSets(vms []evms.Evm, path string, out io.Writer) {
+	var (
+		names []string
+		sets  []evms.AccessSet
+	)
+	for _, vm := range vms {
+		reporter, ok := vm.(evms.AccessSetReporter)
+		if !ok {
+			continue
+		}
+		set, err := reporter.AccessSet(path)
+		if err != nil {
+			log.Warn("Failed to obtain accessed set", "vm", vm.Name(), "err", err)
+			continue
+		}
+		names = append(names, vm.Name())
+		sets = append(sets, set)
+	}
+	if len(sets) < 2 {
+		return
+	}
+	for _, diff := range evms.CompareAccessSets(names, sets) {
+		fmt.Fprintln(out, diff)
+	}
+}
+
+// compareRevertData executes the test on the vms which can report the return
+// data of the outermost call, and writes any differences found to the given
+// writer.
+func compareRevertData(vms []evms.Evm, path string, out io.Writer) {
+	var (
+		names   []string
+		results []*evms.RevertData
+	)
+	for _, vm := range vms {
+		reporter, ok := vm.(evms.RevertDataReporter)
+		if !ok {
+			continue
+		}
+		res, err := reporter.RevertData(path)
+		if err != nil {
+			log.Warn("Failed to obtain revert data", "vm", vm.Name(), "err", err)
+			continue
+		}
+		names = append(names, vm.Name())
+		results = append(results, res)
+	}
+	if len(results) < 2 {
+		return
+	}
+	for _, diff := range evms.CompareRevertData(names, results) {
+		fmt.Fprintln(out, diff)
+	}
+}
+
 func TestSpeed(dir string, c *cli.Context) error {
 	vms := initVMs(c)
 	if len(vms) < 1 {
@@ -348,7 +668,7 @@ func TestSpeed(dir string, c *cli.Context) error {
 	infoThreshold := time.Second
 	warnThreshold := 5 * time.Second
 	speedTest := func(path string, info os.FileInfo, err error) error {
-		if !strings.HasSuffix(path, "json") {
+		if !strings.HasSuffix(path, "json") || IsProvenanceFile(path) {
 			return nil
 		}
 		if err != nil {
@@ -379,43 +699,299 @@ func TestSpeed(dir string, c *cli.Context) error {
 
 type TestProviderFn func(index, threadId int) (string, error)
 
-func testFnFromGenerator(fn GeneratorFn, name, location string) TestProviderFn {
+// maxGenerationFailures is the number of consecutive tests failing to convert
+// into blockchain tests, after which the generator is given up on.
+const maxGenerationFailures = 10
+
+// generatorMu serializes the generators, which draw from the global random
+// source.
+var generatorMu sync.Mutex
+
+// GenerateTest makes a test with the generator, from the given seed. The same
+// generator and seed always make the same test.
+func GenerateTest(fn GeneratorFn, seed int64) *fuzzing.GstMaker {
+	generatorMu.Lock()
+	defer generatorMu.Unlock()
+	rand.Seed(seed)
+	return fn()
+}
+
+// testFnFromGenerator returns a TestProviderFn which stores the tests made by
+// the generator, each along with its provenance.
+//
+// Each test is generated from a seed of its own (the next one after the given
+// seed), so that the seed recorded in the provenance regenerates the test
+// regardless of the other factory threads.
+func testFnFromGenerator(fn GeneratorFn, name, location string, blockTest bool, seed int64) TestProviderFn {
+	var counter atomic.Int64
 	return func(index, threadId int) (string, error) {
-		gstMaker := fn()
-		testName := fmt.Sprintf("%08d-%v-%d", index, name, threadId)
-		test := gstMaker.ToGeneralStateTest(testName)
-		return storeTest(location, test, testName)
+		var (
+			testSeed  int64
+			testName  string
+			generator string
+			fork      string
+			test      any
+		)
+		// A test which cannot be made into a blockchain test is skipped, in
+		// favour of the next one. Only if that keeps failing, the generator
+		// is considered broken.
+		for failures := 0; ; failures++ {
+			testSeed = seed + counter.Add(1)
+			gstMaker := GenerateTest(fn, testSeed)
+			generator, fork = gstMaker.Generator()
+			desc := gstMaker.Describe()
+			if desc == "" {
+				desc = name
+			}
+			testName = fmt.Sprintf("%08d-%v-%d", index, desc, threadId)
+			test = gstMaker.ToGeneralStateTest(testName)
+			if !blockTest {
+				break
+			}
+			bt, err := gstMaker.ToBlockchainTest(testName)
+			if err == nil {
+				test = bt
+				break
+			}
+			if failures+1 >= maxGenerationFailures {
+				return "", err
+			}
+			log.Warn("Failed making blockchain test, skipping", "seed", testSeed, "err", err)
+		}
+		path, err := storeTest(location, test, testName)
+		if err != nil {
+			return "", err
+		}
+		if err := storeProvenance(path, provenance{
+			Generator: generator,
+			Fork:      fork,
+			Seed:      testSeed,
+			Test:      testName,
+			BlockTest: blockTest,
+		}); err != nil {
+			os.Remove(path)
+			return "", err
+		}
+		return path, nil
 	}
 }
 
 type GeneratorFn func() *fuzzing.GstMaker
 
 func GenerateAndExecute(c *cli.Context, generatorFn GeneratorFn, name string) error {
-	fn := testFnFromGenerator(generatorFn, name, c.String(LocationFlag.Name))
+	seed := c.Int64(SeedFlag.Name)
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	log.Info("Seeding test generators", "seed", seed)
+	if path := c.String(DictFlag.Name); path != "" {
+		values, err := fuzzing.LoadDictionary(path)
+		if err != nil {
+			return err
+		}
+		fuzzing.SetDictionary(values)
+		log.Info("Loaded operand dictionary", "file", path, "values", len(values))
+	}
+	if names := c.StringSlice(OpcodesFlag.Name); len(names) > 0 {
+		list, err := fuzzing.ParseOpcodes(names)
+		if err != nil {
+			return err
+		}
+		fuzzing.SetOpcodeAllowlist(list)
+		log.Info("Restricted generated opcodes", "opcodes", names)
+	}
+	if dir := c.String(SeedCorpusFlag.Name); dir != "" {
+		files, err := corpusFiles(dir)
+		if err != nil {
+			return err
+		}
+		n, err := fuzzing.LoadSeedCorpus(files)
+		if err != nil {
+			return err
+		}
+		log.Info("Loaded seed corpus", "dir", dir, "tests", n)
+	}
+	location := c.String(LocationFlag.Name)
+	if dir := c.String(RamdiskFlag.Name); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		location = dir
+		log.Info("Writing tests to scratch directory", "dir", dir, "outdir", c.String(LocationFlag.Name))
+	}
+	fn := testFnFromGenerator(generatorFn, name, location, c.Bool(BlockTestFlag.Name), seed)
+	if n := c.Int(ValidateGeneratorFlag.Name); n > 0 {
+		return ValidateGenerator(c, fn, n)
+	}
 	return ExecuteFuzzer(c, false, fn, true)
 }
 
 func ExecuteFuzzer(c *cli.Context, allClients bool, providerFn TestProviderFn, cleanupFiles bool) error {
+	ignoreSigpipe()
 	var (
-		vms        = initVMs(c)
-		numThreads = c.Int(ThreadFlag.Name)
-		skipTrace  = c.Bool(SkipTraceFlag.Name)
-		numClients = 2
+		vms         = initVMs(c)
+		numThreads  = c.Int(ThreadFlag.Name)
+		skipTrace   = c.Bool(SkipTraceFlag.Name)
+		blockTest   = c.Bool(BlockTestFlag.Name)
+		compareMode = c.String(CompareModeFlag.Name)
+		numClients  = 2
 	)
+	switch compareMode {
+	case compareTrace, compareBoth:
+	case compareRoot:
+		skipTrace = true
+	default:
+		return fmt.Errorf("unknown compare mode %q", compareMode)
+	}
+	var maxDisk int64
+	if v := c.String(MaxDiskFlag.Name); v != "" {
+		size, err := parseDiskSize(v)
+		if err != nil {
+			return err
+		}
+		maxDisk = size
+	}
+	if blockTest {
+		var btVms []evms.Evm
+		for _, vm := range vms {
+			if _, ok := vm.(evms.BlockTester); ok {
+				btVms = append(btVms, vm)
+			} else {
+				log.Warn("Client does not support blockchain tests, skipping", "vm", vm.Name())
+			}
+		}
+		// Each test is waited upon until numClients results are in, so
+		// running with fewer would hang.
+		if len(btVms) < numClients {
+			return fmt.Errorf("need at least %d clients supporting blockchain tests, have %d", numClients, len(btVms))
+		}
+		vms = btVms
+	}
+	fullPostState := c.Bool(FullPostStateFlag.Name)
+	if fullPostState {
+		if blockTest {
+			return fmt.Errorf("full post-state comparison is not supported for blockchain tests")
+		}
+		for _, vm := range vms {
+			if _, ok := vm.(evms.StateDumper); !ok {
+				return fmt.Errorf("%v does not support dumping the post-state", vm.Name())
+			}
+		}
+		if len(vms) < 2 {
+			return fmt.Errorf("full post-state comparison needs at least two clients")
+		}
+	} else if dumpers := countStateDumpers(vms); dumpers < 2 && !blockTest {
+		log.Warn("Fewer than two clients can dump the post-state, it will not be compared when reporting a flaw", "count", dumpers)
+	}
+	compareAccessSet := c.Bool(CompareAccessSetFlag.Name)
+	if compareAccessSet {
+		if blockTest {
+			return fmt.Errorf("accessed set comparison is not supported for blockchain tests")
+		}
+		var reporters int
+		for _, vm := range vms {
+			if _, ok := vm.(evms.AccessSetReporter); ok {
+				reporters++
+			}
+		}
+		if reporters < 2 {
+			log.Warn("Fewer than two clients can report the accessed set, it will not be compared", "count", reporters)
+		}
+	}
+	compareRevertData := c.Bool(CompareRevertDataFlag.Name)
+	if compareRevertData {
+		if blockTest {
+			return fmt.Errorf("revert data comparison is not supported for blockchain tests")
+		}
+		var reporters int
+		for _, vm := range vms {
+			if _, ok := vm.(evms.RevertDataReporter); ok {
+				reporters++
+			}
+		}
+		if reporters < 2 {
+			log.Warn("Fewer than two clients can report the revert data, it will not be compared", "count", reporters)
+		}
+	}
 	if allClients {
 		numClients = len(vms)
 	}
 	if len(vms) == 0 {
 		return fmt.Errorf("need at least one vm to participate")
 	}
-	log.Info("Fuzzing started", "threads", numThreads)
+	advisory := make([]bool, len(vms))
+	for _, name := range c.StringSlice(AdvisoryEvmFlag.Name) {
+		var found bool
+		for i, vm := range vms {
+			if vm.Name() == name {
+				advisory[i] = true
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("unknown advisory vm %q", name)
+		}
+	}
+	if n := c.Int(GoMaxProcsFlag.Name); n > 0 {
+		runtime.GOMAXPROCS(n)
+	}
+	log.Info("Fuzzing started", "threads", numThreads, "gomaxprocs", runtime.GOMAXPROCS(0))
 	meta := &testMeta{
-		testCh:              make(chan string, 4), // channel where we'll deliver tests
-		consensusCh:         make(chan string, 4), // channel for signalling consensus errors
-		vms:                 vms,
-		deleteFilesWhenDone: cleanupFiles,
-		outdir:              c.String(LocationFlag.Name),
-		notifyTopic:         c.String(NotifyFlag.Name),
+		testCh:               make(chan string, 4), // channel where we'll deliver tests
+		consensusCh:          make(chan string, 4), // channel for signalling consensus errors
+		vms:                  vms,
+		advisory:             advisory,
+		blockTest:            blockTest,
+		compareSteps:         c.Int(CompareStepsFlag.Name),
+		compareRoot:          compareMode == compareBoth,
+		maxRate:              c.Int(MaxRateFlag.Name),
+		maxPending:           c.Int(MaxPendingFlag.Name),
+		maxDisk:              maxDisk,
+		deleteFilesWhenDone:  cleanupFiles,
+		outdir:               c.String(LocationFlag.Name),
+		scratchdir:           c.String(RamdiskFlag.Name),
+		notifyTopic:          c.String(NotifyFlag.Name),
+		onCrash:              c.String(OnCrashFlag.Name),
+		autoMinimize:         c.Bool(AutoMinimizeFlag.Name),
+		minimizeTimeout:      c.Duration(MinimizeTimeoutFlag.Name),
+		sortFields:           c.StringSlice(SortFieldsFlag.Name),
+		rawOutput:            c.Bool(RawOutputFlag.Name),
+		fullPostState:        fullPostState,
+		compareAccessSet:     compareAccessSet,
+		compareRevertData:    compareRevertData,
+		divergenceContext:    c.Int(VerboseDivergenceFlag.Name),
+		continueOnDivergence: c.Bool(ContinueOnDivergenceFlag.Name),
+		maxCrashers:          c.Int(MaxCrashersFlag.Name),
+		signatures:           make(map[string]bool),
+		divStats:             newDivergenceStats(),
+		duration:             c.Duration(DurationFlag.Name),
+		maxTests:             c.Int(MaxTestsFlag.Name),
+	}
+	if c.Bool(ShuffleEvmsFlag.Name) {
+		meta.shuffleRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	if url := c.String(WebhookFlag.Name); url != "" {
+		meta.webhook = newWebhook(url)
+	}
+	if path := c.String(CsvFlag.Name); path != "" {
+		var names []string
+		for _, vm := range vms {
+			names = append(names, vm.Name())
+		}
+		csvOut, err := newCSVLog(path, names)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := csvOut.Close(); err != nil {
+				log.Error("Error closing csv file", "err", err)
+			}
+		}()
+		meta.csv = csvOut
+	}
+	campaigns := c.String(CampaignsFlag.Name)
+	if campaigns != "" {
+		meta.campaign = newCampaignRecord(vms)
 	}
 	// Routines to deliver tests
 	meta.startTestFactories((numThreads+1)/2, providerFn)
@@ -425,19 +1001,35 @@ func ExecuteFuzzer(c *cli.Context, allClients bool, providerFn TestProviderFn, c
 		meta.fuzzingLoop(skipTrace, numClients)
 		cancel()
 	}()
+	if addr := c.String(PprofFlag.Name); addr != "" {
+		// The pipeline state is served at /debug/vars
+		expvar.Publish("pipeline", expvar.Func(func() any {
+			stats := meta.pipelineStats()
+			m := make(map[string]any)
+			for i := 0; i < len(stats); i += 2 {
+				m[stats[i].(string)] = stats[i+1]
+			}
+			return m
+		}))
+		startPprof(ctx, addr)
+	}
 	// One goroutine to spit out some statistics
 	meta.wg.Add(1)
 	go func() {
 		defer meta.wg.Done()
 		var (
-			tStart    = time.Now()
-			ticker    = time.NewTicker(8 * time.Second)
-			testCount = uint64(0)
-			ticks     = 0
+			tStart      = time.Now()
+			ticker      = time.NewTicker(8 * time.Second)
+			debugTicker = time.NewTicker(10 * time.Second)
+			testCount   = uint64(0)
+			ticks       = 0
 		)
 		defer ticker.Stop()
+		defer debugTicker.Stop()
 		for {
 			select {
+			case <-debugTicker.C:
+				log.Debug("Pipeline", meta.pipelineStats()...)
 			case <-ticker.C:
 				ticks++
 				n := meta.numTests.Load()
@@ -455,13 +1047,20 @@ func ExecuteFuzzer(c *cli.Context, allClients bool, providerFn TestProviderFn, c
 				if err := os.WriteFile(".fuzzcounter", []byte(fmt.Sprintf("%d", globalCount)), 0755); err != nil {
 					log.Error("Error saving progress", "err", err)
 				}
-				log.Info("Executing",
+				stats := []any{
 					"tests", n,
 					"time", common.PrettyDuration(timeSpent),
 					"test/s", fmt.Sprintf("%.01f", float64(uint64(time.Second)*n)/float64(timeSpent)),
 					"avg steps", fmt.Sprintf("%.01f", traceLengthSA.Avg()),
 					"global", globalCount,
-				)
+				}
+				if meta.maxRate > 0 {
+					stats = append(stats, "max test/s", meta.maxRate)
+				}
+				if meta.maxDisk > 0 {
+					stats = append(stats, "disk", meta.diskStats())
+				}
+				log.Info("Executing", stats...)
 				for _, vm := range vms {
 					log.Info(fmt.Sprintf("Stats %v", vm.Name()), vm.Stats()...)
 				}
@@ -484,17 +1083,49 @@ func ExecuteFuzzer(c *cli.Context, allClients bool, providerFn TestProviderFn, c
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
 	select {
 	case <-sigs:
+		log.Info("Shutting down, interrupt again (Ctrl-C) to force quit")
+		// A second signal means the operator is not willing to wait for a
+		// possibly wedged shutdown.
+		go func() {
+			<-sigs
+			log.Warn("Forced exit")
+			os.Exit(1)
+		}()
 	case <-ctx.Done():
 	}
 	log.Info("Waiting for processes to exit")
 	meta.abort.Store(true)
 	cancel()
 	meta.wg.Wait()
-	return nil
+	if meta.webhook != nil {
+		meta.webhook.wait()
+	}
+	if meta.campaign != nil {
+		if err := meta.campaign.appendTo(campaigns, meta.numTests.Load()); err != nil {
+			log.Error("Error saving campaign summary", "file", campaigns, "err", err)
+		}
+	}
+	return meta.fatalErr
+}
+
+// startPprof starts a pprof http server on the given address, which is shut
+// down when the context is cancelled.
+func startPprof(ctx context.Context, addr string) {
+	srv := &http.Server{Addr: addr}
+	go func() {
+		log.Info("Starting pprof server", "addr", fmt.Sprintf("http://%v/debug/pprof", addr))
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error("Failure in running pprof server", "err", err)
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		_ = srv.Close()
+	}()
 }
 
 // storeTest saves a testcase to disk
-func storeTest(location string, test *fuzzing.GeneralStateTest, testName string) (string, error) {
+func storeTest(location string, test any, testName string) (string, error) {
 	fileName := fmt.Sprintf("%v.json", testName)
 	fullPath := path.Join(location, fileName)
 
@@ -502,11 +1133,17 @@ func storeTest(location string, test *fuzzing.GeneralStateTest, testName string)
 	if err != nil {
 		return "", err
 	}
-	defer f.Close()
 	// Write to file
 	encoder := json.NewEncoder(f)
-	if err = encoder.Encode(test); err != nil {
-		return fullPath, err
+	if err = encoder.Encode(test); err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+	if err != nil {
+		// Don't leave a partial test behind
+		os.Remove(fullPath)
+		return "", err
 	}
 	return fullPath, nil
 }
@@ -533,23 +1170,163 @@ func Copy(src, dst string) error {
 	return out.Close()
 }
 
+// maxEmptyOutputs is the number of consecutive tests a client may fail to produce
+// any output for, before the run is aborted.
+const maxEmptyOutputs = 3
+
+// The values accepted by CompareModeFlag.
+const (
+	compareTrace = "trace"     // compare the trace output
+	compareRoot  = "stateroot" // compare the final stateroot only
+	compareBoth  = "both"      // compare the trace output, and always the stateroot
+)
+
 type testMeta struct {
 	abort       atomic.Bool
 	testCh      chan string
 	consensusCh chan string
 	wg          sync.WaitGroup
 	vms         []evms.Evm
+	advisory    []bool // per vm: whether its disagreement is only reported
 	numTests    atomic.Uint64
 	outdir      string
+	// scratchdir, if set, is the fast (RAM-backed) directory the tests are
+	// generated in. Tests which are kept are moved out to the outdir.
+	scratchdir  string
 	notifyTopic string
+	onCrash     string // command to run on consensus flaws
+	webhook     *webhook
+	// autoMinimize, if set, makes consensus flaws get minimized, spending at
+	// most minimizeTimeout on each.
+	autoMinimize    bool
+	minimizeTimeout time.Duration
+	sortFields      []string // output fields whose contents are sorted before comparison
+	rawOutput       bool     // whether to save the raw and normalized outputs of consensus flaws
+	fullPostState   bool     // whether to compare the full post-states as well
+	csv             *csvLog
+	blockTest       bool // whether the tests are blockchain tests
+	// compareAccessSet, if set, makes the accessed sets get compared across
+	// the clients which can report them.
+	compareAccessSet bool
+	// compareRevertData, if set, makes the return data of the outermost call
+	// get compared across the clients which can report it.
+	compareRevertData bool
+	// divergenceContext, if non-zero, is the number of output lines around
+	// the divergence to include in the report of a consensus flaw.
+	divergenceContext int
+	// shuffleRand, if set, randomizes the order in which the clients are
+	// handed the tests. It is a source of its own, as the global one is what
+	// the generators are seeded through: drawing from it would change the
+	// tests made from the seed.
+	shuffleRand *rand.Rand
+	shuffleMu   sync.Mutex
+	// compareSteps, if non-zero, limits the comparison to the first lines of output
+	compareSteps int
+	// compareRoot, if set, makes sure the final stateroot is compared even
+	// if the comparison is limited by compareSteps.
+	compareRoot bool
+	// maxRate, if non-zero, is the maximum number of tests executed per second
+	maxRate int
+	// continueOnDivergence, if set, makes consensus flaws not abort the run.
+	// The signatures of the flaws found are kept, to discard duplicates.
+	continueOnDivergence bool
+	maxCrashers          int
+	signatures           map[string]bool
+	divStats             *divergenceStats // the flaws found, by op
+	campaign             *campaignRecord  // summary of the run, if recorded
+	// duration and maxTests, if non-zero, limit the run.
+	duration time.Duration
+	maxTests int
+	// maxPending, if non-zero, is the maximum number of tests generated but
+	// not yet cleaned up, before the factories pause.
+	maxPending int
+	pending    atomic.Int64
+	// maxDisk, if non-zero, is the disk space in bytes the generated tests
+	// may take up. diskFiles holds the size of each test counted in diskUsage.
+	maxDisk   int64
+	diskUsage atomic.Int64
+	diskMu    sync.Mutex
+	diskFiles map[string]int64
+	// fatalErr is set by the fuzzing loop if the run was aborted due to a
+	// setup error, such as a vm binary going missing.
+	fatalErr error
 
 	deleteFilesWhenDone bool
+
+	liveFactories atomic.Int64 // number of running test factories
+	liveExecutors atomic.Int64 // number of running vm loops
+}
+
+// normalizer wraps the writer so that the configured fields are sorted, if
+// any. The returned function must be called when the output is complete.
+func (meta *testMeta) normalizer(out io.Writer) (io.Writer, func()) {
+	if len(meta.sortFields) == 0 {
+		return out, func() {}
+	}
+	sorter := evms.NewFieldSorter(out, meta.sortFields)
+	return sorter, func() {
+		if err := sorter.Flush(); err != nil {
+			log.Error("Failed writing output", "err", err)
+		}
+	}
+}
+
+// pipelineStats returns the state of the test pipeline, for diagnosing
+// stalls: a full test channel means the executors are not keeping up (or are
+// stuck), an empty one means the factories are.
+func (meta *testMeta) pipelineStats() []any {
+	return []any{
+		"queued", len(meta.testCh),
+		"capacity", cap(meta.testCh),
+		"factories", meta.liveFactories.Load(),
+		"pending", meta.pending.Load(),
+		"disk", common.StorageSize(meta.diskUsage.Load()),
+		"executors", meta.liveExecutors.Load(),
+		"abort", meta.abort.Load(),
+	}
+}
+
+// executionOrder returns the order in which n clients are executed: as
+// given, or shuffled if so configured.
+func (meta *testMeta) executionOrder(n int) []int {
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	meta.shuffle(n, func(i, j int) { order[i], order[j] = order[j], order[i] })
+	return order
+}
+
+// shuffle randomizes the order of n elements, if so configured.
+func (meta *testMeta) shuffle(n int, swap func(i, j int)) {
+	if meta.shuffleRand == nil {
+		return
+	}
+	meta.shuffleMu.Lock()
+	defer meta.shuffleMu.Unlock()
+	meta.shuffleRand.Shuffle(n, swap)
+}
+
+// backlogPollInterval is how often a paused test factory checks whether the
+// backlog has shrunk.
+var backlogPollInterval = 100 * time.Millisecond
+
+// waitForBacklog blocks while the number of pending tests is at the maximum,
+// or until the run is aborted.
+func (meta *testMeta) waitForBacklog() {
+	if meta.maxPending == 0 || meta.pending.Load() < int64(meta.maxPending) {
+		return
+	}
+	log.Debug("Test backlog full, pausing generation", "pending", meta.pending.Load())
+	for meta.pending.Load() >= int64(meta.maxPending) && !meta.abort.Load() {
+		time.Sleep(backlogPollInterval)
+	}
 }
 
 // startTestFactories creates a number of go-routines that write tests to disk, and delivers
 // the paths on the testCh.
 func (meta *testMeta) startTestFactories(numFactories int, providerFn TestProviderFn) {
-	var factories atomic.Int64
+	factories := &meta.liveFactories
 	factories.Add(int64(numFactories))
 	meta.wg.Add(numFactories)
 	factory := func(threadId int) {
@@ -562,8 +1339,29 @@ func (meta *testMeta) startTestFactories(numFactories int, providerFn TestProvid
 			}
 			meta.wg.Done()
 		}()
+		var paused bool
 		for i := 0; !meta.abort.Load(); i++ {
+			meta.waitForBacklog()
+			meta.waitForDiskBudget()
+			if meta.abort.Load() {
+				break
+			}
 			fileName, err := providerFn(i, threadId)
+			if isDiskFull(err) {
+				// Wait for the executed tests to be cleaned up, and retry
+				if !paused {
+					log.Warn("Disk full, pausing test generation until space frees up",
+						"dir", meta.outdir, "retry", diskFullRetryInterval, "err", err)
+					paused = true
+				}
+				time.Sleep(diskFullRetryInterval)
+				i--
+				continue
+			}
+			if paused {
+				log.Info("Disk space available, resuming test generation")
+				paused = false
+			}
 			if err == io.EOF {
 				log.Info("Test provider done, exiting")
 				break
@@ -572,7 +1370,9 @@ func (meta *testMeta) startTestFactories(numFactories int, providerFn TestProvid
 				log.Error("Error generating test, exiting", "err", err)
 				break
 			}
+			meta.trackTest(fileName)
 			log.Trace("Shipping a test", "file", fileName)
+			meta.pending.Add(1)
 			meta.testCh <- fileName
 		}
 	}
@@ -592,42 +1392,118 @@ type task struct {
 	execSpeed time.Duration
 	slow      bool   // set by the executor if the test is deemed slow.
 	result    []byte // result is the md5 hash of the execution output
+	accessSet []byte // accessSet is the hash of the accessed set, if reported
+	revert    []byte // revert is the hash of the outermost call outcome, if reported
 	nLines    int    // number of lines of output
+	empty     bool   // set if the vm produced no output
+	exhausted bool   // set if the vm was killed due to the resource limits
 	command   string // command used to execute the test
 	err       error  // if error occurred
 }
 
+// lineCountingHasher hashes the data written to it, and counts the number of
+// lines. If maxLines is non-zero, only the first maxLines lines are hashed.
 type lineCountingHasher struct {
-	h     hash.Hash
-	lines int
+	h        hash.Hash
+	lines    int
+	maxLines int
+	head     []byte // the first few bytes written, to detect empty outputs
+	size     int    // the total number of bytes written
+	keepLast bool   // whether the last line is hashed, even beyond maxLines
+	tail     []byte // the last few bytes written, if keepLast is set
 }
 
-func newLineCountingHasher() *lineCountingHasher {
-	return &lineCountingHasher{md5.New(), 0}
+func newLineCountingHasher(maxLines int, keepLast bool) *lineCountingHasher {
+	return &lineCountingHasher{h: md5.New(), maxLines: maxLines, keepLast: keepLast}
+}
+
+// sum returns the hash of the output. If keepLast is set, and the last line
+// was not hashed due to maxLines, it is included.
+func (l *lineCountingHasher) sum() []byte {
+	if !l.keepLast || l.maxLines == 0 || l.lines <= l.maxLines {
+		return l.h.Sum(nil)
+	}
+	last := bytes.TrimRight(l.tail, "\n")
+	if i := bytes.LastIndexByte(last, '\n'); i >= 0 {
+		last = last[i+1:]
+	}
+	h := md5.New()
+	h.Write(l.h.Sum(nil))
+	h.Write(last)
+	return h.Sum(nil)
+}
+
+// empty returns whether the output written so far is empty.
+func (l *lineCountingHasher) empty() bool {
+	return l.size <= cap(l.head) && evms.IsEmptyOutput(l.head)
 }
 
 func (l *lineCountingHasher) Write(p []byte) (n int, err error) {
-	var count int
-	for _, c := range p {
-		if c == '\n' {
-			count++
+	if l.head == nil {
+		l.head = make([]byte, 0, 64)
+	}
+	if room := cap(l.head) - len(l.head); room > 0 {
+		if room > len(p) {
+			room = len(p)
 		}
+		l.head = append(l.head, p[:room]...)
+	}
+	l.size += len(p)
+	if l.keepLast {
+		// The stateroot line is short, so the last 256 bytes suffice.
+		l.tail = append(l.tail, p...)
+		if len(l.tail) > 256 {
+			l.tail = append(l.tail[:0], l.tail[len(l.tail)-256:]...)
+		}
+	}
+	end := len(p)
+	if l.maxLines > 0 && l.lines >= l.maxLines {
+		end = 0 // limit already reached
 	}
-	l.lines += count
-	return l.h.Write(p)
+	for i, c := range p {
+		if c != '\n' {
+			continue
+		}
+		l.lines++
+		if l.lines == l.maxLines {
+			end = i + 1
+		}
+	}
+	if _, err := l.h.Write(p[:end]); err != nil {
+		return 0, err
+	}
+	return len(p), nil
 }
 
 func (l *lineCountingHasher) Reset() {
 	l.h.Reset()
 	l.lines = 0
+	l.head = l.head[:0]
+	l.size = 0
+	l.tail = l.tail[:0]
 }
 
 func (meta *testMeta) vmLoop(evm evms.Evm, taskCh, resultCh chan *task) {
 	defer meta.wg.Done()
-	var hasher = newLineCountingHasher()
+	meta.liveExecutors.Add(1)
+	defer meta.liveExecutors.Add(-1)
+	var hasher = newLineCountingHasher(meta.compareSteps, meta.compareRoot)
 	for t := range taskCh {
 		hasher.Reset()
-		res, err := evm.RunStateTest(t.file, hasher, t.skipTrace)
+		run := evm.RunStateTest
+		if meta.blockTest {
+			run = evm.(evms.BlockTester).RunBlockTest
+		}
+		out, flush := meta.normalizer(hasher)
+		res, err := run(t.file, out, t.skipTrace)
+		flush()
+		if errors.Is(err, evms.ErrResourceExhausted) {
+			log.Warn("Resource limits exceeded", "evm", evm.Name(), "file", t.file, "err", err)
+			t.exhausted = true
+			t.command = res.Cmd
+			resultCh <- t
+			continue
+		}
 		if err != nil {
 			log.Error("Error starting vm", "err", err, "evm", evm.Name())
 			t.err = fmt.Errorf("error starting vm %v: %w", evm.Name(), err)
@@ -639,8 +1515,38 @@ func (meta *testMeta) vmLoop(evm evms.Evm, taskCh, resultCh chan *task) {
 			log.Warn("Slow test found", "evm", evm.Name(), "time", res.ExecTime, "cmd", res.Cmd, "file", t.file)
 		}
 		t.slow = res.Slow
-		t.result = hasher.h.Sum(nil)
+		t.result = hasher.sum()
+		if meta.fullPostState {
+			post, err := evm.(evms.StateDumper).DumpPostState(t.file)
+			if err != nil {
+				log.Error("Error dumping post-state", "err", err, "evm", evm.Name())
+				t.err = fmt.Errorf("error dumping post-state on %v: %w", evm.Name(), err)
+				resultCh <- t
+				continue
+			}
+			postHash := post.Hash()
+			t.result = append(t.result, postHash[:]...)
+		}
+		if reporter, ok := evm.(evms.AccessSetReporter); ok && meta.compareAccessSet {
+			// Clients which cannot report it are not compared, so a failure
+			// just skips the check
+			if set, err := reporter.AccessSet(t.file); err != nil {
+				log.Warn("Error obtaining accessed set", "err", err, "evm", evm.Name())
+			} else {
+				setHash := set.Hash()
+				t.accessSet = setHash[:]
+			}
+		}
+		if reporter, ok := evm.(evms.RevertDataReporter); ok && meta.compareRevertData {
+			if res, err := reporter.RevertData(t.file); err != nil {
+				log.Warn("Error obtaining revert data", "err", err, "evm", evm.Name())
+			} else {
+				revertHash := res.Hash()
+				t.revert = revertHash[:]
+			}
+		}
 		t.nLines = hasher.lines
+		t.empty = hasher.empty()
 		t.command = res.Cmd
 		t.execSpeed = res.ExecTime
 		// Send back
@@ -650,69 +1556,322 @@ func (meta *testMeta) vmLoop(evm evms.Evm, taskCh, resultCh chan *task) {
 }
 
 type cleanTask struct {
-	slow   string // path to a file considered 'slow'
-	remove string // path to a file to be removed
+	slow      string // path to a file considered 'slow'
+	exhausted string // path to a file which exceeded the resource limits
+	remove    string // path to a file to be removed
 }
 
 func (meta *testMeta) cleanupLoop(cleanCh chan *cleanTask) {
 	defer meta.wg.Done()
 	for task := range cleanCh {
-		if path := task.slow; path != "" {
-			newPath := filepath.Join(filepath.Dir(path), fmt.Sprintf("slowtest-%v", filepath.Base(path)))
-			if err := Copy(path, newPath); err != nil {
+		// Close to the disk budget, only tests which are needed are kept
+		keep := !meta.diskTight()
+		if path := task.slow; path != "" && keep {
+			newPath := filepath.Join(meta.durableDir(path), fmt.Sprintf("slowtest-%v", filepath.Base(path)))
+			if err := copyTest(path, newPath); err != nil {
 				log.Error("Error copying file", "file", path, "err", err)
 			}
+			if !meta.inScratch(path) {
+				meta.trackTest(newPath)
+			}
+		}
+		if path := task.slow; path != "" && !keep && meta.deleteFilesWhenDone {
+			task.remove = path
+		}
+		if path := task.exhausted; path != "" && keep {
+			newPath := filepath.Join(meta.durableDir(path), fmt.Sprintf("exhausted-%v", filepath.Base(path)))
+			if err := copyTest(path, newPath); err != nil {
+				log.Error("Error copying file", "file", path, "err", err)
+			}
+			if !meta.inScratch(path) {
+				meta.trackTest(newPath)
+			}
 		}
 		if path := task.remove; path != "" && meta.deleteFilesWhenDone {
-			if err := os.Remove(path); err != nil {
+			// Consensus flaws may have been moved out of the scratch directory
+			if err := meta.removeTrackedTest(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
 				log.Error("Error deleting file", "file", path, "err", err)
 			}
 		}
+		// Only count the test as done once its files are gone, so that a
+		// paused generation sees the disk usage it leaves behind.
+		meta.pending.Add(-1)
 	}
 	log.Debug("CleanupLoop exiting")
 }
 
-func (meta *testMeta) handleConsensusFlaw(testfile string) {
+// handleConsensusFlaw investigates and reports the consensus flaw. When
+// continuing on divergences, flaws with an already seen signature are not
+// reported, and their outputs are removed. It returns whether the flaw was
+// reported.
+func (meta *testMeta) handleConsensusFlaw(testfile string) bool {
+	// Consensus flaws are exempt from the disk budget
+	meta.untrackTest(testfile)
+	var (
+		promoted bool
+		scratch  = testfile // the path the test was executed, and is known by, at
+	)
+	if path, err := meta.promoteTest(testfile); err != nil {
+		log.Error("Failed moving test out of the scratch directory", "file", testfile, "err", err)
+	} else {
+		promoted = path != testfile
+		testfile = path
+	}
 	output := new(strings.Builder)
 	fmt.Fprintf(output, "Consensus error\n")
 	fmt.Fprintf(output, "Testcase: %v\n", testfile)
-	var readers []io.Reader
-	var diffargs []string
-	for _, evm := range meta.vms {
+	var (
+		readers       = make([]io.Reader, len(meta.vms))
+		diffargs      = make([]string, len(meta.vms))
+		clientDetails = make([]string, len(meta.vms)) // per client, the lines of the report
+		report        = &crashReport{Testfile: testfile, Clients: make([]crashClient, len(meta.vms))}
+	)
+	// The clients are executed in order, unless shuffled, but reported in order
+	for _, i := range meta.executionOrder(len(meta.vms)) {
+		var (
+			evm     = meta.vms[i]
+			details = new(strings.Builder)
+		)
 		filename := fmt.Sprintf("%v/%v-output.jsonl", meta.outdir, evm.Name())
+		if meta.continueOnDivergence {
+			// Keep the outputs of each flaw
+			filename = fmt.Sprintf("%v/%v-%v-output.jsonl", meta.outdir,
+				strings.TrimSuffix(filepath.Base(testfile), ".json"), evm.Name())
+		}
 		out, err := os.OpenFile(filename, os.O_CREATE|os.O_RDWR, 0755)
+		if isDiskFull(err) {
+			// Saving the flaw takes priority over the queued tests
+			log.Warn("Disk full, deleting queued tests to save the consensus flaw", "err", err)
+			meta.freeQueuedTests()
+			out, err = os.OpenFile(filename, os.O_CREATE|os.O_RDWR, 0755)
+		}
 		if err != nil {
 			log.Error("Failed opening file", "err", err)
 			panic(err)
 		}
-		res, err := evm.RunStateTest(testfile, out, false)
+		run := evm.RunStateTest
+		if meta.blockTest {
+			run = evm.(evms.BlockTester).RunBlockTest
+		}
+		w, flush := meta.normalizer(out)
+		res, err := run(testfile, w, false)
+		flush()
 		if err != nil {
 			log.Error("Failed running vm", "err", err)
 			panic(err)
 		}
-		fmt.Fprintf(output, "- %v: %v\n", evm.Name(), filename)
-		fmt.Fprintf(output, "  - command: %v\n", res.Cmd)
-		diffargs = append(diffargs, filename)
+		fmt.Fprintf(details, "- %v: %v\n", evm.Name(), filename)
+		fmt.Fprintf(details, "  - command: %v\n", res.Cmd)
+		if len(res.Stderr) > 0 {
+			stderrFile := strings.TrimSuffix(filename, ".jsonl") + ".stderr"
+			if err := os.WriteFile(stderrFile, res.Stderr, 0644); err != nil {
+				log.Error("Failed writing stderr", "err", err)
+			} else {
+				fmt.Fprintf(details, "  - stderr: %v\n", stderrFile)
+			}
+		}
+		clientDetails[i] = details.String()
+		diffargs[i] = filename
+		report.Clients[i] = crashClient{evm.Name(), filename, res.Cmd}
 		_ = out.Sync()
 		_, _ = out.Seek(0, 0)
-		readers = append(readers, out)
+		readers[i] = out
+	}
+	for _, d := range clientDetails {
+		fmt.Fprint(output, d)
 	}
 	fmt.Fprintf(output, "\nTo view the difference with tracediff:\n\ttracediff %v %v\n", diffargs[0], diffargs[1])
 
 	// Compare outputs (and show diff)
-	_, _, diff := evms.CompareFiles(meta.vms, readers)
+	// The advisory clients are shown, but not compared
+	var (
+		cmpVMs     []evms.Evm
+		cmpReaders []io.Reader
+	)
+	for i, vm := range meta.vms {
+		if meta.advisory[i] {
+			fmt.Fprintf(output, "Note: %v is advisory, its output is not compared\n", vm.Name())
+			continue
+		}
+		cmpVMs = append(cmpVMs, vm)
+		cmpReaders = append(cmpReaders, readers[i])
+	}
+	div, count, diff := evms.CompareFilesDivergence(cmpVMs, cmpReaders, meta.compareSteps)
+	if meta.csv != nil {
+		var pc string
+		if div != nil {
+			pc = div.Pc
+		}
+		meta.csv.release(scratch, testfile, pc)
+	}
 	fmt.Fprint(output, diff)
-	fmt.Println(output.String())
+	report.Diff = diff
+	if div != nil {
+		report.Signature = div.Signature()
+		fmt.Fprintf(output, "Signature: %v\n", report.Signature)
+	}
+	if div != nil {
+		meta.divStats.add(div, !meta.signatures[report.Signature])
+		if meta.campaign != nil {
+			meta.campaign.addFlaw(div)
+		}
+	}
+	if meta.continueOnDivergence && report.Signature != "" {
+		if meta.signatures[report.Signature] {
+			log.Info("Discarding duplicate consensus flaw", "file", testfile, "signature", report.Signature)
+			for i, f := range readers {
+				f.(*os.File).Close()
+				os.Remove(report.Clients[i].Output)
+			}
+			if promoted {
+				removeTest(testfile)
+			}
+			return false
+		}
+		meta.signatures[report.Signature] = true
+	}
+	if div == nil && meta.compareRoot {
+		fmt.Fprintf(output, "The first %d lines are identical, the difference is in the final stateroot\n", count)
+	}
+	if div != nil && meta.divergenceContext > 0 {
+		var (
+			verbose = new(strings.Builder)
+			names   []string
+			files   []string
+		)
+		for i, vm := range meta.vms {
+			if !meta.advisory[i] {
+				names = append(names, vm.Name())
+				files = append(files, report.Clients[i].Output)
+			}
+		}
+		lines := writeDivergenceContext(verbose, names, files, count, meta.divergenceContext)
+		if !meta.blockTest {
+			if err := writeTestContext(verbose, testfile, lines); err != nil {
+				log.Warn("Failed reading test", "file", testfile, "err", err)
+			}
+		}
+		fmt.Fprint(output, verbose.String())
+		report.Context = verbose.String()
+	}
+	if !meta.blockTest {
+		comparePostStates(meta.vms, testfile, output)
+	}
+	if meta.compareAccessSet {
+		compareAccessSets(meta.vms, testfile, output)
+	}
+	if meta.compareRevertData {
+		compareRevertData(meta.vms, testfile, output)
+	}
+	fmt.Fprintln(stdout, output.String())
 	if meta.notifyTopic != "" {
 		if _, err := http.Post(fmt.Sprintf("https://ntfy.sh/%v", meta.notifyTopic), "text/plain",
 			strings.NewReader(output.String())); err != nil {
-			fmt.Printf("Failed to post notification: %v\n", err)
+			log.Warn("Failed to post notification", "err", err)
 		}
 	}
 
+	if meta.autoMinimize {
+		report.Minimized = meta.minimize(testfile)
+	}
+	if err := writeReproScript(testfile, report.Clients, meta.vms); err != nil {
+		log.Error("Failed writing reproducer script", "err", err)
+	} else {
+		log.Info("Wrote reproducer script", "file", reproPath(testfile))
+	}
+	if meta.rawOutput {
+		writeClientOutputs(testfile, report.Clients, meta.vms)
+	}
+	if meta.webhook != nil {
+		meta.webhook.notify(newWebhookPayload(report, div, meta.vms))
+	}
+	if meta.onCrash != "" {
+		runCrashHook(meta.onCrash, report)
+	}
 	for _, f := range readers {
 		f.(*os.File).Close()
 	}
+	return true
+}
+
+// crashReport is the divergence metadata passed to the crash hook.
+type crashReport struct {
+	Testfile string        `json:"testfile"`
+	Clients  []crashClient `json:"clients"`
+	Diff     string        `json:"diff"`
+	// Signature identifies the divergence point, for deduplicating flaws
+	// found by different tests.
+	Signature string `json:"signature,omitempty"`
+	// Minimized is the path to the minimized test, if minimization succeeded.
+	Minimized string `json:"minimized,omitempty"`
+	// Context is the output around the divergence, along with the relevant
+	// parts of the test, if requested with --verbose-divergence.
+	Context string `json:"context,omitempty"`
+}
+
+// minimize shrinks the test, within the time budget, and returns the path to
+// the minimized test. If the test cannot be minimized, it returns the empty
+// string.
+func (meta *testMeta) minimize(testfile string) string {
+	if meta.blockTest {
+		log.Warn("Minimizing blockchain tests is not supported", "file", testfile)
+		return ""
+	}
+	// The advisory clients are not part of the consensus
+	var vms []evms.Evm
+	for i, vm := range meta.vms {
+		if !meta.advisory[i] {
+			vms = append(vms, vm)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), meta.minimizeTimeout)
+	defer cancel()
+	log.Info("Minimizing test", "file", testfile, "timeout", meta.minimizeTimeout)
+	minimized, err := fuzzing.Minimize(ctx, testfile, func(path string) (bool, error) {
+		agree, err := rootsEqual(vms, path)
+		// An error here might mean that e.g the gas was changed so that the
+		// tx is invalid. Report it as 'agree', so the change is reverted.
+		if err != nil {
+			return true, nil
+		}
+		return agree, nil
+	})
+	if err != nil {
+		log.Warn("Failed to minimize test", "file", testfile, "err", err)
+		return ""
+	}
+	log.Info("Minimized test", "file", minimized)
+	return minimized
+}
+
+type crashClient struct {
+	Name    string `json:"name"`
+	Output  string `json:"output"`  // file containing the output of the client
+	Command string `json:"command"` // command used to execute the test
+}
+
+// crashHookTimeout is how long the crash hook may run before it is killed.
+const crashHookTimeout = 5 * time.Minute
+
+// runCrashHook executes the user-supplied command with the test path as
+// argument and the report on stdin. Failures are logged, but otherwise
+// ignored: the hook must not take down the fuzzer.
+func runCrashHook(command string, report *crashReport) {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		log.Error("Failed encoding crash report", "err", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), crashHookTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", command+` "$1"`, "sh", report.Testfile)
+	cmd.Stdin = bytes.NewReader(data)
+	log.Info("Running crash hook", "cmd", command)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		log.Error("Crash hook failed", "err", err, "output", string(out))
+	} else {
+		log.Info("Crash hook done", "output", string(out))
+	}
 }
 
 func (meta *testMeta) fuzzingLoop(skipTrace bool, clientCount int) {
@@ -737,47 +1896,158 @@ func (meta *testMeta) fuzzingLoop(skipTrace bool, clientCount int) {
 	meta.wg.Add(1)
 	go meta.cleanupLoop(cleanCh)
 
+	var limiter *utils.TokenBucket
+	if meta.maxRate > 0 {
+		log.Info("Limiting execution rate", "tests/s", meta.maxRate)
+		limiter = utils.NewTokenBucket(float64(meta.maxRate), meta.maxRate)
+	}
+
 	type execResult struct {
 		hash          []byte // hash of the output
+		accessSet     []byte // hash of the first accessed set reported
+		revert        []byte // hash of the first outermost call outcome reported
 		slow          bool   // whether it was considered slow
 		consensusFlaw bool   // whether it triggered a consensus flaw
+		empty         bool   // whether any client produced no output
+		exhausted     bool   // whether any client exceeded the resource limits
 		waiting       int    // the number of clients we're waiting the results from
+
+		durations map[int]time.Duration // execution time per client
+		advisory  map[int][]byte        // results of the advisory clients
+	}
+	// outcome describes the result of a test, for the csv log
+	outcome := func(r *execResult) string {
+		switch {
+		case r.consensusFlaw:
+			return "divergent"
+		case r.exhausted:
+			return "exhausted"
+		case r.empty:
+			return "empty"
+		case r.slow:
+			return "slow"
+		}
+		return "equal"
 	}
-	var executing = make(map[string]*execResult)
+	var (
+		executing   = make(map[string]*execResult)
+		emptyStreak = make([]int, len(meta.vms)) // consecutive empty outputs per client
+		flaws       []string                     // consensus flaws to handle, when continuing on divergences
+		start       = time.Now()
+	)
 	readResults := func(count int) {
 		for i := 0; i < count; i++ {
 			t := <-resultCh                // result delivery
 			ready = append(ready, t.vmIdx) // add client to ready-set
-			if t.err != nil {
+			if t.err != nil && !meta.advisory[t.vmIdx] {
 				log.Error("Error", "err", t.err)
+				if errors.Is(t.err, evms.ErrBinaryMissing) {
+					meta.fatalErr = t.err
+				}
 				meta.abort.Store(true)
 				continue
 			}
 			execRs := executing[t.file]
 			execRs.waiting--
+			execRs.durations[t.vmIdx] = t.execSpeed
 
 			if t.slow {
 				execRs.slow = true
 			}
-			// check results
-			if execRs.hash == nil { // first
-				execRs.hash = t.result
-			}
-			if !bytes.Equal(execRs.hash, t.result) {
-				log.Info("Consensus flaw", "file", t.file)
-				execRs.consensusFlaw = true
+			if meta.advisory[t.vmIdx] {
+				// Checked once the others are done. The failures of an advisory
+				// client are only logged, they neither affect the outcome of the
+				// test nor abort the run.
+				switch {
+				case t.err != nil:
+					log.Warn("Advisory client failed", "evm", meta.vms[t.vmIdx].Name(), "file", t.file, "err", t.err)
+				case t.exhausted:
+					log.Warn("Advisory client exceeded the resource limits", "evm", meta.vms[t.vmIdx].Name(), "file", t.file)
+				case t.empty:
+					log.Warn("Advisory client produced no output", "evm", meta.vms[t.vmIdx].Name(), "file", t.file)
+				default:
+					if execRs.advisory == nil {
+						execRs.advisory = make(map[int][]byte)
+					}
+					execRs.advisory[t.vmIdx] = t.result
+				}
+			} else if t.exhausted {
+				// The output is incomplete, so there's nothing to compare.
+				execRs.exhausted = true
+			} else {
+				// A client which produces no output at all may have crashed on
+				// the test: the output is compared (and the flaw reported) like
+				// any other. If it keeps happening, though, the client is
+				// likely broken, and we'd better stop.
+				if t.empty {
+					execRs.empty = true
+					emptyStreak[t.vmIdx]++
+					if emptyStreak[t.vmIdx] == maxEmptyOutputs {
+						name := meta.vms[t.vmIdx].Name()
+						meta.fatalErr = fmt.Errorf("%v produced no output for %d consecutive tests, "+
+							"the binary may be missing or broken", name, maxEmptyOutputs)
+						log.Error("Aborting", "err", meta.fatalErr)
+						meta.abort.Store(true)
+					}
+				} else {
+					emptyStreak[t.vmIdx] = 0
+				}
+				// check results
+				if execRs.hash == nil { // first
+					execRs.hash = t.result
+				}
+				if !bytes.Equal(execRs.hash, t.result) {
+					log.Info("Consensus flaw", "file", t.file)
+					execRs.consensusFlaw = true
+				}
+				if t.accessSet != nil {
+					if execRs.accessSet == nil {
+						execRs.accessSet = t.accessSet
+					} else if !bytes.Equal(execRs.accessSet, t.accessSet) {
+						log.Info("Consensus flaw in accessed set", "file", t.file)
+						execRs.consensusFlaw = true
+					}
+				}
+				if t.revert != nil {
+					if execRs.revert == nil {
+						execRs.revert = t.revert
+					} else if !bytes.Equal(execRs.revert, t.revert) {
+						log.Info("Consensus flaw in revert data", "file", t.file)
+						execRs.consensusFlaw = true
+					}
+				}
 			}
 			if execRs.waiting > 0 {
 				continue
 			}
+			for vmIdx, result := range execRs.advisory {
+				if execRs.hash != nil && !bytes.Equal(execRs.hash, result) {
+					log.Warn("Advisory client disagrees", "evm", meta.vms[vmIdx].Name(), "file", t.file)
+				}
+			}
 			traceLengthSA.Add(t.nLines)
 			// No more results in the pipeline
 			delete(executing, t.file)
 			meta.numTests.Add(1)
+			if meta.csv != nil && execRs.consensusFlaw {
+				// The diverging pc is known once the flaw is investigated
+				meta.csv.hold(t.file, execRs.durations, outcome(execRs), t.nLines)
+			} else if meta.csv != nil {
+				meta.csv.add(t.file, execRs.durations, outcome(execRs), t.nLines)
+			}
 			switch {
+			case execRs.consensusFlaw && meta.continueOnDivergence:
+				// Handled once the clients are idle
+				flaws = append(flaws, t.file)
 			case execRs.consensusFlaw:
 				meta.consensusCh <- t.file
 				meta.abort.Store(true)
+			case execRs.exhausted:
+				cleanCh <- &cleanTask{exhausted: t.file, remove: t.file}
+			case execRs.empty:
+				// Not a flaw, so none of the clients produced any output
+				log.Warn("Clients produced no output, skipping test", "file", t.file)
+				cleanCh <- &cleanTask{remove: t.file}
 			case execRs.slow:
 				cleanCh <- &cleanTask{slow: t.file}
 			default:
@@ -785,19 +2055,55 @@ func (meta *testMeta) fuzzingLoop(skipTrace bool, clientCount int) {
 			}
 		}
 	}
+	// handleFlaws handles the consensus flaws found so far. The flaws are
+	// executed once more on the clients, so that has to wait until they are
+	// all idle.
+	handleFlaws := func() {
+		for len(flaws) > 0 {
+			if len(ready) < len(meta.vms) {
+				readResults(len(meta.vms) - len(ready))
+				continue
+			}
+			file := flaws[0]
+			flaws = flaws[1:]
+			if meta.handleConsensusFlaw(file) {
+				// Keep the test, but count it as done
+				cleanCh <- &cleanTask{}
+			} else {
+				cleanCh <- &cleanTask{remove: file}
+			}
+			if meta.maxCrashers > 0 && len(meta.signatures) >= meta.maxCrashers && !meta.abort.Load() {
+				log.Info("Maximum number of consensus flaws found, stopping", "count", len(meta.signatures))
+				meta.abort.Store(true)
+			}
+		}
+	}
 	for testfile := range meta.testCh {
 		testIndex++
 		// First, make sure we have N clients to execute the test on
 		if clientsNeeded := clientCount - len(ready); clientsNeeded > 0 {
 			readResults(clientsNeeded)
 		}
+		handleFlaws()
+		if !meta.abort.Load() && (meta.duration > 0 && time.Since(start) >= meta.duration ||
+			meta.maxTests > 0 && meta.numTests.Load() >= uint64(meta.maxTests)) {
+			log.Info("Test budget spent, stopping", "tests", meta.numTests.Load(), "time", time.Since(start))
+			meta.abort.Store(true)
+		}
 		if meta.abort.Load() {
 			log.Info("Shortcutting through abort")
 			continue
 		}
+		if limiter != nil {
+			limiter.Wait()
+		}
 		// Dispatch the testfile to the ready clients
 		log.Trace("Dispatching test to clients", "count", clientCount)
-		executing[testfile] = &execResult{waiting: clientCount}
+		executing[testfile] = &execResult{
+			waiting:   clientCount,
+			durations: make(map[int]time.Duration),
+		}
+		meta.shuffle(len(ready), func(i, j int) { ready[i], ready[j] = ready[j], ready[i] })
 		for i := 0; i < clientCount; i++ {
 			id := ready[0]
 			taskChannels[id] <- &task{
@@ -817,6 +2123,7 @@ func (meta *testMeta) fuzzingLoop(skipTrace bool, clientCount int) {
 	for len(ready) < len(meta.vms) {
 		readResults(len(meta.vms) - len(ready))
 	}
+	handleFlaws()
 	log.Debug("Fuzzing loop exiting")
 	// We might have a consensus issue to investigate
 	select {
@@ -824,6 +2131,14 @@ func (meta *testMeta) fuzzingLoop(skipTrace bool, clientCount int) {
 		meta.handleConsensusFlaw(testfile)
 	default:
 	}
+	if meta.continueOnDivergence {
+		log.Info("Distinct consensus flaws found", "count", len(meta.signatures))
+	}
+	// The flaws are reported whether the run went on past them or not
+	if meta.divStats.count > 0 {
+		fmt.Fprintln(stdout, "Consensus flaws by op at the diverging step:")
+		meta.divStats.report(stdout)
+	}
 }
 
 // ConvertToStateTest is a utility to turn stuff into sharable state tests.
@@ -879,6 +2194,6 @@ func ConvertToStateTest(name, fork string, alloc types.GenesisAlloc, gasLimit ui
 	if err := os.WriteFile(fname, dat, 0777); err != nil {
 		return err
 	}
-	fmt.Printf("Wrote file %v\n", fname)
+	log.Info("Wrote file", "file", fname)
 	return nil
 }
@@ -0,0 +1,257 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/holiman/goevmlab/evms"
+	"github.com/holiman/goevmlab/fuzzing"
+)
+
+func TestFactoryMaxPending(t *testing.T) {
+	defer func(interval time.Duration) { backlogPollInterval = interval }(backlogPollInterval)
+	backlogPollInterval = time.Millisecond
+
+	meta := &testMeta{testCh: make(chan string, 10), maxPending: 2}
+	meta.startTestFactories(1, func(index, threadId int) (string, error) {
+		return fmt.Sprintf("test-%d.json", index), nil
+	})
+	// The channel has room for more, but the backlog is full
+	<-meta.testCh
+	<-meta.testCh
+	time.Sleep(20 * time.Millisecond)
+	if n := len(meta.testCh); n != 0 {
+		t.Fatalf("factory outran the backlog limit: %d more tests queued", n)
+	}
+	// Cleaning up a test lets the factory continue
+	meta.pending.Add(-1)
+	select {
+	case file := <-meta.testCh:
+		if file != "test-2.json" {
+			t.Fatalf("wrong test: %v", file)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("factory did not resume")
+	}
+	meta.abort.Store(true)
+	meta.pending.Add(-3)
+	for range meta.testCh {
+	}
+	meta.wg.Wait()
+}
+
+func TestTestProvenance(t *testing.T) {
+	var (
+		dir = t.TempDir()
+		gen = fuzzing.Factory("sstore_sload", "Cancun")
+		fn  = testFnFromGenerator(gen, "mixed", dir, false, 1234)
+	)
+	path, err := fn(7, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(provenancePath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var meta map[string]provenance
+	if err := json.Unmarshal(data, &meta); err != nil {
+		t.Fatal(err)
+	}
+	have := meta["_meta"]
+	if have.Generator != "sstore_sload" || have.Fork != "Cancun" || have.Seed != 1235 || have.Version == "" || have.Timestamp == "" {
+		t.Fatalf("wrong provenance: %+v", have)
+	}
+	// The seed regenerates the test
+	data, _ = os.ReadFile(path)
+	rand.Seed(have.Seed)
+	regenerated, _ := json.Marshal(gen().ToGeneralStateTest(strings.TrimSuffix(filepath.Base(path), ".json")))
+	if string(regenerated)+"\n" != string(data) {
+		t.Fatalf("test not regenerated from seed")
+	}
+	// The test itself must not contain it
+	var test map[string]json.RawMessage
+	if err := json.Unmarshal(data, &test); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := test["_meta"]; ok || len(test) != 1 {
+		t.Fatalf("unexpected keys in test: %d", len(test))
+	}
+	if err := removeTest(path); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("files left behind: %v", entries)
+	}
+}
+
+// TestRegenerateTest checks that the tests stored by the fuzzer, from a mix of
+// all the generators, are made again exactly from their provenance.
+func TestRegenerateTest(t *testing.T) {
+	names := fuzzing.FactoryNames()
+	sort.Strings(names)
+	var factories []GeneratorFn
+	for _, name := range names {
+		factories = append(factories, fuzzing.Factory(name, "Cancun"))
+	}
+	var index atomic.Uint64
+	mixed := func() *fuzzing.GstMaker {
+		return factories[int(index.Add(1))%len(factories)]()
+	}
+	for _, blockTest := range []bool{false, true} {
+		var (
+			dir = t.TempDir()
+			fn  = testFnFromGenerator(mixed, "mixed", dir, blockTest, 99)
+		)
+		for i := 0; i < 2*len(factories); i++ {
+			path, err := fn(i, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			test, err := RegenerateTest(provenancePath(path))
+			if err != nil {
+				t.Fatalf("test %v: %v", path, err)
+			}
+			have, err := json.Marshal(test)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(have)+"\n" != string(want) {
+				t.Fatalf("test %v (blocktest %v) not regenerated from provenance", filepath.Base(path), blockTest)
+			}
+		}
+	}
+}
+
+func TestExecutionOrder(t *testing.T) {
+	meta := &testMeta{}
+	if have := fmt.Sprint(meta.executionOrder(4)); have != "[0 1 2 3]" {
+		t.Fatalf("wrong order: %v", have)
+	}
+	meta.shuffleRand = rand.New(rand.NewSource(1))
+	// The shuffling must not draw from the global source, which the
+	// generators are seeded through.
+	rand.Seed(42)
+	want := rand.Int63()
+	rand.Seed(42)
+	orders := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		order := meta.executionOrder(4)
+		seen := make(map[int]bool)
+		for _, idx := range order {
+			seen[idx] = true
+		}
+		if len(seen) != 4 {
+			t.Fatalf("not a permutation: %v", order)
+		}
+		orders[fmt.Sprint(order)] = true
+	}
+	if len(orders) < 2 {
+		t.Fatalf("order not shuffled: %v", orders)
+	}
+	if have := rand.Int63(); have != want {
+		t.Fatal("shuffling drew from the global random source")
+	}
+}
+
+func TestComparePostStates(t *testing.T) {
+	path := filepath.Join("..", "evms", "testdata", "cases", "00003656-naivefuzz-0.json")
+	out := new(strings.Builder)
+	comparePostStates([]evms.Evm{evms.NewGethNativeVM("a"), evms.NewGethNativeVM("b")}, path, out)
+	if out.Len() != 0 {
+		t.Fatalf("unexpected output: %q", out)
+	}
+	// Only one of the clients can dump the state
+	vms := []evms.Evm{evms.NewGethNativeVM("a"), evms.NewNethermindVM("", "b")}
+	if have := countStateDumpers(vms); have != 1 {
+		t.Fatalf("wrong number of dumpers: %d", have)
+	}
+	comparePostStates(vms, path, out)
+	if want := "Post-state not compared: 1 client(s) could dump it, need two\n"; out.String() != want {
+		t.Fatalf("wrong output: have %q, want %q", out, want)
+	}
+}
+
+// BenchmarkGoMaxProcs measures the throughput of the vm executors at different
+// GOMAXPROCS settings, with as many executors as there are cpus. Each test
+// spawns a client process and hashes its output, like vmLoop does. The client
+// is a script replaying a recorded geth trace, so it is the Go side of the
+// pipeline which differs between the settings. Run it on the fuzzing host to
+// pick the --gomaxprocs setting:
+//
+//	go test -run - -bench GoMaxProcs ./common/
+func BenchmarkGoMaxProcs(b *testing.B) {
+	trace, err := filepath.Abs(filepath.Join("..", "evms", "testdata", "traces", "00000006-naivefuzz-0.json.geth.stderr.txt"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	bin := filepath.Join(b.TempDir(), "evm")
+	if err := os.WriteFile(bin, []byte(fmt.Sprintf("#!/bin/sh\ncat %v >&2\n", trace)), 0755); err != nil {
+		b.Fatal(err)
+	}
+	var (
+		vm        = evms.NewGethEVM(bin, "geth")
+		executors = runtime.NumCPU()
+		settings  = []int{1, 2, 4, executors / 2, executors}
+		done      = make(map[int]bool)
+	)
+	for _, procs := range settings {
+		if procs < 1 || procs > executors || done[procs] {
+			continue
+		}
+		done[procs] = true
+		b.Run(fmt.Sprintf("gomaxprocs-%d", procs), func(b *testing.B) {
+			defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(procs))
+			var (
+				next atomic.Int64
+				wg   sync.WaitGroup
+			)
+			b.ResetTimer()
+			for i := 0; i < executors; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					hasher := newLineCountingHasher(0, false)
+					for next.Add(1) <= int64(b.N) {
+						hasher.Reset()
+						if _, err := vm.RunStateTest(trace, hasher, false); err != nil {
+							b.Error(err)
+							return
+						}
+					}
+				}()
+			}
+			wg.Wait()
+		})
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/holiman/goevmlab/evms"
+	"github.com/urfave/cli/v2"
+)
+
+// ValidateGenerator executes n tests from the provider on the first vm only,
+// without comparing against other clients, to check that the generator makes
+// tests which the client accepts. Tests which the client fails on (an error,
+// no output, or no stateroot) are reported and kept, the others are removed.
+// It returns an error if any invalid test was found.
+func ValidateGenerator(c *cli.Context, providerFn TestProviderFn, n int) error {
+	vms := initVMs(c)
+	if len(vms) == 0 {
+		return fmt.Errorf("need at least one vm")
+	}
+	defer func() {
+		for _, vm := range vms {
+			vm.Close()
+		}
+	}()
+	invalid, err := validateTests(vms[0], providerFn, n, c.Bool(BlockTestFlag.Name), stdout)
+	if err != nil {
+		return err
+	}
+	log.Info("Validated generator", "evm", vms[0].Name(), "tests", n, "invalid", invalid)
+	if invalid > 0 {
+		return fmt.Errorf("%d of %d generated tests invalid", invalid, n)
+	}
+	return nil
+}
+
+// validateTests executes n tests from the provider on the vm, reports the
+// invalid ones to the writer, and returns their number.
+func validateTests(vm evms.Evm, providerFn TestProviderFn, n int, blockTest bool, w io.Writer) (int, error) {
+	var invalid int
+	for i := 0; i < n; i++ {
+		path, err := providerFn(i, 0)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return invalid, err
+		}
+		problem, command := validateTest(vm, path, blockTest)
+		if problem == "" {
+			if err := removeTest(path); err != nil {
+				log.Warn("Error deleting file", "file", path, "err", err)
+			}
+			continue
+		}
+		invalid++
+		fmt.Fprintf(w, "Invalid test\n")
+		fmt.Fprintf(w, "Testcase: %v\n", path)
+		fmt.Fprintf(w, "- %v: %v\n", vm.Name(), problem)
+		fmt.Fprintf(w, "  - command: %v\n", command)
+	}
+	return invalid, nil
+}
+
+// validateTest executes the test on the vm, and returns what is wrong with the
+// execution, if anything, along with the command used.
+func validateTest(vm evms.Evm, path string, blockTest bool) (problem, command string) {
+	run := vm.RunStateTest
+	if blockTest {
+		run = vm.(evms.BlockTester).RunBlockTest
+	}
+	var (
+		out    = new(rootCollector)
+		hasher = newLineCountingHasher(0, false)
+	)
+	res, err := run(path, io.MultiWriter(out, hasher), true)
+	out.flush()
+	if res != nil {
+		command = res.Cmd
+	}
+	switch {
+	case err != nil:
+		return fmt.Sprintf("error: %v", err), command
+	case hasher.empty():
+		return "no output", command
+	case len(out.roots) == 0:
+		return "no stateroot", command
+	}
+	return "", command
+}
@@ -0,0 +1,70 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/holiman/goevmlab/evms"
+)
+
+func TestValidateTests(t *testing.T) {
+	src, err := os.ReadFile(filepath.Join("..", "evms", "testdata", "cases", "statetest1.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		dir   = t.TempDir()
+		tests = []struct {
+			name string
+			data []byte
+		}{
+			{"valid.json", src},
+			{"invalid.json", src[:len(src)/2]},
+		}
+		out = new(strings.Builder)
+	)
+	provider := func(index, threadId int) (string, error) {
+		if index >= len(tests) {
+			return "", io.EOF
+		}
+		path := filepath.Join(dir, tests[index].name)
+		return path, os.WriteFile(path, tests[index].data, 0o644)
+	}
+	n, err := validateTests(evms.NewGethNativeVM("native"), provider, 3, false, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("wrong number of invalid tests: %d\n%v", n, out)
+	}
+	invalid := filepath.Join(dir, "invalid.json")
+	if have := out.String(); !strings.HasPrefix(have, fmt.Sprintf("Invalid test\nTestcase: %v\n- native: ", invalid)) {
+		t.Fatalf("wrong report: %v", have)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "valid.json")); !os.IsNotExist(err) {
+		t.Fatalf("valid test not removed: %v", err)
+	}
+	if _, err := os.Stat(invalid); err != nil {
+		t.Fatalf("invalid test removed: %v", err)
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/holiman/goevmlab/evms"
+)
+
+// webhookTimeout is how long posting to the webhook may take, so that a slow
+// or unreachable endpoint cannot hold up the run.
+const webhookTimeout = 10 * time.Second
+
+// webhookPayload is the report posted to the webhook for each distinct
+// consensus flaw.
+type webhookPayload struct {
+	Testfile string          `json:"testfile"`
+	Clients  []webhookClient `json:"clients"`
+	// Signature identifies the divergence point, and is used to deduplicate
+	// the notifications.
+	Signature string `json:"signature,omitempty"`
+	// Divergence is the first diverging step, if the outputs differ.
+	Divergence *evms.Divergence `json:"divergence,omitempty"`
+	// Minimized is the path to the minimized test, if minimization succeeded.
+	Minimized string `json:"minimized,omitempty"`
+	Goevmlab  string `json:"goevmlab"`
+}
+
+type webhookClient struct {
+	Name    string `json:"name"`
+	Version string `json:"version"` // binary and its hash, see clientVersion
+	Command string `json:"command"` // command used to execute the test
+	Output  string `json:"output"`  // file containing the output of the client
+}
+
+// webhook posts the reports of consensus flaws to a URL. Posting happens in
+// the background, and each signature is only reported once.
+type webhook struct {
+	url    string
+	client *http.Client
+	mu     sync.Mutex
+	sent   map[string]bool // signatures already reported
+	wg     sync.WaitGroup  // pending posts
+}
+
+func newWebhook(url string) *webhook {
+	return &webhook{
+		url:    url,
+		client: &http.Client{Timeout: webhookTimeout},
+		sent:   make(map[string]bool),
+	}
+}
+
+// validateWebhookURL checks that the webhook is an absolute http(s) URL.
+func validateWebhookURL(value string) error {
+	u, err := url.Parse(value)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid webhook %q: need an http or https URL", value)
+	}
+	return nil
+}
+
+// newWebhookPayload assembles the payload for a consensus flaw.
+func newWebhookPayload(report *crashReport, div *evms.Divergence, vms []evms.Evm) *webhookPayload {
+	payload := &webhookPayload{
+		Testfile:   report.Testfile,
+		Signature:  report.Signature,
+		Divergence: div,
+		Minimized:  report.Minimized,
+		Goevmlab:   goevmlabVersion,
+	}
+	for i, client := range report.Clients {
+		payload.Clients = append(payload.Clients, webhookClient{
+			Name:    client.Name,
+			Version: clientVersion(vms[i]),
+			Command: client.Command,
+			Output:  client.Output,
+		})
+	}
+	return payload
+}
+
+// notify posts the payload in the background, unless its signature has been
+// reported already. Flaws without a signature are always reported. It returns
+// whether the payload is posted.
+func (w *webhook) notify(payload *webhookPayload) bool {
+	if payload.Signature != "" {
+		w.mu.Lock()
+		if w.sent[payload.Signature] {
+			w.mu.Unlock()
+			log.Info("Skipping webhook for duplicate consensus flaw", "signature", payload.Signature)
+			return false
+		}
+		w.sent[payload.Signature] = true
+		w.mu.Unlock()
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		log.Error("Failed encoding webhook payload", "err", err)
+		return false
+	}
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		resp, err := w.client.Post(w.url, "application/json", bytes.NewReader(data))
+		if err != nil {
+			log.Warn("Failed to post to webhook", "err", err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			log.Warn("Webhook rejected the report", "status", resp.Status)
+			return
+		}
+		log.Info("Posted consensus flaw to webhook", "signature", payload.Signature)
+	}()
+	return true
+}
+
+// wait blocks until the pending posts are done, which takes at most the
+// webhook timeout.
+func (w *webhook) wait() {
+	w.wg.Wait()
+}
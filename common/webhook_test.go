@@ -0,0 +1,119 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/holiman/goevmlab/evms"
+)
+
+func TestWebhook(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		payloads []webhookPayload
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload webhookPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("bad payload: %v", err)
+		}
+		mu.Lock()
+		payloads = append(payloads, payload)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	var (
+		hook = newWebhook(srv.URL)
+		vms  = []evms.Evm{evms.NewGethNativeVM("geth-0"), evms.NewGethNativeVM("geth-1")}
+		div  = evms.NewDivergence("geth-0", "geth-1",
+			[]byte(`{"pc":3,"op":85,"gas":"0x10","depth":1,"opName":"SSTORE"}`),
+			[]byte(`{"pc":3,"op":85,"gas":"0x11","depth":1,"opName":"SSTORE"}`))
+		report = &crashReport{
+			Testfile: "/tmp/00000001-naive-0.json",
+			Clients: []crashClient{
+				{"geth-0", "/tmp/geth-0-output.jsonl", "geth-0 statetest"},
+				{"geth-1", "/tmp/geth-1-output.jsonl", "geth-1 statetest"},
+			},
+			Signature: div.Signature(),
+			Minimized: "/tmp/00000001-naive-0.json.min",
+		}
+	)
+	if !hook.notify(newWebhookPayload(report, div, vms)) {
+		t.Fatal("first flaw not posted")
+	}
+	// The same divergence, found by another test, is not posted again
+	dup := *report
+	dup.Testfile = "/tmp/00000002-naive-0.json"
+	if hook.notify(newWebhookPayload(&dup, div, vms)) {
+		t.Fatal("duplicate flaw posted")
+	}
+	// Flaws without signature cannot be deduplicated
+	nosig := *report
+	nosig.Signature = ""
+	if !hook.notify(newWebhookPayload(&nosig, nil, vms)) || !hook.notify(newWebhookPayload(&nosig, nil, vms)) {
+		t.Fatal("flaw without signature not posted")
+	}
+	hook.wait()
+	mu.Lock()
+	defer mu.Unlock()
+	if len(payloads) != 3 {
+		t.Fatalf("expected 3 posts, have %d", len(payloads))
+	}
+	for _, p := range payloads {
+		if p.Signature != report.Signature {
+			continue
+		}
+		if p.Testfile != report.Testfile || p.Minimized != report.Minimized || p.Goevmlab == "" {
+			t.Errorf("wrong payload: %+v", p)
+		}
+		if p.Divergence == nil || p.Divergence.Pc != "3" || p.Divergence.Field != "gas" {
+			t.Errorf("wrong divergence: %+v", p.Divergence)
+		}
+		if len(p.Clients) != 2 || p.Clients[1].Name != "geth-1" || p.Clients[1].Version == "" {
+			t.Errorf("wrong clients: %+v", p.Clients)
+		}
+	}
+}
+
+func TestWebhookUnreachable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := srv.URL
+	srv.Close()
+	hook := newWebhook(url)
+	// Failing to post is logged, but must not block or fail
+	hook.notify(&webhookPayload{Testfile: "test.json"})
+	hook.wait()
+}
+
+func TestValidateWebhookURL(t *testing.T) {
+	for _, url := range []string{"http://localhost:8080/hook", "https://example.com/x?token=1"} {
+		if err := validateWebhookURL(url); err != nil {
+			t.Errorf("%v: unexpected error: %v", url, err)
+		}
+	}
+	for _, url := range []string{"example.com/hook", "ftp://example.com", "https://", "::"} {
+		if err := validateWebhookURL(url); err == nil {
+			t.Errorf("%v: expected error", url)
+		}
+	}
+}
@@ -0,0 +1,427 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package evms
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/eth/tracers/logger"
+	"github.com/ethereum/go-ethereum/tests"
+	"github.com/holiman/uint256"
+)
+
+// AccessSet is the set of accounts and storage slots accessed while executing
+// a test: those warm before the execution starts, and those accessed by the
+// opcodes executed. Since the warm/cold status of an access determines its gas
+// cost, a difference in the accessed set precedes a gas divergence.
+type AccessSet map[common.Address]map[common.Hash]bool
+
+// AccessSetReporter is implemented by the Evm implementations which can
+// report the accessed set of a statetest.
+type AccessSetReporter interface {
+	// AccessSet runs the statetest and returns the accounts and storage
+	// slots accessed.
+	AccessSet(path string) (AccessSet, error)
+}
+
+func (set AccessSet) addAddress(addr common.Address) {
+	if _, ok := set[addr]; !ok {
+		set[addr] = make(map[common.Hash]bool)
+	}
+}
+
+func (set AccessSet) addSlot(addr common.Address, slot common.Hash) {
+	set.addAddress(addr)
+	set[addr][slot] = true
+}
+
+// Hash returns a hash of the accessed set, which is equal for sets which
+// CompareAccessSets finds no mismatches between.
+func (set AccessSet) Hash() common.Hash {
+	addrs := make(map[common.Address]bool)
+	for addr := range set {
+		addrs[addr] = true
+	}
+	var enc []byte
+	for _, addr := range sortedAddresses(addrs) {
+		enc = append(enc, addr.Bytes()...)
+		slots := sortedSlots(set[addr])
+		enc = append(enc, common.BigToHash(big.NewInt(int64(len(slots)))).Bytes()...)
+		for _, slot := range slots {
+			enc = append(enc, slot.Bytes()...)
+		}
+	}
+	return crypto.Keccak256Hash(enc)
+}
+
+// CompareAccessSets compares the accessed sets reported by the clients, and
+// returns a description of each account or slot which was not accessed by
+// all of them.
+func CompareAccessSets(names []string, sets []AccessSet) []string {
+	var (
+		addrs = make(map[common.Address]bool)
+		diffs []string
+	)
+	for _, set := range sets {
+		for addr := range set {
+			addrs[addr] = true
+		}
+	}
+	// describe returns the details of a mismatch, or the empty string
+	describe := func(accessed func(AccessSet) bool) string {
+		var (
+			details []string
+			differ  bool
+		)
+		for i, set := range sets {
+			details = append(details, fmt.Sprintf("%v=%v", names[i], accessed(set)))
+			differ = differ || accessed(set) != accessed(sets[0])
+		}
+		if !differ {
+			return ""
+		}
+		return strings.Join(details, " ")
+	}
+	for _, addr := range sortedAddresses(addrs) {
+		if d := describe(func(set AccessSet) bool { _, ok := set[addr]; return ok }); d != "" {
+			diffs = append(diffs, fmt.Sprintf("accessed account mismatch at address %v: %v", addr, d))
+		}
+		slots := make(map[common.Hash]bool)
+		for _, set := range sets {
+			for slot := range set[addr] {
+				slots[slot] = true
+			}
+		}
+		for _, slot := range sortedSlots(slots) {
+			if d := describe(func(set AccessSet) bool { return set[addr][slot] }); d != "" {
+				diffs = append(diffs, fmt.Sprintf("accessed slot mismatch at address %v slot %v: %v", addr, slot.Hex(), d))
+			}
+		}
+	}
+	return diffs
+}
+
+func sortedSlots(set map[common.Hash]bool) []common.Hash {
+	var slots []common.Hash
+	for slot := range set {
+		slots = append(slots, slot)
+	}
+	sort.Slice(slots, func(i, j int) bool {
+		return slots[i].Cmp(slots[j]) < 0
+	})
+	return slots
+}
+
+// stWarmJSON is the part of a statetest which determines the accounts and
+// slots that are warm before the execution starts.
+type stWarmJSON struct {
+	Env struct {
+		Coinbase  string                `json:"currentCoinbase"`
+		Number    math.HexOrDecimal64   `json:"currentNumber"`
+		Timestamp math.HexOrDecimal64   `json:"currentTimestamp"`
+		Random    *math.HexOrDecimal256 `json:"currentRandom"`
+	} `json:"env"`
+	Tx struct {
+		Nonce       math.HexOrDecimal64 `json:"nonce"`
+		To          string              `json:"to"`
+		AccessLists []*types.AccessList `json:"accessLists"`
+		PrivateKey  hexutil.Bytes       `json:"secretKey"`
+		Sender      *common.Address     `json:"sender"`
+	} `json:"transaction"`
+	Post map[string][]struct {
+		Indexes struct {
+			Data int `json:"data"`
+		} `json:"indexes"`
+	} `json:"post"`
+}
+
+// warmAccessSet returns the accounts and slots which are warm before the first
+// subtest of the statetest executes, like the state is prepared for a
+// transaction: the sender, the recipient, the precompiles, the coinbase (since
+// Shanghai) and the entries of the access list. Before Berlin, nothing is warm.
+// It also returns the recipient, or the address of the created contract.
+func warmAccessSet(path string) (AccessSet, common.Address, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, common.Address{}, err
+	}
+	var stTests map[string]stWarmJSON
+	if err := json.Unmarshal(data, &stTests); err != nil {
+		return nil, common.Address{}, err
+	}
+	var names []string
+	for name := range stTests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var forks []string
+	if len(names) > 0 {
+		for fork := range stTests[names[0]].Post {
+			forks = append(forks, fork)
+		}
+	}
+	sort.Strings(forks)
+	if len(forks) == 0 || len(stTests[names[0]].Post[forks[0]]) == 0 {
+		return nil, common.Address{}, fmt.Errorf("no subtest found")
+	}
+	var (
+		test   = stTests[names[0]]
+		fork   = forks[0]
+		index  = test.Post[fork][0].Indexes.Data
+		sender common.Address
+		to     common.Address
+		set    = make(AccessSet)
+	)
+	config, _, err := tests.GetChainConfig(fork)
+	if err != nil {
+		return nil, common.Address{}, err
+	}
+	if len(test.Tx.PrivateKey) > 0 {
+		key, err := crypto.ToECDSA(test.Tx.PrivateKey)
+		if err != nil {
+			return nil, common.Address{}, fmt.Errorf("invalid private key: %w", err)
+		}
+		sender = crypto.PubkeyToAddress(key.PublicKey)
+	} else if test.Tx.Sender != nil {
+		sender = *test.Tx.Sender
+	}
+	if test.Tx.To != "" {
+		to = common.HexToAddress(test.Tx.To)
+	} else {
+		to = crypto.CreateAddress(sender, uint64(test.Tx.Nonce))
+	}
+	rules := config.Rules(new(big.Int).SetUint64(uint64(test.Env.Number)),
+		config.IsLondon(common.Big0) && test.Env.Random != nil, uint64(test.Env.Timestamp))
+	if !rules.IsBerlin {
+		return set, to, nil
+	}
+	set.addAddress(sender)
+	set.addAddress(to)
+	for _, addr := range vm.ActivePrecompiles(rules) {
+		set.addAddress(addr)
+	}
+	if rules.IsShanghai {
+		set.addAddress(common.HexToAddress(test.Env.Coinbase))
+	}
+	if index < len(test.Tx.AccessLists) && test.Tx.AccessLists[index] != nil {
+		for _, tuple := range *test.Tx.AccessLists[index] {
+			set.addAddress(tuple.Address)
+			for _, slot := range tuple.StorageKeys {
+				set.addSlot(tuple.Address, slot)
+			}
+		}
+	}
+	return set, to, nil
+}
+
+// accessContext is the storage context of a call frame. The address of a
+// contract being created is not known from a json trace until the creation
+// returns, so the slots it accesses are held back until then. The slots of a
+// creation which fails are dropped, as its address is never known.
+type accessContext struct {
+	addr     common.Address
+	creation bool // whether the address is that of a pending creation
+	slots    []common.Hash
+}
+
+// accessSetTracer collects the accounts and storage slots accessed by the
+// opcodes executed into the set, which holds the warm accounts and slots
+// to begin with. It is used in-process, as well as to replay a json trace.
+type accessSetTracer struct {
+	set    AccessSet
+	frames []*accessContext
+}
+
+func newAccessSetTracer(set AccessSet) *accessSetTracer {
+	return &accessSetTracer{set: set}
+}
+
+// enter pushes the storage context of a new call frame.
+func (t *accessSetTracer) enter(typ vm.OpCode, to common.Address) {
+	switch {
+	case len(t.frames) > 0 && (typ == vm.DELEGATECALL || typ == vm.CALLCODE):
+		t.frames = append(t.frames, t.frames[len(t.frames)-1])
+	case typ == vm.CREATE || typ == vm.CREATE2:
+		t.frames = append(t.frames, &accessContext{addr: to, creation: true})
+	default:
+		t.frames = append(t.frames, &accessContext{addr: to})
+	}
+}
+
+// exit pops the storage context of the returning call frame. If it was a
+// creation, created is its address, or the zero address if it failed.
+func (t *accessSetTracer) exit(created common.Address) {
+	ctx := t.frames[len(t.frames)-1]
+	t.frames = t.frames[:len(t.frames)-1]
+	if !ctx.creation || (len(t.frames) > 0 && t.frames[len(t.frames)-1] == ctx) {
+		return
+	}
+	if created != (common.Address{}) {
+		for _, slot := range ctx.slots {
+			t.set.addSlot(created, slot)
+		}
+	}
+}
+
+// step records the accesses of an opcode about to be executed.
+func (t *accessSetTracer) step(op vm.OpCode, stack []uint256.Int) {
+	size := len(stack)
+	switch op {
+	case vm.SLOAD, vm.SSTORE:
+		if size >= 1 && len(t.frames) > 0 {
+			ctx, slot := t.frames[len(t.frames)-1], common.Hash(stack[size-1].Bytes32())
+			if ctx.creation {
+				ctx.slots = append(ctx.slots, slot)
+			} else {
+				t.set.addSlot(ctx.addr, slot)
+			}
+		}
+	case vm.EXTCODECOPY, vm.EXTCODEHASH, vm.EXTCODESIZE, vm.BALANCE, vm.SELFDESTRUCT:
+		if size >= 1 {
+			t.set.addAddress(stack[size-1].Bytes20())
+		}
+	case vm.CALL, vm.CALLCODE, vm.DELEGATECALL, vm.STATICCALL:
+		if size >= 2 {
+			t.set.addAddress(stack[size-2].Bytes20())
+		}
+	}
+}
+
+func (t *accessSetTracer) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	t.step(op, scope.Stack.Data())
+}
+
+func (t *accessSetTracer) CaptureTxStart(gasLimit uint64) {}
+
+func (t *accessSetTracer) CaptureTxEnd(restGas uint64) {}
+
+func (t *accessSetTracer) CaptureStart(env *vm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	// The address of a created contract is known up front here, and the
+	// outermost frame is never held back.
+	t.enter(vm.CALL, to)
+}
+
+func (t *accessSetTracer) CaptureEnd(output []byte, gasUsed uint64, err error) {
+	t.exit(common.Address{})
+}
+
+func (t *accessSetTracer) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+	t.enter(typ, to)
+}
+
+func (t *accessSetTracer) CaptureExit(output []byte, gasUsed uint64, err error) {
+	var created common.Address
+	if err == nil {
+		created = t.frames[len(t.frames)-1].addr
+	}
+	t.exit(created)
+}
+
+func (t *accessSetTracer) CaptureFault(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+}
+
+// parseAccessSet reads a json trace, which must include the stack, and adds
+// the accounts and slots accessed by the steps of the first subtest to the
+// set. The trace does not tell the address of a call frame, so it is tracked
+// from the call opcodes, starting with the recipient of the transaction.
+func parseAccessSet(input io.Reader, set AccessSet, to common.Address) error {
+	var (
+		t       = newAccessSetTracer(set)
+		pending vm.OpCode // the call opcode of the previous step, if any
+		target  common.Address
+	)
+	t.enter(vm.CALL, to)
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 1024*1024), 32*1024*1024)
+	for scanner.Scan() {
+		data := scanner.Bytes()
+		if bytes.Contains(data, []byte(`"output"`)) || bytes.Contains(data, []byte(`"stateRoot"`)) {
+			// The end of the first subtest
+			break
+		}
+		var step logger.StructLog
+		if err := json.Unmarshal(data, &step); err != nil || step.Depth == 0 {
+			continue
+		}
+		if pending != 0 && step.Depth == len(t.frames)+1 {
+			t.enter(pending, target)
+		}
+		pending = 0
+		for len(t.frames) > step.Depth && len(t.frames) > 1 {
+			// The result of a creation is on the stack of the caller
+			var created common.Address
+			if len(t.frames) == step.Depth+1 && len(step.Stack) > 0 {
+				created = step.Stack[len(step.Stack)-1].Bytes20()
+			}
+			t.exit(created)
+		}
+		if len(t.frames) != step.Depth {
+			return fmt.Errorf("unexpected depth %d at pc %d", step.Depth, step.Pc)
+		}
+		t.step(step.Op, step.Stack)
+		switch step.Op {
+		case vm.CALL, vm.CALLCODE, vm.DELEGATECALL, vm.STATICCALL:
+			if len(step.Stack) >= 2 {
+				pending, target = step.Op, step.Stack[len(step.Stack)-2].Bytes20()
+			}
+		case vm.CREATE, vm.CREATE2:
+			pending, target = step.Op, common.Address{}
+		}
+	}
+	return scanner.Err()
+}
+
+// runAccessSet executes the command, and parses the accessed set from the json
+// trace it writes to stderr.
+func runAccessSet(cmd *exec.Cmd, path string) (AccessSet, error) {
+	set, to, err := warmAccessSet(path)
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := startCmd(cmd); err != nil {
+		return nil, err
+	}
+	parseErr := parseAccessSet(stderr, set, to)
+	// Drain the remainder, so the process can exit
+	_, _ = io.Copy(io.Discard, stderr)
+	if err := waitCmd(cmd); err != nil {
+		return nil, fmt.Errorf("%v: %w", cmd.String(), err)
+	}
+	if parseErr != nil {
+		return nil, fmt.Errorf("%v: %w", cmd.String(), parseErr)
+	}
+	return set, nil
+}
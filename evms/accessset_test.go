@@ -0,0 +1,149 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package evms
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestCompareAccessSets(t *testing.T) {
+	var (
+		addrA = common.HexToAddress("0xaa")
+		addrB = common.HexToAddress("0xbb")
+		slot1 = common.HexToHash("0x01")
+		slot2 = common.HexToHash("0x02")
+		a     = make(AccessSet)
+		b     = make(AccessSet)
+	)
+	a.addSlot(addrA, slot1)
+	a.addSlot(addrA, slot2)
+	a.addAddress(addrB)
+	b.addSlot(addrA, slot1)
+	diffs := CompareAccessSets([]string{"geth", "besu"}, []AccessSet{a, b})
+	want := []string{
+		fmt.Sprintf("accessed slot mismatch at address %v slot %v: geth=true besu=false", addrA.Hex(), slot2.Hex()),
+		fmt.Sprintf("accessed account mismatch at address %v: geth=true besu=false", addrB.Hex()),
+	}
+	if fmt.Sprint(diffs) != fmt.Sprint(want) {
+		t.Fatalf("wrong report:\nhave %q\nwant %q", diffs, want)
+	}
+	if a.Hash() == b.Hash() {
+		t.Fatal("different sets have the same hash")
+	}
+	// An account accessed without slots differs from one not accessed at all
+	b.addAddress(addrB)
+	if b.Hash() == (AccessSet{addrA: {slot1: true}}).Hash() {
+		t.Fatal("different sets have the same hash")
+	}
+	b.addSlot(addrA, slot2)
+	if diffs := CompareAccessSets([]string{"a", "b"}, []AccessSet{a, b}); len(diffs) != 0 {
+		t.Fatalf("unexpected differences: %v", diffs)
+	}
+	if a.Hash() != b.Hash() {
+		t.Fatal("equal sets have different hashes")
+	}
+}
+
+func TestGethNativeAccessSet(t *testing.T) {
+	vm := NewGethNativeVM("native")
+	set, err := vm.AccessSet(filepath.Join("testdata", "cases", "00003656-naivefuzz-0.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		addr  = common.HexToAddress("0xf1")
+		slots = []common.Hash{common.HexToHash("0x02"), common.HexToHash("0x03")}
+	)
+	for _, slot := range slots {
+		if !set[addr][slot] {
+			t.Errorf("slot %v of %v missing from %v", slot.Hex(), addr, set)
+		}
+	}
+	if _, ok := set[common.HexToAddress("0xf3")]; !ok {
+		t.Errorf("account missing from %v", set)
+	}
+	// The precompiles are warm since Berlin, the coinbase since Shanghai
+	if _, ok := set[common.HexToAddress("0x01")]; !ok {
+		t.Errorf("precompile missing from %v", set)
+	}
+	if _, ok := set[common.HexToAddress("0xb94f5374fce5edbc8e2a8697c15331677e6ebf0b")]; ok {
+		t.Errorf("coinbase warm before Shanghai: %v", set)
+	}
+}
+
+func TestParseAccessSet(t *testing.T) {
+	// A test which creates a contract storing to slot 1, and one storing to
+	// slot 2 which then fails
+	data, err := os.ReadFile(filepath.Join("testdata", "cases", "00003656-naivefuzz-0.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = bytes.Replace(data, []byte(`"0x600060006000600060f35af450600354506000`),
+		[]byte(`"0x64602a6001556000526005601b6000f050656001600255fe6000526006601a6000f05000`), 1)
+	data = bytes.Replace(data, []byte(`"0x99df"`), []byte(`"0x7a1200"`), 1)
+	creations := filepath.Join(t.TempDir(), "creations.json")
+	if err := os.WriteFile(creations, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	files, err := filepath.Glob(filepath.Join("testdata", "cases", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm := NewGethNativeVM("native")
+	for _, path := range append(files, creations) {
+		want, err := vm.AccessSet(path)
+		if err != nil {
+			t.Fatalf("%v: %v", path, err)
+		}
+		// The set parsed from the trace equals the one traced in-process
+		trace := new(bytes.Buffer)
+		if _, err := vm.execute(path, trace, true, nil, nil); err != nil {
+			t.Fatalf("%v: %v", path, err)
+		}
+		have, to, err := warmAccessSet(path)
+		if err != nil {
+			t.Fatalf("%v: %v", path, err)
+		}
+		if err := parseAccessSet(trace, have, to); err != nil {
+			t.Fatalf("%v: %v", path, err)
+		}
+		if diffs := CompareAccessSets([]string{"parsed", "native"}, []AccessSet{have, want}); len(diffs) != 0 {
+			t.Errorf("%v: sets differ: %v", path, diffs)
+		}
+		if path != creations {
+			continue
+		}
+		var created, failed int
+		for _, slots := range have {
+			if slots[common.HexToHash("0x01")] {
+				created++
+			}
+			if slots[common.HexToHash("0x02")] {
+				failed++
+			}
+		}
+		if created != 1 || failed != 0 {
+			t.Errorf("wrong creation slots: %v", have)
+		}
+	}
+}
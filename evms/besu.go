@@ -56,11 +56,17 @@ func (evm *BesuVM) Name() string {
 	return evm.name
 }
 
+// Binary returns the path to the client binary.
+func (evm *BesuVM) Binary() string {
+	return evm.path
+}
+
 // RunStateTest implements the Evm interface
 func (evm *BesuVM) RunStateTest(path string, out io.Writer, speedTest bool) (*tracingResult, error) {
 	var (
 		t0     = time.Now()
 		stdout io.ReadCloser
+		stderr *stderrBuffer
 		err    error
 		cmd    *exec.Cmd
 	)
@@ -69,22 +75,23 @@ func (evm *BesuVM) RunStateTest(path string, out io.Writer, speedTest bool) (*tr
 	} else {
 		cmd = exec.Command(evm.path, "--nomemory", "--notime", "--json", "state-test", path) // exclude memory
 	}
-	if stdout, err = cmd.StdoutPipe(); err != nil {
-		return &tracingResult{Cmd: cmd.String()}, err
+	if stdout, stderr, err = stdoutPipe(cmd, "besu"); err != nil {
+		return &tracingResult{Cmd: shellCommand(cmd)}, err
 	}
-	if err = cmd.Start(); err != nil {
-		return &tracingResult{Cmd: cmd.String()}, err
+	if err = startCmd(cmd); err != nil {
+		return &tracingResult{Cmd: shellCommand(cmd)}, err
 	}
 	// copy everything to the given writer
 	evm.Copy(out, stdout)
-	err = cmd.Wait()
+	err = waitCmd(cmd)
 	// release resources
 	duration, slow := evm.stats.TraceDone(t0)
 
 	return &tracingResult{
 			Slow:     slow,
 			ExecTime: duration,
-			Cmd:      cmd.String()},
+			Cmd:      shellCommand(cmd),
+			Stderr:   stderr.take()},
 		err
 }
 
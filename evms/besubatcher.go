@@ -30,6 +30,7 @@ type BesuBatchVM struct {
 	BesuVM
 	cmd    *exec.Cmd // the 'master' process
 	stdout io.ReadCloser
+	stderr *stderrBuffer
 	stdin  io.WriteCloser
 	mu     sync.Mutex
 }
@@ -61,6 +62,7 @@ func (evm *BesuBatchVM) RunStateTest(path string, out io.Writer, speedTest bool)
 		err    error
 		cmd    *exec.Cmd
 		stdout io.ReadCloser
+		stderr *stderrBuffer
 		stdin  io.WriteCloser
 	)
 	if evm.cmd == nil {
@@ -69,17 +71,18 @@ func (evm *BesuBatchVM) RunStateTest(path string, out io.Writer, speedTest bool)
 		} else {
 			cmd = exec.Command(evm.path, "--nomemory", "--notime", "--json", "state-test")
 		}
-		if stdout, err = cmd.StdoutPipe(); err != nil {
-			return &tracingResult{Cmd: cmd.String()}, err
+		if stdout, stderr, err = stdoutPipe(cmd, "besubatch"); err != nil {
+			return &tracingResult{Cmd: shellCommand(cmd)}, err
 		}
 		if stdin, err = cmd.StdinPipe(); err != nil {
-			return &tracingResult{Cmd: cmd.String()}, err
+			return &tracingResult{Cmd: shellCommand(cmd)}, err
 		}
-		if err = cmd.Start(); err != nil {
-			return &tracingResult{Cmd: cmd.String()}, err
+		if err = startBatchCmd(cmd); err != nil {
+			return &tracingResult{Cmd: shellCommand(cmd)}, err
 		}
 		evm.cmd = cmd
 		evm.stdout = stdout
+		evm.stderr = stderr
 		evm.stdin = stdin
 	}
 	evm.mu.Lock()
@@ -91,7 +94,8 @@ func (evm *BesuBatchVM) RunStateTest(path string, out io.Writer, speedTest bool)
 	return &tracingResult{
 		Slow:     slow,
 		ExecTime: duration,
-		Cmd:      evm.cmd.String(),
+		Cmd:      batchCommand(evm.cmd, path),
+		Stderr:   evm.stderr.take(),
 	}, nil
 }
 
@@ -114,7 +118,7 @@ func (evm *BesuBatchVM) GetStateRoot(path string) (root, command string, err err
 		if evm.stdin, err = evm.cmd.StdinPipe(); err != nil {
 			return "", evm.cmd.String(), err
 		}
-		if err = evm.cmd.Start(); err != nil {
+		if err = startBatchCmd(evm.cmd); err != nil {
 			return "", evm.cmd.String(), err
 		}
 	}
@@ -0,0 +1,129 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package evms
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// CaptureMode determines what is done with the standard error of a client
+// whose trace is read from standard output.
+type CaptureMode string
+
+const (
+	CaptureMerge    CaptureMode = "merge"    // stderr is part of the compared output
+	CaptureSeparate CaptureMode = "separate" // stderr is collected into the tracing result
+	CaptureIgnore   CaptureMode = "ignore"   // stderr is discarded
+)
+
+// stdoutTracers are the clients whose trace is read from standard output, and
+// thus the only ones for which the stderr capture mode can be set. The others
+// already have their stderr compared. The list is sorted.
+var stdoutTracers = []string{"besu", "besubatch", "nethbatch", "nethermind"}
+
+// stderrCapture holds the capture mode per client. The empty name holds the
+// mode for the clients not explicitly listed.
+var stderrCapture = map[string]CaptureMode{}
+
+// ParseStderrCapture parses the stderr capture settings, each of which is
+// either a mode, which applies to all clients, or client=mode.
+func ParseStderrCapture(values []string) (map[string]CaptureMode, error) {
+	modes := make(map[string]CaptureMode)
+	for _, v := range values {
+		client, mode, found := strings.Cut(v, "=")
+		if !found {
+			client, mode = "", v
+		}
+		switch CaptureMode(mode) {
+		case CaptureMerge, CaptureSeparate, CaptureIgnore:
+		default:
+			return nil, fmt.Errorf("invalid stderr capture mode %q (want merge, separate or ignore)", mode)
+		}
+		if client != "" && !contains(stdoutTracers, client) {
+			return nil, fmt.Errorf("cannot set stderr capture for %q, valid clients are %v", client, strings.Join(stdoutTracers, ", "))
+		}
+		modes[client] = CaptureMode(mode)
+	}
+	return modes, nil
+}
+
+// SetStderrCapture sets the capture modes for evm processes started from now
+// on. Clients without a mode ignore their stderr.
+func SetStderrCapture(modes map[string]CaptureMode) {
+	stderrCapture = modes
+}
+
+func stderrCaptureMode(client string) CaptureMode {
+	if mode, ok := stderrCapture[client]; ok {
+		return mode
+	}
+	if mode, ok := stderrCapture[""]; ok {
+		return mode
+	}
+	return CaptureIgnore
+}
+
+// stdoutPipe returns a pipe to the standard output of the command, and sets up
+// its standard error according to the capture mode of the client: sent through
+// the same pipe, collected into the returned buffer, or discarded. The buffer
+// is nil unless stderr is kept separate.
+func stdoutPipe(cmd *exec.Cmd, client string) (io.ReadCloser, *stderrBuffer, error) {
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	var buf *stderrBuffer
+	switch stderrCaptureMode(client) {
+	case CaptureMerge:
+		// Using the same writer makes the process share the file descriptor
+		cmd.Stderr = cmd.Stdout
+	case CaptureSeparate:
+		buf = new(stderrBuffer)
+		cmd.Stderr = buf
+	}
+	return stdout, buf, nil
+}
+
+// stderrBuffer collects the standard error of a process. It is safe for
+// concurrent use, since the batch-mode vms write to it in the background.
+type stderrBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *stderrBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// take returns the data collected so far, and resets the buffer.
+func (b *stderrBuffer) take() []byte {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	data := append([]byte(nil), b.buf.Bytes()...)
+	b.buf.Reset()
+	return data
+}
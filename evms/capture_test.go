@@ -0,0 +1,79 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package evms
+
+import (
+	"io"
+	"os/exec"
+	"testing"
+)
+
+func TestParseStderrCapture(t *testing.T) {
+	modes, err := ParseStderrCapture([]string{"separate", "besu=merge"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetStderrCapture(modes)
+	defer SetStderrCapture(nil)
+	for client, want := range map[string]CaptureMode{
+		"besu":       CaptureMerge,
+		"besubatch":  CaptureSeparate,
+		"nethermind": CaptureSeparate,
+	} {
+		if have := stderrCaptureMode(client); have != want {
+			t.Errorf("%v: have %v, want %v", client, have, want)
+		}
+	}
+	for _, bad := range []string{"both", "besu=", "geth=merge"} {
+		if _, err := ParseStderrCapture([]string{bad}); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestStdoutPipeCapture(t *testing.T) {
+	for _, tc := range []struct {
+		mode   CaptureMode
+		out    string
+		stderr string
+	}{
+		{CaptureMerge, "out\nerr\n", ""},
+		{CaptureSeparate, "out\n", "err\n"},
+		{CaptureIgnore, "out\n", ""},
+	} {
+		SetStderrCapture(map[string]CaptureMode{"besu": tc.mode})
+		cmd := exec.Command("sh", "-c", "echo out; sleep 0.1; echo err >&2")
+		stdout, stderr, err := stdoutPipe(cmd, "besu")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+		out, _ := io.ReadAll(stdout)
+		if err := cmd.Wait(); err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != tc.out {
+			t.Errorf("%v: output %q, want %q", tc.mode, out, tc.out)
+		}
+		if have := string(stderr.take()); have != tc.stderr {
+			t.Errorf("%v: stderr %q, want %q", tc.mode, have, tc.stderr)
+		}
+	}
+	SetStderrCapture(nil)
+}
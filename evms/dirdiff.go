@@ -0,0 +1,108 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package evms
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// DirDiff is the result of comparing two directories of outputs.
+type DirDiff struct {
+	Compared int      // Number of files present in both directories
+	Differ   []string // Files which differ
+	OnlyA    []string // Files only present in the first directory
+	OnlyB    []string // Files only present in the second directory
+}
+
+// CompareDirs matches the files in the two directories by name, and compares
+// each pair line by line, the same way as CompareFiles. The differences are
+// written to out, if non-nil.
+func CompareDirs(dirA, dirB string, out io.Writer) (*DirDiff, error) {
+	filesA, err := listFiles(dirA)
+	if err != nil {
+		return nil, err
+	}
+	filesB, err := listFiles(dirB)
+	if err != nil {
+		return nil, err
+	}
+	res := new(DirDiff)
+	for _, name := range filesB {
+		if !contains(filesA, name) {
+			res.OnlyB = append(res.OnlyB, name)
+		}
+	}
+	for _, name := range filesA {
+		if !contains(filesB, name) {
+			res.OnlyA = append(res.OnlyA, name)
+			continue
+		}
+		equal, diff, err := compareFilePair(filepath.Join(dirA, name), filepath.Join(dirB, name))
+		if err != nil {
+			return nil, err
+		}
+		res.Compared++
+		if !equal {
+			res.Differ = append(res.Differ, name)
+			if out != nil {
+				fmt.Fprintf(out, "%v:\n%v\n", name, diff)
+			}
+		}
+	}
+	return res, nil
+}
+
+// compareFilePair compares the two files, using the file paths to describe
+// any difference.
+func compareFilePair(a, b string) (bool, string, error) {
+	fA, err := os.Open(a)
+	if err != nil {
+		return false, "", err
+	}
+	defer fA.Close()
+	fB, err := os.Open(b)
+	if err != nil {
+		return false, "", err
+	}
+	defer fB.Close()
+	equal, _, diff, _ := compareReaders([]string{a, b}, []io.Reader{fA, fB}, 0)
+	return equal, diff, nil
+}
+
+// listFiles returns the sorted names of the regular files in the directory.
+func listFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() {
+			files = append(files, entry.Name())
+		}
+	}
+	return files, nil
+}
+
+func contains(sorted []string, name string) bool {
+	i := sort.SearchStrings(sorted, name)
+	return i < len(sorted) && sorted[i] == name
+}
@@ -0,0 +1,65 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package evms
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompareDirs(t *testing.T) {
+	var (
+		dirA = t.TempDir()
+		dirB = t.TempDir()
+	)
+	write := func(dir, name, data string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(dirA, "equal.jsonl", "{\"pc\":0}\n{\"stateRoot\":\"0x01\"}\n")
+	write(dirB, "equal.jsonl", "{\"pc\":0}\n{\"stateRoot\":\"0x01\"}\n")
+	write(dirA, "differ.jsonl", "{\"pc\":0}\n{\"stateRoot\":\"0x01\"}\n")
+	write(dirB, "differ.jsonl", "{\"pc\":0}\n{\"stateRoot\":\"0x02\"}\n")
+	write(dirA, "shorter.jsonl", "{\"pc\":0}\n")
+	write(dirB, "shorter.jsonl", "{\"pc\":0}\n{\"pc\":1}\n")
+	write(dirA, "a.jsonl", "")
+	write(dirB, "b.jsonl", "")
+	if err := os.Mkdir(filepath.Join(dirB, "subdir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	out := new(strings.Builder)
+	res, err := CompareDirs(dirA, dirB, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &DirDiff{
+		Compared: 3,
+		Differ:   []string{"differ.jsonl", "shorter.jsonl"},
+		OnlyA:    []string{"a.jsonl"},
+		OnlyB:    []string{"b.jsonl"},
+	}
+	if !reflect.DeepEqual(res, want) {
+		t.Fatalf("have %+v, want %+v", res, want)
+	}
+	if !strings.Contains(out.String(), "0x02") {
+		t.Fatalf("missing diff in output: %v", out)
+	}
+}
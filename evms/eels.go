@@ -56,6 +56,11 @@ func (evm *EelsEVM) Name() string {
 	return evm.name
 }
 
+// Binary returns the path to the client binary.
+func (evm *EelsEVM) Binary() string {
+	return evm.path
+}
+
 // GetStateRoot runs the test and returns the stateroot
 // This currently only works for non-filled statetests. TODO: make it work even if the
 // test is filled. Either by getting the whole trace, or adding stateroot to exec std output
@@ -99,21 +104,21 @@ func (evm *EelsEVM) RunStateTest(path string, out io.Writer, speedTest bool) (*t
 		cmd = exec.Command(evm.path, "statetest", "--json", "--noreturndata", "--nomemory", path)
 	}
 	if stderr, err = cmd.StderrPipe(); err != nil {
-		return &tracingResult{Cmd: cmd.String()}, err
+		return &tracingResult{Cmd: shellCommand(cmd)}, err
 	}
-	if err = cmd.Start(); err != nil {
-		return &tracingResult{Cmd: cmd.String()}, err
+	if err = startCmd(cmd); err != nil {
+		return &tracingResult{Cmd: shellCommand(cmd)}, err
 	}
 	// copy everything to the given writer
 	evm.Copy(out, stderr)
-	err = cmd.Wait()
+	err = waitCmd(cmd)
 	// release resources
 	duration, slow := evm.stats.TraceDone(t0)
 
 	return &tracingResult{
 		Slow:     slow,
 		ExecTime: duration,
-		Cmd:      cmd.String(),
+		Cmd:      shellCommand(cmd),
 	}, err
 }
 
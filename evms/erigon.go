@@ -54,6 +54,11 @@ func (evm *ErigonVM) Name() string {
 	return evm.name
 }
 
+// Binary returns the path to the client binary.
+func (evm *ErigonVM) Binary() string {
+	return evm.path
+}
+
 // GetStateRoot runs the test and returns the stateroot
 // This currently only works for non-filled statetests. TODO: make it work even if the
 // test is filled. Either by getting the whole trace, or adding stateroot to exec std output
@@ -95,26 +100,40 @@ func (evm *ErigonVM) RunStateTest(path string, out io.Writer, speedTest bool) (*
 		cmd = exec.Command(evm.path, "--nomemory", "--noreturndata", "--nostack", "statetest", path)
 	}
 	if stderr, err = cmd.StderrPipe(); err != nil {
-		return &tracingResult{Cmd: cmd.String()}, err
+		return &tracingResult{Cmd: shellCommand(cmd)}, err
 	}
-	if err = cmd.Start(); err != nil {
-		return &tracingResult{Cmd: cmd.String()}, err
+	if err = startCmd(cmd); err != nil {
+		return &tracingResult{Cmd: shellCommand(cmd)}, err
 	}
 	// copy everything to the given writer
 	evm.Copy(out, stderr)
-	err = cmd.Wait()
+	err = waitCmd(cmd)
 	// release resources
 	duration, slow := evm.stats.TraceDone(t0)
 	return &tracingResult{
 			Slow:     slow,
 			ExecTime: duration,
-			Cmd:      cmd.String()},
+			Cmd:      shellCommand(cmd)},
 		err
 }
 
 func (vm *ErigonVM) Close() {
 }
 
+// AccessSet implements the AccessSetReporter interface. If the file contains
+// several tests, the set of the first one is returned.
+func (evm *ErigonVM) AccessSet(path string) (AccessSet, error) {
+	cmd := exec.Command(evm.path, "--json", "--noreturndata", "--nomemory", "statetest", path)
+	return runAccessSet(cmd, path)
+}
+
+// RevertData implements the RevertDataReporter interface. If the file contains
+// several tests, the outcome of the first one is returned.
+func (evm *ErigonVM) RevertData(path string) (*RevertData, error) {
+	cmd := exec.Command(evm.path, "--json", "--noreturndata", "--nomemory", "--nostack", "statetest", path)
+	return runRevertData(cmd, gethRevertErr)
+}
+
 // Copy reads from the reader, does some geth-specific filtering and
 // outputs items onto the channel
 func (evm *ErigonVM) Copy(out io.Writer, input io.Reader) {
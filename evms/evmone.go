@@ -53,6 +53,11 @@ func (evm *EvmoneVM) Name() string {
 	return fmt.Sprintf("evmone-%s", evm.name)
 }
 
+// Binary returns the path to the client binary.
+func (evm *EvmoneVM) Binary() string {
+	return evm.path
+}
+
 func (evm *EvmoneVM) GetStateRoot(path string) (root, command string, err error) {
 	cmd := exec.Command(evm.path, "--trace-summary", path)
 	data, err := StdErrOutput(cmd)
@@ -97,12 +102,12 @@ func (evm *EvmoneVM) RunStateTest(path string, out io.Writer, speedTest bool) (*
 	if stderr, err = cmd.StderrPipe(); err != nil {
 		return nil, err
 	}
-	if err = cmd.Start(); err != nil {
+	if err = startCmd(cmd); err != nil {
 		return nil, err
 	}
 
 	evm.Copy(out, stderr)
-	err = cmd.Wait()
+	err = waitCmd(cmd)
 	duration, slow := evm.stats.TraceDone(t0)
 
 	// In case of root hash mismatch evmone exists with 1. Ignore this.
@@ -113,7 +118,7 @@ func (evm *EvmoneVM) RunStateTest(path string, out io.Writer, speedTest bool) (*
 	return &tracingResult{
 		Slow:     slow,
 		ExecTime: duration,
-		Cmd:      cmd.String(),
+		Cmd:      shellCommand(cmd),
 	}, err
 }
 
@@ -50,6 +50,14 @@ type Evm interface {
 	Instance(threadId int) Evm
 }
 
+// BlockTester is implemented by the Evm implementations which can also execute
+// blockchain tests.
+type BlockTester interface {
+	// RunBlockTest runs the blockchain test on the underlying EVM, and writes
+	// the output to the given writer
+	RunBlockTest(path string, writer io.Writer, skipTrace bool) (*tracingResult, error)
+}
+
 type stateRoot struct {
 	StateRoot string `json:"stateRoot"`
 }
@@ -57,6 +65,34 @@ type stateRoot struct {
 // CompareFiles returns true if the files are equal, along with the number of line s
 // compared
 func CompareFiles(vms []Evm, readers []io.Reader) (bool, int, string) {
+	return CompareFilesLimit(vms, readers, 0)
+}
+
+// CompareFilesLimit is like CompareFiles, but stops after comparing maxLines
+// lines (if non-zero), and then reports the files as equal. Any difference
+// after that point, including in the stateroot, goes unnoticed.
+func CompareFilesLimit(vms []Evm, readers []io.Reader, maxLines int) (bool, int, string) {
+	div, count, diff := CompareFilesDivergence(vms, readers, maxLines)
+	return div == nil, count, diff
+}
+
+// CompareFilesDivergence is like CompareFilesLimit, but instead of a bool it
+// returns the point where the files diverge, or nil if they are equal.
+func CompareFilesDivergence(vms []Evm, readers []io.Reader, maxLines int) (*Divergence, int, string) {
+	var names []string
+	for _, vm := range vms {
+		names = append(names, vm.Name())
+	}
+	equal, count, diff, div := compareReaders(names, readers, maxLines)
+	if equal {
+		return nil, count, diff
+	}
+	return div, count, diff
+}
+
+// compareReaders compares the outputs line by line, using the names to
+// describe any difference. If they differ, it also returns the divergence.
+func compareReaders(names []string, readers []io.Reader, maxLines int) (bool, int, string, *Divergence) {
 	var output = new(strings.Builder)
 	var scanners []*bufio.Scanner
 	for _, r := range readers {
@@ -72,7 +108,7 @@ func CompareFiles(vms []Evm, readers []io.Reader) (bool, int, string) {
 		count    = 0
 		prevLine = ""
 		refOut   = scanners[0]
-		refVM    = vms[0]
+		refName  = names[0]
 	)
 	for refOut.Scan() {
 		for i, scanner := range scanners[1:] {
@@ -80,26 +116,31 @@ func CompareFiles(vms []Evm, readers []io.Reader) (bool, int, string) {
 			if !bytes.Equal(refOut.Bytes(), scanner.Bytes()) {
 				fmt.Fprintf(output, "-------\nprev:%15v: %v\ndiff:%15v: %v\ndiff:%15v: %v\n",
 					"both", prevLine,
-					refVM.Name(), string(refOut.Bytes()),
-					vms[i+1].Name(), string(scanner.Bytes()))
-				return false, count, output.String()
+					refName, string(refOut.Bytes()),
+					names[i+1], string(scanner.Bytes()))
+				div := NewDivergence(refName, names[i+1], refOut.Bytes(), scanner.Bytes())
+				return false, count, output.String(), div
 			}
 		}
 		prevLine = string(refOut.Bytes())
 		count++
+		if count == maxLines {
+			return true, count, output.String(), nil
+		}
 	}
 	// The source is 'done', need to also check if the other scanners are done
 	for i, scanner := range scanners[1:] {
 		if scanner.Scan() {
 			fmt.Fprintf(output, "diff: \n%15v: %v\n%15v: %v\n",
-				refVM.Name(),
+				refName,
 				string("--  depleted --"),
-				vms[i+1].Name(),
+				names[i+1],
 				string(scanner.Bytes()))
-			return false, count, output.String()
+			div := NewDivergence(refName, names[i+1], nil, scanner.Bytes())
+			return false, count, output.String(), div
 		}
 	}
-	return true, count, output.String()
+	return true, count, output.String(), nil
 }
 
 var bufferPool = sync.Pool{
@@ -0,0 +1,128 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package evms
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+)
+
+// FieldSorter is a writer which normalizes the lines of json output written to
+// it, by sorting the contents of the configured fields, before writing them
+// on. This makes the comparison of fields whose order is not relevant, e.g.
+// sets of accounts, insensitive to the order in which a client lists them.
+// Array fields have their elements sorted, object fields their keys. Lines
+// which do not contain any of the fields are passed through as is.
+type FieldSorter struct {
+	out    io.Writer
+	fields []string
+	buf    []byte // incomplete line
+}
+
+// NewFieldSorter creates a FieldSorter which sorts the given (top-level)
+// fields, and writes to out.
+func NewFieldSorter(out io.Writer, fields []string) *FieldSorter {
+	return &FieldSorter{out: out, fields: fields}
+}
+
+func (s *FieldSorter) Write(p []byte) (int, error) {
+	s.buf = append(s.buf, p...)
+	for {
+		i := bytes.IndexByte(s.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if _, err := s.out.Write(append(s.sortLine(s.buf[:i]), '\n')); err != nil {
+			return 0, err
+		}
+		s.buf = s.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush writes any remaining incomplete line.
+func (s *FieldSorter) Flush() error {
+	if len(s.buf) == 0 {
+		return nil
+	}
+	_, err := s.out.Write(s.sortLine(s.buf))
+	s.buf = s.buf[:0]
+	return err
+}
+
+// sortLine returns the line with the configured fields sorted. If the line is
+// not a json object, or contains none of the fields, it is returned as is.
+func (s *FieldSorter) sortLine(line []byte) []byte {
+	var found bool
+	for _, field := range s.fields {
+		if bytes.Contains(line, []byte(`"`+field+`"`)) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return line
+	}
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(line, &obj); err != nil {
+		return line
+	}
+	for _, field := range s.fields {
+		if val, ok := obj[field]; ok {
+			obj[field] = sortValue(val)
+		}
+	}
+	// Note: marshalling the map also sorts the keys of the line itself.
+	out, err := json.Marshal(obj)
+	if err != nil {
+		return line
+	}
+	return out
+}
+
+// sortValue returns the array with its elements sorted, or the object with
+// its keys sorted. Nested objects have their keys sorted too, so that the
+// order of keys does not matter. Other values are returned as is.
+func sortValue(val json.RawMessage) json.RawMessage {
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(val))
+	dec.UseNumber() // Don't lose precision
+	if err := dec.Decode(&v); err != nil {
+		return val
+	}
+	switch v := v.(type) {
+	case []interface{}:
+		var elems []string
+		for _, elem := range v {
+			data, err := json.Marshal(elem)
+			if err != nil {
+				return val
+			}
+			elems = append(elems, string(data))
+		}
+		sort.Strings(elems)
+		return json.RawMessage("[" + strings.Join(elems, ",") + "]")
+	case map[string]interface{}:
+		if data, err := json.Marshal(v); err == nil {
+			return data
+		}
+	}
+	return val
+}
@@ -0,0 +1,83 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package evms
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestFieldSorter(t *testing.T) {
+	var (
+		traceA = `{"pc":0,"op":96,"touched":["0x02","0x01",{"b":1,"a":2}],"stack":["0x1","0x2"]}
+{"pc":2,"op":0,"accounts":{"0xbb":"0x1","0xaa":"0x2"}}
+{"stateRoot":"0x01"}
+`
+		// Same as A, except for the order of elements in the fields
+		traceB = `{"pc":0,"op":96,"touched":[{"a":2, "b":1},"0x01","0x02"],"stack":["0x1","0x2"]}
+{"pc":2,"op":0,"accounts":{"0xaa":"0x2","0xbb":"0x1"}}
+{"stateRoot":"0x01"}
+`
+		// Differs from A in the order of the stack, which is not sorted
+		traceC = `{"pc":0,"op":96,"touched":["0x01","0x02",{"a":2,"b":1}],"stack":["0x2","0x1"]}
+{"pc":2,"op":0,"accounts":{"0xaa":"0x2","0xbb":"0x1"}}
+{"stateRoot":"0x01"}
+`
+		// Differs from A in the contents of the touched field
+		traceD = `{"pc":0,"op":96,"touched":["0x01","0x03",{"a":2,"b":1}],"stack":["0x1","0x2"]}
+{"pc":2,"op":0,"accounts":{"0xaa":"0x2","0xbb":"0x1"}}
+{"stateRoot":"0x01"}
+`
+		fields = []string{"touched", "accounts"}
+	)
+	normalize := func(trace string, fields []string) io.Reader {
+		out := new(strings.Builder)
+		s := NewFieldSorter(out, fields)
+		// Write it in chunks, to exercise the line buffering
+		for len(trace) > 0 {
+			n := 7
+			if n > len(trace) {
+				n = len(trace)
+			}
+			if _, err := s.Write([]byte(trace[:n])); err != nil {
+				t.Fatal(err)
+			}
+			trace = trace[n:]
+		}
+		if err := s.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		return strings.NewReader(out.String())
+	}
+	compare := func(a, b string, fields []string) bool {
+		equal, _, _, _ := compareReaders([]string{"a", "b"}, []io.Reader{normalize(a, fields), normalize(b, fields)}, 0)
+		return equal
+	}
+	if compare(traceA, traceB, nil) {
+		t.Fatal("traces equal without sorting")
+	}
+	if !compare(traceA, traceB, fields) {
+		t.Fatal("traces differing in element order not equal after sorting")
+	}
+	if compare(traceA, traceC, fields) {
+		t.Fatal("traces differing in unsorted field equal")
+	}
+	if compare(traceA, traceD, fields) {
+		t.Fatal("traces differing in field contents equal")
+	}
+}
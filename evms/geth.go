@@ -20,10 +20,12 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"strings"
 	"time"
 
 	"github.com/ethereum/go-ethereum/eth/tracers/logger"
@@ -55,6 +57,11 @@ func (evm *GethEVM) Name() string {
 	return evm.name
 }
 
+// Binary returns the path to the client binary.
+func (evm *GethEVM) Binary() string {
+	return evm.path
+}
+
 // GetStateRoot runs the test and returns the stateroot
 // This currently only works for non-filled statetests. TODO: make it work even if the
 // test is filled. Either by getting the whole trace, or adding stateroot to exec std output
@@ -96,24 +103,103 @@ func (evm *GethEVM) RunStateTest(path string, out io.Writer, speedTest bool) (*t
 		cmd = exec.Command(evm.path, "--nomemory", "--noreturndata", "--nostack", "statetest", path)
 	}
 	if stderr, err = cmd.StderrPipe(); err != nil {
-		return &tracingResult{Cmd: cmd.String()}, err
+		return &tracingResult{Cmd: shellCommand(cmd)}, err
 	}
-	if err = cmd.Start(); err != nil {
-		return &tracingResult{Cmd: cmd.String()}, err
+	if err = startCmd(cmd); err != nil {
+		return &tracingResult{Cmd: shellCommand(cmd)}, err
 	}
 	// copy everything to the given writer
 	evm.Copy(out, stderr)
-	err = cmd.Wait()
+	err = waitCmd(cmd)
+	// release resources
+	duration, slow := evm.stats.TraceDone(t0)
+
+	return &tracingResult{
+		Slow:     slow,
+		ExecTime: duration,
+		Cmd:      shellCommand(cmd),
+	}, err
+}
+
+// RunBlockTest implements the BlockTester interface. The evm blocktest command
+// does not report a stateroot, so it is instead obtained from a state dump.
+func (evm *GethEVM) RunBlockTest(path string, out io.Writer, speedTest bool) (*tracingResult, error) {
+	var (
+		t0     = time.Now()
+		stderr io.ReadCloser
+		dump   = new(bytes.Buffer)
+		err    error
+		cmd    = exec.Command(evm.path, "--json", "--noreturndata", "--nomemory", "--dump", "blocktest", path)
+	)
+	if speedTest {
+		cmd = exec.Command(evm.path, "--nomemory", "--noreturndata", "--nostack", "--dump", "blocktest", path)
+	}
+	cmd.Stdout = dump
+	if stderr, err = cmd.StderrPipe(); err != nil {
+		return &tracingResult{Cmd: shellCommand(cmd)}, err
+	}
+	if err = startCmd(cmd); err != nil {
+		return &tracingResult{Cmd: shellCommand(cmd)}, err
+	}
+	// copy everything to the given writer
+	evm.copyTrace(out, stderr)
+	err = waitCmd(cmd)
+	// A block which fails validation makes evm exit with an error. That is
+	// not a failure to execute, but a result to be compared.
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		err = nil
+	}
+	root, _ := json.Marshal(stateRoot{StateRoot: parseDumpRoot(dump.Bytes())})
+	if _, err := out.Write(append(root, '\n')); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing to out: %v\n", err)
+	}
 	// release resources
 	duration, slow := evm.stats.TraceDone(t0)
 
 	return &tracingResult{
 		Slow:     slow,
 		ExecTime: duration,
-		Cmd:      cmd.String(),
+		Cmd:      shellCommand(cmd),
 	}, err
 }
 
+// DumpPostState implements the StateDumper interface.
+func (evm *GethEVM) DumpPostState(path string) (PostState, error) {
+	cmd := exec.Command(evm.path, "--dump", "statetest", path)
+	data, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", cmd.String(), err)
+	}
+	return parseGethDump(data)
+}
+
+// AccessSet implements the AccessSetReporter interface. If the file contains
+// several tests, the set of the first one is returned.
+func (evm *GethEVM) AccessSet(path string) (AccessSet, error) {
+	cmd := exec.Command(evm.path, "--json", "--noreturndata", "--nomemory", "statetest", path)
+	return runAccessSet(cmd, path)
+}
+
+// RevertData implements the RevertDataReporter interface. If the file contains
+// several tests, the outcome of the first one is returned.
+func (evm *GethEVM) RevertData(path string) (*RevertData, error) {
+	cmd := exec.Command(evm.path, "--json", "--noreturndata", "--nomemory", "--nostack", "statetest", path)
+	return runRevertData(cmd, gethRevertErr)
+}
+
+// parseDumpRoot returns the root from a state dump, or the empty string if
+// there is no dump.
+func parseDumpRoot(data []byte) string {
+	var dump struct {
+		Root string `json:"root"`
+	}
+	if err := json.Unmarshal(data, &dump); err != nil || dump.Root == "" {
+		return ""
+	}
+	return "0x" + strings.TrimPrefix(dump.Root, "0x")
+}
+
 func (vm *GethEVM) Close() {
 }
 
@@ -126,6 +212,18 @@ func (evm *GethEVM) Copy(out io.Writer, input io.Reader) {
 // copyUntilEnd reads from the reader, does some geth-specific filtering and
 // outputs items onto the channel
 func (evm *GethEVM) copyUntilEnd(out io.Writer, input io.Reader) stateRoot {
+	stateRoot := evm.copyTrace(out, input)
+	root, _ := json.Marshal(stateRoot)
+	if _, err := out.Write(append(root, '\n')); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing to out: %v\n", err)
+	}
+	return stateRoot
+}
+
+// copyTrace reads the trace from the reader, does some geth-specific filtering
+// and outputs the steps to the writer. It stops reading when the stateroot is
+// encountered, and returns it, but does not write it.
+func (evm *GethEVM) copyTrace(out io.Writer, input io.Reader) stateRoot {
 	buf := bufferPool.Get().([]byte)
 	//lint:ignore SA6002: argument should be pointer-like to avoid allocations.
 	defer bufferPool.Put(buf)
@@ -193,10 +291,6 @@ func (evm *GethEVM) copyUntilEnd(out io.Writer, input io.Reader) stateRoot {
 		yield(&elem)
 	}
 	yield(nil)
-	root, _ := json.Marshal(stateRoot)
-	if _, err := out.Write(append(root, '\n')); err != nil {
-		fmt.Fprintf(os.Stderr, "Error writing to out: %v\n", err)
-	}
 	return stateRoot
 }
 
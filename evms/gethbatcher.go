@@ -65,13 +65,13 @@ func (evm *GethBatchVM) RunStateTest(path string, out io.Writer, speedTest bool)
 			cmd = exec.Command(evm.path, "--json", "--noreturndata", "--nomemory", "statetest")
 		}
 		if stdout, err = cmd.StderrPipe(); err != nil {
-			return &tracingResult{Cmd: cmd.String()}, err
+			return &tracingResult{Cmd: shellCommand(cmd)}, err
 		}
 		if stdin, err = cmd.StdinPipe(); err != nil {
-			return &tracingResult{Cmd: cmd.String()}, err
+			return &tracingResult{Cmd: shellCommand(cmd)}, err
 		}
-		if err = cmd.Start(); err != nil {
-			return &tracingResult{Cmd: cmd.String()}, err
+		if err = startBatchCmd(cmd); err != nil {
+			return &tracingResult{Cmd: shellCommand(cmd)}, err
 		}
 		evm.cmd = cmd
 		evm.stdout = stdout
@@ -87,7 +87,7 @@ func (evm *GethBatchVM) RunStateTest(path string, out io.Writer, speedTest bool)
 	return &tracingResult{
 			Slow:     slow,
 			ExecTime: duration,
-			Cmd:      evm.cmd.String()},
+			Cmd:      batchCommand(evm.cmd, path)},
 		nil
 }
 
@@ -109,7 +109,7 @@ func (evm *GethBatchVM) GetStateRoot(path string) (root, command string, err err
 		if evm.stdin, err = evm.cmd.StdinPipe(); err != nil {
 			return "", evm.cmd.String(), err
 		}
-		if err = evm.cmd.Start(); err != nil {
+		if err = startBatchCmd(evm.cmd); err != nil {
 			return "", evm.cmd.String(), err
 		}
 	}
@@ -0,0 +1,253 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package evms
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/eth/tracers/logger"
+	"github.com/ethereum/go-ethereum/tests"
+)
+
+// GethNativeVM is an Evm-interface implementation which executes statetests
+// in-process, using the go-ethereum packages directly, instead of spawning an
+// external binary. The output is identical to that of GethEVM.
+type GethNativeVM struct {
+	name   string
+	parser *GethEVM // parser is used to convert the output into canonical form
+
+	// Some metrics
+	stats *VmStat
+}
+
+func NewGethNativeVM(name string) *GethNativeVM {
+	return &GethNativeVM{
+		name:   name,
+		parser: NewGethEVM("", name),
+		stats:  &VmStat{},
+	}
+}
+
+func (evm *GethNativeVM) Instance(int) Evm {
+	return evm
+}
+
+func (evm *GethNativeVM) Name() string {
+	return evm.name
+}
+
+// GetStateRoot runs the test and returns the stateroot
+func (evm *GethNativeVM) GetStateRoot(path string) (root, command string, err error) {
+	command = evm.command(path)
+	roots, err := evm.execute(path, nil, false, nil, nil)
+	if err != nil {
+		return "", command, err
+	}
+	if len(roots) == 0 {
+		return "", command, fmt.Errorf("%v: no stateroot found", evm.Name())
+	}
+	return roots[len(roots)-1].Hex(), command, nil
+}
+
+// ParseStateRoot reads the stateroot from the combined output.
+func (evm *GethNativeVM) ParseStateRoot(data []byte) (string, error) {
+	return evm.parser.ParseStateRoot(data)
+}
+
+// RunStateTest implements the Evm interface
+func (evm *GethNativeVM) RunStateTest(path string, out io.Writer, speedTest bool) (*tracingResult, error) {
+	var (
+		t0     = time.Now()
+		pr, pw = io.Pipe()
+		errCh  = make(chan error, 1)
+	)
+	// Execute the test, writing the raw output to the pipe, in the same
+	// format as the evm binary does.
+	go func() {
+		_, err := evm.execute(path, pw, !speedTest, nil, nil)
+		pw.Close()
+		errCh <- err
+	}()
+	evm.parser.copyUntilEnd(out, pr)
+	// Drain the remainder, in case the parser exited early
+	_, _ = io.Copy(io.Discard, pr)
+	err := <-errCh
+	duration, slow := evm.stats.TraceDone(t0)
+
+	return &tracingResult{
+		Slow:     slow,
+		ExecTime: duration,
+		Cmd:      evm.command(path),
+	}, err
+}
+
+// execute runs all subtests in the given file, and returns the resulting
+// stateroots. If out is non-nil, the stateroots (and optionally a json trace)
+// are written to it. If newTracer is non-nil, it is invoked for each subtest,
+// and the tracer it returns, if any, is used instead. If onState is non-nil,
+// it is invoked with the post-state of each subtest. Subtests for forks which
+// are not supported are skipped.
+func (evm *GethNativeVM) execute(path string, out io.Writer, trace bool, newTracer func() vm.EVMLogger, onState func(*tests.StateTestState, common.Hash)) ([]common.Hash, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var stTests map[string]tests.StateTest
+	if err := json.Unmarshal(data, &stTests); err != nil {
+		return nil, err
+	}
+	// Iterate in a deterministic order
+	var names []string
+	for name := range stTests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var roots []common.Hash
+	for _, name := range names {
+		test := stTests[name]
+		for _, st := range test.Subtests() {
+			cfg := vm.Config{}
+			if out != nil && trace {
+				cfg.Tracer = logger.NewJSONLogger(&logger.Config{}, out)
+			}
+			if newTracer != nil {
+				if tracer := newTracer(); tracer != nil {
+					cfg.Tracer = tracer
+				}
+			}
+			tstate, root, err := test.RunNoVerify(st, cfg, false, rawdb.HashScheme)
+			if tstate.StateDB == nil {
+				var unsupported tests.UnsupportedForkError
+				if errors.As(err, &unsupported) {
+					// Like the evm binary, produce no result for it, so the
+					// test shows up as empty output rather than a failure
+					continue
+				}
+				// The test could not be set up
+				return roots, err
+			}
+			if onState != nil {
+				onState(&tstate, root)
+			}
+			tstate.Close()
+			roots = append(roots, root)
+			if out != nil {
+				fmt.Fprintf(out, "{\"stateRoot\": \"%#x\"}\n", root)
+			}
+		}
+	}
+	return roots, nil
+}
+
+// DumpPostState implements the StateDumper interface. If the file contains
+// several tests, the state after the first one is returned.
+func (evm *GethNativeVM) DumpPostState(path string) (PostState, error) {
+	var dump *state.Dump
+	_, err := evm.execute(path, nil, false, nil, func(st *tests.StateTestState, root common.Hash) {
+		if dump != nil {
+			return
+		}
+		cpy, err := state.New(root, st.StateDB.Database(), nil)
+		if err != nil {
+			return
+		}
+		d := cpy.RawDump(nil)
+		dump = &d
+	})
+	if err != nil {
+		return nil, err
+	}
+	if dump == nil {
+		return nil, fmt.Errorf("%v: no state produced", evm.Name())
+	}
+	return fromDump(dump)
+}
+
+// AccessSet implements the AccessSetReporter interface. If the file contains
+// several tests, the set of the first one is returned.
+func (evm *GethNativeVM) AccessSet(path string) (AccessSet, error) {
+	set, _, err := warmAccessSet(path)
+	if err != nil {
+		return nil, err
+	}
+	var tracer *accessSetTracer
+	_, err = evm.execute(path, nil, false, func() vm.EVMLogger {
+		if tracer != nil {
+			return nil
+		}
+		tracer = newAccessSetTracer(set)
+		return tracer
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if tracer == nil {
+		return nil, fmt.Errorf("%v: no test executed", evm.Name())
+	}
+	return tracer.set, nil
+}
+
+// RevertData implements the RevertDataReporter interface. If the file contains
+// several tests, the outcome of the first one is returned.
+func (evm *GethNativeVM) RevertData(path string) (*RevertData, error) {
+	var tracer *revertTracer
+	_, err := evm.execute(path, nil, false, func() vm.EVMLogger {
+		if tracer != nil {
+			return nil
+		}
+		tracer = new(revertTracer)
+		return tracer
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if tracer == nil {
+		return nil, fmt.Errorf("%v: no test executed", evm.Name())
+	}
+	if tracer.result == nil {
+		// The transaction was not executed, e.g. due to being invalid
+		return &RevertData{}, nil
+	}
+	return tracer.result, nil
+}
+
+func (evm *GethNativeVM) command(path string) string {
+	return fmt.Sprintf("%v (in-process) statetest %v", evm.name, path)
+}
+
+func (evm *GethNativeVM) Close() {
+}
+
+// Copy reads from the reader, does some geth-specific filtering and
+// outputs items onto the channel
+func (evm *GethNativeVM) Copy(out io.Writer, input io.Reader) {
+	evm.parser.Copy(out, input)
+}
+
+func (evm *GethNativeVM) Stats() []any {
+	return evm.stats.Stats()
+}
@@ -0,0 +1,89 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package evms
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// ResourceLimits are the limits applied to spawned evm processes, to prevent a
+// single pathological test from taking down the host. A zero value means
+// no limit.
+type ResourceLimits struct {
+	Memory uint64 // Address space limit (RLIMIT_AS), in bytes
+	CPU    uint64 // CPU time limit (RLIMIT_CPU), in seconds
+}
+
+var resourceLimits ResourceLimits
+
+// cpuLimitSlack is the accuracy of the cpu time accounting, within which a
+// process killed at its cpu limit is considered to have reached it.
+const cpuLimitSlack = 100 * time.Millisecond
+
+// SetResourceLimits sets the limits for evm processes started from now on.
+// The cpu time accumulates over the lifetime of a process, so the batch-mode
+// vms, which execute all tests in one process, are exempt from the cpu limit.
+func SetResourceLimits(limits ResourceLimits) {
+	resourceLimits = limits
+}
+
+// applyLimits rewrites the command to be executed via a shell, which sets the
+// resource limits before executing the actual binary. Go does not provide a
+// way to call setrlimit in the child between fork and exec.
+func applyLimits(c *exec.Cmd, limits ResourceLimits) {
+	if c.Err != nil || (limits.Memory == 0 && limits.CPU == 0) {
+		return
+	}
+	// Leave it to Start to report a missing binary.
+	if _, err := exec.LookPath(c.Path); err != nil {
+		return
+	}
+	var script string
+	if limits.Memory != 0 {
+		// ulimit -v takes kilobytes
+		script += fmt.Sprintf("ulimit -v %d || exit 126; ", (limits.Memory+1023)/1024)
+	}
+	if limits.CPU != 0 {
+		script += fmt.Sprintf("ulimit -t %d || exit 126; ", limits.CPU)
+	}
+	script += `exec "$0" "$@"`
+	c.Args = append([]string{"sh", "-c", script, c.Path}, c.Args[1:]...)
+	c.Path, c.Err = exec.LookPath("sh")
+}
+
+// limitsExceeded returns true if the process failed due to the cpu limit: it
+// was killed by SIGXCPU, which is only sent on reaching the limit, or it used
+// up all of its cpu time (the kernel sends SIGKILL once the hard limit is
+// reached, and some runtimes exit on SIGXCPU rather than die of it).
+//
+// Failures due to the memory limit are not detected: a failed allocation makes
+// the process abort or crash, which is indistinguishable from any other crash,
+// and must be reported as such.
+func limitsExceeded(state *os.ProcessState) bool {
+	if state == nil || resourceLimits.CPU == 0 {
+		return false
+	}
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() && status.Signal() == syscall.SIGXCPU {
+		return true
+	}
+	used := state.UserTime() + state.SystemTime()
+	return used+cpuLimitSlack >= time.Duration(resourceLimits.CPU)*time.Second
+}
@@ -20,6 +20,7 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -58,6 +59,11 @@ func (evm *NethermindVM) Name() string {
 	return evm.name
 }
 
+// Binary returns the path to the client binary.
+func (evm *NethermindVM) Binary() string {
+	return evm.path
+}
+
 // GetStateRoot runs the test and returns the stateroot
 func (evm *NethermindVM) GetStateRoot(path string) (root, command string, err error) {
 	// In this mode, we can run it without tracing
@@ -89,34 +95,38 @@ func (evm *NethermindVM) RunStateTest(path string, out io.Writer, speedTest bool
 	var (
 		t0      = time.Now()
 		procOut io.ReadCloser
+		stderr  *stderrBuffer
 		err     error
 		cmd     = exec.Command(evm.path, "--trace", "-m", "--input", path)
 	)
 	if !speedTest {
 		// in normal execution, we read traces from standard error
 		if procOut, err = cmd.StderrPipe(); err != nil {
-			return &tracingResult{Cmd: cmd.String()}, err
+			return &tracingResult{Cmd: shellCommand(cmd)}, err
 		}
 	} else {
 		// In speedtest-mode, we don't want the actual traces, but we do
 		// need to read the stateroot. The stateroot can be found on stdout
 		cmd = exec.Command(evm.path, "-m", "--neverTrace", "--input", path)
-		if procOut, err = cmd.StdoutPipe(); err != nil {
-			return &tracingResult{Cmd: cmd.String()}, err
+		if procOut, stderr, err = stdoutPipe(cmd, "nethermind"); err != nil {
+			return &tracingResult{Cmd: shellCommand(cmd)}, err
 		}
 	}
-	if err = cmd.Start(); err != nil {
-		return &tracingResult{Cmd: cmd.String()}, err
+	if err = startCmd(cmd); err != nil {
+		return &tracingResult{Cmd: shellCommand(cmd)}, err
 	}
 	// copy everything to the given writer
 	evm.copyUntilEnd(out, procOut, speedTest)
 	// release resources, handle error but ignore non-zero exit codes
-	_ = cmd.Wait()
+	if err = waitCmd(cmd); !errors.Is(err, ErrResourceExhausted) {
+		err = nil
+	}
 	duration, slow := evm.stats.TraceDone(t0)
 	return &tracingResult{
 		Slow:     slow,
 		ExecTime: duration,
-		Cmd:      cmd.String()}, nil
+		Cmd:      shellCommand(cmd),
+		Stderr:   stderr.take()}, err
 }
 
 func (vm *NethermindVM) Close() {
@@ -29,6 +29,7 @@ type NethermindBatchVM struct {
 	NethermindVM
 	cmd     *exec.Cmd // the 'master' process
 	procOut io.ReadCloser
+	stderr  *stderrBuffer
 	stdin   io.WriteCloser
 	mu      sync.Mutex
 }
@@ -55,6 +56,7 @@ func (evm *NethermindBatchVM) RunStateTest(path string, out io.Writer, speedTest
 		t0      = time.Now()
 		err     error
 		procOut io.ReadCloser
+		stderr  *stderrBuffer
 		stdin   io.WriteCloser
 		cmd     = exec.Command(evm.path, "-x", "--trace", "-m")
 	)
@@ -62,24 +64,25 @@ func (evm *NethermindBatchVM) RunStateTest(path string, out io.Writer, speedTest
 		if !speedTest {
 			// in normal execution, we read traces from standard error
 			if procOut, err = cmd.StderrPipe(); err != nil {
-				return &tracingResult{Cmd: cmd.String()}, err
+				return &tracingResult{Cmd: shellCommand(cmd)}, err
 			}
 		} else {
 			// In speedtest-mode, we don't want the actual traces, but we do
 			// need to read the stateroot. The stateroot can be found on stdout
 			cmd = exec.Command(evm.path, "-x", "-m", "--neverTrace")
-			if procOut, err = cmd.StdoutPipe(); err != nil {
-				return &tracingResult{Cmd: cmd.String()}, err
+			if procOut, stderr, err = stdoutPipe(cmd, "nethbatch"); err != nil {
+				return &tracingResult{Cmd: shellCommand(cmd)}, err
 			}
 		}
 		if stdin, err = cmd.StdinPipe(); err != nil {
-			return &tracingResult{Cmd: cmd.String()}, err
+			return &tracingResult{Cmd: shellCommand(cmd)}, err
 		}
-		if err = cmd.Start(); err != nil {
-			return &tracingResult{Cmd: cmd.String()}, err
+		if err = startBatchCmd(cmd); err != nil {
+			return &tracingResult{Cmd: shellCommand(cmd)}, err
 		}
 		evm.cmd = cmd
 		evm.procOut = procOut
+		evm.stderr = stderr
 		evm.stdin = stdin
 	}
 	evm.mu.Lock()
@@ -91,7 +94,8 @@ func (evm *NethermindBatchVM) RunStateTest(path string, out io.Writer, speedTest
 	return &tracingResult{
 		Slow:     slow,
 		ExecTime: duration,
-		Cmd:      evm.cmd.String(),
+		Cmd:      batchCommand(evm.cmd, path),
+		Stderr:   evm.stderr.take(),
 	}, nil
 }
 
@@ -113,7 +117,7 @@ func (evm *NethermindBatchVM) GetStateRoot(path string) (root, command string, e
 		if evm.stdin, err = evm.cmd.StdinPipe(); err != nil {
 			return "", evm.cmd.String(), err
 		}
-		if err = evm.cmd.Start(); err != nil {
+		if err = startBatchCmd(evm.cmd); err != nil {
 			return "", evm.cmd.String(), err
 		}
 	}
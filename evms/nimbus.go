@@ -20,6 +20,7 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -54,6 +55,11 @@ func (evm *NimbusEVM) Name() string {
 	return evm.name
 }
 
+// Binary returns the path to the client binary.
+func (evm *NimbusEVM) Binary() string {
+	return evm.path
+}
+
 // GetStateRoot runs the test and returns the stateroot
 // This currently only works for non-filled statetests. TODO: make it work even if the
 // test is filled. Either by getting the whole trace, or adding stateroot to exec std output
@@ -96,23 +102,25 @@ func (evm *NimbusEVM) RunStateTest(path string, out io.Writer, speedTest bool) (
 		cmd = exec.Command(evm.path, "--json", "--noreturndata", "--nomemory", "--nostorage", path)
 	}
 	if stderr, err = cmd.StderrPipe(); err != nil {
-		return &tracingResult{Cmd: cmd.String()}, err
+		return &tracingResult{Cmd: shellCommand(cmd)}, err
 	}
-	if err = cmd.Start(); err != nil {
-		return &tracingResult{Cmd: cmd.String()}, err
+	if err = startCmd(cmd); err != nil {
+		return &tracingResult{Cmd: shellCommand(cmd)}, err
 	}
 	// copy everything to the given writer
 	evm.Copy(out, stderr)
 	// Nimbus returns a non-zero exit code for tests that do not pass. We just ignore that.
-	_ = cmd.Wait()
+	if err = waitCmd(cmd); !errors.Is(err, ErrResourceExhausted) {
+		err = nil
+	}
 	// release resources
 	duration, slow := evm.stats.TraceDone(t0)
 
 	return &tracingResult{
 		Slow:     slow,
 		ExecTime: duration,
-		Cmd:      cmd.String(),
-	}, nil
+		Cmd:      shellCommand(cmd),
+	}, err
 }
 
 func (vm *NimbusEVM) Close() {
@@ -18,10 +18,12 @@ package evms
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -86,6 +88,91 @@ func testVmsOutput(t *testing.T, testfile string) {
 	}
 }
 
+// TestGethNativeOutput checks that the in-process geth produces the same output
+// as the geth binary did.
+func TestGethNativeOutput(t *testing.T) {
+	finfos, err := os.ReadDir(filepath.Join("testdata", "cases"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		native = NewGethNativeVM("native")
+		geth   = NewGethEVM("", "gethvm")
+	)
+	for _, finfo := range finfos {
+		var (
+			testcase = filepath.Join("testdata", "cases", finfo.Name())
+			trace    = filepath.Join("testdata", "traces", finfo.Name())
+			have     = new(bytes.Buffer)
+			want     = new(bytes.Buffer)
+		)
+		if _, err := native.RunStateTest(testcase, have, false); err != nil {
+			t.Fatalf("%v: %v", finfo.Name(), err)
+		}
+		rawOutput, err := os.Open(fmt.Sprintf("%v.geth.stderr.txt", trace))
+		if err != nil {
+			t.Fatal(err)
+		}
+		geth.Copy(want, rawOutput)
+		rawOutput.Close()
+		if eq, _, data := CompareFiles([]Evm{native, geth}, []io.Reader{have, want}); !eq {
+			t.Log(data)
+			t.Errorf("Expected equality, didn't get it, file: %v", finfo.Name())
+		}
+	}
+}
+
+// TestGethNativeUnsupportedFork checks that a test for a fork which the
+// in-process geth does not support yields empty output, not an error.
+func TestGethNativeUnsupportedFork(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "cases", "00003656-naivefuzz-0.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = bytes.Replace(data, []byte(`"London"`), []byte(`"Nosuchfork"`), 1)
+	path := filepath.Join(t.TempDir(), "unsupported.json")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	out := new(bytes.Buffer)
+	if _, err := NewGethNativeVM("native").RunStateTest(path, out, false); err != nil {
+		t.Fatal(err)
+	}
+	if !IsEmptyOutput(out.Bytes()) {
+		t.Fatalf("expected empty output, got %q", out)
+	}
+}
+
+func TestCompareFilesLimit(t *testing.T) {
+	var (
+		vms = []Evm{NewGethEVM("", "a"), NewGethEVM("", "b")}
+		a   = "line1\nline2\nline3\n"
+		b   = "line1\nline2\nline3-diff\nline4\n"
+	)
+	for i, tc := range []struct {
+		limit int
+		eq    bool
+		count int
+	}{
+		{0, false, 2},
+		{1, true, 1},
+		{2, true, 2},
+		{3, false, 2},
+		{10, false, 2},
+	} {
+		readers := []io.Reader{strings.NewReader(a), strings.NewReader(b)}
+		eq, count, _ := CompareFilesLimit(vms, readers, tc.limit)
+		if eq != tc.eq || count != tc.count {
+			t.Errorf("test %d: have eq=%v count=%d, want eq=%v count=%d", i, eq, count, tc.eq, tc.count)
+		}
+	}
+	// Differing lengths are ignored if the limit is reached before the shorter ends
+	readers := []io.Reader{strings.NewReader("x\ny\n"), strings.NewReader("x\ny\nz\n")}
+	if eq, _, _ := CompareFilesLimit(vms, readers, 2); !eq {
+		t.Errorf("expected equality within limit")
+	}
+}
+
 func TestStateRootGeth(t *testing.T) {
 	testStateRootOnly(t, NewGethEVM("", ""), "geth")
 }
@@ -159,3 +246,56 @@ func testStateRootOnly(t *testing.T, vm Evm, name string) {
 		}
 	}
 }
+
+// TestWrongPostOutput checks that a test with a wrong post-state expectation,
+// which all clients fail, produces the same output as the correct one: the
+// expectation must not affect the comparison.
+func TestWrongPostOutput(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "cases", "statetest_filled.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var test map[string]struct {
+		Env  json.RawMessage            `json:"env"`
+		Pre  json.RawMessage            `json:"pre"`
+		Tx   json.RawMessage            `json:"transaction"`
+		Post map[string][]stPostSubtest `json:"post"`
+	}
+	if err := json.Unmarshal(data, &test); err != nil {
+		t.Fatal(err)
+	}
+	for _, st := range test {
+		for _, posts := range st.Post {
+			for i := range posts {
+				posts[i].Hash = "0x" + strings.Repeat("de", 32)
+			}
+		}
+	}
+	wrong := filepath.Join(t.TempDir(), "wrongpost.json")
+	if data, err = json.Marshal(test); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(wrong, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	var (
+		vm   = NewGethNativeVM("native")
+		have = new(bytes.Buffer)
+		want = new(bytes.Buffer)
+	)
+	if _, err := vm.RunStateTest(filepath.Join("testdata", "cases", "statetest_filled.json"), want, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vm.RunStateTest(wrong, have, false); err != nil {
+		t.Fatal(err)
+	}
+	if eq, _, diff := CompareFiles([]Evm{vm, vm}, []io.Reader{have, want}); !eq {
+		t.Fatalf("wrong expectation changed the output: %v", diff)
+	}
+}
+
+type stPostSubtest struct {
+	Hash    string          `json:"hash"`
+	Logs    string          `json:"logs"`
+	Indexes json.RawMessage `json:"indexes"`
+}
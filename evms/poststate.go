@@ -0,0 +1,294 @@
+// Copyright 2019 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package evms
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Account is an account in the post-state of a test, as reported by a vm.
+type Account struct {
+	Balance  *big.Int
+	Nonce    uint64
+	CodeHash common.Hash
+	Code     []byte
+	Storage  map[common.Hash]common.Hash
+}
+
+// PostState is the state after executing a test.
+type PostState map[common.Address]*Account
+
+// StateDumper is implemented by the Evm implementations which can report the
+// full post-state of a statetest.
+type StateDumper interface {
+	// DumpPostState runs the statetest and returns the post-state.
+	DumpPostState(path string) (PostState, error)
+}
+
+// fromDump converts a go-ethereum state dump into a PostState.
+func fromDump(dump *state.Dump) (PostState, error) {
+	post := make(PostState)
+	for key, acc := range dump.Accounts {
+		if !common.IsHexAddress(key) {
+			return nil, fmt.Errorf("account without address in dump: %v", key)
+		}
+		balance, ok := new(big.Int).SetString(acc.Balance, 10)
+		if !ok {
+			return nil, fmt.Errorf("invalid balance %q", acc.Balance)
+		}
+		account := &Account{
+			Balance:  balance,
+			Nonce:    acc.Nonce,
+			CodeHash: common.BytesToHash(acc.CodeHash),
+			Code:     acc.Code,
+			Storage:  make(map[common.Hash]common.Hash),
+		}
+		for k, v := range acc.Storage {
+			account.Storage[k] = common.HexToHash(v)
+		}
+		post[common.HexToAddress(key)] = account
+	}
+	return post, nil
+}
+
+// parseGethDump parses the post-state from the output of
+// 'evm statetest --dump'. If the file contains several tests, the state after
+// the first one is returned.
+func parseGethDump(data []byte) (PostState, error) {
+	var results []struct {
+		State *state.Dump `json:"state"`
+	}
+	if err := json.Unmarshal(data, &results); err != nil {
+		return nil, err
+	}
+	if len(results) == 0 || results[0].State == nil {
+		return nil, fmt.Errorf("no state dump found")
+	}
+	return fromDump(results[0].State)
+}
+
+// CompareDeployedCode compares the code of all accounts across the given
+// post-states, and returns a description of each mismatch found.
+func CompareDeployedCode(names []string, states []PostState) []string {
+	return compareAccounts("deployed code", names, states, func(acc *Account) string {
+		// A missing account has no code
+		if acc == nil {
+			return types.EmptyCodeHash.Hex()
+		}
+		return codeHash(acc).Hex()
+	})
+}
+
+// CompareNonces compares the nonces of all accounts across the given
+// post-states, and returns a description of each mismatch found.
+func CompareNonces(names []string, states []PostState) []string {
+	return compareAccounts("nonce", names, states, func(acc *Account) string {
+		// A missing account has nonce zero
+		if acc == nil {
+			return "0"
+		}
+		return fmt.Sprint(acc.Nonce)
+	})
+}
+
+// CompareBalances compares the balances of all accounts across the given
+// post-states, and returns a description of each mismatch found.
+func CompareBalances(names []string, states []PostState) []string {
+	return compareAccounts("balance", names, states, func(acc *Account) string {
+		// A missing account has no balance
+		if acc == nil || acc.Balance == nil {
+			return "0"
+		}
+		return acc.Balance.String()
+	})
+}
+
+// CompareExistence compares which accounts exist across the given
+// post-states, and returns a description of each mismatch found.
+func CompareExistence(names []string, states []PostState) []string {
+	return compareAccounts("existence", names, states, func(acc *Account) string {
+		return fmt.Sprint(acc != nil)
+	})
+}
+
+// CompareStorage compares the storage slots of all accounts across the given
+// post-states, and returns a description of each mismatch found.
+func CompareStorage(names []string, states []PostState) []string {
+	var (
+		addrs = make(map[common.Address]bool)
+		diffs []string
+	)
+	for _, post := range states {
+		for addr := range post {
+			addrs[addr] = true
+		}
+	}
+	for _, addr := range sortedAddresses(addrs) {
+		slots := make(map[common.Hash]bool)
+		for _, post := range states {
+			if acc := post[addr]; acc != nil {
+				for k := range acc.Storage {
+					slots[k] = true
+				}
+			}
+		}
+		var keys []common.Hash
+		for k := range slots {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].Cmp(keys[j]) < 0
+		})
+		for _, key := range keys {
+			var (
+				values = make([]common.Hash, len(states))
+				differ bool
+			)
+			for i, post := range states {
+				// A missing slot is zero
+				if acc := post[addr]; acc != nil {
+					values[i] = acc.Storage[key]
+				}
+				differ = differ || values[i] != values[0]
+			}
+			if !differ {
+				continue
+			}
+			var details []string
+			for i, v := range values {
+				details = append(details, fmt.Sprintf("%v=%v", names[i], v.Hex()))
+			}
+			diffs = append(diffs, fmt.Sprintf("storage mismatch at address %v slot %v: %v",
+				addr, key.Hex(), strings.Join(details, " ")))
+		}
+	}
+	return diffs
+}
+
+// ComparePostStates compares the entire post-states: which accounts exist,
+// and their balances, nonces, code and storage. It returns a description of
+// each mismatch found.
+func ComparePostStates(names []string, states []PostState) []string {
+	var diffs []string
+	diffs = append(diffs, CompareExistence(names, states)...)
+	diffs = append(diffs, CompareBalances(names, states)...)
+	diffs = append(diffs, CompareNonces(names, states)...)
+	diffs = append(diffs, CompareDeployedCode(names, states)...)
+	diffs = append(diffs, CompareStorage(names, states)...)
+	return diffs
+}
+
+// Hash returns a hash of the post-state, which is equal for post-states which
+// ComparePostStates finds no mismatches between.
+func (post PostState) Hash() common.Hash {
+	addrs := make(map[common.Address]bool)
+	for addr := range post {
+		addrs[addr] = true
+	}
+	var enc []byte
+	for _, addr := range sortedAddresses(addrs) {
+		acc := post[addr]
+		balance := new(big.Int)
+		if acc.Balance != nil {
+			balance = acc.Balance
+		}
+		enc = append(enc, addr.Bytes()...)
+		enc = append(enc, common.BigToHash(balance).Bytes()...)
+		enc = append(enc, common.BigToHash(new(big.Int).SetUint64(acc.Nonce)).Bytes()...)
+		enc = append(enc, codeHash(acc).Bytes()...)
+		var keys []common.Hash
+		for k, v := range acc.Storage {
+			// Zero slots are the same as missing ones
+			if v != (common.Hash{}) {
+				keys = append(keys, k)
+			}
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].Cmp(keys[j]) < 0
+		})
+		enc = binary.BigEndian.AppendUint64(enc, uint64(len(keys)))
+		for _, k := range keys {
+			enc = append(enc, k.Bytes()...)
+			enc = append(enc, acc.Storage[k].Bytes()...)
+		}
+	}
+	return crypto.Keccak256Hash(enc)
+}
+
+// compareAccounts compares a property, as given by the field function, of all
+// accounts across the given post-states. The field function is called with nil
+// for accounts missing from a post-state.
+func compareAccounts(what string, names []string, states []PostState, field func(*Account) string) []string {
+	var (
+		addrs = make(map[common.Address]bool)
+		diffs []string
+	)
+	for _, post := range states {
+		for addr := range post {
+			addrs[addr] = true
+		}
+	}
+	for _, addr := range sortedAddresses(addrs) {
+		var (
+			values = make([]string, len(states))
+			differ bool
+		)
+		for i, post := range states {
+			values[i] = field(post[addr])
+			differ = differ || values[i] != values[0]
+		}
+		if !differ {
+			continue
+		}
+		var details []string
+		for i, v := range values {
+			details = append(details, fmt.Sprintf("%v=%v", names[i], v))
+		}
+		diffs = append(diffs, fmt.Sprintf("%v mismatch at address %v: %v", what, addr, strings.Join(details, " ")))
+	}
+	return diffs
+}
+
+// codeHash returns the hash of the account code, computing it from the code
+// if the vm did not report it.
+func codeHash(acc *Account) common.Hash {
+	if acc.CodeHash != (common.Hash{}) {
+		return acc.CodeHash
+	}
+	return crypto.Keccak256Hash(acc.Code)
+}
+
+func sortedAddresses(set map[common.Address]bool) []common.Address {
+	var addrs []common.Address
+	for addr := range set {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		return addrs[i].Cmp(addrs[j]) < 0
+	})
+	return addrs
+}
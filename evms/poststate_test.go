@@ -0,0 +1,175 @@
+// Copyright 2019 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package evms
+
+import (
+	"fmt"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestParseGethDump(t *testing.T) {
+	data := []byte(`[
+  {
+    "name": "test",
+    "pass": false,
+    "stateRoot": "0xa2b3391f7a85bf1ad08dc541a1b99da3c591c156351391f26ec88c557ff12134",
+    "fork": "Cancun",
+    "state": {
+      "root": "a2b3391f7a85bf1ad08dc541a1b99da3c591c156351391f26ec88c557ff12134",
+      "accounts": {
+        "0x00000000000000000000000000000000000000f1": {
+          "balance": "1000",
+          "nonce": 2,
+          "root": "0x56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421",
+          "codeHash": "0xbc36789e7a1e281436464229828f817d6612f7b477d66591ff96a9e064bcc98a",
+          "code": "0x00",
+          "storage": {
+            "0x0000000000000000000000000000000000000000000000000000000000000001": "02"
+          }
+        }
+      }
+    }
+  }
+]`)
+	post, err := parseGethDump(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acc, ok := post[common.HexToAddress("0xf1")]
+	if !ok {
+		t.Fatal("account missing")
+	}
+	if acc.Balance.Cmp(big.NewInt(1000)) != 0 || acc.Nonce != 2 {
+		t.Errorf("wrong balance/nonce: %v %d", acc.Balance, acc.Nonce)
+	}
+	if have, want := acc.CodeHash, crypto.Keccak256Hash([]byte{0}); have != want {
+		t.Errorf("wrong code hash: have %v want %v", have, want)
+	}
+	if have := acc.Storage[common.HexToHash("0x01")]; have != common.HexToHash("0x02") {
+		t.Errorf("wrong storage value: %v", have)
+	}
+}
+
+func TestGethNativeDump(t *testing.T) {
+	vm := NewGethNativeVM("native")
+	post, err := vm.DumpPostState(filepath.Join("testdata", "cases", "statetest1.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(post) == 0 {
+		t.Fatal("empty post-state")
+	}
+	// Compare with itself: no differences expected
+	if diffs := CompareDeployedCode([]string{"a", "b"}, []PostState{post, post}); len(diffs) != 0 {
+		t.Fatalf("unexpected differences: %v", diffs)
+	}
+}
+
+func TestCompareDeployedCode(t *testing.T) {
+	var (
+		addrA = common.HexToAddress("0xaa")
+		addrB = common.HexToAddress("0xbb")
+		a     = PostState{
+			addrA: {Code: []byte{1}},
+			addrB: {Code: []byte{}},
+		}
+		b = PostState{
+			addrA: {Code: []byte{2}},
+		}
+	)
+	diffs := CompareDeployedCode([]string{"x", "y"}, []PostState{a, b})
+	if len(diffs) != 1 {
+		t.Fatalf("expected one difference, got %v", diffs)
+	}
+	if !strings.HasPrefix(diffs[0], "deployed code mismatch at address "+addrA.Hex()) {
+		t.Fatalf("wrong report: %v", diffs[0])
+	}
+}
+
+func TestCompareNonces(t *testing.T) {
+	var (
+		addrA = common.HexToAddress("0xaa")
+		addrB = common.HexToAddress("0xbb")
+		addrC = common.HexToAddress("0xcc")
+		a     = PostState{
+			addrA: {Nonce: 1},
+			addrB: {Nonce: 0},
+			addrC: {Nonce: 3},
+		}
+		b = PostState{
+			addrA: {Nonce: 2},
+			addrC: {Nonce: 3},
+		}
+	)
+	diffs := CompareNonces([]string{"geth", "besu"}, []PostState{a, b})
+	if len(diffs) != 1 {
+		t.Fatalf("expected one difference, got %v", diffs)
+	}
+	if want := fmt.Sprintf("nonce mismatch at address %v: geth=1 besu=2", addrA.Hex()); diffs[0] != want {
+		t.Fatalf("wrong report: have %q want %q", diffs[0], want)
+	}
+}
+
+func TestComparePostStates(t *testing.T) {
+	var (
+		addrA = common.HexToAddress("0xaa")
+		addrB = common.HexToAddress("0xbb")
+		addrC = common.HexToAddress("0xcc")
+		slot1 = common.HexToHash("0x01")
+		slot2 = common.HexToHash("0x02")
+		a     = PostState{
+			addrA: {Balance: big.NewInt(1), Storage: map[common.Hash]common.Hash{slot1: common.HexToHash("0x1")}},
+			addrB: {Balance: big.NewInt(2), Storage: map[common.Hash]common.Hash{slot2: {}}},
+			addrC: {Balance: big.NewInt(0)},
+		}
+		b = PostState{
+			addrA: {Balance: big.NewInt(1), Storage: map[common.Hash]common.Hash{slot1: common.HexToHash("0x2")}},
+			addrB: {Balance: big.NewInt(3)},
+		}
+	)
+	diffs := ComparePostStates([]string{"geth", "besu"}, []PostState{a, b})
+	want := []string{
+		fmt.Sprintf("existence mismatch at address %v: geth=true besu=false", addrC.Hex()),
+		fmt.Sprintf("balance mismatch at address %v: geth=2 besu=3", addrB.Hex()),
+		fmt.Sprintf("storage mismatch at address %v slot %v: geth=%v besu=%v", addrA.Hex(), slot1.Hex(),
+			common.HexToHash("0x1").Hex(), common.HexToHash("0x2").Hex()),
+	}
+	if fmt.Sprint(diffs) != fmt.Sprint(want) {
+		t.Fatalf("wrong report:\nhave %q\nwant %q", diffs, want)
+	}
+	if a.Hash() == b.Hash() {
+		t.Fatal("different post-states have the same hash")
+	}
+	// A zero slot is the same as a missing one
+	c := PostState{
+		addrA: {Balance: big.NewInt(1), Storage: map[common.Hash]common.Hash{slot1: common.HexToHash("0x1")}},
+		addrB: {Balance: big.NewInt(2)},
+		addrC: {Balance: big.NewInt(0)},
+	}
+	if diffs := ComparePostStates([]string{"a", "c"}, []PostState{a, c}); len(diffs) != 0 {
+		t.Fatalf("unexpected differences: %v", diffs)
+	}
+	if a.Hash() != c.Hash() {
+		t.Fatal("equal post-states have different hashes")
+	}
+}
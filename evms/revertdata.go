@@ -0,0 +1,182 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package evms
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os/exec"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// RevertData is the outcome of the outermost call of a transaction: whether
+// it reverted, and if so, the data it returned (e.g. an abi-encoded
+// Error(string)). Unlike the return data in the steps of a trace, this is the
+// final result of the transaction.
+type RevertData struct {
+	Reverted bool
+	Data     []byte
+}
+
+// RevertDataReporter is implemented by the Evm implementations which can
+// report the return data of the outermost call of a statetest.
+type RevertDataReporter interface {
+	// RevertData runs the statetest and returns the outcome of the
+	// outermost call.
+	RevertData(path string) (*RevertData, error)
+}
+
+func (r *RevertData) String() string {
+	if !r.Reverted {
+		return "no revert"
+	}
+	return "revert " + hexutil.Encode(r.Data)
+}
+
+// Hash returns a hash of the outcome, which is equal for outcomes which
+// CompareRevertData finds no mismatch between.
+func (r *RevertData) Hash() common.Hash {
+	return crypto.Keccak256Hash([]byte(r.String()))
+}
+
+// CompareRevertData compares the outcomes reported by the clients, and returns
+// a description of the mismatch, if any.
+func CompareRevertData(names []string, results []*RevertData) []string {
+	var differ bool
+	for _, r := range results {
+		differ = differ || r.String() != results[0].String()
+	}
+	if !differ {
+		return nil
+	}
+	var details []string
+	for i, r := range results {
+		details = append(details, fmt.Sprintf("%v=%v", names[i], r))
+	}
+	return []string{fmt.Sprintf("revert data mismatch: %v", strings.Join(details, " "))}
+}
+
+// gethRevertErr is the error with which geth and erigon report a revert.
+var gethRevertErr = vm.ErrExecutionReverted.Error()
+
+// outputLine is the line with the result of the outermost call, which follows
+// the steps in the json traces of geth and similar clients:
+//
+//	{"output":"08c379a0...","gasUsed":"0x6a4a","error":"execution reverted"}
+type outputLine struct {
+	Output *string `json:"output"`
+	Error  string  `json:"error"`
+}
+
+// parseRevertData reads a json trace and returns the outcome from the first
+// output line, i.e. that of the first subtest. A trace without an output line
+// has no revert. The revertErr is the error
+// with which the client reports a revert.
+func parseRevertData(input io.Reader, revertErr string) (*RevertData, error) {
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 1024*1024), 32*1024*1024)
+	for scanner.Scan() {
+		data := scanner.Bytes()
+		if !strings.Contains(string(data), `"output"`) {
+			continue
+		}
+		var line outputLine
+		if err := json.Unmarshal(data, &line); err != nil || line.Output == nil {
+			continue
+		}
+		if line.Error != revertErr {
+			return &RevertData{}, nil
+		}
+		output := *line.Output
+		if !strings.HasPrefix(output, "0x") {
+			output = "0x" + output
+		}
+		ret, err := hexutil.Decode(output)
+		if err != nil {
+			return nil, fmt.Errorf("invalid output %q: %w", *line.Output, err)
+		}
+		return &RevertData{Reverted: true, Data: ret}, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	// No call was made, e.g. since the transaction was invalid
+	return &RevertData{}, nil
+}
+
+// runRevertData executes the command, and parses the outcome from the json
+// trace it writes to stderr.
+func runRevertData(cmd *exec.Cmd, revertErr string) (*RevertData, error) {
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := startCmd(cmd); err != nil {
+		return nil, err
+	}
+	res, parseErr := parseRevertData(stderr, revertErr)
+	// Drain the remainder, so the process can exit
+	_, _ = io.Copy(io.Discard, stderr)
+	if err := waitCmd(cmd); err != nil {
+		return nil, fmt.Errorf("%v: %w", cmd.String(), err)
+	}
+	if parseErr != nil {
+		return nil, fmt.Errorf("%v: %w", cmd.String(), parseErr)
+	}
+	return res, nil
+}
+
+// revertTracer is a vm.EVMLogger which records the outcome of the outermost
+// call.
+type revertTracer struct {
+	result *RevertData
+}
+
+func (t *revertTracer) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+}
+
+func (t *revertTracer) CaptureTxStart(gasLimit uint64) {}
+
+func (t *revertTracer) CaptureTxEnd(restGas uint64) {}
+
+func (t *revertTracer) CaptureStart(env *vm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+}
+
+func (t *revertTracer) CaptureEnd(output []byte, gasUsed uint64, err error) {
+	t.result = &RevertData{}
+	if errors.Is(err, vm.ErrExecutionReverted) {
+		t.result.Reverted = true
+		t.result.Data = common.CopyBytes(output)
+	}
+}
+
+func (t *revertTracer) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+}
+
+func (t *revertTracer) CaptureExit(output []byte, gasUsed uint64, err error) {}
+
+func (t *revertTracer) CaptureFault(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+}
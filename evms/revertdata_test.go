@@ -0,0 +1,117 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package evms
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompareRevertData(t *testing.T) {
+	var (
+		a = &RevertData{Reverted: true, Data: []byte{0x08, 0xc3, 0x79, 0xa0}}
+		b = &RevertData{Reverted: true, Data: []byte{0x08, 0xc3}}
+		c = &RevertData{}
+	)
+	diffs := CompareRevertData([]string{"geth", "erigon", "native"}, []*RevertData{a, b, c})
+	want := "revert data mismatch: geth=revert 0x08c379a0 erigon=revert 0x08c3 native=no revert"
+	if len(diffs) != 1 || diffs[0] != want {
+		t.Fatalf("wrong report:\nhave %q\nwant %q", diffs, want)
+	}
+	if a.Hash() == b.Hash() || c.Hash() == (&RevertData{Reverted: true}).Hash() {
+		t.Fatal("different outcomes have the same hash")
+	}
+	if diffs := CompareRevertData([]string{"a", "b"}, []*RevertData{a, {Reverted: true, Data: []byte{0x08, 0xc3, 0x79, 0xa0}}}); len(diffs) != 0 {
+		t.Fatalf("unexpected differences: %v", diffs)
+	}
+}
+
+func TestParseRevertData(t *testing.T) {
+	for i, tc := range []struct {
+		input string
+		want  string
+	}{
+		{`{"pc":0,"op":96,"gas":"0x79bc18","depth":1}
+{"output":"0000002a","gasUsed":"0x5208","error":"execution reverted"}
+{"stateRoot": "0xa2b3391f7a85bf1ad08dc541a1b99da3c591c156351391f26ec88c557ff12134"}`, "revert 0x0000002a"},
+		{`{"output":"","gasUsed":"0x5208","error":"execution reverted"}`, "revert 0x"},
+		{`{"output":"0x2a","gasUsed":"0x5208"}`, "no revert"},
+		{`{"output":"","gasUsed":"0x4757","error":"out of gas"}`, "no revert"},
+		// Only the first subtest is considered
+		{`{"output":"","gasUsed":"0x4757"}
+{"output":"01","gasUsed":"0x5208","error":"execution reverted"}`, "no revert"},
+		// No call at all
+		{`{"stateRoot": "0xa2b3391f7a85bf1ad08dc541a1b99da3c591c156351391f26ec88c557ff12134"}`, "no revert"},
+	} {
+		res, err := parseRevertData(strings.NewReader(tc.input), gethRevertErr)
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		if have := res.String(); have != tc.want {
+			t.Errorf("test %d: have %q, want %q", i, have, tc.want)
+		}
+	}
+	if _, err := parseRevertData(strings.NewReader(`{"output":"zz","error":"execution reverted"}`), gethRevertErr); err == nil {
+		t.Fatal("expected error for invalid output")
+	}
+	// A trace from the testdata, which does not revert
+	f, err := os.Open(filepath.Join("testdata", "traces", "negative_refund.json.geth.stderr.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	res, err := parseRevertData(f, gethRevertErr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Reverted {
+		t.Fatalf("unexpected revert: %v", res)
+	}
+}
+
+func TestGethNativeRevertData(t *testing.T) {
+	// A test whose callee reverts with a word of data
+	data, err := os.ReadFile(filepath.Join("testdata", "cases", "00003656-naivefuzz-0.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = bytes.Replace(data, []byte(`"0x600060006000600060f35af450600354506000`),
+		[]byte(`"0x602a60005260206000fd`), 1)
+	path := filepath.Join(t.TempDir(), "revert.json")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	vm := NewGethNativeVM("native")
+	res, err := vm.RevertData(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "revert 0x000000000000000000000000000000000000000000000000000000000000002a"
+	if res.String() != want {
+		t.Fatalf("have %v, want %v", res, want)
+	}
+	// The original test does not revert at the top level
+	if res, err = vm.RevertData(filepath.Join("testdata", "cases", "00003656-naivefuzz-0.json")); err != nil {
+		t.Fatal(err)
+	}
+	if res.Reverted {
+		t.Fatalf("unexpected revert: %v", res)
+	}
+}
@@ -58,6 +58,11 @@ func (evm *RethVM) Name() string {
 	return fmt.Sprintf("revm-%s", evm.name)
 }
 
+// Binary returns the path to the client binary.
+func (evm *RethVM) Binary() string {
+	return evm.path
+}
+
 func (evm *RethVM) GetStateRoot(path string) (root, command string, err error) {
 	cmd := exec.Command(evm.path, "statetest", "--json-outcome", path)
 	data, err := StdErrOutput(cmd)
@@ -104,12 +109,12 @@ func (evm *RethVM) RunStateTest(path string, out io.Writer, speedTest bool) (*tr
 	if stderr, err = cmd.StderrPipe(); err != nil {
 		return nil, err
 	}
-	if err = cmd.Start(); err != nil {
+	if err = startCmd(cmd); err != nil {
 		return nil, err
 	}
 
 	evm.Copy(out, stderr)
-	err = cmd.Wait()
+	err = waitCmd(cmd)
 	duration, slow := evm.stats.TraceDone(t0)
 
 	// If revm exits with 1 on stateroot errors, uncomment to ignore:
@@ -120,7 +125,7 @@ func (evm *RethVM) RunStateTest(path string, out io.Writer, speedTest bool) (*tr
 	return &tracingResult{
 		Slow:     slow,
 		ExecTime: duration,
-		Cmd:      cmd.String(),
+		Cmd:      shellCommand(cmd),
 	}, err
 }
 
@@ -0,0 +1,102 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package evms
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// eofField is the field reported as differing when the output of one of the
+// clients ends before the other.
+const eofField = "eof"
+
+// Divergence describes the point where the outputs of two clients first
+// differ. It leaves out the values themselves, which depend on the test.
+type Divergence struct {
+	Clients [2]string `json:"clients"` // the clients, in sorted order
+	Op      string    `json:"op"`      // the op being executed, if any
+	Pc      string    `json:"pc"`
+	Depth   string    `json:"depth"`
+	Field   string    `json:"field"` // the first (alphabetically) differing field
+}
+
+// NewDivergence creates the divergence between two differing output lines.
+// A nil line means that the output of the client ended.
+func NewDivergence(nameA, nameB string, lineA, lineB []byte) *Divergence {
+	// Order the clients, so that the divergence does not depend on which
+	// client was used as reference
+	if nameA > nameB {
+		nameA, nameB = nameB, nameA
+		lineA, lineB = lineB, lineA
+	}
+	var (
+		div  = &Divergence{Clients: [2]string{nameA, nameB}}
+		objA = parseLine(lineA)
+		objB = parseLine(lineB)
+	)
+	// The location is taken from the first line which is a step
+	for _, obj := range []map[string]json.RawMessage{objA, objB} {
+		if _, ok := obj["pc"]; ok {
+			div.Op, div.Pc, div.Depth = string(obj["op"]), string(obj["pc"]), string(obj["depth"])
+			break
+		}
+	}
+	if lineA == nil || lineB == nil {
+		div.Field = eofField
+		return div
+	}
+	var keys []string
+	for k := range objA {
+		keys = append(keys, k)
+	}
+	for k := range objB {
+		if _, ok := objA[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if string(objA[k]) != string(objB[k]) {
+			div.Field = k
+			break
+		}
+	}
+	return div
+}
+
+// parseLine parses an output line into its fields. Lines which are not json
+// objects have no fields.
+func parseLine(line []byte) map[string]json.RawMessage {
+	var obj map[string]json.RawMessage
+	if line != nil {
+		_ = json.Unmarshal(line, &obj)
+	}
+	return obj
+}
+
+// Signature returns a hash identifying the divergence, which is the same for
+// different tests hitting the same divergence point. It can be used to
+// deduplicate consensus flaws.
+func (d *Divergence) Signature() string {
+	h := sha256.Sum256([]byte(strings.Join([]string{
+		d.Clients[0], d.Clients[1], d.Op, d.Pc, d.Depth, d.Field}, "\x00")))
+	return fmt.Sprintf("%x", h[:16])
+}
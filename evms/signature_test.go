@@ -0,0 +1,88 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package evms
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestDivergenceSignature(t *testing.T) {
+	// Two different tests, which diverge at the same point, in the gas cost
+	var (
+		test1A = `{"pc":0,"op":96,"gas":"0x100","gasCost":"0x3","stack":[],"depth":1}
+{"pc":2,"op":84,"gas":"0xfd","gasCost":"0x834","stack":["0x1"],"depth":1}
+`
+		test1B = `{"pc":0,"op":96,"gas":"0x100","gasCost":"0x3","stack":[],"depth":1}
+{"pc":2,"op":84,"gas":"0xfd","gasCost":"0x64","stack":["0x1"],"depth":1}
+`
+		test2A = `{"pc":0,"op":96,"gas":"0x5000","gasCost":"0x3","stack":[],"depth":1}
+{"pc":2,"op":84,"gas":"0x4ffd","gasCost":"0x834","stack":["0x7"],"depth":1}
+`
+		test2B = `{"pc":0,"op":96,"gas":"0x5000","gasCost":"0x3","stack":[],"depth":1}
+{"pc":2,"op":84,"gas":"0x4ffd","gasCost":"0x0","stack":["0x7"],"depth":1}
+`
+		// Diverging at the same pc, but in a different field
+		test3A = `{"pc":0,"op":96,"gas":"0x100","gasCost":"0x3","stack":[],"depth":1}
+{"pc":2,"op":84,"gas":"0xfd","gasCost":"0x834","stack":["0x1"],"depth":1}
+`
+		test3B = `{"pc":0,"op":96,"gas":"0x100","gasCost":"0x3","stack":[],"depth":1}
+{"pc":2,"op":84,"gas":"0xfc","gasCost":"0x834","stack":["0x1"],"depth":1}
+`
+		// One output ends early
+		test4A = `{"pc":0,"op":96,"gas":"0x100","gasCost":"0x3","stack":[],"depth":1}
+`
+		test4B = `{"pc":0,"op":96,"gas":"0x100","gasCost":"0x3","stack":[],"depth":1}
+{"pc":2,"op":84,"gas":"0xfd","gasCost":"0x834","stack":["0x1"],"depth":1}
+`
+	)
+	divergence := func(nameA, a, nameB, b string) *Divergence {
+		t.Helper()
+		equal, _, _, div := compareReaders([]string{nameA, nameB}, []io.Reader{strings.NewReader(a), strings.NewReader(b)}, 0)
+		if equal || div == nil {
+			t.Fatal("expected divergence")
+		}
+		return div
+	}
+	div1 := divergence("geth", test1A, "besu", test1B)
+	if div1.Field != "gasCost" || div1.Pc != "2" || div1.Op != "84" || div1.Depth != "1" {
+		t.Fatalf("wrong divergence: %+v", div1)
+	}
+	sig := div1.Signature()
+	if have := divergence("geth", test2A, "besu", test2B).Signature(); have != sig {
+		t.Errorf("different tests with the same divergence: %v != %v", have, sig)
+	}
+	// The order of the clients does not matter
+	if have := divergence("besu", test1B, "geth", test1A).Signature(); have != sig {
+		t.Errorf("swapped clients: %v != %v", have, sig)
+	}
+	// But the clients, and the differing field, do
+	if have := divergence("geth", test1A, "nethermind", test1B).Signature(); have == sig {
+		t.Error("different clients have the same signature")
+	}
+	if have := divergence("geth", test3A, "besu", test3B).Signature(); have == sig {
+		t.Error("different fields have the same signature")
+	}
+	div4 := divergence("geth", test4A, "besu", test4B)
+	if div4.Field != eofField || div4.Pc != "2" {
+		t.Fatalf("wrong divergence: %+v", div4)
+	}
+	if have := divergence("besu", test4B, "geth", test4A).Signature(); have != div4.Signature() {
+		t.Errorf("swapped clients: %v != %v", have, div4.Signature())
+	}
+}
@@ -2,8 +2,12 @@ package evms
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io/fs"
 	"os/exec"
+	"strings"
 )
 
 const (
@@ -39,3 +43,81 @@ func StdErrOutput(c *exec.Cmd) ([]byte, error) {
 	err := c.Run()
 	return b.Bytes(), err
 }
+
+// ErrBinaryMissing is returned when the evm binary cannot be executed, e.g.
+// because it has been removed or is not executable.
+var ErrBinaryMissing = errors.New("evm binary missing or not executable")
+
+// ErrResourceExhausted is returned when an evm process was killed due to the
+// configured resource limits.
+var ErrResourceExhausted = errors.New("evm resource limits exceeded")
+
+// startCmd starts the command, applying the resource limits. If the binary cannot be executed, the returned
+// error wraps ErrBinaryMissing.
+func startCmd(c *exec.Cmd) error {
+	applyLimits(c, resourceLimits)
+	return startProcess(c)
+}
+
+// startBatchCmd starts the command of a batch-mode vm, which executes many
+// tests in one process: only the memory limit applies, as the cpu time would
+// add up over all of them.
+func startBatchCmd(c *exec.Cmd) error {
+	applyLimits(c, ResourceLimits{Memory: resourceLimits.Memory})
+	return startProcess(c)
+}
+
+// startProcess starts the command, reporting a binary which cannot be executed.
+func startProcess(c *exec.Cmd) error {
+	err := c.Start()
+	if errors.Is(err, exec.ErrNotFound) || errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission) {
+		return fmt.Errorf("%w: %v", ErrBinaryMissing, err)
+	}
+	return err
+}
+
+// waitCmd waits for the command to exit. If the process was killed due to the
+// resource limits, the returned error wraps ErrResourceExhausted.
+func waitCmd(c *exec.Cmd) error {
+	err := c.Wait()
+	if err != nil && limitsExceeded(c.ProcessState) {
+		return fmt.Errorf("%w: %v", ErrResourceExhausted, err)
+	}
+	return err
+}
+
+// shellCommand returns the command as it would be typed into a shell, with
+// the arguments quoted where needed.
+func shellCommand(c *exec.Cmd) string {
+	var args []string
+	for _, arg := range c.Args {
+		args = append(args, ShellQuote(arg))
+	}
+	return strings.Join(args, " ")
+}
+
+// batchCommand returns a shell command which executes the test at the given
+// path using the batch-mode command, which reads the paths from stdin.
+func batchCommand(c *exec.Cmd, path string) string {
+	return fmt.Sprintf("echo %v | %v", ShellQuote(path), shellCommand(c))
+}
+
+// ShellQuote quotes the string for use as a single shell word, unless it
+// only contains characters which need no quoting.
+func ShellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_=+.,:/@%") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
+
+// emptyOutput is the canonical output of a vm which produced neither steps nor
+// a stateroot.
+var emptyOutput, _ = json.Marshal(stateRoot{})
+
+// IsEmptyOutput returns true if the canonical output contains neither steps
+// nor a stateroot. This happens if the vm did not execute at all.
+func IsEmptyOutput(output []byte) bool {
+	output = bytes.TrimSpace(output)
+	return len(output) == 0 || bytes.Equal(output, emptyOutput)
+}
@@ -0,0 +1,122 @@
+// Copyright 2019 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package evms
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestBinaryMissing(t *testing.T) {
+	dir := t.TempDir()
+	// A file which is not executable
+	notExec := filepath.Join(dir, "evm")
+	if err := os.WriteFile(notExec, []byte("#!/bin/sh\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{filepath.Join(dir, "missing"), notExec} {
+		vm := NewGethEVM(path, "geth")
+		_, err := vm.RunStateTest(filepath.Join("testdata", "cases", "statetest1.json"), io.Discard, false)
+		if !errors.Is(err, ErrBinaryMissing) {
+			t.Errorf("%v: expected ErrBinaryMissing, got %v", path, err)
+		}
+	}
+}
+
+func TestIsEmptyOutput(t *testing.T) {
+	for i, tc := range []struct {
+		output string
+		empty  bool
+	}{
+		{"", true},
+		{"\n", true},
+		{`{"stateRoot":""}` + "\n", true},
+		{`{"stateRoot":"0x1234"}` + "\n", false},
+		{`{"pc":0,"op":1,"gas":"0x1","gasCost":"0x1","memSize":0,"stack":[],"depth":1,"refund":0,"opName":"ADD"}` + "\n", false},
+	} {
+		if have := IsEmptyOutput([]byte(tc.output)); have != tc.empty {
+			t.Errorf("test %d: have %v want %v", i, have, tc.empty)
+		}
+	}
+}
+
+func TestResourceLimits(t *testing.T) {
+	SetResourceLimits(ResourceLimits{CPU: 1})
+	defer SetResourceLimits(ResourceLimits{})
+
+	// A missing binary is still reported as such
+	TestBinaryMissing(t)
+
+	cmd := exec.Command("sh", "-c", "while :; do :; done")
+	if err := startCmd(cmd); err != nil {
+		t.Fatal(err)
+	}
+	if err := waitCmd(cmd); !errors.Is(err, ErrResourceExhausted) {
+		t.Fatalf("expected ErrResourceExhausted, got %v", err)
+	}
+	// A process exiting normally is not affected
+	cmd = exec.Command("sh", "-c", "exit 0")
+	if err := startCmd(cmd); err != nil {
+		t.Fatal(err)
+	}
+	if err := waitCmd(cmd); err != nil {
+		t.Fatal(err)
+	}
+	// Neither is a crash
+	SetResourceLimits(ResourceLimits{CPU: 1, Memory: 1 << 30})
+	cmd = exec.Command("sh", "-c", "kill -SEGV $$")
+	if err := startCmd(cmd); err != nil {
+		t.Fatal(err)
+	}
+	if err := waitCmd(cmd); err == nil || errors.Is(err, ErrResourceExhausted) {
+		t.Fatalf("expected a crash, got %v", err)
+	}
+	// The batch processes have no cpu limit
+	cmd = exec.Command("sh", "-c", "ulimit -t; ulimit -v")
+	out := new(bytes.Buffer)
+	cmd.Stdout = out
+	if err := startBatchCmd(cmd); err != nil {
+		t.Fatal(err)
+	}
+	if err := waitCmd(cmd); err != nil {
+		t.Fatal(err)
+	}
+	if have := out.String(); have != "unlimited\n1048576\n" {
+		t.Fatalf("wrong batch limits: %q", have)
+	}
+}
+
+func TestShellCommand(t *testing.T) {
+	args := []string{"plain", "with space", "it's", "", `"$HOME"`, "a;b"}
+	cmd := exec.Command("printf", append([]string{"[%s]"}, args...)...)
+	out, err := exec.Command("sh", "-c", shellCommand(cmd)).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want string
+	for _, arg := range args {
+		want += "[" + arg + "]"
+	}
+	if string(out) != want {
+		t.Fatalf("have %q, want %q (command %v)", out, want, shellCommand(cmd))
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"math/big"
+	"math/rand"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/tests"
+	"github.com/holiman/goevmlab/ops"
+	"github.com/holiman/goevmlab/program"
+)
+
+func fillAccessList(gst *GstMaker, fork string) {
+	var (
+		dest     = common.HexToAddress("0x00ac0000")
+		coinbase = gst.env.Coinbase
+		// Accounts which exist in the state
+		existing = []common.Address{
+			common.HexToAddress("0x00ac0001"),
+			common.HexToAddress("0x00ac0002"),
+			common.HexToAddress("0x00ac0003"),
+		}
+		// Accounts which do not exist
+		missing = []common.Address{
+			common.HexToAddress("0x00ac0004"),
+			common.HexToAddress("0x00ac0005"),
+		}
+		targets = []common.Address{dest, coinbase, gst.SenderAddress()}
+	)
+	targets = append(targets, existing...)
+	targets = append(targets, missing...)
+	// Some precompiles, which are always warm
+	for i := 1; i <= 10; i++ {
+		targets = append(targets, common.BytesToAddress([]byte{byte(i)}))
+	}
+	for _, addr := range existing {
+		gst.AddAccount(addr, GenesisAccount{
+			Code:    RandStorageOps().Bytecode(),
+			Balance: big.NewInt(1),
+			Storage: RandStorage(8, 3),
+		})
+	}
+	gst.AddAccount(dest, GenesisAccount{
+		Code:    RandAccessListOps(targets),
+		Balance: new(big.Int),
+		Storage: RandStorage(8, 3),
+	})
+	tx := &StTransaction{
+		// 8M gaslimit
+		GasLimit:   []uint64{8000000},
+		Nonce:      0,
+		Value:      []string{randHex(4)},
+		Data:       []string{randHex(100)},
+		GasPrice:   big.NewInt(0x10),
+		To:         dest.Hex(),
+		Sender:     sender,
+		PrivateKey: pKey,
+	}
+	// Access lists only exist from Berlin and onwards
+	if config, ok := tests.Forks[fork]; ok && config.IsBerlin(common.Big0) {
+		acl := randAccessList(targets)
+		tx.AccessLists = []*types.AccessList{&acl}
+	}
+	gst.SetTx(tx)
+}
+
+// randAccessList returns an access list containing a random subset of the
+// given addresses and the low storage slots. Addresses and slots may appear
+// more than once.
+func randAccessList(addrs []common.Address) types.AccessList {
+	var acl types.AccessList
+	for _, addr := range addrs {
+		if rand.Intn(3) != 0 {
+			continue
+		}
+		tuple := types.AccessTuple{
+			Address:     addr,
+			StorageKeys: []common.Hash{},
+		}
+		for n := rand.Intn(4); n > 0; n-- {
+			tuple.StorageKeys = append(tuple.StorageKeys, common.BigToHash(big.NewInt(int64(rand.Intn(8)))))
+		}
+		acl = append(acl, tuple)
+		if rand.Intn(10) == 0 {
+			acl = append(acl, tuple) // duplicate entry
+		}
+	}
+	return acl
+}
+
+// RandAccessListOps creates code which accesses the given accounts and the low
+// storage slots, which may or may not be pre-warmed by an access list. The
+// remaining gas is stored now and then, so the state depends on the correct
+// warm/cold accounting.
+func RandAccessListOps(addrs []common.Address) []byte {
+	var (
+		p       = program.NewProgram()
+		addrGen = addressRandomizer(addrs)
+		gasSlot = 0x100
+	)
+	for p.Size() < 1000 {
+		switch r := rand.Intn(100); {
+		case r < 30: // Account access
+			p.Push(addrGen())
+			p.Op(oneOf(ops.BALANCE, ops.EXTCODESIZE, ops.EXTCODEHASH).(ops.OpCode))
+			p.Op(ops.POP)
+		case r < 35:
+			p.ExtcodeCopy(addrGen(), 0, 0, 32)
+		case r < 50: // Storage read
+			p.Push(rand.Intn(8))
+			p.Op(ops.SLOAD)
+			p.Op(ops.POP)
+		case r < 60: // Storage write
+			p.Sstore(rand.Intn(8), rand.Intn(3))
+		case r < 75: // Calls, which also warm up the callee
+			gas := big.NewInt(int64(rand.Intn(50_000)))
+			switch rand.Intn(3) {
+			case 0:
+				p.Call(gas, addrGen(), 0, 0, 0, 0, 0)
+			case 1:
+				p.StaticCall(gas, addrGen(), 0, 0, 0, 0)
+			default:
+				p.DelegateCall(gas, addrGen(), 0, 0, 0, 0)
+			}
+			p.Op(ops.POP)
+		default:
+			// Store the remaining gas
+			p.Op(ops.GAS)
+			p.Push(gasSlot)
+			p.Op(ops.SSTORE)
+			gasSlot++
+		}
+	}
+	p.Op(ops.GAS)
+	p.Push(gasSlot)
+	p.Op(ops.SSTORE)
+	return p.Bytecode()
+}
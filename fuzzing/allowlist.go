@@ -0,0 +1,70 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/holiman/goevmlab/ops"
+)
+
+// opcodeAllowlist, if set, restricts the ops which the random bytecode
+// generator picks. Push instructions are used as well, for the operands; the
+// code ends with an implicit STOP.
+var opcodeAllowlist []ops.OpCode
+
+// SetOpcodeAllowlist restricts the ops used by the random bytecode generator
+// to the given ones. It must be called before generation starts.
+func SetOpcodeAllowlist(list []ops.OpCode) {
+	opcodeAllowlist = list
+}
+
+// ParseOpcodes returns the ops with the given names.
+func ParseOpcodes(names []string) ([]ops.OpCode, error) {
+	var list []ops.OpCode
+	for _, name := range names {
+		name = strings.ToUpper(strings.TrimSpace(name))
+		op := ops.StringToOp(name)
+		if op == ops.STOP && name != "STOP" {
+			return nil, fmt.Errorf("unknown opcode %q", name)
+		}
+		list = append(list, op)
+	}
+	return list, nil
+}
+
+// allowedOps returns the ops of the allowlist which are valid in the fork, or
+// nil if there is no allowlist.
+func allowedOps(f *ops.Fork) []ops.OpCode {
+	var allowed []ops.OpCode
+	for _, op := range opcodeAllowlist {
+		if f.IsValid(op) {
+			allowed = append(allowed, op)
+		}
+	}
+	return allowed
+}
+
+// allowedOp returns an op from the allowed ones, or, in a quarter of the cases
+// (and if none of them are valid), a push instruction.
+func allowedOp(allowed []ops.OpCode, rnd byte) ops.OpCode {
+	if len(allowed) == 0 || rnd < 0x40 {
+		return ops.PUSH1 + ops.OpCode(rnd%32)
+	}
+	return allowed[int(rnd)%len(allowed)]
+}
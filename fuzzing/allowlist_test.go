@@ -0,0 +1,67 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"testing"
+
+	"github.com/holiman/goevmlab/ops"
+)
+
+func TestParseOpcodes(t *testing.T) {
+	list, err := ParseOpcodes([]string{"add", " MSTORE", "STOP"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ops.OpCode{ops.ADD, ops.MSTORE, ops.STOP}
+	if len(list) != len(want) {
+		t.Fatalf("expected %d ops, have %d", len(want), len(list))
+	}
+	for i, op := range list {
+		if op != want[i] {
+			t.Errorf("op %d: expected %v, have %v", i, want[i], op)
+		}
+	}
+	if _, err := ParseOpcodes([]string{"ADD", "FOO"}); err == nil {
+		t.Error("expected error for unknown opcode")
+	}
+}
+
+func TestOpcodeAllowlist(t *testing.T) {
+	// BLOBHASH is not valid in Berlin, and must not be used
+	SetOpcodeAllowlist([]ops.OpCode{ops.ADD, ops.SLOAD, ops.MSTORE, ops.BLOBHASH})
+	defer SetOpcodeAllowlist(nil)
+	allowed := map[ops.OpCode]bool{ops.ADD: true, ops.SLOAD: true, ops.MSTORE: true}
+	for i := 0; i < 20; i++ {
+		code := randomBytecode(ops.LookupFork("Berlin"))
+		seen := make(map[ops.OpCode]bool)
+		for pc := 0; pc < len(code); pc++ {
+			op := ops.OpCode(code[pc])
+			if op.IsPush() {
+				pc += int(op-ops.PUSH1) + 1
+				continue
+			}
+			if !allowed[op] {
+				t.Fatalf("op %v at pc %d not allowed", op, pc)
+			}
+			seen[op] = true
+		}
+		if len(seen) != len(allowed) {
+			t.Errorf("expected all allowed ops to be used, have %v", seen)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"math/big"
+	"math/rand"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/holiman/goevmlab/ops"
+	"github.com/holiman/goevmlab/program"
+)
+
+var (
+	maxUint256 = asBig("0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff") // also -1
+	minInt256  = asBig("0x8000000000000000000000000000000000000000000000000000000000000000")
+	maxInt256  = asBig("0x7fffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")
+
+	// arithSentinels are the boundary operands.
+	arithSentinels = []*big.Int{
+		big.NewInt(0), big.NewInt(1), big.NewInt(2), big.NewInt(31), big.NewInt(32),
+		big.NewInt(255), big.NewInt(256), big.NewInt(257),
+		new(big.Int).Lsh(big.NewInt(1), 128), maxUint256, minInt256, maxInt256,
+		new(big.Int).Sub(maxUint256, big.NewInt(1)), // -2
+	}
+
+	// arithOps are the arithmetic ops.
+	arithOps = []ops.OpCode{
+		ops.ADD, ops.MUL, ops.SUB, ops.DIV, ops.SDIV, ops.MOD, ops.SMOD, ops.ADDMOD,
+		ops.MULMOD, ops.EXP, ops.SIGNEXTEND, ops.BYTE, ops.SHL, ops.SHR, ops.SAR,
+	}
+)
+
+func fillArithmetic(gst *GstMaker, fork string) {
+	dest := common.HexToAddress("0x00000000000000000000000000000000000a1700")
+	gst.AddAccount(dest, GenesisAccount{
+		Code:    RandArithmetic(fork),
+		Balance: new(big.Int),
+		Storage: make(map[common.Hash]common.Hash),
+	})
+	// The transaction
+	gst.SetTx(&StTransaction{
+		// 8M gaslimit
+		GasLimit:   []uint64{8000000},
+		Nonce:      0,
+		Value:      []string{randHex(4)},
+		Data:       []string{randHex(100)},
+		GasPrice:   big.NewInt(0x10),
+		To:         dest.Hex(),
+		Sender:     sender,
+		PrivateKey: pKey,
+	})
+}
+
+// RandArithmetic creates code which executes arithmetic ops (valid in the
+// fork) on boundary operands, and stores the results. Now and then, it
+// targets the classic edge cases: SDIV/SMOD of INT_MIN by -1, division by
+// zero, and EXP with large exponents (stored along with the gas left, to
+// check the dynamic gas).
+func RandArithmetic(fork string) []byte {
+	var (
+		p      = program.NewProgram()
+		n      = 1 + rand.Intn(20)
+		forkOp = ops.LookupFork(fork)
+		valid  []ops.OpCode
+	)
+	for _, op := range arithOps {
+		if forkOp == nil || forkOp.IsValid(op) {
+			valid = append(valid, op)
+		}
+	}
+	for i := 0; i < n; i++ {
+		op := valid[rand.Intn(len(valid))]
+		switch rand.Intn(6) {
+		case 0: // INT_MIN / -1
+			op = oneOf(ops.SDIV, ops.SMOD).(ops.OpCode)
+		case 1: // Division by zero
+			op = oneOf(ops.DIV, ops.SDIV, ops.MOD, ops.SMOD, ops.ADDMOD, ops.MULMOD).(ops.OpCode)
+		case 2:
+			op = ops.EXP
+		}
+		args := make([]*big.Int, len(op.Pops()))
+		for j := range args {
+			args[j] = arithSentinels[rand.Intn(len(arithSentinels))]
+		}
+		switch {
+		case op == ops.SDIV || op == ops.SMOD:
+			if rand.Intn(2) == 0 {
+				args[0], args[1] = minInt256, maxUint256
+			}
+		case op == ops.EXP:
+			// An exponent of 0-32 bytes
+			exp := new(big.Int).Lsh(big.NewInt(1), uint(8*rand.Intn(33)))
+			args[1] = exp.Sub(exp, big.NewInt(1))
+		}
+		if op == ops.DIV || op == ops.SDIV || op == ops.MOD || op == ops.SMOD ||
+			op == ops.ADDMOD || op == ops.MULMOD {
+			if rand.Intn(3) == 0 {
+				args[len(args)-1] = big.NewInt(0)
+			}
+		}
+		// The first operand goes on top of the stack
+		for j := len(args) - 1; j >= 0; j-- {
+			p.Push(args[j])
+		}
+		p.Op(op)
+		p.Push(2 * i)
+		p.Op(ops.SSTORE)
+		if op == ops.EXP {
+			p.Op(ops.GAS)
+			p.Push(2*i + 1)
+			p.Op(ops.SSTORE)
+		}
+	}
+	return p.Bytecode()
+}
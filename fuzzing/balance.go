@@ -0,0 +1,97 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"math/big"
+	"math/rand"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/holiman/goevmlab/program"
+)
+
+// balanceGasLimits are the transaction gas limits: the intrinsic gas, and
+// some more.
+var balanceGasLimits = []uint64{21000, 100_000, 8_000_000}
+
+// balanceGasPrices are the gas prices: the base fee, and prices which make
+// gasLimit*gasPrice large, or overflow when the value is added.
+var balanceGasPrices = []string{
+	"0x10", "0x11", "0x10000000000000000", "0x100000000000000000000000000000000",
+	"0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff",
+}
+
+// balanceValues are the transferred values.
+var balanceValues = []string{
+	"0x0", "0x1", "0x8000000000000000000000000000000000000000000000000000000000000000",
+	"0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff",
+}
+
+func fillBalance(gst *GstMaker, fork string) {
+	dest := common.HexToAddress("0x00000000000000000000000000000000000ba1a0")
+	// The destination just records that it was called
+	p := program.NewProgram()
+	p.Sstore(0, 1)
+	gst.AddAccount(dest, GenesisAccount{
+		Code:    p.Bytecode(),
+		Balance: new(big.Int),
+		Storage: make(map[common.Hash]common.Hash),
+	})
+	var (
+		gas      = balanceGasLimits[rand.Intn(len(balanceGasLimits))]
+		gasPrice = asBig(balanceGasPrices[rand.Intn(len(balanceGasPrices))])
+		value    = asBig(balanceValues[rand.Intn(len(balanceValues))])
+	)
+	if rand.Intn(2) == 0 {
+		// Just a bit over the base fee, to keep the costs near the balance
+		gasPrice = big.NewInt(int64(0x10 + rand.Intn(4)))
+	}
+	// The sender has just below, exactly, or just above the required balance,
+	// unless that is not representable.
+	gst.AddAccount(sender, GenesisAccount{
+		Balance: RandBalanceNear(gas, gasPrice, value),
+		Storage: make(map[common.Hash]common.Hash),
+	})
+	gst.SetTx(&StTransaction{
+		GasLimit:   []uint64{gas},
+		Nonce:      0,
+		Value:      []string{hexutil.EncodeBig(value)},
+		Data:       []string{"0x"},
+		GasPrice:   gasPrice,
+		To:         dest.Hex(),
+		Sender:     sender,
+		PrivateKey: pKey,
+	})
+}
+
+// RandBalanceNear returns a balance one below, equal to, or one above the
+// required upfront cost: gas*gasPrice + value. If the cost overflows 256 bits,
+// the maximum balance is returned.
+func RandBalanceNear(gas uint64, gasPrice, value *big.Int) *big.Int {
+	cost := new(big.Int).Mul(new(big.Int).SetUint64(gas), gasPrice)
+	cost.Add(cost, value)
+	balance := cost.Add(cost, big.NewInt(int64(rand.Intn(3)-1)))
+	if balance.Sign() < 0 {
+		return new(big.Int)
+	}
+	if balance.Cmp(math.MaxBig256) > 0 {
+		return new(big.Int).Set(math.MaxBig256)
+	}
+	return balance
+}
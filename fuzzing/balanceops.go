@@ -0,0 +1,124 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"math/big"
+	"math/rand"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/holiman/goevmlab/ops"
+	"github.com/holiman/goevmlab/program"
+)
+
+// balanceOpsBalances are the balances of the accounts read.
+var balanceOpsBalances = []*big.Int{
+	big.NewInt(0), big.NewInt(1), big.NewInt(0xffff),
+	new(big.Int).Lsh(big.NewInt(1), 128), new(big.Int).Lsh(big.NewInt(1), 255),
+}
+
+func fillBalanceOps(gst *GstMaker, fork string) {
+	// Cold and warm accounts exist from Berlin on
+	if !ops.LookupRules(fork).IsBerlin {
+		fork = "Berlin"
+		gst.SetFork(fork)
+	}
+	var (
+		dest = common.HexToAddress("0x00ba0000")
+		// Accounts which exist in the state
+		existing = []common.Address{
+			common.HexToAddress("0x00ba0001"),
+			common.HexToAddress("0x00ba0002"),
+			common.HexToAddress("0x00ba0003"),
+		}
+		// Accounts which do not exist
+		missing = []common.Address{
+			common.HexToAddress("0x00ba0004"),
+			common.HexToAddress("0x00ba0005"),
+		}
+		targets = []common.Address{dest, gst.env.Coinbase, gst.SenderAddress()}
+	)
+	targets = append(targets, existing...)
+	targets = append(targets, missing...)
+	// Some precompiles, which are always warm
+	for i := 1; i <= 10; i++ {
+		targets = append(targets, common.BytesToAddress([]byte{byte(i)}))
+	}
+	for _, addr := range existing {
+		acc := GenesisAccount{
+			Balance: balanceOpsBalances[rand.Intn(len(balanceOpsBalances))],
+			Storage: make(map[common.Hash]common.Hash),
+		}
+		if acc.Balance.Sign() == 0 {
+			// Not empty, despite having no balance
+			acc.Nonce = 1
+		}
+		gst.AddAccount(addr, acc)
+	}
+	gst.AddAccount(dest, GenesisAccount{
+		Code:    RandBalanceOps(targets),
+		Balance: balanceOpsBalances[1+rand.Intn(len(balanceOpsBalances)-1)],
+		Storage: make(map[common.Hash]common.Hash),
+	})
+	tx := &StTransaction{
+		// 8M gaslimit
+		GasLimit:   []uint64{8000000},
+		Nonce:      0,
+		Value:      []string{randHex(4)},
+		Data:       []string{randHex(100)},
+		GasPrice:   big.NewInt(0x10),
+		To:         dest.Hex(),
+		Sender:     sender,
+		PrivateKey: pKey,
+	}
+	if rand.Intn(2) == 0 {
+		// Pre-warm some of the accounts
+		acl := randAccessList(targets)
+		tx.AccessLists = []*types.AccessList{&acl}
+	}
+	gst.SetTx(tx)
+}
+
+// RandBalanceOps creates code which reads the balances of the given accounts,
+// using BALANCE, or SELFBALANCE for its own. Each balance is stored, along with
+// the gas cost of reading it, which depends on whether the account is warm.
+func RandBalanceOps(addrs []common.Address) []byte {
+	var (
+		p     = program.NewProgram()
+		reads = 1 + rand.Intn(30)
+	)
+	for i := 0; i < reads; i++ {
+		p.Op(ops.GAS)
+		if rand.Intn(5) == 0 {
+			p.Op(ops.SELFBALANCE)
+		} else {
+			p.Push(addrs[rand.Intn(len(addrs))])
+			p.Op(ops.BALANCE)
+		}
+		p.Op(ops.GAS)
+		// Store the balance, then the gas cost
+		p.Op(ops.SWAP1)
+		p.Push(2 * i)
+		p.Op(ops.SSTORE)
+		p.Op(ops.SWAP1)
+		p.Op(ops.SUB)
+		p.Push(2*i + 1)
+		p.Op(ops.SSTORE)
+	}
+	return p.Bytecode()
+}
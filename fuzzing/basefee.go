@@ -0,0 +1,133 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"math/big"
+	"math/rand"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/holiman/goevmlab/ops"
+	"github.com/holiman/goevmlab/program"
+)
+
+// baseFees are the block base fees used: tiny ones, one gwei, and one which
+// does not fit in 64 bits.
+var baseFees = []string{"0x1", "0x7", "0x10", "0x3b9aca00", "0x10000000000000000"}
+
+func fillBaseFee(gst *GstMaker, fork string) {
+	// The base fee exists from London on
+	if !ops.LookupRules(fork).IsLondon {
+		fork = "London"
+		gst.SetFork(fork)
+	}
+	baseFee := asBig(baseFees[rand.Intn(len(baseFees))])
+	gst.SetBaseFee(baseFee)
+	// The sender needs to afford the largest fees
+	gst.AddAccount(sender, GenesisAccount{
+		Balance: new(big.Int).Lsh(big.NewInt(1), 128),
+		Storage: make(map[common.Hash]common.Hash),
+		Code:    []byte{},
+	})
+	dest := common.HexToAddress("0x00000000000000000000000000000000000bf000")
+	gst.AddAccount(dest, GenesisAccount{
+		Code:    baseFeeCode(),
+		Balance: new(big.Int),
+		Storage: make(map[common.Hash]common.Hash),
+	})
+	tx := &StTransaction{
+		GasLimit:   []uint64{100_000},
+		Nonce:      0,
+		Value:      []string{randHex(4)},
+		Data:       []string{randHex(100)},
+		To:         dest.Hex(),
+		Sender:     sender,
+		PrivateKey: pKey,
+	}
+	if rand.Intn(4) == 0 {
+		// A legacy transaction, whose gas price must cover the base fee
+		tx.GasPrice = RandFeeAround(baseFee)
+		gst.AddTag("legacy")
+	} else {
+		tx.MaxFeePerGas, tx.MaxPriorityFeePerGas = RandFeeCaps(baseFee)
+	}
+	gst.SetTx(tx)
+}
+
+// RandFeeAround returns a fee just below, at, or above the given base fee.
+func RandFeeAround(baseFee *big.Int) *big.Int {
+	delta := big.NewInt(int64(oneOf(-1, 0, 0, 1, 2).(int)))
+	if rand.Intn(4) == 0 {
+		// Well above the base fee
+		delta.Set(baseFee)
+	}
+	fee := new(big.Int).Add(baseFee, delta)
+	if fee.Sign() < 0 {
+		fee.SetUint64(0)
+	}
+	return fee
+}
+
+// RandFeeCaps returns a max fee per gas and a max priority fee per gas which
+// probe the effective gas price computation: the max fee is around the base
+// fee (sometimes too low), and the priority fee is sometimes capped by the max
+// fee, and sometimes larger than it (which makes the transaction invalid).
+func RandFeeCaps(baseFee *big.Int) (maxFee, maxTip *big.Int) {
+	maxFee = RandFeeAround(baseFee)
+	// The part of the max fee which is left for the priority fee
+	headroom := new(big.Int).Sub(maxFee, baseFee)
+	if headroom.Sign() < 0 {
+		headroom.SetUint64(0)
+	}
+	switch rand.Intn(6) {
+	case 0:
+		maxTip = new(big.Int)
+	case 1:
+		maxTip = big.NewInt(1)
+	case 2: // exactly the headroom
+		maxTip = headroom
+	case 3: // capped by the max fee
+		maxTip = new(big.Int).Add(headroom, big.NewInt(1))
+	case 4:
+		maxTip = new(big.Int).Set(maxFee)
+	default: // above the max fee: invalid
+		maxTip = new(big.Int).Add(maxFee, big.NewInt(1))
+	}
+	return maxFee, maxTip
+}
+
+// baseFeeCode returns code which stores what the transaction sees of the fee
+// computation: the effective gas price, the base fee, and the balances of the
+// coinbase and the origin.
+func baseFeeCode() []byte {
+	p := program.NewProgram()
+	p.Op(ops.GASPRICE)
+	p.Push(0)
+	p.Op(ops.SSTORE)
+	p.Op(ops.BASEFEE)
+	p.Push(1)
+	p.Op(ops.SSTORE)
+	p.Op(ops.COINBASE)
+	p.Op(ops.BALANCE)
+	p.Push(2)
+	p.Op(ops.SSTORE)
+	p.Op(ops.ORIGIN)
+	p.Op(ops.BALANCE)
+	p.Push(3)
+	p.Op(ops.SSTORE)
+	return p.Bytecode()
+}
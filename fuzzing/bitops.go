@@ -0,0 +1,126 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"math/big"
+	"math/rand"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/holiman/goevmlab/ops"
+	"github.com/holiman/goevmlab/program"
+)
+
+var (
+	bitOpsAddr = common.HexToAddress("0x00000000000000000000000000000000000b1700")
+
+	// bitOps are the ops whose first operand is a bit or byte position.
+	bitOps = []ops.OpCode{ops.SIGNEXTEND, ops.BYTE, ops.SHL, ops.SHR, ops.SAR}
+
+	// shiftBoundaries are the shift amounts around the word size, past
+	// which the result is zero (or the sign fill, for SAR).
+	shiftBoundaries = []*big.Int{
+		big.NewInt(0), big.NewInt(1), big.NewInt(254), big.NewInt(255), big.NewInt(256), big.NewInt(257),
+		new(big.Int).Lsh(big.NewInt(1), 64), maxUint256,
+	}
+
+	// indexBoundaries are the byte positions around the word size, past which
+	// BYTE returns zero and SIGNEXTEND leaves the value as is.
+	indexBoundaries = []*big.Int{
+		big.NewInt(0), big.NewInt(1), big.NewInt(30), big.NewInt(31), big.NewInt(32), big.NewInt(33),
+		new(big.Int).Lsh(big.NewInt(1), 64), maxUint256,
+	}
+)
+
+func fillBitOps(gst *GstMaker, fork string) {
+	gst.AddAccount(bitOpsAddr, GenesisAccount{
+		Code:    RandBitOps(fork),
+		Balance: new(big.Int),
+		Storage: make(map[common.Hash]common.Hash),
+	})
+	// The transaction
+	gst.SetTx(&StTransaction{
+		// 8M gaslimit
+		GasLimit:   []uint64{8000000},
+		Nonce:      0,
+		Value:      []string{randHex(4)},
+		Data:       []string{randHex(100)},
+		GasPrice:   big.NewInt(0x10),
+		To:         bitOpsAddr.Hex(),
+		Sender:     sender,
+		PrivateKey: pKey,
+	})
+}
+
+// bitOpValue returns a value to shift, or to take a byte of or sign-extend at
+// the given position: one with the sign bit at that byte set or cleared, or a
+// boundary value.
+func bitOpValue(op ops.OpCode, pos *big.Int) *big.Int {
+	random := make([]byte, 32)
+	rand.Read(random)
+	v := new(big.Int).SetBytes(random)
+	if (op == ops.SIGNEXTEND || op == ops.BYTE) && pos.Cmp(big.NewInt(32)) < 0 && rand.Intn(2) == 0 {
+		// Random bits above and below the sign bit of the byte
+		return v.SetBit(v, int(8*pos.Uint64()+7), uint(rand.Intn(2)))
+	}
+	return oneOf(minInt256, maxInt256, maxUint256, big.NewInt(1), big.NewInt(0x80), v).(*big.Int)
+}
+
+// RandBitOps creates code which executes the bit ops (valid in the fork) with
+// shift amounts and byte positions at and beyond the word boundaries, and
+// stores the results. Each op is executed twice with the same operands: once
+// with the position pushed, and once with it computed (masked with XOR), so
+// the two results should be equal.
+func RandBitOps(fork string) []byte {
+	var (
+		p      = program.NewProgram()
+		n      = 1 + rand.Intn(20)
+		forkOp = ops.LookupFork(fork)
+		valid  []ops.OpCode
+	)
+	for _, op := range bitOps {
+		if forkOp == nil || forkOp.IsValid(op) {
+			valid = append(valid, op)
+		}
+	}
+	for i := 0; i < n; i++ {
+		var (
+			op  = valid[rand.Intn(len(valid))]
+			pos = indexBoundaries[rand.Intn(len(indexBoundaries))]
+		)
+		if op == ops.SHL || op == ops.SHR || op == ops.SAR {
+			pos = shiftBoundaries[rand.Intn(len(shiftBoundaries))]
+		}
+		val := bitOpValue(op, pos)
+		// The position goes on top of the stack
+		p.Push(val)
+		p.Push(pos)
+		p.Op(op)
+		p.Push(2 * i)
+		p.Op(ops.SSTORE)
+		// The same, with the position computed as (pos^mask)^mask
+		mask := arithSentinels[rand.Intn(len(arithSentinels))]
+		p.Push(val)
+		p.Push(mask)
+		p.Push(new(big.Int).Xor(pos, mask))
+		p.Op(ops.XOR)
+		p.Op(op)
+		p.Push(2*i + 1)
+		p.Op(ops.SSTORE)
+	}
+	return p.Bytecode()
+}
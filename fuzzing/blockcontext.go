@@ -0,0 +1,129 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"math/big"
+	"math/rand"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/holiman/goevmlab/ops"
+	"github.com/holiman/goevmlab/program"
+)
+
+// blockContextOps are the opcodes which read the block environment.
+var blockContextOps = []ops.OpCode{
+	ops.COINBASE, ops.TIMESTAMP, ops.NUMBER, ops.DIFFICULTY, ops.GASLIMIT,
+	ops.CHAINID, ops.BASEFEE, ops.BLOBBASEFEE,
+}
+
+func fillBlockContext(gst *GstMaker, fork string) {
+	forkDef := ops.LookupFork(fork) // known, the factory checks it
+	dest := common.HexToAddress("0x00b10c0000")
+	randBlockEnv(gst, fork, dest)
+	gst.AddAccount(dest, GenesisAccount{
+		Code:    RandBlockContextOps(forkDef, gst.env.Number),
+		Balance: new(big.Int),
+		Storage: make(map[common.Hash]common.Hash),
+	})
+	// The transaction
+	gst.SetTx(&StTransaction{
+		// 8M gaslimit
+		GasLimit:   []uint64{8000000},
+		Nonce:      0,
+		Value:      []string{randHex(4)},
+		Data:       []string{randHex(100)},
+		GasPrice:   big.NewInt(0x10),
+		To:         dest.Hex(),
+		Sender:     sender,
+		PrivateKey: pKey,
+	})
+}
+
+// randBlockEnv sets up a block environment with values on the edges.
+func randBlockEnv(gst *GstMaker, fork string, dest common.Address) {
+	gst.SetNumber(oneOf(uint64(1), uint64(255), uint64(256), uint64(257),
+		uint64(rand.Intn(10_000)), uint64(1)<<32, uint64(1)<<62).(uint64))
+	gst.SetTimestamp(oneOf(uint64(1), uint64(0x3e8), uint64(1)<<32-1, uint64(1)<<40).(uint64))
+	// The tx gas limit is 8M
+	gst.SetGasLimit(oneOf(uint64(8_000_000), uint64(30_000_000), uint64(0x26e1f476fe1e22)).(uint64))
+	// The coinbase may be a precompile, the called contract, or the sender
+	gst.SetCoinbase(oneOf(gst.env.Coinbase, common.BytesToAddress([]byte{1}), dest, sender).(common.Address))
+	gst.SetDifficulty(asBig(oneOf("0x0", "0x1", "0x20000", "0xffffffffffffffff",
+		"0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff").(string)))
+	// The tx gas price is 0x10, so the base fee must not exceed that.
+	gst.SetBaseFee(big.NewInt(int64(oneOf(0, 1, 7, 0x10).(int))))
+	switch fork {
+	case "Istanbul", "Berlin", "London":
+		// Pre-merge, DIFFICULTY reads the difficulty
+		gst.SetRandom(nil)
+	default:
+		rnd := oneOf(common.Hash{}, common.HexToHash("0x01"), common.HexToHash("0x20000"),
+			crypto.Keccak256Hash(big.NewInt(rand.Int63()).Bytes())).(common.Hash)
+		gst.SetRandom(&rnd)
+	}
+	if fork == "Cancun" {
+		excess := oneOf(uint64(0), uint64(1), uint64(0x60000), uint64(0x3000000), uint64(1)<<32).(uint64)
+		gst.SetExcessBlobGas(&excess)
+	}
+}
+
+// RandBlockContextOps creates code which reads the block environment, and
+// stores the results. BLOCKHASH is invoked with block numbers around the
+// edges of the available range, relative to the given current number.
+func RandBlockContextOps(fork *ops.Fork, number uint64) []byte {
+	var valid = make(map[ops.OpCode]bool)
+	for _, op := range fork.ValidOpcodes {
+		valid[op] = true
+	}
+	var (
+		p    = program.NewProgram()
+		slot = 0
+		num  = new(big.Int).SetUint64(number)
+	)
+	blockNumbers := []*big.Int{
+		new(big.Int).Sub(num, big.NewInt(1)),
+		new(big.Int).Sub(num, big.NewInt(256)),
+		new(big.Int).Sub(num, big.NewInt(257)),
+		new(big.Int).Set(num),
+		new(big.Int).Add(num, big.NewInt(1)),
+		new(big.Int),
+		// The number in the lower 64 bits, and garbage above
+		new(big.Int).Add(num, new(big.Int).Lsh(big.NewInt(1), 64)),
+		asBig("0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"),
+	}
+	for i := 0; i < 20; i++ {
+		if rand.Intn(2) == 0 {
+			// Numbers below zero wrap around
+			n := math.U256(new(big.Int).Set(blockNumbers[rand.Intn(len(blockNumbers))]))
+			p.Push(n)
+			p.Op(ops.BLOCKHASH)
+		} else {
+			op := blockContextOps[rand.Intn(len(blockContextOps))]
+			if !valid[op] {
+				continue
+			}
+			p.Op(op)
+		}
+		p.Push(slot)
+		p.Op(ops.SSTORE)
+		slot++
+	}
+	return p.Bytecode()
+}
@@ -0,0 +1,358 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/consensus/beacon"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/tests"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// BlockchainTest is the top-level container of blockchain tests, mapping
+// test names to tests.
+type BlockchainTest map[string]*btJSON
+
+// btJSON is the blockchain test format, as used by go-ethereum.
+type btJSON struct {
+	Blocks     []btBlock             `json:"blocks"`
+	Genesis    btHeader              `json:"genesisBlockHeader"`
+	Pre        GenesisAlloc          `json:"pre"`
+	Post       GenesisAlloc          `json:"postState,omitempty"`
+	BestBlock  common.UnprefixedHash `json:"lastblockhash"`
+	Network    string                `json:"network"`
+	SealEngine string                `json:"sealEngine"`
+}
+
+type btBlock struct {
+	BlockHeader     *btHeader     `json:"blockHeader"`
+	ExpectException string        `json:"expectException,omitempty"`
+	Rlp             hexutil.Bytes `json:"rlp"`
+}
+
+type btHeader struct {
+	Bloom                 types.Bloom      `json:"bloom"`
+	Coinbase              common.Address   `json:"coinbase"`
+	MixHash               common.Hash      `json:"mixHash"`
+	Nonce                 types.BlockNonce `json:"nonce"`
+	Number                *hexutil.Big     `json:"number"`
+	Hash                  common.Hash      `json:"hash"`
+	ParentHash            common.Hash      `json:"parentHash"`
+	ReceiptTrie           common.Hash      `json:"receiptTrie"`
+	StateRoot             common.Hash      `json:"stateRoot"`
+	TransactionsTrie      common.Hash      `json:"transactionsTrie"`
+	UncleHash             common.Hash      `json:"uncleHash"`
+	ExtraData             hexutil.Bytes    `json:"extraData"`
+	Difficulty            *hexutil.Big     `json:"difficulty"`
+	GasLimit              hexutil.Uint64   `json:"gasLimit"`
+	GasUsed               hexutil.Uint64   `json:"gasUsed"`
+	Timestamp             hexutil.Uint64   `json:"timestamp"`
+	BaseFeePerGas         *hexutil.Big     `json:"baseFeePerGas,omitempty"`
+	WithdrawalsRoot       *common.Hash     `json:"withdrawalsRoot,omitempty"`
+	BlobGasUsed           *hexutil.Uint64  `json:"blobGasUsed,omitempty"`
+	ExcessBlobGas         *hexutil.Uint64  `json:"excessBlobGas,omitempty"`
+	ParentBeaconBlockRoot *common.Hash     `json:"parentBeaconBlockRoot,omitempty"`
+}
+
+func newBtHeader(h *types.Header) *btHeader {
+	return &btHeader{
+		Bloom:                 h.Bloom,
+		Coinbase:              h.Coinbase,
+		MixHash:               h.MixDigest,
+		Nonce:                 h.Nonce,
+		Number:                (*hexutil.Big)(h.Number),
+		Hash:                  h.Hash(),
+		ParentHash:            h.ParentHash,
+		ReceiptTrie:           h.ReceiptHash,
+		StateRoot:             h.Root,
+		TransactionsTrie:      h.TxHash,
+		UncleHash:             h.UncleHash,
+		ExtraData:             h.Extra,
+		Difficulty:            (*hexutil.Big)(h.Difficulty),
+		GasLimit:              hexutil.Uint64(h.GasLimit),
+		GasUsed:               hexutil.Uint64(h.GasUsed),
+		Timestamp:             hexutil.Uint64(h.Time),
+		BaseFeePerGas:         (*hexutil.Big)(h.BaseFee),
+		WithdrawalsRoot:       h.WithdrawalsHash,
+		BlobGasUsed:           (*hexutil.Uint64)(h.BlobGasUsed),
+		ExcessBlobGas:         (*hexutil.Uint64)(h.ExcessBlobGas),
+		ParentBeaconBlockRoot: h.ParentBeaconRoot,
+	}
+}
+
+// genesis returns the genesis-specification corresponding to the test. The
+// values mirror what go-ethereum's blocktest runner derives from the
+// genesis header.
+func (g *GstMaker) genesis(config *params.ChainConfig) *core.Genesis {
+	alloc := make(types.GenesisAlloc)
+	for addr, acc := range *g.pre {
+		alloc[addr] = types.Account{
+			Code:       acc.Code,
+			Storage:    acc.Storage,
+			Balance:    acc.Balance,
+			Nonce:      acc.Nonce,
+			PrivateKey: acc.PrivateKey,
+		}
+	}
+	genesis := &core.Genesis{
+		Config:     config,
+		Timestamp:  g.env.Timestamp,
+		ParentHash: g.env.PreviousHash,
+		GasLimit:   g.env.GasLimit,
+		Difficulty: g.env.Difficulty,
+		Coinbase:   g.env.Coinbase,
+		Alloc:      alloc,
+	}
+	if ttd := config.TerminalTotalDifficulty; ttd != nil && ttd.Sign() == 0 {
+		genesis.Difficulty = new(big.Int)
+		if g.env.Random != nil {
+			genesis.Mixhash = *g.env.Random
+		}
+	}
+	if config.IsLondon(common.Big0) {
+		genesis.BaseFee = g.env.BaseFee
+		// The base fee of the block follows from that of the genesis. A zero
+		// one stays zero, which go-ethereum's blocktest runner fails to
+		// validate (the decoded zero values differ in representation).
+		if genesis.BaseFee != nil && genesis.BaseFee.Sign() == 0 {
+			genesis.BaseFee = big.NewInt(1)
+		}
+	}
+	return genesis
+}
+
+// signedTx creates a signed transaction out of the statetest transaction. It
+// is signed for the given chain id, or, if nil, for the chain of the config.
+func (g *GstMaker) signedTx(config *params.ChainConfig, chainID *big.Int) (*types.Transaction, error) {
+	if len(g.tx.GasLimit) == 0 || len(g.tx.Data) == 0 || len(g.tx.Value) == 0 {
+		return nil, errors.New("incomplete transaction")
+	}
+	key, err := crypto.ToECDSA(g.tx.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	value := new(big.Int)
+	if v := g.tx.Value[0]; v != "0x" {
+		var ok bool
+		if value, ok = math.ParseBig256(v); !ok {
+			return nil, fmt.Errorf("invalid tx value %q", v)
+		}
+	}
+	var to *common.Address
+	if g.tx.To != "" {
+		addr := common.HexToAddress(g.tx.To)
+		to = &addr
+	}
+	var (
+		tx     *types.Transaction
+		acl    types.AccessList
+		hasAcl = len(g.tx.AccessLists) > 0 && g.tx.AccessLists[0] != nil
+		signer = types.LatestSigner(config)
+	)
+	if chainID == nil {
+		chainID = config.ChainID
+	} else {
+		signer = types.LatestSignerForChainID(chainID)
+	}
+	if hasAcl {
+		acl = *g.tx.AccessLists[0]
+	}
+	if g.tx.MaxFeePerGas != nil {
+		tip := g.tx.MaxPriorityFeePerGas
+		if tip == nil {
+			tip = g.tx.MaxFeePerGas
+		}
+		tx = types.NewTx(&types.DynamicFeeTx{
+			ChainID:    chainID,
+			Nonce:      g.tx.Nonce,
+			GasTipCap:  tip,
+			GasFeeCap:  g.tx.MaxFeePerGas,
+			Gas:        g.tx.GasLimit[0],
+			To:         to,
+			Value:      value,
+			Data:       common.FromHex(g.tx.Data[0]),
+			AccessList: acl,
+		})
+	} else if hasAcl {
+		tx = types.NewTx(&types.AccessListTx{
+			ChainID:    chainID,
+			Nonce:      g.tx.Nonce,
+			GasPrice:   g.tx.GasPrice,
+			Gas:        g.tx.GasLimit[0],
+			To:         to,
+			Value:      value,
+			Data:       common.FromHex(g.tx.Data[0]),
+			AccessList: acl,
+		})
+	} else {
+		tx = types.NewTx(&types.LegacyTx{
+			Nonce:    g.tx.Nonce,
+			GasPrice: g.tx.GasPrice,
+			Gas:      g.tx.GasLimit[0],
+			To:       to,
+			Value:    value,
+			Data:     common.FromHex(g.tx.Data[0]),
+		})
+	}
+	if chainID.Sign() == 0 && tx.Type() == types.LegacyTxType {
+		// Without replay protection
+		signer = types.HomesteadSigner{}
+	}
+	return types.SignTx(tx, signer, key)
+}
+
+// ToBlockchainTest wraps the transaction in a single block on top of the
+// pre-state, and returns it as a blockchain test. The block is produced by
+// go-ethereum. The post-state is not included: the last block hash commits to
+// the state root, so a client with a differing post-state fails the test anyway.
+func (g *GstMaker) ToBlockchainTest(name string) (*BlockchainTest, error) {
+	if len(g.forks) == 0 {
+		return nil, errors.New("no fork enabled")
+	}
+	fork := g.forks[0]
+	config, ok := tests.Forks[fork]
+	if !ok {
+		return nil, tests.UnsupportedForkError{Name: fork}
+	}
+	tx, err := g.signedTx(config, g.chainID)
+	if err != nil {
+		return nil, err
+	}
+	// An invalid transaction cannot be included by the block generator.
+	// Instead, the block is generated without it, and the transaction is
+	// added afterwards, making the block invalid. A transaction signed for
+	// another chain is invalid regardless of the state, the other exceptions
+	// are found by trying to include the transaction.
+	var (
+		genesis   = g.genesis(config)
+		exception string
+		blocks    []*types.Block
+	)
+	if _, err := types.Sender(types.LatestSigner(config), tx); err != nil {
+		exception = "TransactionException.INVALID_CHAINID"
+	} else if blocks, err = generateBlock(genesis, tx, g.withdrawals); err != nil {
+		for _, e := range expectedExceptions {
+			if errors.Is(err, e.err) {
+				exception = e.name
+				break
+			}
+		}
+		if exception == "" {
+			return nil, err
+		}
+	}
+	if exception != "" {
+		if blocks, err = generateBlock(genesis, nil, g.withdrawals); err != nil {
+			return nil, err
+		}
+		blocks[0] = withTransaction(blocks[0], tx)
+	}
+	block := blocks[0]
+	blockRlp, err := rlp.EncodeToBytes(block)
+	if err != nil {
+		return nil, err
+	}
+	bt := &btJSON{
+		Blocks: []btBlock{{
+			BlockHeader: newBtHeader(block.Header()),
+			Rlp:         blockRlp,
+		}},
+		Genesis:    *newBtHeader(genesis.ToBlock().Header()),
+		Pre:        *g.pre,
+		BestBlock:  common.UnprefixedHash(block.Hash()),
+		Network:    fork,
+		SealEngine: "NoProof",
+	}
+	if exception != "" {
+		// The block is rejected, leaving the genesis as the head
+		bt.Blocks[0].BlockHeader = nil
+		bt.Blocks[0].ExpectException = exception
+		bt.BestBlock = common.UnprefixedHash(bt.Genesis.Hash)
+	}
+	if err := validateBlockTest(bt); err != nil {
+		return nil, fmt.Errorf("invalid blockchain test: %w", err)
+	}
+	return &BlockchainTest{name: bt}, nil
+}
+
+// generateBlock creates a single block containing the given transaction, if
+// any, and withdrawals.
+func generateBlock(genesis *core.Genesis, tx *types.Transaction, withdrawals []*types.Withdrawal) (blocks []*types.Block, err error) {
+	// The block generator panics if the transaction cannot be included
+	defer func() {
+		if r := recover(); r != nil {
+			if rErr, ok := r.(error); ok {
+				err = fmt.Errorf("block generation failed: %w", rErr)
+			} else {
+				err = fmt.Errorf("block generation failed: %v", r)
+			}
+		}
+	}()
+	_, blocks, _ = core.GenerateChainWithGenesis(genesis, beacon.New(ethash.NewFaker()), 1,
+		func(i int, b *core.BlockGen) {
+			b.SetCoinbase(genesis.Coinbase)
+			if ttd := genesis.Config.TerminalTotalDifficulty; ttd != nil && ttd.Sign() == 0 {
+				b.SetPoS()
+			}
+			if tx != nil {
+				b.AddTx(tx)
+			}
+			for _, w := range withdrawals {
+				b.AddWithdrawal(w)
+			}
+		})
+	return blocks, nil
+}
+
+// withTransaction returns a copy of the block, with the transactions replaced
+// by the given transaction.
+func withTransaction(block *types.Block, tx *types.Transaction) *types.Block {
+	var (
+		txs    = types.Transactions{tx}
+		header = block.Header()
+	)
+	header.TxHash = types.DeriveSha(txs, trie.NewStackTrie(nil))
+	return types.NewBlockWithHeader(header).WithBody(txs, nil).WithWithdrawals(block.Withdrawals())
+}
+
+// validateBlockTest runs the blockchain test through the go-ethereum blocktest
+// runner, to verify that the test is well-formed.
+func validateBlockTest(bt *btJSON) error {
+	data, err := json.Marshal(bt)
+	if err != nil {
+		return err
+	}
+	var test tests.BlockTest
+	if err := json.Unmarshal(data, &test); err != nil {
+		return err
+	}
+	return test.Run(false, rawdb.HashScheme, nil, nil)
+}
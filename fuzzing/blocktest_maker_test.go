@@ -0,0 +1,177 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"encoding/json"
+	"math/big"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/tests"
+)
+
+func TestToBlockchainTest(t *testing.T) {
+	for _, fork := range []string{"London", "Merge", "Shanghai", "Cancun"} {
+		gst := Factory("sstore_sload", fork)()
+		bt, err := gst.ToBlockchainTest("test")
+		if err != nil {
+			t.Fatalf("fork %v: %v", fork, err)
+		}
+		// Round-trip it through json, and execute it.
+		data, err := json.Marshal(bt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var parsed map[string]tests.BlockTest
+		if err := json.Unmarshal(data, &parsed); err != nil {
+			t.Fatalf("fork %v: %v", fork, err)
+		}
+		test := parsed["test"]
+		if err := test.Run(false, rawdb.HashScheme, nil, nil); err != nil {
+			t.Fatalf("fork %v: test failed: %v", fork, err)
+		}
+	}
+}
+
+// TestToBlockchainTestFactories checks that the tests of every generator can be
+// converted into blockchain tests, including those with invalid transactions.
+func TestToBlockchainTestFactories(t *testing.T) {
+	names := FactoryNames()
+	sort.Strings(names)
+	for _, name := range names {
+		for seed := int64(1); seed <= 20; seed++ {
+			rand.Seed(seed)
+			gst := Factory(name, "Cancun")()
+			if _, err := gst.ToBlockchainTest(name); err != nil {
+				t.Errorf("%v, seed %d: %v", name, seed, err)
+			}
+		}
+	}
+}
+
+func TestToBlockchainTestDynamicFee(t *testing.T) {
+	gst := Factory("sstore_sload", "London")()
+	gst.tx.GasPrice = nil
+	gst.tx.MaxFeePerGas = big.NewInt(0x20)
+	gst.tx.MaxPriorityFeePerGas = big.NewInt(0x2)
+	bt, err := gst.ToBlockchainTest("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(bt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parsed map[string]tests.BlockTest
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		t.Fatal(err)
+	}
+	test := parsed["test"]
+	if err := test.Run(false, rawdb.HashScheme, nil, nil); err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+}
+
+// blockTestBalances executes the blockchain test, and returns the balances of
+// the given accounts after the block.
+func blockTestBalances(t *testing.T, gst *GstMaker, addrs []common.Address) map[common.Address]*big.Int {
+	t.Helper()
+	bt, err := gst.ToBlockchainTest("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(bt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parsed map[string]tests.BlockTest
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		t.Fatal(err)
+	}
+	balances := make(map[common.Address]*big.Int)
+	test := parsed["test"]
+	err = test.Run(false, rawdb.HashScheme, nil, func(res error, chain *core.BlockChain) {
+		if res != nil {
+			return
+		}
+		if chain.CurrentBlock().Number.Sign() == 0 {
+			t.Error("block not imported")
+		}
+		state, err := chain.State()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, addr := range addrs {
+			balances[addr] = state.GetBalance(addr).ToBig()
+		}
+	})
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	return balances
+}
+
+func TestToBlockchainTestWithdrawals(t *testing.T) {
+	for i := 0; i < 10; i++ {
+		gst := Factory("withdrawals", "Cancun")()
+		var (
+			addrs   []common.Address
+			credits = make(map[common.Address]*big.Int)
+		)
+		for _, w := range gst.withdrawals {
+			if credits[w.Address] == nil {
+				addrs = append(addrs, w.Address)
+				credits[w.Address] = new(big.Int)
+			}
+			amount := new(big.Int).SetUint64(w.Amount)
+			credits[w.Address].Add(credits[w.Address], amount.Mul(amount, big.NewInt(params.GWei)))
+		}
+		// Withdrawals are processed after the transaction, so the balances
+		// differ from the ones without withdrawals by exactly the amounts
+		have := blockTestBalances(t, gst, addrs)
+		withdrawals := gst.withdrawals
+		gst.withdrawals = nil
+		base := blockTestBalances(t, gst, addrs)
+		gst.withdrawals = withdrawals
+		for _, addr := range addrs {
+			want := new(big.Int).Add(base[addr], credits[addr])
+			if have[addr].Cmp(want) != 0 {
+				t.Errorf("account %v: expected balance %v, have %v", addr, want, have[addr])
+			}
+		}
+		// The block commits to the withdrawals
+		bt, err := gst.ToBlockchainTest("test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var block types.Block
+		if err := rlp.DecodeBytes((*bt)["test"].Blocks[0].Rlp, &block); err != nil {
+			t.Fatal(err)
+		}
+		if len(block.Withdrawals()) != len(gst.withdrawals) {
+			t.Errorf("expected %d withdrawals in the block, have %d", len(gst.withdrawals), len(block.Withdrawals()))
+		}
+	}
+}
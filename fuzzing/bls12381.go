@@ -17,7 +17,6 @@
 package fuzzing
 
 import (
-	crand "crypto/rand"
 	"math/big"
 	"math/rand"
 	"sync"
@@ -109,7 +108,7 @@ func NewG1Add() []byte {
 func NewG1Mul() []byte {
 	a := NewG1Point()
 	mul := make([]byte, 32)
-	_, _ = crand.Read(mul)
+	_, _ = rand.Read(mul)
 	return append(a, mul...)
 }
 
@@ -132,7 +131,7 @@ func NewG2Add() []byte {
 func NewG2Mul() []byte {
 	a := NewG2Point()
 	mul := make([]byte, 32)
-	_, _ = crand.Read(mul)
+	_, _ = rand.Read(mul)
 	return append(a, mul...)
 }
 
@@ -211,10 +210,7 @@ func NewPairing() []byte {
 }
 
 func NewFieldElement() []byte {
-	ret, err := crand.Int(crand.Reader, modulo)
-	if err != nil {
-		panic(err)
-	}
+	ret := randBigInt(modulo)
 	bytes := ret.Bytes()
 	buf := make([]byte, 48)
 	copy(buf[48-len(bytes):], bytes)
@@ -0,0 +1,170 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"math/big"
+	"math/rand"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto/bn256"
+	"github.com/holiman/goevmlab/ops"
+	"github.com/holiman/goevmlab/program"
+)
+
+var (
+	// bn256Order is the order of the bn256 groups
+	bn256Order, _ = new(big.Int).SetString("21888242871839275222246405745257275088548364400416034343698204186575808495617", 10)
+	// bn256Modulus is the modulus of the base field
+	bn256Modulus, _ = new(big.Int).SetString("21888242871839275222246405745257275088696311157297823662689037894645226208583", 10)
+)
+
+const (
+	bn256PairingAddr = 0x08
+	bn256PairSize    = 192 // A G1 point (64 bytes) and a G2 point (128 bytes)
+)
+
+func fillBn256Pairing(gst *GstMaker, fork string) {
+	// Add a contract which calls the pairing precompile
+	dest := common.HexToAddress("0x00ca11b256")
+	gst.AddAccount(dest, GenesisAccount{
+		Code:    RandCallBn256Pairing(),
+		Balance: new(big.Int),
+		Storage: make(map[common.Hash]common.Hash),
+	})
+	// The transaction
+	gst.SetTx(&StTransaction{
+		// 8M gaslimit
+		GasLimit:   []uint64{8000000},
+		Nonce:      0,
+		Value:      []string{randHex(4)},
+		Data:       []string{randHex(100)},
+		GasPrice:   big.NewInt(0x10),
+		To:         dest.Hex(),
+		Sender:     sender,
+		PrivateKey: pKey,
+	})
+}
+
+// RandCallBn256Pairing creates code which performs one or more calls to the
+// bn256 pairing precompile, and stores the success flag and the output.
+func RandCallBn256Pairing() []byte {
+	var (
+		p     = program.NewProgram()
+		slot  = 0
+		calls = 1 + rand.Intn(3)
+	)
+	for i := 0; i < calls; i++ {
+		data := NewBn256PairingInput()
+		if len(data) > 0 {
+			p.Mstore(data, 0)
+		}
+		// Clear the output area, to see whether the output is written
+		p.Mstore(make([]byte, 32), uint32(len(data)))
+		// A failing call consumes all gas given, so pass enough to cover
+		// the (EIP-1108) cost, give or take a little.
+		gas := big.NewInt(int64(45_000 + 34_000*(len(data)/bn256PairSize) + oneOf(-1, 0, 0, 1000).(int)))
+		if rand.Intn(2) == 0 {
+			p.StaticCall(gas, bn256PairingAddr, 0, len(data), len(data), 32)
+		} else {
+			p.Call(gas, bn256PairingAddr, 0, 0, len(data), len(data), 32)
+		}
+		p.Push(slot)
+		p.Op(ops.SSTORE)
+		p.Push(len(data))
+		p.Op(ops.MLOAD)
+		p.Push(slot + 1)
+		p.Op(ops.SSTORE)
+		slot += 2
+	}
+	return p.Bytecode()
+}
+
+// NewBn256PairingInput returns input for the pairing precompile: pairs which
+// pass the pairing check or not, the empty input (which passes), points at
+// infinity, points which are off the curve or have coordinates outside the
+// field, and inputs whose length is not a multiple of 192.
+func NewBn256PairingInput() []byte {
+	var data []byte
+	switch rand.Intn(8) {
+	case 0: // Empty input
+		return nil
+	case 1, 2: // A product of pairings which equals one
+		for i := 0; i < 1+rand.Intn(3); i++ {
+			data = append(data, bn256CancellingPairs()...)
+		}
+	default: // Random pairs
+		for i := 0; i < 1+rand.Intn(4); i++ {
+			data = append(data, bn256RandomPair()...)
+		}
+	}
+	switch rand.Intn(8) {
+	case 0: // Put a point off the curve
+		pair := rand.Intn(len(data) / bn256PairSize)
+		data[pair*bn256PairSize+rand.Intn(bn256PairSize)] ^= 0x01
+	case 1: // Put a coordinate outside of the field (but fitting 32 bytes)
+		pair := rand.Intn(len(data) / bn256PairSize)
+		coord := rand.Intn(bn256PairSize / 32)
+		x := new(big.Int).SetBytes(data[pair*bn256PairSize+32*coord:][:32])
+		x.Add(x, bn256Modulus)
+		if x.BitLen() <= 256 {
+			x.FillBytes(data[pair*bn256PairSize+32*coord:][:32])
+		}
+	case 2: // Make the length wrong
+		if rand.Intn(2) == 0 {
+			data = data[:len(data)-1-rand.Intn(bn256PairSize-1)]
+		} else {
+			data = append(data, make([]byte, 1+rand.Intn(bn256PairSize-1))...)
+		}
+	}
+	return data
+}
+
+// bn256RandomPair returns a random pair of a G1 and a G2 point, either of which
+// may be the point at infinity.
+func bn256RandomPair() []byte {
+	var (
+		g1 = make([]byte, 64)
+		g2 = make([]byte, 128)
+	)
+	if rand.Intn(8) != 0 {
+		k := randBigInt(bn256Order)
+		g1 = new(bn256.G1).ScalarBaseMult(k).Marshal()
+	}
+	if rand.Intn(8) != 0 {
+		k := randBigInt(bn256Order)
+		g2 = new(bn256.G2).ScalarBaseMult(k).Marshal()
+	}
+	return append(g1, g2...)
+}
+
+// bn256CancellingPairs returns two pairs, e(a*G1, b*G2) and e(-ab*G1, G2),
+// whose product is one.
+func bn256CancellingPairs() []byte {
+	var (
+		a  = randBigInt(bn256Order)
+		b  = randBigInt(bn256Order)
+		ab = new(big.Int).Mul(a, b)
+	)
+	ab.Neg(ab).Mod(ab, bn256Order)
+	var data []byte
+	data = append(data, new(bn256.G1).ScalarBaseMult(a).Marshal()...)
+	data = append(data, new(bn256.G2).ScalarBaseMult(b).Marshal()...)
+	data = append(data, new(bn256.G1).ScalarBaseMult(ab).Marshal()...)
+	data = append(data, new(bn256.G2).ScalarBaseMult(big.NewInt(1)).Marshal()...)
+	return data
+}
@@ -0,0 +1,184 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"math/big"
+	"math/rand"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/holiman/goevmlab/ops"
+	"github.com/holiman/goevmlab/program"
+)
+
+var (
+	callcodeCallerAddr  = common.HexToAddress("0x0000000000000000000000000000000000cc0de0")
+	callcodeLibAddr     = common.HexToAddress("0x0000000000000000000000000000000000cc0de1")
+	callcodeMissingAddr = common.HexToAddress("0x0000000000000000000000000000000000cc0de2")
+)
+
+// callcodeSharedSlot is present in the storage of both the caller and the
+// library, with different values, so that a read from the wrong storage
+// context shows up in the post-state.
+var callcodeSharedSlot = common.BigToHash(big.NewInt(0x10))
+
+// callcodeCallerBalance is the balance of the caller. Values above it make
+// the CALLCODE fail.
+const callcodeCallerBalance = 0x2222
+
+func fillCallCode(gst *GstMaker, fork string) {
+	// The library, which inspects the execution context
+	gst.AddAccount(callcodeLibAddr, GenesisAccount{
+		Code:    callcodeLibCode(),
+		Balance: big.NewInt(0x1111),
+		Storage: map[common.Hash]common.Hash{
+			callcodeSharedSlot:              common.HexToHash("0x11b"),
+			common.BigToHash(big.NewInt(1)): common.HexToHash("0x11b1"),
+		},
+	})
+	// The caller, which callcodes into the library
+	gst.AddAccount(callcodeCallerAddr, GenesisAccount{
+		Code:    RandCallCodes(fork, callcodeLibAddr),
+		Balance: big.NewInt(callcodeCallerBalance),
+		Storage: map[common.Hash]common.Hash{
+			callcodeSharedSlot: common.HexToHash("0xca11c0de"),
+		},
+	})
+	// The transaction
+	gst.SetTx(&StTransaction{
+		// 8M gaslimit
+		GasLimit:   []uint64{8000000},
+		Nonce:      0,
+		Value:      []string{randHex(4)},
+		Data:       []string{randHex(100)},
+		GasPrice:   big.NewInt(0x10),
+		To:         callcodeCallerAddr.Hex(),
+		Sender:     sender,
+		PrivateKey: pKey,
+	})
+}
+
+// callcodeLibCode returns code which stores the execution context (ADDRESS,
+// CALLER, CALLVALUE, the own balance, CALLDATASIZE, the balance of the
+// library itself and the value of the shared slot) into the slots following the one
+// given as the first calldata word. Unlike with DELEGATECALL, the caller and
+// value are those of the CALLCODE itself, while the address, balance and
+// storage are those of the caller.
+func callcodeLibCode() []byte {
+	p := program.NewProgram()
+	store := func(i int) {
+		p.Push(i)
+		p.Push(0)
+		p.Op(ops.CALLDATALOAD)
+		p.Op(ops.ADD)
+		p.Op(ops.SSTORE)
+	}
+	for i, op := range []ops.OpCode{ops.ADDRESS, ops.CALLER, ops.CALLVALUE} {
+		p.Op(op)
+		store(i)
+	}
+	// The own balance, without SELFBALANCE, which older forks lack
+	p.Op(ops.ADDRESS)
+	p.Op(ops.BALANCE)
+	store(3)
+	p.Op(ops.CALLDATASIZE)
+	store(4)
+	// The library balance, which the value transfer must not touch
+	p.Push(callcodeLibAddr)
+	p.Op(ops.BALANCE)
+	store(5)
+	// Copy the shared slot
+	p.Push(callcodeSharedSlot.Big())
+	p.Op(ops.SLOAD)
+	store(6)
+	// And overwrite it
+	p.Op(ops.CALLVALUE)
+	p.Push(callcodeSharedSlot.Big())
+	p.Op(ops.SSTORE)
+	// Return the caller, for the caller to inspect
+	p.Op(ops.CALLER)
+	p.Push(0)
+	p.Op(ops.MSTORE)
+	p.Return(0, 32)
+	return p.Bytecode()
+}
+
+// RandCallCodes creates code which callcodes the given library (which is
+// expected to behave like callcodeLibCode) a few times, with value, and now
+// and then a precompile or an account which does not exist. The values range
+// from zero to more than the caller owns, and the gas from none, to around
+// the stipend, to plenty. The success flag, the return data (size only in
+// forks with RETURNDATASIZE), the balance and the remaining gas end up in the
+// storage of the caller.
+func RandCallCodes(fork string, lib common.Address) []byte {
+	var (
+		p          = program.NewProgram()
+		slot       = 0x100
+		calls      = 1 + rand.Intn(4)
+		forkOp     = ops.LookupFork(fork)
+		returnData = forkOp == nil || forkOp.IsValid(ops.RETURNDATASIZE)
+	)
+	for i := 0; i < calls; i++ {
+		// The library writes to slots following the first calldata word
+		p.Mstore(common.BigToHash(big.NewInt(int64(slot))).Bytes(), 0)
+		var (
+			gas   = big.NewInt(int64(oneOf(0, 2299, 2300, 5_000, 50_000, 1_000_000).(int)))
+			value = oneOf(0, 1, 1+rand.Intn(0x100), callcodeCallerBalance, callcodeCallerBalance+1).(int)
+			addr  = lib
+		)
+		switch rand.Intn(8) {
+		case 0:
+			// A precompile, which gets the value in the caller's context
+			addr = common.BytesToAddress([]byte{byte(1 + rand.Intn(9))})
+			p.Mstore(common.FromHex(randHex(100)), 32)
+		case 1:
+			// An account which does not exist: the value goes to the caller
+			// itself, so no account is created
+			addr = callcodeMissingAddr
+		}
+		p.CallCode(gas, addr, value, 0, oneOf(32, 64, 132).(int), 0x100, 32)
+		// Store the success flag, the return data size, the returned word,
+		// the balance and the remaining gas
+		p.Push(i)
+		p.Op(ops.SSTORE)
+		if returnData {
+			p.Op(ops.RETURNDATASIZE)
+			p.Push(0x10 + i)
+			p.Op(ops.SSTORE)
+		}
+		p.Push(0x100)
+		p.Op(ops.MLOAD)
+		p.Push(0x20 + i)
+		p.Op(ops.SSTORE)
+		p.Op(ops.ADDRESS)
+		p.Op(ops.BALANCE)
+		p.Push(0x30 + i)
+		p.Op(ops.SSTORE)
+		p.Op(ops.GAS)
+		p.Push(0x40 + i)
+		p.Op(ops.SSTORE)
+		slot += 0x10
+	}
+	// The context of the caller itself, for comparison
+	p.Op(ops.CALLER)
+	p.Push(0x50)
+	p.Op(ops.SSTORE)
+	p.Op(ops.CALLVALUE)
+	p.Push(0x51)
+	p.Op(ops.SSTORE)
+	return p.Bytecode()
+}
@@ -0,0 +1,191 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"math/big"
+	"math/rand"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/holiman/goevmlab/ops"
+	"github.com/holiman/goevmlab/program"
+)
+
+var (
+	callGasAddr       = common.HexToAddress("0x0000000000000000000000000000000000063640")
+	callGasReportAddr = common.HexToAddress("0x0000000000000000000000000000000000063641")
+	callGasNestedAddr = common.HexToAddress("0x0000000000000000000000000000000000063642")
+)
+
+// callGasLimits are the transaction gas limits, from levels where the callees
+// are left with very little gas, up to plenty of it.
+var callGasLimits = []uint64{25_000, 30_000, 40_000, 60_000, 100_000, 1_000_000, 8_000_000}
+
+func fillCallGas(gst *GstMaker, fork string) {
+	gst.AddAccount(callGasReportAddr, GenesisAccount{
+		Code:    callGasReportCode(),
+		Balance: new(big.Int),
+		Storage: make(map[common.Hash]common.Hash),
+	})
+	gst.AddAccount(callGasNestedAddr, GenesisAccount{
+		Code:    callGasNestedCode(callGasReportAddr),
+		Balance: new(big.Int),
+		Storage: make(map[common.Hash]common.Hash),
+	})
+	gst.AddAccount(callGasAddr, GenesisAccount{
+		Code:    RandCallGasCode(fork, []common.Address{callGasReportAddr, callGasNestedAddr}),
+		Balance: big.NewInt(1_000_000),
+		Storage: make(map[common.Hash]common.Hash),
+	})
+	gst.SetTx(&StTransaction{
+		GasLimit:   []uint64{callGasLimits[rand.Intn(len(callGasLimits))]},
+		Nonce:      0,
+		Value:      []string{randHex(4)},
+		Data:       []string{randHex(100)},
+		GasPrice:   big.NewInt(0x10),
+		To:         callGasAddr.Hex(),
+		Sender:     sender,
+		PrivateKey: pKey,
+	})
+}
+
+// callGasReportCode returns code which returns the gas it received, as
+// reported by the GAS opcode as its very first instruction.
+func callGasReportCode() []byte {
+	p := program.NewProgram()
+	p.Op(ops.GAS)
+	p.Push(0)
+	p.Op(ops.MSTORE)
+	p.Return(0, 32)
+	return p.Bytecode()
+}
+
+// callGasNestedCode returns code which reports the gas it received, then
+// calls the reporter with more gas than can be forwarded, and returns both
+// its own and the reporter's received gas.
+func callGasNestedCode(reporter common.Address) []byte {
+	p := program.NewProgram()
+	p.Op(ops.GAS)
+	p.Push(0)
+	p.Op(ops.MSTORE)
+	p.Call(maxUint256, reporter, 0, 0, 0, 32, 32)
+	p.Op(ops.POP)
+	p.Return(0, 64)
+	return p.Bytecode()
+}
+
+// pushCallGas pushes the gas to request for a call. Mostly, it is more than
+// what can be forwarded, so the 63/64 cap binds: huge values, all of the
+// remaining gas, or an amount just around the cap. Sometimes it is a small
+// amount, which is forwarded as is.
+func pushCallGas(p *program.Program) {
+	switch rand.Intn(8) {
+	case 0, 1:
+		p.Push(asBig(oneOf("0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff",
+			"0x10000000000000000", "0xffffffffffffffff", "0x7fffffffffffffff", "0x100000000").(string)))
+	case 2, 3:
+		p.Op(ops.GAS)
+	case 4, 5, 6:
+		// GAS - GAS/64 +/- delta, which is around the cap, as the cost of
+		// the call itself is yet to be deducted
+		p.Op(ops.GAS)
+		p.Op(ops.DUP1)
+		p.Push(64)
+		p.Op(ops.SWAP1)
+		p.Op(ops.DIV)
+		p.Op(ops.SWAP1)
+		p.Op(ops.SUB)
+		if delta := rand.Intn(3000) - 1000; delta < 0 {
+			p.Push(-delta)
+			p.Op(ops.SWAP1)
+			p.Op(ops.SUB)
+		} else {
+			p.Push(delta)
+			p.Op(ops.ADD)
+		}
+	default:
+		p.Push(rand.Intn(3000))
+	}
+}
+
+// RandCallGasCode creates code which calls into the given reporters with
+// the various call types, requesting gas so that the 63/64 cap of EIP-150
+// binds. It stores the outcome, the gas the callee reported to have received,
+// and the gas retained after the call. Contracts created with CREATE and
+// CREATE2 store the gas they received in their own storage.
+func RandCallGasCode(fork string, reporters []common.Address) []byte {
+	var (
+		p      = program.NewProgram()
+		forkOp = ops.LookupFork(fork)
+		slot   = 0
+		store  = func() {
+			p.Push(slot)
+			p.Op(ops.SSTORE)
+			slot++
+		}
+	)
+	initcode := program.NewProgram()
+	initcode.Op(ops.GAS)
+	initcode.Push(0)
+	initcode.Op(ops.SSTORE)
+	for n := 1 + rand.Intn(6); n > 0; n-- {
+		op := oneOf(ops.CALL, ops.CALLCODE, ops.DELEGATECALL, ops.STATICCALL, ops.CREATE, ops.CREATE2).(ops.OpCode)
+		if forkOp != nil && !forkOp.IsValid(op) {
+			op = ops.CALL
+		}
+		switch op {
+		case ops.CREATE, ops.CREATE2:
+			// Creations always forward all but one 64th
+			code := initcode.Bytecode()
+			p.Mstore(code, 0)
+			if op == ops.CREATE2 {
+				p.Push(slot) // salt
+			}
+			p.Push(len(code))
+			p.Push(0)
+			p.Push(0)
+			p.Op(op)
+			store()
+		default:
+			p.Push(64) // outSize
+			p.Push(0)  // outOffset
+			p.Push(0)  // inSize
+			p.Push(0)  // inOffset
+			if op == ops.CALL || op == ops.CALLCODE {
+				// A value transfer adds the stipend to the forwarded gas
+				p.Push(oneOf(0, 0, 1).(int))
+			}
+			p.Push(reporters[rand.Intn(len(reporters))])
+			pushCallGas(p)
+			p.Op(op)
+			store()
+			// The gas received by the callee (and the nested callee)
+			p.Push(0)
+			p.Op(ops.MLOAD)
+			store()
+			p.Push(32)
+			p.Op(ops.MLOAD)
+			store()
+		}
+		// The gas retained
+		p.Op(ops.GAS)
+		store()
+		// Clear the memory, so a failed call does not show stale values
+		p.Mstore(make([]byte, 64), 0)
+	}
+	return p.Bytecode()
+}
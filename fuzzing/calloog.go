@@ -0,0 +1,173 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"math/big"
+	"math/rand"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/holiman/goevmlab/ops"
+	"github.com/holiman/goevmlab/program"
+)
+
+var (
+	callOOGAddr       = common.HexToAddress("0x00000000000000000000000000000000000600f0")
+	callOOGCalleeAddr = common.HexToAddress("0x00000000000000000000000000000000000600f1")
+)
+
+func fillCallOOG(gst *GstMaker, fork string) {
+	gst.AddAccount(callOOGCalleeAddr, GenesisAccount{
+		Code:    CallOOGCalleeCode(),
+		Balance: new(big.Int),
+		Storage: make(map[common.Hash]common.Hash),
+	})
+	gst.AddAccount(callOOGAddr, GenesisAccount{
+		Code:    RandCallOOGCode(callOOGCalleeAddr),
+		Balance: big.NewInt(1_000_000),
+		Storage: make(map[common.Hash]common.Hash),
+	})
+	gst.SetTx(&StTransaction{
+		// 8M gaslimit
+		GasLimit:   []uint64{8000000},
+		Nonce:      0,
+		Value:      []string{randHex(4)},
+		Data:       []string{randHex(100)},
+		GasPrice:   big.NewInt(0x10),
+		To:         callOOGAddr.Hex(),
+		Sender:     sender,
+		PrivateKey: pKey,
+	})
+}
+
+// CallOOGCalleeCode returns code which loops as many times as given by the
+// first word of calldata (which must be non-zero), and returns the gas left.
+// It only uses ops with a static cost, so the gas it needs is known exactly:
+// see CallOOGCalleeCost.
+func CallOOGCalleeCode() []byte {
+	p := program.NewProgram()
+	p.Push(0)
+	p.Op(ops.CALLDATALOAD)
+	loop := p.Jumpdest()
+	p.Push(1)
+	p.Op(ops.SWAP1)
+	p.Op(ops.SUB)
+	p.Op(ops.DUP1)
+	p.Push(loop)
+	p.Op(ops.JUMPI)
+	p.Op(ops.GAS)
+	p.Push(0)
+	p.Op(ops.MSTORE)
+	p.Return(0, 32)
+	return p.Bytecode()
+}
+
+// CallOOGCalleeCost returns the gas the callee needs to complete the given
+// number of iterations: 6 for loading the counter, 26 per iteration, and 17 for
+// returning the gas left (including the expansion of memory to one word).
+func CallOOGCalleeCost(iterations int) uint64 {
+	return 6 + 26*uint64(iterations) + 17
+}
+
+// callOOGGas returns the gas to forward to the callee for the given number of
+// iterations: mostly just short of what it needs, so it runs out of gas
+// somewhere in the last iterations or while returning, and sometimes just
+// enough.
+func callOOGGas(iterations int) uint64 {
+	var (
+		cost  = CallOOGCalleeCost(iterations)
+		short = uint64(oneOf(1, 1, 2, 1+rand.Intn(17), 1+rand.Intn(3*26), 1+rand.Intn(int(cost))).(int))
+	)
+	switch rand.Intn(5) {
+	case 0:
+		return cost
+	case 1:
+		return cost + 1
+	}
+	return cost - short
+}
+
+// RandCallOOGCode creates code which calls the callee with gas tuned so it
+// runs out of gas partway, or barely makes it. The outcome of each call is
+// branched on: a successful call stores the gas the callee had left, a failed
+// one the caller's own gas left, each with the size of the return data. The
+// exact point where the callee runs out of gas thus shows up as a different
+// path taken by the caller.
+func RandCallOOGCode(callee common.Address) []byte {
+	var (
+		p     = program.NewProgram()
+		calls = 1 + rand.Intn(8)
+	)
+	for i := 0; i < calls; i++ {
+		var (
+			iterations = 1 + rand.Intn(100)
+			gas        = callOOGGas(iterations)
+			op         = oneOf(ops.CALL, ops.CALL, ops.STATICCALL, ops.DELEGATECALL).(ops.OpCode)
+			value      = 0
+		)
+		if op == ops.CALL && rand.Intn(3) == 0 {
+			// A value transfer adds the stipend to the forwarded gas
+			value = 1
+			if gas < params.CallStipend {
+				gas = 0
+			} else {
+				gas -= params.CallStipend
+			}
+		}
+		p.Mstore(common.BigToHash(big.NewInt(int64(iterations))).Bytes(), 0)
+		switch op {
+		case ops.CALL:
+			p.Call(new(big.Int).SetUint64(gas), callee, value, 0, 32, 0, 32)
+		case ops.STATICCALL:
+			p.StaticCall(new(big.Int).SetUint64(gas), callee, 0, 32, 0, 32)
+		default:
+			p.DelegateCall(new(big.Int).SetUint64(gas), callee, 0, 32, 0, 32)
+		}
+		// The code executed when the call fails
+		failed := program.NewProgram()
+		failed.Op(ops.GAS)
+		failed.Push(4*i + 2)
+		failed.Op(ops.SSTORE)
+		failed.Op(ops.RETURNDATASIZE)
+		failed.Push(4*i + 3)
+		failed.Op(ops.SSTORE)
+		// PUSH2 target, JUMPI, the failure code, PUSH2 end, JUMP
+		target := p.Size() + 4 + len(failed.Bytecode()) + 4
+		p.Op(ops.PUSH2)
+		p.AddAll([]byte{byte(target >> 8), byte(target)})
+		p.Op(ops.JUMPI)
+		p.AddAll(failed.Bytecode())
+		// The code executed when the call succeeds
+		succeeded := program.NewProgram()
+		succeeded.Op(ops.JUMPDEST)
+		succeeded.Push(0)
+		succeeded.Op(ops.MLOAD)
+		succeeded.Push(4 * i)
+		succeeded.Op(ops.SSTORE)
+		succeeded.Op(ops.RETURNDATASIZE)
+		succeeded.Push(4*i + 1)
+		succeeded.Op(ops.SSTORE)
+		end := target + len(succeeded.Bytecode())
+		p.Op(ops.PUSH2)
+		p.AddAll([]byte{byte(end >> 8), byte(end)})
+		p.Op(ops.JUMP)
+		p.AddAll(succeeded.Bytecode())
+		p.Op(ops.JUMPDEST)
+	}
+	return p.Bytecode()
+}
@@ -0,0 +1,137 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"math/big"
+	"math/rand"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/holiman/goevmlab/ops"
+	"github.com/holiman/goevmlab/program"
+)
+
+var (
+	callValueAddr    = common.HexToAddress("0x00000000000000000000000000000000000ca100")
+	callValueEOA     = common.HexToAddress("0x00000000000000000000000000000000000ca101")
+	callValueLogAddr = common.HexToAddress("0x00000000000000000000000000000000000ca102")
+	callValueSstAddr = common.HexToAddress("0x00000000000000000000000000000000000ca103")
+	callValueEmpty   = common.HexToAddress("0x00000000000000000000000000000000000ca104")
+)
+
+// callValueGas are the gas values passed to the value-bearing calls: around
+// zero, around the stipend (2300), and 'all of it' (nil, which means GAS).
+var callValueGas = []*big.Int{
+	big.NewInt(0), big.NewInt(1),
+	big.NewInt(2299), big.NewInt(2300), big.NewInt(2301),
+	big.NewInt(5000), big.NewInt(25000), big.NewInt(100_000),
+	nil,
+}
+
+func fillCallValue(gst *GstMaker, fork string) {
+	// An existing EOA
+	gst.AddAccount(callValueEOA, GenesisAccount{
+		Balance: big.NewInt(1),
+		Storage: make(map[common.Hash]common.Hash),
+	})
+	// Existing contracts, requiring less and more gas than the stipend
+	gst.AddAccount(callValueLogAddr, GenesisAccount{
+		Code:    callValueLogger(),
+		Balance: new(big.Int),
+		Storage: make(map[common.Hash]common.Hash),
+	})
+	gst.AddAccount(callValueSstAddr, GenesisAccount{
+		Code:    callValueStorer(),
+		Balance: new(big.Int),
+		Storage: map[common.Hash]common.Hash{
+			common.HexToHash("0x01"): common.HexToHash("0x01"),
+		},
+	})
+	// The caller, with some balance to transfer
+	gst.AddAccount(callValueAddr, GenesisAccount{
+		Code:    RandCallValue(),
+		Balance: big.NewInt(0xffffff),
+		Storage: make(map[common.Hash]common.Hash),
+	})
+	// The transaction
+	gst.SetTx(&StTransaction{
+		// 8M gaslimit
+		GasLimit:   []uint64{8000000},
+		Nonce:      0,
+		Value:      []string{randHex(4)},
+		Data:       []string{randHex(100)},
+		GasPrice:   big.NewInt(0x10),
+		To:         callValueAddr.Hex(),
+		Sender:     sender,
+		PrivateKey: pKey,
+	})
+}
+
+// callValueLogger returns code which logs the call value, which fits within
+// the stipend.
+func callValueLogger() []byte {
+	p := program.NewProgram()
+	p.Op(ops.CALLVALUE)
+	p.Push(0)
+	p.Op(ops.MSTORE)
+	p.Push(32)
+	p.Push(0)
+	p.Op(ops.LOG0)
+	return p.Bytecode()
+}
+
+// callValueStorer returns code which writes storage, which does not fit
+// within the stipend.
+func callValueStorer() []byte {
+	p := program.NewProgram()
+	p.Op(ops.CALLVALUE)
+	p.Push(1)
+	p.Op(ops.SSTORE)
+	return p.Bytecode()
+}
+
+// RandCallValue creates code which does a few value-bearing calls, with gas
+// near the stipend boundary, to an empty account (which needs to be created),
+// an existing EOA, contracts, a precompile and itself. Now and then, the
+// value exceeds the balance.
+func RandCallValue() []byte {
+	var (
+		p     = program.NewProgram()
+		calls = 1 + rand.Intn(6)
+	)
+	for i := 0; i < calls; i++ {
+		var (
+			gas   = callValueGas[rand.Intn(len(callValueGas))]
+			value = big.NewInt(int64(oneOf(1, 2, 0xffff).(int)))
+			addr  = oneOf(callValueEmpty, callValueEOA, callValueLogAddr, callValueSstAddr,
+				common.BytesToAddress([]byte{byte(1 + rand.Intn(9))}),
+				callValueAddr).(common.Address)
+		)
+		if rand.Intn(8) == 0 {
+			// More than the balance
+			value = big.NewInt(0x1000000)
+		}
+		p.Call(gas, addr, value, 0, 0, 0, 0)
+		// Store the success flag and the remaining gas
+		p.Push(i)
+		p.Op(ops.SSTORE)
+		p.Op(ops.GAS)
+		p.Push(0x100 + i)
+		p.Op(ops.SSTORE)
+	}
+	return p.Bytecode()
+}
@@ -0,0 +1,132 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"math/big"
+	"math/rand"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/holiman/goevmlab/ops"
+	"github.com/holiman/goevmlab/program"
+)
+
+func fillChainID(gst *GstMaker, fork string) {
+	// All transaction types are available from London
+	if !ops.LookupRules(fork).IsLondon {
+		fork = "London"
+		gst.SetFork(fork)
+	}
+	dest := common.HexToAddress("0x00000000000000000000000000000000c4a1d000")
+	gst.AddAccount(dest, GenesisAccount{
+		Code:    RandChainIDCode(),
+		Balance: new(big.Int),
+		Storage: make(map[common.Hash]common.Hash),
+	})
+	// The transaction
+	tx := &StTransaction{
+		// 8M gaslimit
+		GasLimit:   []uint64{8000000},
+		Nonce:      0,
+		Value:      []string{randHex(4)},
+		Data:       []string{randHex(100)},
+		To:         dest.Hex(),
+		Sender:     sender,
+		PrivateKey: pKey,
+	}
+	switch rand.Intn(3) {
+	case 0:
+		tx.GasPrice = big.NewInt(0x10)
+	case 1:
+		tx.GasPrice = big.NewInt(0x10)
+		tx.AccessLists = []*types.AccessList{{{Address: dest, StorageKeys: []common.Hash{}}}}
+	default:
+		tx.MaxFeePerGas = big.NewInt(0x20)
+		tx.MaxPriorityFeePerGas = big.NewInt(0x1)
+	}
+	gst.SetTx(tx)
+	// The chain id only applies to blockchain tests, where the transaction is
+	// signed by us.
+	gst.SetChainID(randChainID())
+}
+
+// randChainID returns a chain id to sign the transaction with: usually the
+// one of the test chain, sometimes zero (no replay protection for legacy
+// transactions) and sometimes a mismatching one.
+func randChainID() *big.Int {
+	switch rand.Intn(6) {
+	case 0, 1, 2:
+		return nil // the default
+	case 3:
+		return new(big.Int)
+	case 4:
+		return big.NewInt(1)
+	}
+	return asBig(oneOf("0x2", "0x5", "0x539", "0xffffffff", "0xffffffffffffffff",
+		"0x10000000000000001", "0x8000000000000000000000000000000000000000000000000000000000000000").(string))
+}
+
+// RandChainIDCode creates code which calls ECRECOVER with signatures of random
+// hashes. The v value is either correct, for the other recovery id, or
+// derived from the chain id as done for transactions by EIP-155, which the
+// precompile does not accept. The chain id, the call results and the
+// recovered addresses are stored.
+func RandChainIDCode() []byte {
+	p := program.NewProgram()
+	p.Op(ops.CHAINID)
+	p.Push(0)
+	p.Op(ops.SSTORE)
+	calls := 1 + rand.Intn(8)
+	for i := 1; i <= calls; i++ {
+		var (
+			key     = randKey()
+			hash    = make([]byte, 32)
+			outSlot = 32 * (4 + i)
+		)
+		_, _ = rand.Read(hash)
+		sig, _ := crypto.Sign(hash, key)
+		recID := int(sig[64])
+		p.Mstore(hash, 0)
+		p.Mstore(sig[:64], 64)
+		switch rand.Intn(4) {
+		case 0: // valid
+			p.Push(27 + recID)
+		case 1: // the other recovery id
+			p.Push(28 - recID)
+		case 2: // EIP-155: chainid * 2 + 35 + recid
+			p.Push(35 + recID)
+			p.Push(2)
+			p.Op(ops.CHAINID)
+			p.Op(ops.MUL)
+			p.Op(ops.ADD)
+		default: // the bare recovery id
+			p.Push(recID)
+		}
+		p.Push(32)
+		p.Op(ops.MSTORE)
+		p.StaticCall(big.NewInt(10_000), 1, 0, 128, outSlot, 32)
+		p.Push(2 * i)
+		p.Op(ops.SSTORE)
+		p.Push(outSlot)
+		p.Op(ops.MLOAD)
+		p.Push(2*i + 1)
+		p.Op(ops.SSTORE)
+	}
+	return p.Bytecode()
+}
@@ -0,0 +1,109 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"math/big"
+	"math/rand"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/holiman/goevmlab/ops"
+	"github.com/holiman/goevmlab/program"
+)
+
+// codeSizes are the sizes of the code deployed by CREATE/CREATE2: around the
+// limit (EIP-170), and at the word boundaries next to it.
+var codeSizes = []int{
+	params.MaxCodeSize - 32, params.MaxCodeSize - 1, params.MaxCodeSize,
+	params.MaxCodeSize + 1, params.MaxCodeSize + 32,
+}
+
+func fillCodeSize(gst *GstMaker, fork string) {
+	dest := common.HexToAddress("0x00000000000000000000000000000000000c0170")
+	gst.AddAccount(dest, GenesisAccount{
+		Code:    RandCodeSizeCreates(),
+		Balance: big.NewInt(0xffff),
+		Storage: make(map[common.Hash]common.Hash),
+	})
+	// The transaction
+	gst.SetTx(&StTransaction{
+		// 8M gaslimit
+		GasLimit:   []uint64{8000000},
+		Nonce:      0,
+		Value:      []string{randHex(4)},
+		Data:       []string{randHex(100)},
+		GasPrice:   big.NewInt(0x10),
+		To:         dest.Hex(),
+		Sender:     sender,
+		PrivateKey: pKey,
+	})
+}
+
+// CodeSizeInitcode returns initcode which deploys code of the given size: the
+// first byte is given, the rest is zeroes.
+func CodeSizeInitcode(size int, first byte) []byte {
+	p := program.NewProgram()
+	if first != 0 {
+		p.Push(first)
+		p.Push(0)
+		p.Op(ops.MSTORE8)
+	}
+	p.Return(0, uint32(size))
+	return p.Bytecode()
+}
+
+// RandCodeSizeCreates creates code which does a few CREATE/CREATE2 with
+// initcode which deploys code of a size around the limit. Since the code
+// deposit of a contract at the limit costs almost 5M gas, the later creates
+// may also run out of gas. The created address, the size of its code and the
+// gas left are stored.
+func RandCodeSizeCreates() []byte {
+	var (
+		p       = program.NewProgram()
+		creates = 1 + rand.Intn(3)
+	)
+	for i := 0; i < creates; i++ {
+		var (
+			size     = codeSizes[rand.Intn(len(codeSizes))]
+			initcode = CodeSizeInitcode(size, oneOf(byte(0), byte(0), byte(ops.INVALID), byte(0xef)).(byte))
+		)
+		p.Mstore(initcode, 0)
+		if rand.Intn(2) == 0 {
+			p.Push(i) // salt
+			p.Push(len(initcode))
+			p.Push(0)
+			p.Push(rand.Intn(2)) // value
+			p.Op(ops.CREATE2)
+		} else {
+			p.Push(len(initcode))
+			p.Push(0)
+			p.Push(rand.Intn(2)) // value
+			p.Op(ops.CREATE)
+		}
+		p.Op(ops.DUP1)
+		p.Push(3 * i)
+		p.Op(ops.SSTORE)
+		p.Op(ops.EXTCODESIZE)
+		p.Push(3*i + 1)
+		p.Op(ops.SSTORE)
+		p.Op(ops.GAS)
+		p.Push(3*i + 2)
+		p.Op(ops.SSTORE)
+	}
+	return p.Bytecode()
+}
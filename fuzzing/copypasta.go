@@ -26,6 +26,7 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/rlp"
 	"golang.org/x/crypto/sha3"
 )
@@ -114,9 +115,10 @@ type stJSON struct {
 }
 
 type stPostState struct {
-	Root    common.Hash `json:"hash"`
-	Logs    common.Hash `json:"logs"`
-	Indexes stIndex     `json:"indexes"`
+	Root            common.Hash `json:"hash"`
+	Logs            common.Hash `json:"logs"`
+	Indexes         stIndex     `json:"indexes"`
+	ExpectException string      `json:"expectException,omitempty"`
 }
 
 type stIndex struct {
@@ -128,44 +130,51 @@ type stIndex struct {
 //go:generate gencodec -type stEnv -field-override stEnvMarshaling -out gen_stenv.go
 
 type stEnv struct {
-	Coinbase     common.Address `json:"currentCoinbase"   gencodec:"required"`
-	Difficulty   *big.Int       `json:"currentDifficulty" gencodec:"optional"`
-	Random       *common.Hash   `json:"currentRandom,omitempty"     gencodec:"optional"`
-	GasLimit     uint64         `json:"currentGasLimit"   gencodec:"required"`
-	Number       uint64         `json:"currentNumber"     gencodec:"required"`
-	Timestamp    uint64         `json:"currentTimestamp"  gencodec:"required"`
-	PreviousHash common.Hash    `json:"previousHash"`
-	BaseFee      *big.Int       `json:"currentBaseFee"`
+	Coinbase      common.Address `json:"currentCoinbase"   gencodec:"required"`
+	Difficulty    *big.Int       `json:"currentDifficulty" gencodec:"optional"`
+	Random        *common.Hash   `json:"currentRandom,omitempty"     gencodec:"optional"`
+	GasLimit      uint64         `json:"currentGasLimit"   gencodec:"required"`
+	Number        uint64         `json:"currentNumber"     gencodec:"required"`
+	Timestamp     uint64         `json:"currentTimestamp"  gencodec:"required"`
+	PreviousHash  common.Hash    `json:"previousHash"`
+	BaseFee       *big.Int       `json:"currentBaseFee"`
+	ExcessBlobGas *uint64        `json:"currentExcessBlobGas,omitempty"`
 }
 
 type stEnvMarshaling struct {
-	Coinbase   common.UnprefixedAddress
-	Difficulty *math.HexOrDecimal256
-	Random     *common.Hash
-	GasLimit   math.HexOrDecimal64
-	Number     math.HexOrDecimal64
-	Timestamp  math.HexOrDecimal64
-	BaseFee    *math.HexOrDecimal256
+	Coinbase      common.UnprefixedAddress
+	Difficulty    *math.HexOrDecimal256
+	Random        *common.Hash
+	GasLimit      math.HexOrDecimal64
+	Number        math.HexOrDecimal64
+	Timestamp     math.HexOrDecimal64
+	BaseFee       *math.HexOrDecimal256
+	ExcessBlobGas *math.HexOrDecimal64
 }
 
 //go:generate gencodec -type StTransaction -field-override stTransactionMarshaling -out gen_sttransaction.go
 
 type StTransaction struct {
-	GasPrice   *big.Int       `json:"gasPrice"`
-	Nonce      uint64         `json:"nonce"`
-	To         string         `json:"to"`
-	Data       []string       `json:"data"`
-	GasLimit   []uint64       `json:"gasLimit"`
-	Value      []string       `json:"value"`
-	Sender     common.Address `json:"sender"`
-	PrivateKey []byte         `json:"secretKey"`
+	GasPrice             *big.Int            `json:"gasPrice,omitempty"`
+	MaxFeePerGas         *big.Int            `json:"maxFeePerGas,omitempty"`
+	MaxPriorityFeePerGas *big.Int            `json:"maxPriorityFeePerGas,omitempty"`
+	Nonce                uint64              `json:"nonce"`
+	To                   string              `json:"to"`
+	Data                 []string            `json:"data"`
+	AccessLists          []*types.AccessList `json:"accessLists,omitempty"`
+	GasLimit             []uint64            `json:"gasLimit"`
+	Value                []string            `json:"value"`
+	Sender               common.Address      `json:"sender"`
+	PrivateKey           []byte              `json:"secretKey"`
 }
 
 type stTransactionMarshaling struct {
-	GasPrice   *math.HexOrDecimal256
-	Nonce      math.HexOrDecimal64
-	GasLimit   []math.HexOrDecimal64
-	PrivateKey hexutil.Bytes
+	GasPrice             *math.HexOrDecimal256
+	MaxFeePerGas         *math.HexOrDecimal256
+	MaxPriorityFeePerGas *math.HexOrDecimal256
+	Nonce                math.HexOrDecimal64
+	GasLimit             []math.HexOrDecimal64
+	PrivateKey           hexutil.Bytes
 }
 
 func rlpHash(x interface{}) (h common.Hash) {
@@ -0,0 +1,153 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"math/big"
+	"math/rand"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/holiman/goevmlab/ops"
+	"github.com/holiman/goevmlab/program"
+)
+
+func fillCreateCall(gst *GstMaker, fork string) {
+	dest := common.HexToAddress("0x00000000000000000000000000000000000c2ea7")
+	gst.AddAccount(dest, GenesisAccount{
+		Code:    RandCreateCall(fork),
+		Balance: big.NewInt(1_000_000),
+		Storage: make(map[common.Hash]common.Hash),
+	})
+	// The transaction
+	gst.SetTx(&StTransaction{
+		// 8M gaslimit
+		GasLimit:   []uint64{8000000},
+		Nonce:      0,
+		Value:      []string{randHex(4)},
+		Data:       []string{randHex(100)},
+		GasPrice:   big.NewInt(0x10),
+		To:         dest.Hex(),
+		Sender:     sender,
+		PrivateKey: pKey,
+	})
+}
+
+// RandCreateCall creates code which creates contracts, and immediately calls
+// into them, within the same transaction. After each create, it stores the
+// new address, the gas cost of accessing it (which should be warm), its code
+// size, and the outcome of calling it. The created contracts return their own
+// code size, as seen from inside.
+func RandCreateCall(fork string) []byte {
+	var (
+		p      = program.NewProgram()
+		flows  = 1 + rand.Intn(5)
+		forkOp = ops.LookupFork(fork)
+		slot   = 0
+	)
+	valid := func(op ops.OpCode) bool {
+		return forkOp == nil || forkOp.IsValid(op)
+	}
+	store := func() {
+		p.Push(slot)
+		p.Op(ops.SSTORE)
+		slot++
+	}
+	var createOps, callOps []ops.OpCode
+	for _, op := range []ops.OpCode{ops.CREATE, ops.CREATE2} {
+		if valid(op) {
+			createOps = append(createOps, op)
+		}
+	}
+	for _, op := range []ops.OpCode{ops.CALL, ops.CALLCODE, ops.DELEGATECALL, ops.STATICCALL} {
+		if valid(op) {
+			callOps = append(callOps, op)
+		}
+	}
+	for i := 0; i < flows; i++ {
+		initcode := createCallInitcode(valid)
+		p.Mstore(initcode, 0)
+		// Create it, leaving the address on the stack
+		createOp := createOps[rand.Intn(len(createOps))]
+		if createOp == ops.CREATE2 {
+			p.Push(i) // salt
+		}
+		p.Push(len(initcode)).Push(0).Push(rand.Intn(2)).Op(createOp)
+		p.Op(ops.DUP1)
+		store()
+		// The cost of accessing the new address
+		p.Op(ops.GAS)
+		p.Op(ops.DUP2)
+		p.Op(ops.BALANCE)
+		p.Op(ops.POP)
+		p.Op(ops.GAS)
+		p.Op(ops.SWAP1)
+		p.Op(ops.SUB)
+		store()
+		p.Op(ops.DUP1)
+		p.Op(ops.EXTCODESIZE)
+		store()
+		// Call into it
+		callOp := callOps[rand.Intn(len(callOps))]
+		p.Push(32).Push(0) // mem out
+		p.Push(0).Push(0)  // mem in
+		addrOffset := ops.DUP5
+		if callOp == ops.CALL || callOp == ops.CALLCODE {
+			p.Push(rand.Intn(2)) // value
+			addrOffset = ops.DUP6
+		}
+		p.Op(addrOffset)
+		p.Push(100_000)
+		p.Op(callOp)
+		store()
+		p.Push(0)
+		p.Op(ops.MLOAD)
+		store()
+		p.Op(ops.POP) // pop the address
+	}
+	return p.Bytecode()
+}
+
+// createCallInitcode returns initcode which mostly deploys code returning its
+// own code size, but which may also deploy empty code, or fail.
+func createCallInitcode(valid func(ops.OpCode) bool) []byte {
+	runtime := program.NewProgram()
+	if rand.Intn(2) == 0 {
+		runtime.Push(1)
+		runtime.Push(0)
+		runtime.Op(ops.SSTORE)
+	}
+	runtime.Op(ops.ADDRESS)
+	runtime.Op(ops.EXTCODESIZE)
+	runtime.Push(0)
+	runtime.Op(ops.MSTORE)
+	runtime.Return(0, 32)
+
+	initcode := program.NewProgram()
+	switch rand.Intn(8) {
+	case 0: // Empty code
+		initcode.Op(ops.STOP)
+	case 1: // Failure
+		if valid(ops.REVERT) {
+			initcode.Push(0).Push(0).Op(ops.REVERT)
+		} else {
+			initcode.Op(ops.INVALID)
+		}
+	default:
+		initcode.ReturnData(runtime.Bytecode())
+	}
+	return initcode.Bytecode()
+}
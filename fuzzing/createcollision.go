@@ -0,0 +1,163 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"math/big"
+	"math/rand"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/holiman/goevmlab/ops"
+	"github.com/holiman/goevmlab/program"
+)
+
+var createCollisionAddr = common.HexToAddress("0x00000000000000000000000000000000000c0111")
+
+func fillCreateCollision(gst *GstMaker, fork string) {
+	initcode := createCollisionInitcode()
+	if rand.Intn(3) == 0 {
+		// A creation transaction, colliding with an account at the address
+		// derived from the sender's nonce
+		nonce := uint64(rand.Intn(4))
+		acc := (*gst.pre)[gst.SenderAddress()]
+		acc.Nonce = nonce
+		gst.AddAccount(gst.SenderAddress(), acc)
+		gst.AddAccount(gst.CreateAddress(gst.SenderAddress()), collidingAccount())
+		gst.SetTx(&StTransaction{
+			// 8M gaslimit
+			GasLimit:   []uint64{8000000},
+			Nonce:      nonce,
+			Value:      []string{randHex(4)},
+			Data:       []string{hexutil.Encode(initcode)},
+			GasPrice:   big.NewInt(0x10),
+			To:         "",
+			Sender:     sender,
+			PrivateKey: pKey,
+		})
+		return
+	}
+	var (
+		creations  = 1 + rand.Intn(3)
+		forkOp     = ops.LookupFork(fork)
+		useCreate2 = forkOp == nil || forkOp.IsValid(ops.CREATE2)
+	)
+	// Contract accounts start with nonce 1 (EIP-161), but may have created
+	// contracts before
+	gst.AddAccount(createCollisionAddr, GenesisAccount{
+		Code:    RandCreateCollisionCode(initcode, creations, useCreate2),
+		Balance: big.NewInt(1_000_000),
+		Nonce:   uint64(1 + rand.Intn(3)),
+		Storage: make(map[common.Hash]common.Hash),
+	})
+	// Accounts at the addresses of the creations: the first one always
+	// collides, the others now and then
+	nonce := (*gst.pre)[createCollisionAddr].Nonce
+	for i := 0; i < creations; i++ {
+		if i == 0 || rand.Intn(2) == 0 {
+			gst.AddAccount(crypto.CreateAddress(createCollisionAddr, nonce+uint64(i)), collidingAccount())
+		}
+	}
+	if useCreate2 {
+		for salt := int64(0); salt < 2; salt++ {
+			if rand.Intn(2) == 0 {
+				addr := crypto.CreateAddress2(createCollisionAddr, common.BigToHash(big.NewInt(salt)), crypto.Keccak256(initcode))
+				gst.AddAccount(addr, collidingAccount())
+			}
+		}
+	}
+	gst.SetTx(&StTransaction{
+		// 8M gaslimit
+		GasLimit:   []uint64{8000000},
+		Nonce:      0,
+		Value:      []string{randHex(4)},
+		Data:       []string{randHex(100)},
+		GasPrice:   big.NewInt(0x10),
+		To:         createCollisionAddr.Hex(),
+		Sender:     sender,
+		PrivateKey: pKey,
+	})
+}
+
+// collidingAccount returns an account which a creation collides with: it has
+// a nonzero nonce, or code, or both. Now and then, it only has a balance, and
+// does not collide.
+func collidingAccount() GenesisAccount {
+	acc := GenesisAccount{
+		Balance: big.NewInt(int64(rand.Intn(2))),
+		Storage: make(map[common.Hash]common.Hash),
+	}
+	switch rand.Intn(7) {
+	case 0, 1:
+		acc.Nonce = uint64(oneOf(1, 1, 2, 0xff).(int))
+	case 2, 3:
+		acc.Code = []byte{byte(ops.STOP)}
+	case 4, 5:
+		acc.Nonce = 1
+		acc.Code = []byte{byte(ops.CALLER), byte(ops.SELFDESTRUCT)}
+		acc.Storage[common.Hash{}] = common.BigToHash(big.NewInt(1))
+	default:
+		acc.Balance = big.NewInt(1)
+	}
+	return acc
+}
+
+// createCollisionInitcode returns initcode which records the value it received
+// in storage, and deploys a short contract.
+func createCollisionInitcode() []byte {
+	p := program.NewProgram()
+	p.Op(ops.CALLVALUE)
+	p.Push(0)
+	p.Op(ops.SSTORE)
+	p.ReturnData([]byte{byte(ops.ADDRESS), byte(ops.POP)})
+	return p.Bytecode()
+}
+
+// RandCreateCollisionCode creates code which deploys the initcode a number of
+// times, with CREATE or, if allowed, CREATE2 using salt 0 or 1. It stores the
+// address returned by each creation (zero on a collision) and the gas left
+// afterwards, which shows whether the forwarded gas was consumed. Finally, the
+// code stores the address of a creation following them, which shows whether
+// the nonce was incremented by the failed creations.
+func RandCreateCollisionCode(initcode []byte, creations int, useCreate2 bool) []byte {
+	p := program.NewProgram()
+	p.Mstore(initcode, 0)
+	for i := 0; i < creations; i++ {
+		op := ops.CREATE
+		if useCreate2 && rand.Intn(2) == 0 {
+			op = ops.CREATE2
+			p.Push(rand.Intn(2)) // salt
+		}
+		p.Push(len(initcode))
+		p.Push(0)
+		p.Push(rand.Intn(2)) // value
+		p.Op(op)
+		p.Push(2 * i)
+		p.Op(ops.SSTORE)
+		p.Op(ops.GAS)
+		p.Push(2*i + 1)
+		p.Op(ops.SSTORE)
+	}
+	p.Push(0) // size
+	p.Push(0)
+	p.Push(0)
+	p.Op(ops.CREATE)
+	p.Push(2 * creations)
+	p.Op(ops.SSTORE)
+	return p.Bytecode()
+}
@@ -0,0 +1,101 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"math/big"
+	"math/rand"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/holiman/goevmlab/ops"
+	"github.com/holiman/goevmlab/program"
+)
+
+// deployedSizes are the sizes of the code deployed, around the limit
+// (EIP-170).
+var deployedSizes = []int{
+	params.MaxCodeSize - 1, params.MaxCodeSize, params.MaxCodeSize + 1, params.MaxCodeSize + 32,
+}
+
+func fillCreationTx(gst *GstMaker, fork string) {
+	// The transaction, without a destination
+	gst.SetTx(&StTransaction{
+		// 8M gaslimit
+		GasLimit:   []uint64{8000000},
+		Nonce:      0,
+		Value:      []string{randHex(4)},
+		Data:       []string{hexutil.Encode(RandCreationInitcode())},
+		GasPrice:   big.NewInt(0x10),
+		To:         "",
+		Sender:     sender,
+		PrivateKey: pKey,
+	})
+}
+
+// RandCreationInitcode creates initcode for a contract-creation transaction.
+// It may deploy random code (possibly starting with the reserved 0xEF byte),
+// code of a size around the limit, or nothing at all. It may also revert, or
+// create a contract of its own before deploying.
+func RandCreationInitcode() []byte {
+	p := program.NewProgram()
+	// Some state changes made while in the creation context
+	if rand.Intn(2) == 0 {
+		p.Op(ops.CALLVALUE)
+		p.Op(ops.ADDRESS)
+		p.Op(ops.SSTORE)
+	}
+	switch rand.Intn(6) {
+	case 0: // Empty initcode
+		return nil
+	case 1: // Revert, with some data
+		data := make([]byte, 32)
+		_, _ = rand.Read(data)
+		p.Mstore(data, 0)
+		p.Push(rand.Intn(33))
+		p.Push(0)
+		p.Op(ops.REVERT)
+	case 2: // Code of a size around the limit
+		p.Push(0xfe)
+		p.Push(0)
+		p.Op(ops.MSTORE8)
+		p.Return(0, uint32(deployedSizes[rand.Intn(len(deployedSizes))]))
+	case 3: // Create a contract, and deploy its address
+		inner := program.NewProgram()
+		inner.ReturnData(randRuntimeCode())
+		p.CreateAndCall(inner.Bytecode(), rand.Intn(2) == 0, ops.CALL)
+		p.Op(ops.ADDRESS)
+		p.Op(ops.EXTCODESIZE)
+		p.Push(1)
+		p.Op(ops.SSTORE)
+		p.ReturnData(randRuntimeCode())
+	default:
+		p.ReturnData(randRuntimeCode())
+	}
+	return p.Bytecode()
+}
+
+// randRuntimeCode returns a bit of random code, which now and then starts with
+// the reserved 0xEF byte (EIP-3541).
+func randRuntimeCode() []byte {
+	code := make([]byte, rand.Intn(64))
+	_, _ = rand.Read(code)
+	if len(code) > 0 && rand.Intn(4) == 0 {
+		code[0] = 0xef
+	}
+	return code
+}
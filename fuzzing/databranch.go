@@ -0,0 +1,155 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"math/big"
+	"math/rand"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/holiman/goevmlab/ops"
+	"github.com/holiman/goevmlab/program"
+)
+
+var (
+	dataBranchAddr = common.HexToAddress("0x00000000000000000000000000000000000d8b00")
+
+	// branchOps are the ops whose result a data-dependent branch is on: the
+	// arithmetic ops, and the comparisons and bitwise ops.
+	branchOps = append([]ops.OpCode{
+		ops.LT, ops.GT, ops.SLT, ops.SGT, ops.EQ, ops.ISZERO, ops.AND, ops.OR, ops.XOR, ops.NOT,
+	}, arithOps...)
+)
+
+// dataBranchSlots is the number of storage slots seeded with operands.
+const dataBranchSlots = 8
+
+func fillDataBranch(gst *GstMaker, fork string) {
+	storage := make(map[common.Hash]common.Hash)
+	for i := 0; i < dataBranchSlots; i++ {
+		if rand.Intn(8) != 0 {
+			storage[common.BigToHash(big.NewInt(int64(i)))] = common.BigToHash(randOperand())
+		}
+	}
+	gst.AddAccount(dataBranchAddr, GenesisAccount{
+		Code:    RandDataBranch(fork),
+		Balance: new(big.Int),
+		Storage: storage,
+	})
+	// The calldata: operands, possibly cut short
+	var data []byte
+	for i := 0; i < 4; i++ {
+		data = append(data, common.BigToHash(randOperand()).Bytes()...)
+	}
+	data = data[:len(data)-oneOf(0, 0, 1, 16, 31, 32+rand.Intn(64)).(int)]
+	gst.SetTx(&StTransaction{
+		// 8M gaslimit
+		GasLimit:   []uint64{8000000},
+		Nonce:      0,
+		Value:      []string{randHex(4)},
+		Data:       []string{hexutil.Encode(data)},
+		GasPrice:   big.NewInt(0x10),
+		To:         dataBranchAddr.Hex(),
+		Sender:     sender,
+		PrivateKey: pKey,
+	})
+}
+
+// randOperand returns an operand to seed storage or calldata with: a boundary
+// value, or a random one.
+func randOperand() *big.Int {
+	if rand.Intn(2) == 0 {
+		return new(big.Int).Set(arithSentinels[rand.Intn(len(arithSentinels))])
+	}
+	return randInt(16, 64)().(*big.Int)
+}
+
+// pushDataOperand pushes an operand loaded from the data: from a (possibly
+// unset) storage slot, or from calldata, at an offset which may be unaligned
+// or past the end. Now and then, it is a constant.
+func pushDataOperand(p *program.Program, constant bool) {
+	switch r := rand.Intn(5); {
+	case r < 2:
+		p.Push(rand.Intn(dataBranchSlots + 1))
+		p.Op(ops.SLOAD)
+	case r < 4 || !constant:
+		p.Push(oneOf(0, 32, 64, 96, rand.Intn(128), 128).(int))
+		p.Op(ops.CALLDATALOAD)
+	default:
+		p.Push(arithSentinels[rand.Intn(len(arithSentinels))])
+	}
+}
+
+// RandDataBranch creates code which, block by block, loads operands from
+// storage and calldata, does arithmetic on them (with ops valid in the fork),
+// and branches on the result (JUMPI). A client handling an operand differently
+// thus takes a different path: the result is stored, and the branch taken
+// either executes a gas-consuming op and stores the gas left, or stores a
+// marker.
+func RandDataBranch(fork string) []byte {
+	var (
+		p      = program.NewProgram()
+		blocks = 1 + rand.Intn(16)
+		forkOp = ops.LookupFork(fork)
+		valid  []ops.OpCode
+	)
+	for _, op := range branchOps {
+		if forkOp == nil || forkOp.IsValid(op) {
+			valid = append(valid, op)
+		}
+	}
+	for i := 0; i < blocks; i++ {
+		op := valid[rand.Intn(len(valid))]
+		// The first operand goes on top of the stack, and is always loaded
+		for j := len(op.Pops()) - 1; j >= 0; j-- {
+			pushDataOperand(p, j > 0)
+		}
+		p.Op(op)
+		if rand.Intn(3) == 0 {
+			// Branch on a single bit only
+			p.Push(1)
+			p.Op(ops.AND)
+		}
+		p.Op(ops.DUP1)
+		p.Push(3 * i)
+		p.Op(ops.SSTORE)
+		// The code executed when not jumping
+		notTaken := program.NewProgram()
+		notTaken.Sstore(3*i+1, 1)
+		target := p.Size() + 4 + len(notTaken.Bytecode()) + 4
+		// PUSH2 target, JUMPI, the code not jumping, PUSH2 end, JUMP
+		p.Op(ops.PUSH2)
+		p.AddAll([]byte{byte(target >> 8), byte(target)})
+		p.Op(ops.JUMPI)
+		p.AddAll(notTaken.Bytecode())
+		// The code executed when jumping
+		taken := program.NewProgram()
+		taken.Op(ops.JUMPDEST)
+		gasConsumer(taken)
+		taken.Op(ops.GAS)
+		taken.Push(3*i + 2)
+		taken.Op(ops.SSTORE)
+		end := target + len(taken.Bytecode())
+		p.Op(ops.PUSH2)
+		p.AddAll([]byte{byte(end >> 8), byte(end)})
+		p.Op(ops.JUMP)
+		p.AddAll(taken.Bytecode())
+		p.Op(ops.JUMPDEST)
+	}
+	return p.Bytecode()
+}
@@ -0,0 +1,144 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"math/big"
+	"math/rand"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/holiman/goevmlab/ops"
+	"github.com/holiman/goevmlab/program"
+)
+
+var (
+	delegateCallerAddr = common.HexToAddress("0x00000000000000000000000000000000000de1e0")
+	delegateLibAddr    = common.HexToAddress("0x00000000000000000000000000000000000de1e1")
+)
+
+// delegateSharedSlot is present in the storage of both the caller and the
+// library, with different values, so that a read from the wrong storage
+// context shows up in the post-state.
+var delegateSharedSlot = common.BigToHash(big.NewInt(0x10))
+
+func fillDelegateCall(gst *GstMaker, fork string) {
+	// The library, which inspects the execution context
+	gst.AddAccount(delegateLibAddr, GenesisAccount{
+		Code:    delegateLibCode(),
+		Balance: big.NewInt(0x1111),
+		Storage: map[common.Hash]common.Hash{
+			delegateSharedSlot: common.HexToHash("0x11b"),
+		},
+	})
+	// The caller, which delegatecalls into the library
+	gst.AddAccount(delegateCallerAddr, GenesisAccount{
+		Code:    RandDelegateCalls(delegateLibAddr),
+		Balance: big.NewInt(0x2222),
+		Storage: map[common.Hash]common.Hash{
+			delegateSharedSlot: common.HexToHash("0xca11e4"),
+		},
+	})
+	// The transaction
+	gst.SetTx(&StTransaction{
+		// 8M gaslimit
+		GasLimit:   []uint64{8000000},
+		Nonce:      0,
+		Value:      []string{randHex(4)},
+		Data:       []string{randHex(100)},
+		GasPrice:   big.NewInt(0x10),
+		To:         delegateCallerAddr.Hex(),
+		Sender:     sender,
+		PrivateKey: pKey,
+	})
+}
+
+// delegateLibCode returns code which stores the execution context (ADDRESS,
+// CALLER, CALLVALUE, SELFBALANCE, CALLDATASIZE and the value of the shared
+// slot) into the slots following the one given as the first calldata word.
+// Since it is delegatecalled, all of it should be the context of the caller.
+func delegateLibCode() []byte {
+	p := program.NewProgram()
+	for i, op := range []ops.OpCode{ops.ADDRESS, ops.CALLER, ops.CALLVALUE, ops.SELFBALANCE, ops.CALLDATASIZE} {
+		p.Op(op)
+		p.Push(i)
+		p.Push(0)
+		p.Op(ops.CALLDATALOAD)
+		p.Op(ops.ADD)
+		p.Op(ops.SSTORE)
+	}
+	// Copy the shared slot
+	p.Push(delegateSharedSlot.Big())
+	p.Op(ops.SLOAD)
+	p.Push(5)
+	p.Push(0)
+	p.Op(ops.CALLDATALOAD)
+	p.Op(ops.ADD)
+	p.Op(ops.SSTORE)
+	// And overwrite it
+	p.Op(ops.CALLVALUE)
+	p.Push(delegateSharedSlot.Big())
+	p.Op(ops.SSTORE)
+	// Return the caller, for the caller to inspect
+	p.Op(ops.CALLER)
+	p.Push(0)
+	p.Op(ops.MSTORE)
+	p.Return(0, 32)
+	return p.Bytecode()
+}
+
+// RandDelegateCalls creates code which delegatecalls the given library (which
+// is expected to behave like delegateLibCode) a few times, and now and then a
+// precompile. The success flag, the return data and the storage written by
+// the library end up in the storage of the caller.
+func RandDelegateCalls(lib common.Address) []byte {
+	var (
+		p     = program.NewProgram()
+		slot  = 0x100
+		calls = 1 + rand.Intn(4)
+	)
+	for i := 0; i < calls; i++ {
+		// The library writes to slots following the first calldata word
+		p.Mstore(common.BigToHash(big.NewInt(int64(slot))).Bytes(), 0)
+		gas := big.NewInt(int64(oneOf(5_000, 50_000, 1_000_000).(int)))
+		addr := lib
+		if rand.Intn(4) == 0 {
+			// Delegatecalling a precompile
+			addr = common.BytesToAddress([]byte{byte(1 + rand.Intn(9))})
+			p.Mstore(common.FromHex(randHex(100)), 32)
+		}
+		p.DelegateCall(gas, addr, 0, oneOf(32, 64, 132).(int), 0x100, 32)
+		// Store the success flag, the return data size and the returned word
+		p.Push(i)
+		p.Op(ops.SSTORE)
+		p.Op(ops.RETURNDATASIZE)
+		p.Push(0x10 + i)
+		p.Op(ops.SSTORE)
+		p.Push(0x100)
+		p.Op(ops.MLOAD)
+		p.Push(0x20 + i)
+		p.Op(ops.SSTORE)
+		slot += 0x10
+	}
+	// The context of the caller itself, for comparison
+	p.Op(ops.CALLER)
+	p.Push(0x30)
+	p.Op(ops.SSTORE)
+	p.Op(ops.CALLVALUE)
+	p.Push(0x31)
+	p.Op(ops.SSTORE)
+	return p.Bytecode()
+}
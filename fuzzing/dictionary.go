@@ -0,0 +1,83 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"bufio"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"os"
+	"strings"
+)
+
+// dictionary holds the 'interesting' constants which, if set, are mixed into
+// the values pushed by the generators.
+var dictionary []*big.Int
+
+// SetDictionary sets the constants for the generators to draw operands from,
+// along with random ones. It must be called before generation starts.
+func SetDictionary(values []*big.Int) {
+	dictionary = values
+}
+
+// LoadDictionary reads a dictionary file, which has one value per line, in
+// hex (0x-prefixed) or decimal, of at most 32 bytes. Empty lines and lines
+// starting with '#' are ignored. AFL-style entries (name="value") are
+// accepted as well, with the value in one of the formats above.
+func LoadDictionary(path string) ([]*big.Int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var (
+		values  []*big.Int
+		scanner = bufio.NewScanner(f)
+	)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if i := strings.Index(line, "="); i >= 0 {
+			line = strings.Trim(strings.TrimSpace(line[i+1:]), `"`)
+		}
+		v, ok := new(big.Int).SetString(line, 0)
+		if !ok || v.Sign() < 0 || v.BitLen() > 256 {
+			return nil, fmt.Errorf("%v:%d: invalid value %q", path, n, line)
+		}
+		values = append(values, v)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("%v: no values", path)
+	}
+	return values, nil
+}
+
+// fromDictionary returns, in a quarter of the calls, a value from the
+// dictionary, and otherwise nil. Without a dictionary, it always returns nil,
+// without drawing any randomness.
+func fromDictionary() *big.Int {
+	if len(dictionary) == 0 || rand.Intn(4) != 0 {
+		return nil
+	}
+	return new(big.Int).Set(dictionary[rand.Intn(len(dictionary))])
+}
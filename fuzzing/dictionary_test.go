@@ -0,0 +1,113 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/holiman/goevmlab/ops"
+)
+
+func TestLoadDictionary(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dict")
+	content := `# Some constants
+0xdeadbeef
+1234
+
+addr="0x00000000000000000000000000000000000c0ffe"
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	values, err := LoadDictionary(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []int64{0xdeadbeef, 1234, 0xc0ffe}
+	if len(values) != len(want) {
+		t.Fatalf("expected %d values, have %d", len(want), len(values))
+	}
+	for i, v := range values {
+		if v.Int64() != want[i] {
+			t.Errorf("value %d: expected %#x, have %#x", i, want[i], v)
+		}
+	}
+	for _, bad := range []string{"0xzz", "-1", "0x10000000000000000000000000000000000000000000000000000000000000000", ""} {
+		if err := os.WriteFile(path, []byte(bad), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadDictionary(path); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+// pushOperands returns the immediate values of the push instructions in the
+// code.
+func pushOperands(code []byte) []*big.Int {
+	var values []*big.Int
+	for pc := 0; pc < len(code); pc++ {
+		op := ops.OpCode(code[pc])
+		if !op.IsPush() {
+			continue
+		}
+		end := pc + 1 + int(op-ops.PUSH1) + 1
+		if end > len(code) {
+			break
+		}
+		values = append(values, new(big.Int).SetBytes(code[pc+1:end]))
+		pc = end - 1
+	}
+	return values
+}
+
+func TestDictionaryOperands(t *testing.T) {
+	magic := new(big.Int).SetBytes(common.FromHex("0x5ca1ab1e00000000000000000000000000000000000000000000000000c0ffee"))
+	SetDictionary([]*big.Int{magic})
+	defer SetDictionary(nil)
+
+	for _, name := range []string{"naive", "simpleops"} {
+		var found int
+		for i := 0; i < 5; i++ {
+			gst := Factory(name, "Cancun")()
+			for _, acc := range *gst.pre {
+				for _, v := range pushOperands(acc.Code) {
+					if v.Cmp(magic) == 0 {
+						found++
+					}
+				}
+			}
+		}
+		if found == 0 {
+			t.Errorf("%v: dictionary value not pushed", name)
+		}
+	}
+	var found int
+	gen := ValueRandomizer()
+	for i := 0; i < 100; i++ {
+		if gen().(*big.Int).Cmp(magic) == 0 {
+			found++
+		}
+	}
+	if found == 0 || found == 100 {
+		t.Errorf("dictionary values not mixed with random ones: %d of 100", found)
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"math/big"
+	"math/rand"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/holiman/goevmlab/ops"
+	"github.com/holiman/goevmlab/program"
+)
+
+// emptyAccounts are the accounts at the EIP-161 'empty' boundary: empty ones
+// (zero nonce and balance, no code), and ones which miss being empty by a
+// single field.
+var emptyAccounts = []GenesisAccount{
+	{}, // empty
+	{Storage: map[common.Hash]common.Hash{{0x01}: {0x01}}}, // empty, but with storage
+	{Balance: big.NewInt(1)},                               // balance only
+	{Nonce: 1},                                             // nonce only
+	{Code: []byte{byte(ops.STOP)}},                         // code only
+}
+
+// emptyAccountBase is the first of the addresses used for the (near-)empty
+// accounts.
+var emptyAccountBase = common.HexToAddress("0x00000000000000000000000000000000000e1610")
+
+func fillEmptyAccounts(gst *GstMaker, fork string) {
+	dest := common.HexToAddress("0x00000000000000000000000000000000000e1600")
+	// Some of the addresses are not present at all
+	var addrs []common.Address
+	for i := 0; i < 2+rand.Intn(6); i++ {
+		addr := common.BigToAddress(new(big.Int).Add(emptyAccountBase.Big(), big.NewInt(int64(i))))
+		addrs = append(addrs, addr)
+		if rand.Intn(4) == 0 {
+			continue
+		}
+		acc := emptyAccounts[rand.Intn(len(emptyAccounts))]
+		balance := new(big.Int)
+		if acc.Balance != nil {
+			balance.Set(acc.Balance)
+		}
+		gst.AddAccount(addr, GenesisAccount{
+			Code:    common.CopyBytes(acc.Code),
+			Balance: balance,
+			Nonce:   acc.Nonce,
+			Storage: copyStorage(acc.Storage),
+		})
+	}
+	gst.AddAccount(dest, GenesisAccount{
+		Code:    RandTouchAccounts(addrs),
+		Balance: big.NewInt(0xffff),
+		Storage: make(map[common.Hash]common.Hash),
+	})
+	to, value := dest, randHex(4)
+	if rand.Intn(5) == 0 {
+		// Touch one of the accounts with the transaction itself
+		to, value = addrs[rand.Intn(len(addrs))], oneOf("0x", "0x00", "0x01").(string)
+	}
+	gst.SetTx(&StTransaction{
+		// 8M gaslimit
+		GasLimit:   []uint64{8000000},
+		Nonce:      0,
+		Value:      []string{value},
+		Data:       []string{randHex(100)},
+		GasPrice:   big.NewInt(0x10),
+		To:         to.Hex(),
+		Sender:     sender,
+		PrivateKey: pKey,
+	})
+}
+
+func copyStorage(storage map[common.Hash]common.Hash) map[common.Hash]common.Hash {
+	cpy := make(map[common.Hash]common.Hash)
+	for k, v := range storage {
+		cpy[k] = v
+	}
+	return cpy
+}
+
+// RandTouchAccounts creates code which touches the given accounts in various
+// ways: calls with zero (or non-zero) value, and account inspection. The
+// results are stored. Now and then, the code ends by selfdestructing to one of
+// the accounts.
+func RandTouchAccounts(addrs []common.Address) []byte {
+	var (
+		p       = program.NewProgram()
+		touches = 1 + rand.Intn(10)
+		gas     = big.NewInt(50_000)
+	)
+	for i := 0; i < touches; i++ {
+		addr := addrs[rand.Intn(len(addrs))]
+		switch rand.Intn(7) {
+		case 0, 1:
+			p.Call(gas, addr, oneOf(0, 0, 1).(int), 0, 0, 0, 0)
+		case 2:
+			p.CallCode(gas, addr, 0, 0, 0, 0, 0)
+		case 3:
+			p.StaticCall(gas, addr, 0, 0, 0, 0)
+		case 4:
+			p.DelegateCall(gas, addr, 0, 0, 0, 0)
+		default:
+			p.Push(addr)
+			p.Op(oneOf(ops.BALANCE, ops.EXTCODESIZE, ops.EXTCODEHASH).(ops.OpCode))
+		}
+		p.Push(i)
+		p.Op(ops.SSTORE)
+	}
+	if rand.Intn(4) == 0 {
+		p.Push(addrs[rand.Intn(len(addrs))])
+		p.Op(ops.SELFDESTRUCT)
+	}
+	return p.Bytecode()
+}
@@ -0,0 +1,209 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/tests"
+)
+
+// ExportInfo describes where an exported test comes from, for its _info
+// section.
+type ExportInfo struct {
+	Comment string // e.g. the client bug the test reproduces
+	Source  string // the test it was exported from
+}
+
+// exportPost is a post-state entry in the format of the official tests.
+type exportPost struct {
+	Root            common.Hash   `json:"hash"`
+	Logs            common.Hash   `json:"logs"`
+	TxBytes         hexutil.Bytes `json:"txbytes"`
+	Indexes         stIndex       `json:"indexes"`
+	ExpectException string        `json:"expectException,omitempty"`
+}
+
+// ExportStateTest converts a state test, e.g. a minimized consensus flaw, into
+// the format of the official state tests (ethereum/tests). Each test gets an
+// _info section, and its post section an entry for each of the given forks
+// and each combination of the (data, gas, value) transaction indexes. The
+// expected results are those of go-ethereum, executing in-process, which is
+// the reference. If no forks are given, those of the original post section
+// are used.
+func ExportStateTest(data []byte, forks []string, info ExportInfo) ([]byte, error) {
+	var stTests map[string]map[string]json.RawMessage
+	if err := json.Unmarshal(data, &stTests); err != nil {
+		return nil, err
+	}
+	out := make(map[string]map[string]json.RawMessage)
+	for name, test := range stTests {
+		exported, err := exportTest(test, forks, info)
+		if err != nil {
+			return nil, fmt.Errorf("test %v: %w", name, err)
+		}
+		out[name] = exported
+	}
+	return json.MarshalIndent(out, "", "    ")
+}
+
+func exportTest(test map[string]json.RawMessage, forks []string, info ExportInfo) (map[string]json.RawMessage, error) {
+	var (
+		tx   map[string]json.RawMessage
+		post map[string]json.RawMessage
+	)
+	if err := json.Unmarshal(test["transaction"], &tx); err != nil {
+		return nil, fmt.Errorf("invalid transaction: %w", err)
+	}
+	if len(forks) == 0 {
+		if err := json.Unmarshal(test["post"], &post); err != nil {
+			return nil, fmt.Errorf("invalid post: %w", err)
+		}
+		for fork := range post {
+			forks = append(forks, fork)
+		}
+		sort.Strings(forks)
+	}
+	if len(forks) == 0 {
+		return nil, errors.New("no forks to export for")
+	}
+	// The number of elements of each indexed transaction field
+	counts := make(map[string]int)
+	for field, index := range indexedTxFields {
+		var elems []json.RawMessage
+		if raw, ok := tx[field]; ok {
+			if err := json.Unmarshal(raw, &elems); err != nil {
+				return nil, fmt.Errorf("invalid transaction field %v: %w", field, err)
+			}
+			counts[index] = len(elems)
+		}
+	}
+	// Every combination of indexes, for every fork
+	newPost := make(map[string][]*exportPost)
+	for _, fork := range forks {
+		if _, ok := tests.Forks[fork]; !ok {
+			return nil, tests.UnsupportedForkError{Name: fork}
+		}
+		for d := 0; d < counts["data"]; d++ {
+			for g := 0; g < counts["gas"]; g++ {
+				for v := 0; v < counts["value"]; v++ {
+					newPost[fork] = append(newPost[fork], &exportPost{Indexes: stIndex{Data: d, Gas: g, Value: v}})
+				}
+			}
+		}
+		if len(newPost[fork]) == 0 {
+			return nil, errors.New("transaction without data, gasLimit or value")
+		}
+	}
+	exported := make(map[string]json.RawMessage)
+	for k, v := range test {
+		exported[k] = v
+	}
+	// The entries, still without results, define the subtests to execute
+	var err error
+	if exported["post"], err = json.Marshal(newPost); err != nil {
+		return nil, err
+	}
+	if err := fillExportPost(exported, tx, newPost); err != nil {
+		return nil, err
+	}
+	if exported["post"], err = json.Marshal(newPost); err != nil {
+		return nil, err
+	}
+	exported["_info"], err = json.Marshal(map[string]string{
+		"comment":              info.Comment,
+		"source":               info.Source,
+		"filling-rpc-server":   "go-ethereum " + params.VersionWithMeta,
+		"filling-tool-version": "goevmlab",
+	})
+	return exported, err
+}
+
+// fillExportPost executes each post-state entry of the test, and fills in the
+// expected results, along with the signed transaction.
+func fillExportPost(test, tx map[string]json.RawMessage, post map[string][]*exportPost) error {
+	data, err := json.Marshal(test)
+	if err != nil {
+		return err
+	}
+	var st tests.StateTest
+	if err := json.Unmarshal(data, &st); err != nil {
+		return err
+	}
+	for _, subtest := range st.Subtests() {
+		ps := post[subtest.Fork][subtest.Index]
+		state, root, err := st.RunNoVerify(subtest, vm.Config{}, false, rawdb.HashScheme)
+		if state.StateDB != nil {
+			ps.Logs = rlpHash(state.StateDB.Logs())
+			state.Close()
+		}
+		if err != nil {
+			name := exceptionName(err)
+			if name == "" {
+				return fmt.Errorf("%v/%d: %w", subtest.Fork, subtest.Index, err)
+			}
+			ps.ExpectException = name
+		}
+		ps.Root = root
+		idx := map[string]int{"data": ps.Indexes.Data, "gas": ps.Indexes.Gas, "value": ps.Indexes.Value}
+		if ps.TxBytes, err = exportTxBytes(tx, idx, subtest.Fork); err != nil {
+			return fmt.Errorf("%v/%d: %w", subtest.Fork, subtest.Index, err)
+		}
+	}
+	return nil
+}
+
+// exceptionName returns the name of the exception of an invalid transaction,
+// as used in state tests, or the empty string if the error is not known.
+func exceptionName(err error) string {
+	for _, e := range expectedExceptions {
+		if errors.Is(err, e.err) {
+			return e.name
+		}
+	}
+	return ""
+}
+
+// exportTxBytes returns the signed transaction selected by the indexes, as
+// the official tests include it.
+func exportTxBytes(tx map[string]json.RawMessage, idx map[string]int, fork string) ([]byte, error) {
+	fields, err := selectTxFields(tx, idx)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	g := NewGstMaker()
+	if err := json.Unmarshal(data, &g.tx); err != nil {
+		return nil, err
+	}
+	signed, err := g.signedTx(tests.Forks[fork], nil)
+	if err != nil {
+		return nil, err
+	}
+	return signed.MarshalBinary()
+}
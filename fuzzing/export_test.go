@@ -0,0 +1,118 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/tests"
+	"github.com/holiman/goevmlab/ops"
+	"github.com/holiman/goevmlab/program"
+)
+
+func TestExportStateTest(t *testing.T) {
+	dest := common.HexToAddress("0xe0")
+	p := program.NewProgram()
+	p.Op(ops.CALLVALUE)
+	p.Push(0)
+	p.Op(ops.SSTORE)
+	p.Push(0)
+	p.Push(0)
+	p.Op(ops.LOG0)
+	gst := BasicStateTest("Cancun")
+	gst.AddAccount(dest, GenesisAccount{
+		Code:    p.Bytecode(),
+		Balance: new(big.Int),
+		Storage: make(map[common.Hash]common.Hash),
+	})
+	gst.SetTx(&StTransaction{
+		// The second gas limit is below the intrinsic gas
+		GasLimit:   []uint64{100000, 20000},
+		Value:      []string{"0x00", "0x01"},
+		Data:       []string{"0x", "0x01"},
+		GasPrice:   big.NewInt(0x10),
+		To:         dest.Hex(),
+		Sender:     sender,
+		PrivateKey: pKey,
+	})
+	if err := gst.Fill(nil); err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(gst.ToGeneralStateTest("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exported, err := ExportStateTest(data, []string{"Shanghai", "Cancun"}, ExportInfo{Comment: "a comment", Source: "test.json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out map[string]struct {
+		Info map[string]string        `json:"_info"`
+		Post map[string][]*exportPost `json:"post"`
+	}
+	if err := json.Unmarshal(exported, &out); err != nil {
+		t.Fatal(err)
+	}
+	test := out["test"]
+	if test.Info["comment"] != "a comment" || test.Info["source"] != "test.json" || test.Info["filling-rpc-server"] == "" {
+		t.Errorf("wrong _info: %v", test.Info)
+	}
+	for _, fork := range []string{"Shanghai", "Cancun"} {
+		if len(test.Post[fork]) != 8 {
+			t.Fatalf("%v: have %d post entries, want 8", fork, len(test.Post[fork]))
+		}
+		for _, ps := range test.Post[fork] {
+			wantException := ""
+			if ps.Indexes.Gas == 1 {
+				wantException = "TransactionException.INTRINSIC_GAS_TOO_LOW"
+			}
+			if ps.ExpectException != wantException {
+				t.Errorf("%v %+v: have exception %q, want %q", fork, ps.Indexes, ps.ExpectException, wantException)
+			}
+			var tx types.Transaction
+			if err := tx.UnmarshalBinary(ps.TxBytes); err != nil {
+				t.Fatal(err)
+			}
+			if from, err := types.Sender(types.LatestSigner(tests.Forks[fork]), &tx); err != nil || from != sender {
+				t.Errorf("wrong sender %v: %v", from, err)
+			}
+			if tx.Value().Uint64() != uint64(ps.Indexes.Value) || len(tx.Data()) != ps.Indexes.Data {
+				t.Errorf("%+v: wrong tx value %v, data %x", ps.Indexes, tx.Value(), tx.Data())
+			}
+		}
+	}
+	// The result of the original subtest is unchanged
+	if ps := test.Post["Cancun"][0]; ps.Root != gst.root || ps.Logs != gst.logs {
+		t.Errorf("wrong result: have %v %v, want %v %v", ps.Root, ps.Logs, gst.root, gst.logs)
+	}
+	// And go-ethereum agrees with all the expectations
+	var stTests map[string]*tests.StateTest
+	if err := json.Unmarshal(exported, &stTests); err != nil {
+		t.Fatal(err)
+	}
+	for _, subtest := range stTests["test"].Subtests() {
+		if err := stTests["test"].Run(subtest, vm.Config{}, false, rawdb.HashScheme, func(error, *tests.StateTestState) {}); err != nil {
+			t.Errorf("%v/%d: %v", subtest.Fork, subtest.Index, err)
+		}
+	}
+}
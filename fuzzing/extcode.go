@@ -0,0 +1,163 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"math/big"
+	"math/rand"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/holiman/goevmlab/ops"
+	"github.com/holiman/goevmlab/program"
+)
+
+var (
+	extCodeAddr = common.HexToAddress("0x00000000000000000000000000000000003b0000")
+	// extCodeTargets are the accounts in the various states: a missing one,
+	// an existing but empty one, one with a balance only, one with a nonce
+	// only, and ones with code.
+	extCodeTargets = []common.Address{
+		common.HexToAddress("0x00000000000000000000000000000000003b0001"),
+		common.HexToAddress("0x00000000000000000000000000000000003b0002"),
+		common.HexToAddress("0x00000000000000000000000000000000003b0003"),
+		common.HexToAddress("0x00000000000000000000000000000000003b0004"),
+		common.HexToAddress("0x00000000000000000000000000000000003b0005"),
+		common.HexToAddress("0x00000000000000000000000000000000003b0006"),
+	}
+)
+
+// extCodeSizes are the sizes of the code of the targets with code: around
+// the word boundaries.
+var extCodeSizes = []int{1, 31, 32, 33, 64, 100}
+
+func fillExtCode(gst *GstMaker, fork string) {
+	// extCodeTargets[0] is left out of the state
+	gst.AddAccount(extCodeTargets[1], GenesisAccount{
+		Balance: new(big.Int),
+		Storage: make(map[common.Hash]common.Hash),
+	})
+	gst.AddAccount(extCodeTargets[2], GenesisAccount{
+		Balance: big.NewInt(1),
+		Storage: make(map[common.Hash]common.Hash),
+	})
+	gst.AddAccount(extCodeTargets[3], GenesisAccount{
+		Balance: new(big.Int),
+		Nonce:   1,
+		Storage: make(map[common.Hash]common.Hash),
+	})
+	for _, addr := range extCodeTargets[4:] {
+		code := make([]byte, extCodeSizes[rand.Intn(len(extCodeSizes))])
+		rand.Read(code)
+		if rand.Intn(4) == 0 {
+			code[0] = 0xef
+		}
+		gst.AddAccount(addr, GenesisAccount{
+			Code:    code,
+			Balance: new(big.Int),
+			Storage: make(map[common.Hash]common.Hash),
+		})
+	}
+	// Some of the precompiles exist in the state
+	for i := 1; i <= 10; i++ {
+		if rand.Intn(3) == 0 {
+			gst.AddAccount(common.BytesToAddress([]byte{byte(i)}), GenesisAccount{
+				Balance: big.NewInt(1),
+				Storage: make(map[common.Hash]common.Hash),
+			})
+		}
+	}
+	targets := append([]common.Address{extCodeAddr}, extCodeTargets...)
+	for i := 1; i <= 10; i++ {
+		targets = append(targets, common.BytesToAddress([]byte{byte(i)}))
+	}
+	gst.AddAccount(extCodeAddr, GenesisAccount{
+		Code:    RandExtCodeOps(fork, targets),
+		Balance: new(big.Int),
+		Storage: make(map[common.Hash]common.Hash),
+	})
+	gst.SetTx(&StTransaction{
+		// 8M gaslimit
+		GasLimit:   []uint64{8000000},
+		Nonce:      0,
+		Value:      []string{randHex(4)},
+		Data:       []string{randHex(100)},
+		GasPrice:   big.NewInt(0x10),
+		To:         extCodeAddr.Hex(),
+		Sender:     sender,
+		PrivateKey: pKey,
+	})
+}
+
+// RandExtCodeOps creates code which inspects the code of the targets, the
+// first of which is the executing contract itself, with EXTCODESIZE,
+// EXTCODECOPY and EXTCODEHASH, and stores the results. The copies are done to
+// memory filled with 0xff, at offsets within and past the end of the code, so
+// that any difference in the (zero-)padding shows in the two words stored
+// after each copy.
+func RandExtCodeOps(fork string, targets []common.Address) []byte {
+	var (
+		p      = program.NewProgram()
+		forkOp = ops.LookupFork(fork)
+		slot   = 0
+		store  = func() {
+			p.Push(slot)
+			p.Op(ops.SSTORE)
+			slot++
+		}
+		ones = common.FromHex("0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")
+		self = targets[0]
+	)
+	pushTarget := func(target common.Address) {
+		if target == self && rand.Intn(2) == 0 {
+			p.Op(ops.ADDRESS)
+		} else {
+			p.Push(target)
+		}
+	}
+	for n := 1 + rand.Intn(12); n > 0; n-- {
+		target := targets[rand.Intn(len(targets))]
+		switch r := rand.Intn(5); {
+		case r < 2:
+			pushTarget(target)
+			p.Op(ops.EXTCODESIZE)
+			store()
+		case r < 4:
+			p.Mstore(ones, 0)
+			p.Mstore(ones, 32)
+			p.Push(oneOf(0, 1, 31, 32, 33, 64).(int)) // length
+			p.Push(asBig(oneOf("0x0", "0x1", "0x1f", "0x20", "0x21", "0x63", "0x64", "0x65",
+				"0xffffffff", "0x10000000000000000").(string))) // code offset
+			p.Push(0) // memory offset
+			pushTarget(target)
+			p.Op(ops.EXTCODECOPY)
+			for offset := 0; offset < 64; offset += 32 {
+				p.Push(offset)
+				p.Op(ops.MLOAD)
+				store()
+			}
+		default:
+			pushTarget(target)
+			if forkOp != nil && !forkOp.IsValid(ops.EXTCODEHASH) {
+				p.Op(ops.EXTCODESIZE)
+			} else {
+				p.Op(ops.EXTCODEHASH)
+			}
+			store()
+		}
+	}
+	return p.Bytecode()
+}
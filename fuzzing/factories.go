@@ -16,28 +16,118 @@
 
 package fuzzing
 
+import (
+	"fmt"
+
+	"github.com/holiman/goevmlab/ops"
+)
+
 // fillers is a mapping of names to functions that can fill a statetest.
 var fillers = map[string]func(*GstMaker, string){
-	"ecrecover":    fillEcRecover,
-	"naive":        fillNaive,
-	"blake":        fillBlake,
-	"bls":          fillBls,
-	"precompiles":  fillPrecompileTest,
-	"simpleops":    fillSimple,
-	"memops":       fillMemOps,
-	"sstore_sload": fillSstore,
-	"tstore_tload": fillTstore,
+	"ecrecover":         fillEcRecover,
+	"naive":             fillNaive,
+	"blake":             fillBlake,
+	"bls":               fillBls,
+	"precompiles":       fillPrecompileTest,
+	"simpleops":         fillSimple,
+	"memops":            fillMemOps,
+	"sstore_sload":      fillSstore,
+	"tstore_tload":      fillTstore,
+	"modexp":            fillModexp,
+	"accesslist":        fillAccessList,
+	"blockcontext":      fillBlockContext,
+	"returndata":        fillReturnData,
+	"trie":              fillTrie,
+	"trie_seq":          TrieFiller(TrieSequential),
+	"trie_sparse":       TrieFiller(TrieSparse),
+	"trie_prefix":       TrieFiller(TrieSharedPrefix),
+	"delegatecall":      fillDelegateCall,
+	"callvalue":         fillCallValue,
+	"invalidops":        fillInvalidOps,
+	"stacklimit":        fillStackLimit,
+	"keccak":            fillKeccak,
+	"balance":           fillBalance,
+	"initcode":          fillInitcode,
+	"basefee":           fillBaseFee,
+	"jumpdest":          fillJumpdest,
+	"emptyaccount":      fillEmptyAccounts,
+	"bn256pairing":      fillBn256Pairing,
+	"mcopy":             fillMcopy,
+	"arithmetic":        fillArithmetic,
+	"gasbranch":         fillGasBranch,
+	"createcall":        fillCreateCall,
+	"logs":              fillLogs,
+	"creationtx":        fillCreationTx,
+	"balanceops":        fillBalanceOps,
+	"staticcall":        fillStaticCall,
+	"chainid":           fillChainID,
+	"memexpansion":      fillMemExpansion,
+	"hashprecompiles":   fillHashPrecompiles,
+	"callcode":          fillCallCode,
+	"codesize":          fillCodeSize,
+	"intrinsicgas":      fillIntrinsicGas,
+	"refundcap":         fillRefundCap,
+	"memboundary":       fillMemBoundary,
+	"gasprice":          fillGasPrice,
+	"callgas":           fillCallGas,
+	"selfdestruct_self": fillSelfdestructSelf,
+	"warmcoinbase":      fillWarmCoinbase,
+	"nestedrevert":      fillNestedRevert,
+	"extcode":           fillExtCode,
+	"calloog":           fillCallOOG,
+	"mutate":            fillMutate,
+	"createcollision":   fillCreateCollision,
+	"withdrawals":       fillWithdrawals,
+	"databranch":        fillDataBranch,
+	"bitops":            fillBitOps,
+	"selfcall":          fillSelfCall,
+	"sstoresentry":      fillSstoreSentry,
+	"mstore8":           fillMstore8,
 }
 
-func Factory(name, fork string) func() *GstMaker {
-	if filler, ok := fillers[name]; ok {
-		return func() *GstMaker {
-			gst := BasicStateTest(fork)
-			filler(gst, fork)
-			return gst
-		}
+// forkedFillers are the fillers which tailor the test to the rules or the
+// opcodes of the fork, and so only support the forks defined in ops.
+var forkedFillers = map[string]bool{
+	"naive":        true,
+	"simpleops":    true,
+	"memops":       true,
+	"blockcontext": true,
+	"balanceops":   true,
+	"basefee":      true,
+	"chainid":      true,
+	"initcode":     true,
+	"intrinsicgas": true,
+	"mcopy":        true,
+	"mutate":       true,
+	"refundcap":    true,
+	"staticcall":   true,
+	"withdrawals":  true,
+}
+
+// LookupFactory returns a factory making tests with the named generator for
+// the fork, or an error if there is no such generator, or if it does not
+// support the fork.
+func LookupFactory(name, fork string) (func() *GstMaker, error) {
+	filler, ok := fillers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown generator %v, available: %v", name, FactoryNames())
 	}
-	return nil
+	if forkedFillers[name] && ops.LookupFork(fork) == nil {
+		return nil, fmt.Errorf("generator %v does not support fork %v, supported: %v", name, fork, ops.ForkNames())
+	}
+	return func() *GstMaker {
+		gst := BasicStateTest(fork)
+		gst.generator, gst.generatorFork = name, fork
+		gst.AddTag(name)
+		filler(gst, fork)
+		return gst
+	}, nil
+}
+
+// Factory is like LookupFactory, but returns nil instead of an error.
+func Factory(name, fork string) func() *GstMaker {
+	factory, _ := LookupFactory(name, fork)
+	return factory
 }
 
 // FactoryNames returns the names of the available factories
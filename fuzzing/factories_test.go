@@ -0,0 +1,2165 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/core/vm/runtime"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/eth/tracers/logger"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/holiman/goevmlab/ops"
+)
+
+// traceCode executes the given code in a plain runtime environment, with all
+// forks up to Cancun enabled, and returns the steps executed.
+func traceCode(t *testing.T, code []byte) []logger.StructLog {
+	t.Helper()
+	tracer := logger.NewStructLogger(&logger.Config{EnableMemory: true})
+	_, _, err := runtime.Execute(code, nil, &runtime.Config{
+		ChainConfig: params.MergedTestChainConfig,
+		Random:      &common.Hash{},
+		GasLimit:    10_000_000,
+		EVMConfig:   vm.Config{Tracer: tracer},
+	})
+	if err != nil {
+		t.Fatalf("execution failed: %v", err)
+	}
+	return tracer.StructLogs()
+}
+
+func TestModexpFactory(t *testing.T) {
+	gen := Factory("modexp", "Cancun")
+	if gen == nil {
+		t.Fatal("modexp generator missing")
+	}
+	for i := 0; i < 50; i++ {
+		gst := gen()
+		code := (*gst.pre)[gst.GetDestination()].Code
+		var calls int
+		for _, step := range traceCode(t, code) {
+			if step.Op != vm.CALL {
+				continue
+			}
+			calls++
+			stack := step.Stack
+			// gas, address, value, inOffset, inSize, ...
+			if addr := stack[len(stack)-2]; addr.Uint64() != 5 || !addr.IsUint64() {
+				t.Fatalf("call to wrong address: %v", addr.Hex())
+			}
+			inOffset := stack[len(stack)-4].Uint64()
+			if have := len(step.Memory); have < int(inOffset)+96 {
+				t.Fatalf("memory too small to hold header: %d", have)
+			}
+			header := step.Memory[inOffset : inOffset+96]
+			for j := 0; j < 3; j++ {
+				l := new(big.Int).SetBytes(header[32*j : 32*j+32])
+				if l.Cmp(big.NewInt(1025)) <= 0 {
+					continue
+				}
+				var ok bool
+				for _, huge := range modexpHugeLengths {
+					ok = ok || l.Cmp(asBig(huge)) == 0
+				}
+				if !ok {
+					t.Fatalf("malformed header, length %d: %#x", j, header)
+				}
+			}
+		}
+		if calls == 0 {
+			t.Fatal("no calls made")
+		}
+	}
+}
+
+func TestModexpArgs(t *testing.T) {
+	for i := 0; i < 1000; i++ {
+		data, modLen := randomModexpArgs()
+		if len(data) < 96 {
+			t.Fatalf("input too short: %d", len(data))
+		}
+		var (
+			baseLen = new(big.Int).SetBytes(data[0:32])
+			expLen  = new(big.Int).SetBytes(data[32:64])
+			mLen    = new(big.Int).SetBytes(data[64:96])
+		)
+		if !baseLen.IsUint64() || !expLen.IsUint64() || !mLen.IsUint64() ||
+			baseLen.Uint64() > 1025 || expLen.Uint64() > 1025 || mLen.Uint64() > 1025 {
+			// One of the lengths is a declared huge value
+			continue
+		}
+		if want := 96 + int(baseLen.Uint64()+expLen.Uint64()+mLen.Uint64()); want != len(data) {
+			t.Fatalf("length mismatch, header says %d, have %d", want, len(data))
+		}
+		if int(mLen.Uint64()) != modLen {
+			t.Fatalf("modulus length mismatch: %d != %d", mLen, modLen)
+		}
+	}
+}
+
+func TestAccessListFactory(t *testing.T) {
+	for _, fork := range []string{"Istanbul", "Berlin", "Cancun"} {
+		var withAcl int
+		for i := 0; i < 20; i++ {
+			gst := Factory("accesslist", fork)()
+			if len(gst.tx.AccessLists) > 0 {
+				if fork == "Istanbul" {
+					t.Fatal("access list on pre-berlin fork")
+				}
+				withAcl++
+			}
+			if err := gst.Fill(nil); err != nil {
+				t.Fatalf("fork %v: %v", fork, err)
+			}
+		}
+		if fork != "Istanbul" && withAcl == 0 {
+			t.Fatalf("fork %v: no access lists", fork)
+		}
+	}
+	// The access list must survive being stored and signed
+	gst := Factory("accesslist", "Cancun")()
+	if _, err := gst.ToBlockchainTest("test"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBlockContextFactory(t *testing.T) {
+	for _, fork := range []string{"Istanbul", "London", "Merge", "Cancun"} {
+		for i := 0; i < 20; i++ {
+			gst := Factory("blockcontext", fork)()
+			if fork == "Cancun" && gst.env.ExcessBlobGas == nil {
+				t.Fatal("excess blob gas not set")
+			}
+			if err := gst.Fill(nil); err != nil {
+				t.Fatalf("fork %v: %v", fork, err)
+			}
+		}
+	}
+}
+
+func TestReturnDataFactory(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		gst := Factory("returndata", "Cancun")()
+		// Both inner contracts must be present
+		for _, addr := range []common.Address{returnAddr, revertAddr} {
+			if acc, ok := (*gst.pre)[addr]; !ok || len(acc.Code) == 0 {
+				t.Fatalf("inner contract %v missing", addr)
+			}
+		}
+		// The outer contract must call them
+		code := (*gst.pre)[gst.GetDestination()].Code
+		var calls int
+		for it := ops.NewInstructionIterator(code); it.Next(); {
+			switch it.Op() {
+			case ops.CALL, ops.STATICCALL, ops.DELEGATECALL:
+				calls++
+			}
+		}
+		if calls == 0 {
+			t.Fatal("no calls made")
+		}
+		if err := gst.Fill(nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestTrieFactory(t *testing.T) {
+	for _, name := range []string{"trie", "trie_seq", "trie_sparse", "trie_prefix"} {
+		gst := Factory(name, "Cancun")()
+		if len((*gst.pre)[gst.GetDestination()].Storage) < 16 {
+			t.Fatalf("%v: too few slots", name)
+		}
+		if err := gst.Fill(nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestTrieSharedPrefix(t *testing.T) {
+	base := randHash()
+	hash := crypto.Keccak256Hash(base[:])
+	for _, slot := range slotsWithHashPrefix(hash, 3, 4) {
+		if n := sharedNibbles(hash, crypto.Keccak256Hash(slot[:])); n < 3 {
+			t.Fatalf("slot %v shares %d nibbles, want >= 3", slot, n)
+		}
+	}
+}
+
+func TestDelegateCallFactory(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		gst := Factory("delegatecall", "Cancun")()
+		// Both contracts must be present
+		for _, addr := range []common.Address{delegateCallerAddr, delegateLibAddr} {
+			if acc, ok := (*gst.pre)[addr]; !ok || len(acc.Code) == 0 {
+				t.Fatalf("contract %v missing", addr)
+			}
+		}
+		if have := gst.GetDestination(); have != delegateCallerAddr {
+			t.Fatalf("wrong destination %v", have)
+		}
+		var calls int
+		for it := ops.NewInstructionIterator((*gst.pre)[delegateCallerAddr].Code); it.Next(); {
+			if it.Op() == ops.DELEGATECALL {
+				calls++
+			}
+		}
+		if calls == 0 {
+			t.Fatal("no delegatecalls made")
+		}
+		if err := gst.Fill(nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCallValueFactory(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		gst := Factory("callvalue", "Cancun")()
+		if (*gst.pre)[callValueAddr].Balance.Sign() == 0 {
+			t.Fatal("caller has no balance")
+		}
+		// Each CALL must carry a non-zero value: the value is the third
+		// item on the stack, i.e. the fifth push before the gas.
+		var (
+			code   = (*gst.pre)[callValueAddr].Code
+			pushes [][]byte
+			calls  int
+		)
+		for it := ops.NewInstructionIterator(code); it.Next(); {
+			switch op := it.Op(); {
+			case op.IsPush():
+				pushes = append(pushes, it.Arg())
+			case op == ops.GAS:
+				pushes = append(pushes, nil)
+			case op == ops.CALL:
+				calls++
+				value := pushes[len(pushes)-3]
+				if new(big.Int).SetBytes(value).Sign() == 0 {
+					t.Fatalf("call %d without value", calls)
+				}
+			}
+		}
+		if calls == 0 {
+			t.Fatal("no calls made")
+		}
+		if err := gst.Fill(nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCallCodeFactory(t *testing.T) {
+	var valued int
+	for _, fork := range []string{"Frontier", "Byzantium", "Cancun"} {
+		for i := 0; i < 20; i++ {
+			gst := Factory("callcode", fork)()
+			if acc, ok := (*gst.pre)[callcodeLibAddr]; !ok || len(acc.Code) == 0 || len(acc.Storage) == 0 {
+				t.Fatal("library missing or not seeded")
+			}
+			if have := gst.GetDestination(); have != callcodeCallerAddr {
+				t.Fatalf("wrong destination %v", have)
+			}
+			// The arguments are pushed in reverse: outSize, outOffset, inSize,
+			// inOffset, value, address and gas.
+			var (
+				pushes [][]byte
+				calls  int
+			)
+			for it := ops.NewInstructionIterator((*gst.pre)[callcodeCallerAddr].Code); it.Next(); {
+				switch op := it.Op(); {
+				case op.IsPush():
+					pushes = append(pushes, it.Arg())
+				case op == ops.CALLCODE:
+					calls++
+					args := pushes[len(pushes)-7:]
+					var (
+						addr  = common.BytesToAddress(args[5])
+						value = new(big.Int).SetBytes(args[4])
+					)
+					if addr != callcodeLibAddr && addr != callcodeMissingAddr && (len(args[5]) != 1 || args[5][0] > 9) {
+						t.Fatalf("callcode to unexpected address %v", addr)
+					}
+					if value.Cmp(big.NewInt(callcodeCallerBalance+1)) > 0 {
+						t.Fatalf("unexpected value %v", value)
+					}
+					if value.Sign() > 0 {
+						valued++
+					}
+					if have := new(big.Int).SetBytes(args[0]).Uint64(); have != 32 {
+						t.Fatalf("wrong output size %d", have)
+					}
+					if have := new(big.Int).SetBytes(args[1]).Uint64(); have != 0x100 {
+						t.Fatalf("wrong output offset %d", have)
+					}
+				}
+			}
+			if calls == 0 {
+				t.Fatal("no callcodes made")
+			}
+			if err := gst.Fill(nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if valued == 0 {
+		t.Fatal("no callcode transferred value")
+	}
+}
+
+func TestInvalidOpsFactory(t *testing.T) {
+	for _, fork := range ops.ForkNames() {
+		for i := 0; i < 10; i++ {
+			gst := Factory("invalidops", fork)()
+			if len(gst.forks) != 1 {
+				t.Fatalf("expected one fork, have %v", gst.forks)
+			}
+			// The targeted opcode must be present, and undefined in the fork
+			var found bool
+			for it := ops.NewInstructionIterator((*gst.pre)[invalidOpsInner].Code); it.Next(); {
+				if !ops.LookupFork(gst.forks[0]).IsValid(it.Op()) {
+					found = true
+				}
+			}
+			if !found {
+				t.Fatalf("no undefined opcode in fork %v", gst.forks[0])
+			}
+			if err := gst.Fill(nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestStackLimitFactory(t *testing.T) {
+	var depths = make(map[int]bool)
+	for i := 0; i < 200; i++ {
+		gst := Factory("stacklimit", "Cancun")()
+		// Track the stack height through the (linear) code
+		var depth, maxDepth int
+		for it := ops.NewInstructionIterator((*gst.pre)[stackLimitInner].Code); it.Next(); {
+			depth += len(it.Op().Pushes()) - len(it.Op().Pops())
+			if depth > maxDepth {
+				maxDepth = depth
+			}
+		}
+		if maxDepth < stackLimit-4 {
+			t.Fatalf("stack depth %d too low", maxDepth)
+		}
+		depths[maxDepth] = true
+		if i >= 20 {
+			continue
+		}
+		if err := gst.Fill(nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, d := range []int{stackLimit - 1, stackLimit, stackLimit + 1} {
+		if !depths[d] {
+			t.Errorf("stack depth %d not reached", d)
+		}
+	}
+}
+
+func TestKeccakFactory(t *testing.T) {
+	var sizes = make(map[string]bool)
+	for i := 0; i < 20; i++ {
+		gst := Factory("keccak", "Cancun")()
+		// The size is the second stack item for KECCAK256
+		var (
+			args   [][]byte
+			hashes int
+		)
+		for it := ops.NewInstructionIterator((*gst.pre)[gst.GetDestination()].Code); it.Next(); {
+			switch op := it.Op(); {
+			case op.IsPush():
+				args = append(args, it.Arg())
+			case op == ops.MSIZE:
+				args = append(args, nil)
+			case op == ops.KECCAK256:
+				hashes++
+				sizes[new(big.Int).SetBytes(args[len(args)-2]).String()] = true
+			}
+		}
+		if hashes == 0 {
+			t.Fatal("no KECCAK256 found")
+		}
+		if err := gst.Fill(nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(sizes) < 3 {
+		t.Fatalf("too few distinct sizes: %v", sizes)
+	}
+}
+
+func TestBalanceFactory(t *testing.T) {
+	// Before London, a balance short of the value fails the transfer, not
+	// the upfront gas check.
+	for _, fork := range []string{"Berlin", "Cancun"} {
+		var diffs = make(map[int64]bool)
+		for i := 0; i < 50; i++ {
+			gst := Factory("balance", fork)()
+			var (
+				tx      = gst.tx
+				balance = (*gst.pre)[sender].Balance
+				cost    = new(big.Int).Mul(new(big.Int).SetUint64(tx.GasLimit[0]), tx.GasPrice)
+			)
+			cost.Add(cost, asBig(tx.Value[0]))
+			if cost.BitLen() > 256 {
+				continue // overflow: the tx is invalid regardless
+			}
+			diff := new(big.Int).Sub(balance, cost)
+			if !diff.IsInt64() || diff.Int64() < -1 || diff.Int64() > 1 {
+				if balance.Sign() != 0 || cost.Cmp(big.NewInt(1)) > 0 {
+					t.Fatalf("balance %v not near cost %v", balance, cost)
+				}
+			}
+			diffs[diff.Int64()] = true
+			if err := gst.Fill(nil); err != nil {
+				t.Fatalf("fork %v: %v", fork, err)
+			}
+			if _, err := gst.ToBlockchainTest("test"); err != nil {
+				t.Fatalf("fork %v: %v", fork, err)
+			}
+		}
+		for _, d := range []int64{-1, 0, 1} {
+			if !diffs[d] {
+				t.Errorf("fork %v: balance threshold offset %d not generated", fork, d)
+			}
+		}
+	}
+}
+
+func TestInitcodeFactory(t *testing.T) {
+	var near int
+	for i := 0; i < 20; i++ {
+		gst := Factory("initcode", "London")()
+		if gst.forks[0] != "Shanghai" {
+			t.Fatalf("expected fork Shanghai, have %v", gst.forks)
+		}
+		// The size is the third push before CREATE and CREATE2
+		var (
+			args    [][]byte
+			creates int
+		)
+		for it := ops.NewInstructionIterator((*gst.pre)[gst.GetDestination()].Code); it.Next(); {
+			switch op := it.Op(); {
+			case op.IsPush():
+				args = append(args, it.Arg())
+			case op == ops.CREATE, op == ops.CREATE2:
+				creates++
+				size := new(big.Int).SetBytes(args[len(args)-3]).Int64()
+				if d := size - params.MaxInitCodeSize; d >= -33 && d <= 32 {
+					near++
+				}
+			}
+		}
+		if creates == 0 {
+			t.Fatal("no creates")
+		}
+		if err := gst.Fill(nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if near == 0 {
+		t.Fatal("no initcode sizes near the limit")
+	}
+}
+
+func TestBaseFeeFactory(t *testing.T) {
+	seen := make(map[string]int)
+	for i := 0; i < 100; i++ {
+		gst := Factory("basefee", "Berlin")()
+		if gst.forks[0] != "London" {
+			t.Fatalf("expected fork London, have %v", gst.forks)
+		}
+		if (gst.tx.GasPrice == nil) == (gst.tx.MaxFeePerGas == nil) {
+			t.Fatalf("expected either gas price or fee caps, have %v %v", gst.tx.GasPrice, gst.tx.MaxFeePerGas)
+		}
+		if err := gst.Fill(nil); err != nil {
+			t.Fatal(err)
+		}
+		seen[gst.expectException]++
+	}
+	for _, want := range []string{"", "TransactionException.INSUFFICIENT_MAX_FEE_PER_GAS",
+		"TransactionException.PRIORITY_GREATER_THAN_MAX_FEE_PER_GAS"} {
+		if seen[want] == 0 {
+			t.Errorf("no tests with exception %q: %v", want, seen)
+		}
+	}
+}
+
+func TestJumpdestFactory(t *testing.T) {
+	var jumps, invalid, inPushData int
+	for i := 0; i < 100; i++ {
+		var (
+			code            = JumpdestCode(ops.JUMPI)
+			valid, inPush   = jumpdestAnalysis(code)
+			target          = RandJumpTarget(code)
+			isValid, isPush bool
+		)
+		for _, pc := range valid {
+			isValid = isValid || target.IsUint64() && target.Uint64() == pc
+		}
+		for _, pc := range inPush {
+			isPush = isPush || target.IsUint64() && target.Uint64() == pc
+		}
+		// Verify the classification against go-ethereum
+		input := append(common.BigToHash(target).Bytes(), common.BigToHash(big.NewInt(1)).Bytes()...)
+		_, _, err := runtime.Execute(code, input, &runtime.Config{GasLimit: 1_000_000})
+		if isValid != (err == nil) {
+			t.Fatalf("target %v: valid %v, but err %v, code %x", target, isValid, err, code)
+		}
+		if err != nil && err != vm.ErrInvalidJump {
+			t.Fatalf("target %v: unexpected error %v", target, err)
+		}
+		if isValid {
+			jumps++
+		} else {
+			invalid++
+		}
+		if isPush {
+			inPushData++
+		}
+	}
+	if jumps == 0 || invalid == 0 || inPushData == 0 {
+		t.Fatalf("missing targets: %d valid, %d invalid, %d in push data", jumps, invalid, inPushData)
+	}
+	for i := 0; i < 10; i++ {
+		if err := Factory("jumpdest", "Cancun")().Fill(nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestEmptyAccountFactory(t *testing.T) {
+	var empty, missing int
+	for i := 0; i < 20; i++ {
+		gst := Factory("emptyaccount", "Cancun")()
+		// The first two addresses are always used
+		for j := 0; j < 2; j++ {
+			addr := common.BigToAddress(new(big.Int).Add(emptyAccountBase.Big(), big.NewInt(int64(j))))
+			acc, ok := (*gst.pre)[addr]
+			switch {
+			case !ok:
+				missing++
+			case acc.Nonce == 0 && acc.Balance.Sign() == 0 && len(acc.Code) == 0:
+				empty++
+			}
+		}
+		if err := gst.Fill(nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if empty == 0 || missing == 0 {
+		t.Fatalf("expected both empty and missing accounts: %d empty, %d missing", empty, missing)
+	}
+}
+
+func TestBn256PairingFactory(t *testing.T) {
+	var (
+		sizes = make(map[uint64]bool)
+		valid int
+	)
+	for i := 0; i < 30; i++ {
+		gst := Factory("bn256pairing", "Cancun")()
+		code := (*gst.pre)[gst.GetDestination()].Code
+		for _, step := range traceCode(t, code) {
+			var inSize uint64
+			stack := step.Stack
+			switch step.Op {
+			case vm.CALL:
+				inSize = stack[len(stack)-5].Uint64()
+			case vm.STATICCALL:
+				inSize = stack[len(stack)-4].Uint64()
+			default:
+				continue
+			}
+			if addr := stack[len(stack)-2]; !addr.IsUint64() || addr.Uint64() != bn256PairingAddr {
+				t.Fatalf("call to wrong address: %v", addr.Hex())
+			}
+			sizes[inSize] = true
+			if inSize > 0 && inSize%bn256PairSize == 0 {
+				valid++
+			}
+		}
+		if i < 5 {
+			if err := gst.Fill(nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	var wrong int
+	for size := range sizes {
+		if size%bn256PairSize != 0 {
+			wrong++
+		}
+	}
+	if !sizes[0] || valid == 0 || wrong == 0 {
+		t.Fatalf("input sizes not varied enough: %v", sizes)
+	}
+}
+
+func TestBn256CancellingPairs(t *testing.T) {
+	input := bn256CancellingPairs()
+	out, err := vm.PrecompiledContractsIstanbul[common.BytesToAddress([]byte{bn256PairingAddr})].Run(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if new(big.Int).SetBytes(out).Cmp(big.NewInt(1)) != 0 {
+		t.Fatalf("pairing check failed: %x", out)
+	}
+}
+
+func TestMcopyFactory(t *testing.T) {
+	var forward, backward, push0 int
+	for i := 0; i < 30; i++ {
+		gst := Factory("mcopy", "Shanghai")()
+		if gst.forks[0] != "Cancun" {
+			t.Fatalf("expected fork Cancun, have %v", gst.forks)
+		}
+		code := (*gst.pre)[gst.GetDestination()].Code
+		for _, step := range traceCode(t, code) {
+			switch step.Op {
+			case vm.PUSH0:
+				push0++
+			case vm.MCOPY:
+				stack := step.Stack
+				dst, src, size := stack[len(stack)-1], stack[len(stack)-2], stack[len(stack)-3]
+				if size.IsZero() || !dst.IsUint64() || !src.IsUint64() {
+					continue
+				}
+				switch d, s := dst.Uint64(), src.Uint64(); {
+				case d > s && d < s+size.Uint64():
+					forward++
+				case d < s && s < d+size.Uint64():
+					backward++
+				}
+			}
+		}
+		if i < 5 {
+			if err := gst.Fill(nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if forward == 0 || backward == 0 || push0 == 0 {
+		t.Fatalf("missing cases: %d forward overlaps, %d backward overlaps, %d PUSH0", forward, backward, push0)
+	}
+}
+
+func TestArithmeticFactory(t *testing.T) {
+	var (
+		intMinByMinusOne, divByZero, exp int
+		seen                             = make(map[string]bool)
+		isArith                          = make(map[ops.OpCode]bool)
+	)
+	for _, op := range arithOps {
+		isArith[op] = true
+	}
+	for i := 0; i < 30; i++ {
+		gst := Factory("arithmetic", "Cancun")()
+		code := (*gst.pre)[gst.GetDestination()].Code
+		for _, step := range traceCode(t, code) {
+			pops := len(ops.OpCode(step.Op).Pops())
+			if !isArith[ops.OpCode(step.Op)] || len(step.Stack) < pops {
+				continue
+			}
+			var args []*big.Int
+			for j := 1; j <= pops; j++ {
+				args = append(args, step.Stack[len(step.Stack)-j].ToBig())
+				seen[args[j-1].Text(16)] = true
+			}
+			switch step.Op {
+			case vm.SDIV, vm.SMOD:
+				if args[0].Cmp(minInt256) == 0 && args[1].Cmp(maxUint256) == 0 {
+					intMinByMinusOne++
+				}
+			case vm.EXP:
+				exp++
+			}
+			switch step.Op {
+			case vm.DIV, vm.SDIV, vm.MOD, vm.SMOD, vm.ADDMOD, vm.MULMOD:
+				if args[pops-1].Sign() == 0 {
+					divByZero++
+				}
+			}
+		}
+		if i < 5 {
+			if err := gst.Fill(nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if intMinByMinusOne == 0 || divByZero == 0 || exp == 0 {
+		t.Fatalf("missing cases: %d INT_MIN/-1, %d division by zero, %d EXP", intMinByMinusOne, divByZero, exp)
+	}
+	for _, v := range []*big.Int{big.NewInt(0), big.NewInt(1), maxUint256, minInt256} {
+		if !seen[v.Text(16)] {
+			t.Errorf("sentinel %#x never used as operand", v)
+		}
+	}
+}
+
+func TestGasBranchFactory(t *testing.T) {
+	var taken, notTaken int
+	for i := 0; i < 30; i++ {
+		gst := Factory("gasbranch", "Cancun")()
+		code := (*gst.pre)[gst.GetDestination()].Code
+		steps := traceCode(t, code)
+		for j := 0; j+5 < len(steps); j++ {
+			if steps[j].Op != vm.GAS || steps[j+2].Op != vm.AND || steps[j+4].Op != vm.JUMPI {
+				continue
+			}
+			if steps[j+5].Op == vm.JUMPDEST {
+				taken++
+			} else {
+				notTaken++
+			}
+		}
+		if i < 5 {
+			if err := gst.Fill(nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if taken == 0 || notTaken == 0 {
+		t.Fatalf("missing cases: %d branches taken, %d not taken", taken, notTaken)
+	}
+}
+
+func TestCreateCallFactory(t *testing.T) {
+	var flows, created int
+	for i := 0; i < 30; i++ {
+		gst := Factory("createcall", "Cancun")()
+		code := (*gst.pre)[gst.GetDestination()].Code
+		steps := traceCode(t, code)
+		var addr common.Address
+		for j, step := range steps {
+			if step.Depth != 1 {
+				continue
+			}
+			switch step.Op {
+			case vm.CREATE, vm.CREATE2:
+				// The address is on the stack once the create returns
+				for _, next := range steps[j+1:] {
+					if next.Depth == 1 {
+						addr = common.Address(next.Stack[len(next.Stack)-1].Bytes20())
+						break
+					}
+				}
+				if addr != (common.Address{}) {
+					created++
+				}
+			case vm.CALL, vm.CALLCODE, vm.DELEGATECALL, vm.STATICCALL:
+				target := common.Address(step.Stack[len(step.Stack)-2].Bytes20())
+				if target != addr {
+					t.Fatalf("call to %x, created %x", target, addr)
+				}
+				if addr != (common.Address{}) {
+					flows++
+				}
+			}
+		}
+		if i < 5 {
+			if err := gst.Fill(nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if flows == 0 || flows != created {
+		t.Fatalf("%d contracts created, %d called", created, flows)
+	}
+}
+
+func TestLogsFactory(t *testing.T) {
+	var (
+		variants        = make(map[vm.OpCode]int)
+		empty, expanded int
+	)
+	for i := 0; i < 30; i++ {
+		gst := Factory("logs", "Cancun")()
+		code := (*gst.pre)[gst.GetDestination()].Code
+		for _, step := range traceCode(t, code) {
+			if step.Op < vm.LOG0 || step.Op > vm.LOG4 {
+				continue
+			}
+			topics := int(step.Op - vm.LOG0)
+			if len(step.Stack) != topics+2 {
+				t.Fatalf("%v with %d stack items", step.Op, len(step.Stack))
+			}
+			variants[step.Op]++
+			offset, size := step.Stack[len(step.Stack)-1], step.Stack[len(step.Stack)-2]
+			if size.IsZero() {
+				empty++
+			} else if offset.Uint64()+size.Uint64() > uint64(step.MemorySize) {
+				expanded++
+			}
+		}
+		if i < 5 {
+			if err := gst.Fill(nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	for op := vm.LOG0; op <= vm.LOG4; op++ {
+		if variants[op] == 0 {
+			t.Errorf("no %v emitted", op)
+		}
+	}
+	if empty == 0 || expanded == 0 {
+		t.Fatalf("missing cases: %d empty logs, %d memory expansions", empty, expanded)
+	}
+}
+
+func TestCreationTxFactory(t *testing.T) {
+	var empty, reverts, creates, oversized int
+	for i := 0; i < 200; i++ {
+		gst := Factory("creationtx", "Cancun")()
+		if gst.tx.To != "" {
+			t.Fatalf("expected creation tx, have destination %v", gst.tx.To)
+		}
+		initcode := common.FromHex(gst.tx.Data[0])
+		if len(initcode) == 0 {
+			empty++
+		}
+		// Execute the initcode as plain code, which may revert
+		tracer := logger.NewStructLogger(nil)
+		_, _, _ = runtime.Execute(initcode, nil, &runtime.Config{
+			ChainConfig: params.MergedTestChainConfig,
+			Random:      &common.Hash{},
+			GasLimit:    10_000_000,
+			EVMConfig:   vm.Config{Tracer: tracer},
+		})
+		for _, step := range tracer.StructLogs() {
+			if step.Depth != 1 {
+				continue
+			}
+			switch step.Op {
+			case vm.REVERT:
+				reverts++
+			case vm.CREATE, vm.CREATE2:
+				creates++
+			case vm.RETURN:
+				if size := step.Stack[len(step.Stack)-2]; size.Uint64() > params.MaxCodeSize {
+					oversized++
+				}
+			}
+		}
+		if i < 10 {
+			if err := gst.Fill(nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if empty == 0 || reverts == 0 || creates == 0 || oversized == 0 {
+		t.Fatalf("missing cases: %d empty, %d reverting, %d creating, %d oversized", empty, reverts, creates, oversized)
+	}
+}
+
+func TestCodeSizeFactory(t *testing.T) {
+	var below, at, above, deployed, rejected int
+	for i := 0; i < 30; i++ {
+		gst := Factory("codesize", "Cancun")()
+		trace := new(bytes.Buffer)
+		if err := gst.Fill(trace); err != nil {
+			t.Fatal(err)
+		}
+		scanner := bufio.NewScanner(trace)
+		scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+		for scanner.Scan() {
+			var step struct {
+				Op    string   `json:"opName"`
+				Depth int      `json:"depth"`
+				Stack []string `json:"stack"`
+			}
+			if err := json.Unmarshal(scanner.Bytes(), &step); err != nil || step.Op == "" {
+				continue
+			}
+			switch {
+			case step.Op == "RETURN" && step.Depth == 2:
+				// The size of the code returned by the initcode
+				switch size := asBig(step.Stack[len(step.Stack)-2]).Uint64(); {
+				case size < params.MaxCodeSize:
+					below++
+				case size == params.MaxCodeSize:
+					at++
+				default:
+					above++
+				}
+			case step.Op == "EXTCODESIZE" && step.Depth == 1:
+				// The created address is zero if the deployment failed
+				if asBig(step.Stack[len(step.Stack)-1]).Sign() == 0 {
+					rejected++
+				} else {
+					deployed++
+				}
+			}
+		}
+	}
+	if below == 0 || at == 0 || above == 0 || deployed == 0 || rejected == 0 {
+		t.Fatalf("missing cases: %d below, %d at, %d above the limit, %d deployed, %d rejected",
+			below, at, above, deployed, rejected)
+	}
+}
+
+func TestIntrinsicGasFactory(t *testing.T) {
+	var (
+		offsets              = make(map[int]int)
+		creations, withLists int
+	)
+	for i := 0; i < 60; i++ {
+		gst := Factory("intrinsicgas", "Cancun")()
+		var (
+			tx       = gst.tx
+			data     = common.FromHex(tx.Data[0])
+			creation = tx.To == ""
+			acl      types.AccessList
+		)
+		if creation {
+			creations++
+		}
+		if len(tx.AccessLists) > 0 {
+			acl = *tx.AccessLists[0]
+			withLists++
+		}
+		intrinsic, err := core.IntrinsicGas(data, acl, creation, true, true, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		offset := int(int64(tx.GasLimit[0]) - int64(intrinsic))
+		if offset < -1 || offset > 1 {
+			t.Fatalf("gas limit %d not at the intrinsic gas %d", tx.GasLimit[0], intrinsic)
+		}
+		offsets[offset]++
+		if err := gst.Fill(nil); err != nil {
+			t.Fatal(err)
+		}
+		if rejected := gst.expectException != ""; rejected != (offset < 0) {
+			t.Fatalf("gas limit %d, intrinsic gas %d: exception %q", tx.GasLimit[0], intrinsic, gst.expectException)
+		}
+	}
+	if len(offsets) != 3 || creations == 0 || withLists == 0 {
+		t.Fatalf("missing cases: offsets %v, %d creations, %d with access lists", offsets, creations, withLists)
+	}
+}
+
+func TestRefundCapFactory(t *testing.T) {
+	var capped, uncapped int
+	for i := 0; i < 40; i++ {
+		gst := Factory("refundcap", "Berlin")()
+		if gst.forks[0] != "London" {
+			t.Fatalf("expected fork London, have %v", gst.forks)
+		}
+		trace := new(bytes.Buffer)
+		if err := gst.Fill(trace); err != nil {
+			t.Fatal(err)
+		}
+		var last struct {
+			Gas    math.HexOrDecimal64 `json:"gas"`
+			Refund uint64              `json:"refund"`
+		}
+		scanner := bufio.NewScanner(trace)
+		scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+		for scanner.Scan() {
+			var step struct {
+				Op     string              `json:"opName"`
+				Gas    math.HexOrDecimal64 `json:"gas"`
+				Refund uint64              `json:"refund"`
+			}
+			if err := json.Unmarshal(scanner.Bytes(), &step); err != nil || step.Op == "" {
+				continue
+			}
+			last.Gas, last.Refund = step.Gas, step.Refund
+		}
+		if last.Refund == 0 {
+			t.Fatal("no refund accrued")
+		}
+		// Whether the refund is over the cap, by the gas used before refunds
+		gasUsed := refundCapGasLimit - uint64(last.Gas)
+		if last.Refund > gasUsed/params.RefundQuotientEIP3529 {
+			capped++
+		} else {
+			uncapped++
+		}
+	}
+	if capped == 0 || uncapped == 0 {
+		t.Fatalf("refunds not around the cap: %d capped, %d uncapped", capped, uncapped)
+	}
+}
+
+func TestBalanceOpsFactory(t *testing.T) {
+	var (
+		kinds       = make(map[string]int)
+		accessLists int
+	)
+	for i := 0; i < 30; i++ {
+		gst := Factory("balanceops", "Istanbul")()
+		if gst.forks[0] != "Berlin" {
+			t.Fatalf("expected fork Berlin, have %v", gst.forks)
+		}
+		dest := gst.GetDestination()
+		if len(gst.tx.AccessLists) > 0 {
+			accessLists++
+		}
+		for _, step := range traceCode(t, (*gst.pre)[dest].Code) {
+			if step.Op == vm.SELFBALANCE {
+				kinds["self"]++
+				continue
+			}
+			if step.Op != vm.BALANCE {
+				continue
+			}
+			addr := common.Address(step.Stack[len(step.Stack)-1].Bytes20())
+			_, exists := (*gst.pre)[addr]
+			switch {
+			case addr == dest:
+				kinds["own"]++
+			case addr.Big().Cmp(big.NewInt(10)) <= 0:
+				kinds["precompile"]++
+			case exists:
+				kinds["existing"]++
+			default:
+				kinds["empty"]++
+			}
+		}
+		if i < 5 {
+			if err := gst.Fill(nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	for _, kind := range []string{"self", "own", "precompile", "existing", "empty"} {
+		if kinds[kind] == 0 {
+			t.Errorf("no balance read of kind %v", kind)
+		}
+	}
+	if accessLists == 0 || accessLists == 30 {
+		t.Errorf("access lists in %d out of 30 tests", accessLists)
+	}
+}
+
+func TestStaticCallFactory(t *testing.T) {
+	var (
+		violations = make(map[string]int)
+		maxDepth   int
+		statics    int
+	)
+	for i := 0; i < 20; i++ {
+		gst := Factory("staticcall", "Cancun")()
+		trace := new(bytes.Buffer)
+		if err := gst.Fill(trace); err != nil {
+			t.Fatal(err)
+		}
+		scanner := bufio.NewScanner(trace)
+		scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+		for scanner.Scan() {
+			var step struct {
+				Op    string `json:"opName"`
+				Depth int    `json:"depth"`
+				Error string `json:"error"`
+			}
+			if err := json.Unmarshal(scanner.Bytes(), &step); err != nil || step.Op == "" {
+				continue
+			}
+			if step.Op == "STATICCALL" {
+				statics++
+			}
+			if step.Depth > maxDepth {
+				maxDepth = step.Depth
+			}
+			if strings.Contains(step.Error, "write protection") {
+				violations[step.Op]++
+			}
+		}
+	}
+	if statics == 0 || maxDepth < 4 {
+		t.Fatalf("%d static calls, max depth %d", statics, maxDepth)
+	}
+	for _, op := range []string{"SSTORE", "CREATE", "CALL", "SELFDESTRUCT"} {
+		if violations[op] == 0 {
+			t.Errorf("no write protection violation by %v, have %v", op, violations)
+		}
+	}
+}
+
+func TestGasPriceFactory(t *testing.T) {
+	contexts := make(map[string]int)
+	for i := 0; i < 60; i++ {
+		fork := oneOf("Istanbul", "London", "Cancun").(string)
+		gst := Factory("gasprice", fork)()
+		trace := new(bytes.Buffer)
+		if err := gst.Fill(trace); err != nil {
+			t.Fatal(err)
+		}
+		if gst.expectException != "" {
+			continue
+		}
+		// The effective gas price which GASPRICE must return
+		var (
+			tx   = gst.tx
+			want = tx.GasPrice
+			kind = "legacy"
+		)
+		if want == nil {
+			want = new(big.Int).Add(gst.env.BaseFee, tx.MaxPriorityFeePerGas)
+			kind = "tip"
+			if want.Cmp(tx.MaxFeePerGas) > 0 {
+				want = tx.MaxFeePerGas
+				kind = "capped tip"
+			}
+		}
+		var (
+			scanner = bufio.NewScanner(trace)
+			expect  = map[string]string{
+				"GASPRICE": hexutil.EncodeBig(want),
+				"ORIGIN":   hexutil.EncodeBig(gst.SenderAddress().Big()),
+			}
+			pending string // the op whose result is on the stack of the next step
+			depth   int
+			reads   = make(map[int]int) // GASPRICE reads per depth
+		)
+		scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+		for scanner.Scan() {
+			var step struct {
+				Op    string   `json:"opName"`
+				Depth int      `json:"depth"`
+				Stack []string `json:"stack"`
+			}
+			if err := json.Unmarshal(scanner.Bytes(), &step); err != nil || step.Op == "" {
+				continue
+			}
+			if pending != "" && depth == step.Depth {
+				if have := step.Stack[len(step.Stack)-1]; have != expect[pending] {
+					t.Fatalf("%v returned %v, want %v (%v)", pending, have, expect[pending], kind)
+				}
+				if pending == "GASPRICE" {
+					reads[step.Depth]++
+				}
+			}
+			pending, depth = "", step.Depth
+			if _, ok := expect[step.Op]; ok {
+				pending = step.Op
+			}
+		}
+		if reads[1] == 0 {
+			t.Fatal("no GASPRICE read at the top level")
+		}
+		if reads[2] > 0 {
+			contexts["nested"]++
+		}
+		contexts[kind]++
+	}
+	for _, want := range []string{"legacy", "tip", "capped tip", "nested"} {
+		if contexts[want] == 0 {
+			t.Errorf("no GASPRICE reads with %v: %v", want, contexts)
+		}
+	}
+}
+
+func TestCallGasFactory(t *testing.T) {
+	bound := make(map[string]int)
+	for i := 0; i < 40; i++ {
+		gst := Factory("callgas", "Cancun")()
+		trace := new(bytes.Buffer)
+		if err := gst.Fill(trace); err != nil {
+			t.Fatal(err)
+		}
+		type callStep struct {
+			Op    string              `json:"opName"`
+			Depth int                 `json:"depth"`
+			Gas   math.HexOrDecimal64 `json:"gas"`
+			Stack []string            `json:"stack"`
+		}
+		var (
+			scanner = bufio.NewScanner(trace)
+			call    *callStep // the call whose callee is entered by the next step
+		)
+		scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+		for scanner.Scan() {
+			var step callStep
+			if err := json.Unmarshal(scanner.Bytes(), &step); err != nil || step.Op == "" {
+				continue
+			}
+			if call != nil && step.Depth == call.Depth+1 {
+				var (
+					received = uint64(step.Gas)
+					capped   = uint64(call.Gas) - uint64(call.Gas)/64
+				)
+				if call.Op == "CALL" || call.Op == "CALLCODE" {
+					if value := call.Stack[len(call.Stack)-3]; value != "0x0" {
+						received -= params.CallStipend
+					}
+				}
+				if received > capped {
+					t.Fatalf("%v forwarded %d gas, more than 63/64 of %d", call.Op, received, call.Gas)
+				}
+				switch call.Op {
+				case "CREATE", "CREATE2":
+					bound[call.Op]++
+				default:
+					requested, _ := new(big.Int).SetString(call.Stack[len(call.Stack)-1][2:], 16)
+					if requested.Cmp(new(big.Int).SetUint64(received)) < 0 {
+						t.Fatalf("%v forwarded %d gas, more than the requested %v", call.Op, received, requested)
+					}
+					if requested.Cmp(new(big.Int).SetUint64(received)) > 0 {
+						bound[call.Op]++
+					}
+				}
+			}
+			call = nil
+			switch step.Op {
+			case "CALL", "CALLCODE", "DELEGATECALL", "STATICCALL", "CREATE", "CREATE2":
+				call = &step
+			}
+		}
+	}
+	for _, op := range []string{"CALL", "CALLCODE", "DELEGATECALL", "STATICCALL", "CREATE", "CREATE2"} {
+		if bound[op] == 0 {
+			t.Errorf("63/64 cap never bound for %v: %v", op, bound)
+		}
+	}
+}
+
+// selfdestructTracer checks that every SELFDESTRUCT has the executing
+// contract as its beneficiary, and counts them per kind of contract.
+type selfdestructTracer struct {
+	t        *testing.T
+	existing common.Address
+	kinds    map[string]int
+}
+
+func (s *selfdestructTracer) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	if op != vm.SELFDESTRUCT {
+		return
+	}
+	var (
+		self        = scope.Contract.Address()
+		beneficiary = common.Address(scope.Stack.Back(0).Bytes20())
+	)
+	if beneficiary != self {
+		s.t.Fatalf("selfdestruct of %v to %v", self, beneficiary)
+	}
+	if self == s.existing {
+		s.kinds["existing"]++
+	} else {
+		s.kinds["created"]++
+	}
+}
+
+func (s *selfdestructTracer) CaptureTxStart(gasLimit uint64) {}
+
+func (s *selfdestructTracer) CaptureTxEnd(restGas uint64) {}
+
+func (s *selfdestructTracer) CaptureStart(env *vm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+}
+
+func (s *selfdestructTracer) CaptureEnd(output []byte, gasUsed uint64, err error) {}
+
+func (s *selfdestructTracer) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+}
+
+func (s *selfdestructTracer) CaptureExit(output []byte, gasUsed uint64, err error) {}
+
+func (s *selfdestructTracer) CaptureFault(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+}
+
+func TestSelfdestructSelfFactory(t *testing.T) {
+	var (
+		tracer = &selfdestructTracer{t: t, existing: selfdestructExistingAddr, kinds: make(map[string]int)}
+		forks  = make(map[string]int)
+	)
+	for i := 0; i < 40; i++ {
+		gst := Factory("selfdestruct_self", "Cancun")()
+		forks[gst.forks[0]]++
+		test, err := gst.ToStateTest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		state, _, err := test.RunNoVerify(test.Subtests()[0], vm.Config{Tracer: tracer}, false, rawdb.HashScheme)
+		if err != nil {
+			t.Fatal(err)
+		}
+		state.Close()
+	}
+	if tracer.kinds["existing"] == 0 || tracer.kinds["created"] == 0 {
+		t.Errorf("missing selfdestructs: %v", tracer.kinds)
+	}
+	if forks["Cancun"] == 0 || forks["Shanghai"] == 0 {
+		t.Errorf("expected tests on both sides of EIP-6780: %v", forks)
+	}
+}
+
+func TestWarmCoinbaseFactory(t *testing.T) {
+	costs := make(map[string]int) // first coinbase access, by fork and cost
+	for i := 0; i < 60; i++ {
+		gst := Factory("warmcoinbase", "Cancun")()
+		if gst.env.Coinbase == (common.Address{}) {
+			t.Fatal("no coinbase set")
+		}
+		trace := new(bytes.Buffer)
+		if err := gst.Fill(trace); err != nil {
+			t.Fatal(err)
+		}
+		var (
+			scanner  = bufio.NewScanner(trace)
+			coinbase = hexutil.EncodeBig(gst.env.Coinbase.Big())
+			accessed bool
+		)
+		for scanner.Scan() && !accessed {
+			var step struct {
+				Op      string              `json:"opName"`
+				Depth   int                 `json:"depth"`
+				GasCost math.HexOrDecimal64 `json:"gasCost"`
+				Stack   []string            `json:"stack"`
+			}
+			if err := json.Unmarshal(scanner.Bytes(), &step); err != nil || step.Depth != 1 {
+				continue
+			}
+			var addr string
+			switch step.Op {
+			case "BALANCE", "EXTCODESIZE", "EXTCODEHASH", "EXTCODECOPY":
+				addr = step.Stack[len(step.Stack)-1]
+			case "CALL", "STATICCALL":
+				addr = step.Stack[len(step.Stack)-2]
+			default:
+				continue
+			}
+			if addr != coinbase {
+				t.Fatalf("%v of %v, not the coinbase %v", step.Op, addr, coinbase)
+			}
+			accessed = true
+			if step.Op == "BALANCE" || step.Op == "EXTCODESIZE" || step.Op == "EXTCODEHASH" {
+				warm := gst.forks[0] != "Merge" || len(gst.tx.AccessLists) > 0
+				if want := map[bool]uint64{true: 100, false: 2600}[warm]; uint64(step.GasCost) != want {
+					t.Fatalf("%v of coinbase on %v cost %d, want %d", step.Op, gst.forks[0], step.GasCost, want)
+				}
+				costs[fmt.Sprintf("%v-%d", gst.forks[0], step.GasCost)]++
+			}
+		}
+		if !accessed {
+			t.Fatal("coinbase not accessed")
+		}
+	}
+	for _, want := range []string{"Cancun-100", "Merge-2600"} {
+		if costs[want] == 0 {
+			t.Errorf("no coinbase access with %v: %v", want, costs)
+		}
+	}
+}
+
+func TestNestedRevertFactory(t *testing.T) {
+	reverted := make(map[int]int) // frames with changes which reverted, per depth
+	for i := 0; i < 40; i++ {
+		gst := Factory("nestedrevert", "Cancun")()
+		trace := new(bytes.Buffer)
+		if err := gst.Fill(trace); err != nil {
+			t.Fatal(err)
+		}
+		var (
+			scanner = bufio.NewScanner(trace)
+			changed = make(map[int]bool) // whether the frame at a depth made changes
+			revert  int                  // the depth of the frame which just reverted
+		)
+		scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+		for scanner.Scan() {
+			var step struct {
+				Op    string `json:"opName"`
+				Depth int    `json:"depth"`
+				Error string `json:"error"`
+			}
+			// The faults are reported twice, skip the second one
+			if err := json.Unmarshal(scanner.Bytes(), &step); err != nil || step.Op == "" || step.Error != "" {
+				continue
+			}
+			if revert != 0 {
+				// The caller continues
+				if step.Depth != revert-1 {
+					t.Fatalf("revert at depth %d followed by depth %d", revert, step.Depth)
+				}
+				revert = 0
+			}
+			// A new frame starts without changes
+			for depth := range changed {
+				if depth > step.Depth {
+					delete(changed, depth)
+				}
+			}
+			switch step.Op {
+			case "SSTORE", "TSTORE", "LOG1", "CREATE", "CALL":
+				changed[step.Depth] = true
+			case "REVERT", "INVALID", "JUMP": // the only jumps are invalid ones
+				if step.Depth == 1 {
+					continue
+				}
+				if changed[step.Depth] {
+					reverted[step.Depth]++
+				}
+				revert = step.Depth
+			}
+		}
+	}
+	if reverted[2] == 0 || reverted[3] == 0 {
+		t.Fatalf("missing nested reverts: %v", reverted)
+	}
+}
+
+func TestExtCodeFactory(t *testing.T) {
+	kinds := make(map[string]int) // verified accesses per kind of target
+	for i := 0; i < 40; i++ {
+		gst := Factory("extcode", "Cancun")()
+		trace := new(bytes.Buffer)
+		if err := gst.Fill(trace); err != nil {
+			t.Fatal(err)
+		}
+		var (
+			scanner = bufio.NewScanner(trace)
+			want    []string // the expected results, of the pending ops
+			memory  []byte   // the expected memory after the last copy
+			pending string   // the op whose result is on the stack of the next step
+			target  common.Address
+		)
+		kind := func(addr common.Address) string {
+			switch {
+			case addr == extCodeAddr:
+				return "self"
+			case addr.Big().Cmp(big.NewInt(10)) <= 0:
+				return "precompile"
+			case len((*gst.pre)[addr].Code) > 0:
+				return "code"
+			}
+			return "empty"
+		}
+		for scanner.Scan() {
+			var step struct {
+				Op    string   `json:"opName"`
+				Depth int      `json:"depth"`
+				Stack []string `json:"stack"`
+			}
+			if err := json.Unmarshal(scanner.Bytes(), &step); err != nil || step.Op == "" || step.Depth != 1 {
+				continue
+			}
+			if pending != "" {
+				if have := step.Stack[len(step.Stack)-1]; have != want[0] {
+					t.Fatalf("%v of %v (%v): have %v, want %v", pending, target, kind(target), have, want[0])
+				}
+				kinds[kind(target)]++
+				pending, want = "", want[1:]
+			}
+			arg := func(n int) *big.Int {
+				v, _ := new(big.Int).SetString(step.Stack[len(step.Stack)-1-n][2:], 16)
+				return v
+			}
+			switch step.Op {
+			case "EXTCODESIZE":
+				target = common.BigToAddress(arg(0))
+				code := (*gst.pre)[target].Code
+				pending, want = step.Op, []string{hexutil.EncodeBig(big.NewInt(int64(len(code))))}
+			case "EXTCODECOPY":
+				target = common.BigToAddress(arg(0))
+				var (
+					code   = (*gst.pre)[target].Code
+					offset = arg(2)
+					length = int(arg(3).Int64())
+				)
+				memory = bytes.Repeat([]byte{0xff}, 64)
+				for j := 0; j < length; j++ {
+					memory[j] = 0
+					if offset.IsUint64() && offset.Uint64()+uint64(j) < uint64(len(code)) {
+						memory[j] = code[offset.Uint64()+uint64(j)]
+					}
+				}
+				want = nil
+			case "MLOAD":
+				if memory != nil {
+					offset := arg(0).Int64()
+					pending = "EXTCODECOPY"
+					want = append(want, hexutil.EncodeBig(new(big.Int).SetBytes(memory[offset:offset+32])))
+				}
+			}
+		}
+	}
+	for _, want := range []string{"self", "precompile", "code", "empty"} {
+		if kinds[want] == 0 {
+			t.Errorf("no verified access of %v: %v", want, kinds)
+		}
+	}
+}
+
+func TestCallOOGFactory(t *testing.T) {
+	var succeeded, failed, barely int
+	for i := 0; i < 20; i++ {
+		gst := Factory("calloog", "Cancun")()
+		trace := new(bytes.Buffer)
+		if err := gst.Fill(trace); err != nil {
+			t.Fatal(err)
+		}
+		type oogStep struct {
+			Pc    uint64              `json:"pc"`
+			Op    string              `json:"opName"`
+			Depth int                 `json:"depth"`
+			Gas   math.HexOrDecimal64 `json:"gas"`
+			Stack []string            `json:"stack"`
+			Error string              `json:"error"`
+		}
+		var (
+			scanner    = bufio.NewScanner(trace)
+			inCall     bool
+			received   uint64
+			iterations int
+		)
+		scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+		for scanner.Scan() {
+			var step oogStep
+			if err := json.Unmarshal(scanner.Bytes(), &step); err != nil || step.Op == "" || step.Error != "" {
+				continue
+			}
+			switch {
+			case step.Depth == 2 && step.Pc == 0:
+				inCall, received, iterations = true, uint64(step.Gas), 0
+			case step.Depth == 2 && step.Pc == 3 && iterations == 0:
+				// The loop counter, just loaded from calldata
+				n, _ := strconv.ParseUint(step.Stack[len(step.Stack)-1], 0, 64)
+				iterations = int(n)
+			case step.Depth == 1 && inCall:
+				inCall = false
+				var (
+					cost = CallOOGCalleeCost(iterations)
+					ok   = step.Stack[len(step.Stack)-1] == "0x1"
+				)
+				if want := iterations > 0 && received >= cost; ok != want {
+					t.Fatalf("callee with %d gas for %d iterations (cost %d): success %v, expected %v",
+						received, iterations, cost, ok, want)
+				}
+				if ok {
+					succeeded++
+				} else {
+					failed++
+					if iterations > 0 && cost-received <= 26 {
+						barely++
+					}
+				}
+			}
+		}
+	}
+	if succeeded == 0 || failed == 0 || barely == 0 {
+		t.Errorf("expected successful calls, failed ones, and ones barely short of gas: %d, %d, %d",
+			succeeded, failed, barely)
+	}
+}
+
+func TestCreateCollisionFactory(t *testing.T) {
+	var collisions, txCollisions int
+	for i := 0; i < 40; i++ {
+		gst := Factory("createcollision", "Cancun")()
+		trace := new(bytes.Buffer)
+		if err := gst.Fill(trace); err != nil {
+			t.Fatal(err)
+		}
+		pre := *gst.pre
+		if gst.tx.To == "" {
+			// A creation transaction, which must target a seeded account
+			acc, ok := pre[gst.CreateAddress(gst.SenderAddress())]
+			if !ok {
+				t.Fatal("no account at the address of the creation")
+			}
+			if collides := acc.Nonce > 0 || len(acc.Code) > 0; collides {
+				if trace.Len() > 0 {
+					t.Fatalf("initcode executed despite a collision: %v", trace.String())
+				}
+				txCollisions++
+			}
+			continue
+		}
+		if _, ok := pre[gst.CreateAddress(createCollisionAddr)]; !ok {
+			t.Fatal("no account at the address of the first creation")
+		}
+		type createStep struct {
+			Op    string   `json:"opName"`
+			Depth int      `json:"depth"`
+			Stack []string `json:"stack"`
+		}
+		var (
+			scanner = bufio.NewScanner(trace)
+			prev    string
+		)
+		for scanner.Scan() {
+			var step createStep
+			if err := json.Unmarshal(scanner.Bytes(), &step); err != nil || step.Op == "" {
+				continue
+			}
+			if step.Depth == 1 && (prev == "CREATE" || prev == "CREATE2") {
+				// The creation returned without executing the initcode
+				created := common.HexToAddress(step.Stack[len(step.Stack)-1])
+				if acc, ok := pre[created]; ok && (acc.Nonce > 0 || len(acc.Code) > 0) {
+					t.Fatalf("%v deployed at %v, which collides", prev, created)
+				}
+				if created == (common.Address{}) {
+					collisions++
+				}
+			}
+			prev = step.Op
+		}
+	}
+	if collisions == 0 || txCollisions == 0 {
+		t.Errorf("expected failed creations, by contracts and transactions: %d, %d", collisions, txCollisions)
+	}
+}
+
+func TestDataBranchFactory(t *testing.T) {
+	var taken, notTaken int
+	for i := 0; i < 20; i++ {
+		gst := Factory("databranch", "Cancun")()
+		if len((*gst.pre)[dataBranchAddr].Storage) == 0 && gst.tx.Data[0] == "0x" {
+			t.Fatal("neither storage nor calldata seeded")
+		}
+		trace := new(bytes.Buffer)
+		if err := gst.Fill(trace); err != nil {
+			t.Fatal(err)
+		}
+		type branchStep struct {
+			Op    string   `json:"opName"`
+			Depth int      `json:"depth"`
+			Stack []string `json:"stack"`
+		}
+		var (
+			scanner       = bufio.NewScanner(trace)
+			loaded, arith bool // whether data was loaded, and operated on, since the last branch
+			jumpi         bool
+		)
+		for scanner.Scan() {
+			var step branchStep
+			if err := json.Unmarshal(scanner.Bytes(), &step); err != nil || step.Op == "" || step.Depth != 1 {
+				continue
+			}
+			if jumpi {
+				// The step after the branch tells whether it was taken
+				if step.Op == "JUMPDEST" {
+					taken++
+				} else {
+					notTaken++
+				}
+				jumpi = false
+			}
+			switch step.Op {
+			case "SLOAD", "CALLDATALOAD":
+				loaded = true
+			case "JUMPI":
+				if !loaded || !arith {
+					t.Fatalf("branch not on data: loaded %v, arithmetic %v", loaded, arith)
+				}
+				loaded, arith, jumpi = false, false, true
+			default:
+				for _, op := range branchOps {
+					if step.Op == op.String() && loaded {
+						arith = true
+					}
+				}
+			}
+		}
+	}
+	if taken == 0 || notTaken == 0 {
+		t.Errorf("expected branches both taken and not: %d, %d", taken, notTaken)
+	}
+}
+
+func TestBitOpsFactory(t *testing.T) {
+	seen := make(map[string]map[uint64]bool)
+	for i := 0; i < 60; i++ {
+		gst := Factory("bitops", "Cancun")()
+		trace := new(bytes.Buffer)
+		if err := gst.Fill(trace); err != nil {
+			t.Fatal(err)
+		}
+		type bitStep struct {
+			Op    string   `json:"opName"`
+			Depth int      `json:"depth"`
+			Stack []string `json:"stack"`
+			Error string   `json:"error"`
+		}
+		var (
+			scanner = bufio.NewScanner(trace)
+			stored  = make(map[uint64]string)
+		)
+		for scanner.Scan() {
+			var step bitStep
+			if err := json.Unmarshal(scanner.Bytes(), &step); err != nil || step.Op == "" || step.Depth != 1 || step.Error != "" {
+				continue
+			}
+			switch step.Op {
+			case "SIGNEXTEND", "BYTE", "SHL", "SHR", "SAR":
+				// The position is on top of the stack
+				pos, err := strconv.ParseUint(step.Stack[len(step.Stack)-1], 0, 64)
+				if err != nil {
+					continue // Too large
+				}
+				if seen[step.Op] == nil {
+					seen[step.Op] = make(map[uint64]bool)
+				}
+				seen[step.Op][pos] = true
+			case "SSTORE":
+				key, err := strconv.ParseUint(step.Stack[len(step.Stack)-1], 0, 64)
+				if err != nil {
+					t.Fatal(err)
+				}
+				stored[key] = step.Stack[len(step.Stack)-2]
+			}
+		}
+		if len(stored) == 0 {
+			t.Fatal("no results stored")
+		}
+		// The results with the position pushed and computed should be equal
+		for key, val := range stored {
+			if key%2 == 0 && stored[key+1] != val {
+				t.Fatalf("non-uniform results at %d: %v, %v", key, val, stored[key+1])
+			}
+		}
+	}
+	for _, op := range []string{"SHL", "SHR", "SAR"} {
+		for _, pos := range []uint64{255, 256, 257} {
+			if !seen[op][pos] {
+				t.Errorf("%v: shift %d not seen", op, pos)
+			}
+		}
+	}
+	for _, op := range []string{"SIGNEXTEND", "BYTE"} {
+		for _, pos := range []uint64{31, 32, 33} {
+			if !seen[op][pos] {
+				t.Errorf("%v: position %d not seen", op, pos)
+			}
+		}
+	}
+}
+
+func TestSelfCallFactory(t *testing.T) {
+	var maxDepth int
+	for i := 0; i < 20; i++ {
+		gst := Factory("selfcall", "Cancun")()
+		code := (*gst.pre)[selfCallAddr].Code
+		if !bytes.Contains(code, []byte{byte(ops.ADDRESS)}) && !bytes.Contains(code, selfCallAddr.Big().Bytes()) {
+			t.Fatal("contract does not reference its own address")
+		}
+		trace := new(bytes.Buffer)
+		if err := gst.Fill(trace); err != nil {
+			t.Fatal(err)
+		}
+		scanner := bufio.NewScanner(trace)
+		scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+		for scanner.Scan() {
+			var step struct {
+				Op    string   `json:"opName"`
+				Depth int      `json:"depth"`
+				Stack []string `json:"stack"`
+				Error string   `json:"error"`
+			}
+			if err := json.Unmarshal(scanner.Bytes(), &step); err != nil || step.Op == "" || step.Error != "" {
+				continue
+			}
+			if step.Depth > maxDepth {
+				maxDepth = step.Depth
+			}
+			if step.Op == "CALL" {
+				if to := common.HexToAddress(step.Stack[len(step.Stack)-2]); to != selfCallAddr {
+					t.Fatalf("call to %v, not self", to)
+				}
+			}
+		}
+	}
+	if maxDepth < 3 {
+		t.Errorf("recursion too shallow: depth %d", maxDepth)
+	}
+}
+
+func TestSstoreSentryFactory(t *testing.T) {
+	var below, above int
+	for i := 0; i < 20; i++ {
+		gst := Factory("sstoresentry", "Istanbul")()
+		trace := new(bytes.Buffer)
+		if err := gst.Fill(trace); err != nil {
+			t.Fatal(err)
+		}
+		var (
+			scanner = bufio.NewScanner(trace)
+			prev    string
+		)
+		for scanner.Scan() {
+			var step struct {
+				Pc    uint64         `json:"pc"`
+				Op    string         `json:"opName"`
+				Depth int            `json:"depth"`
+				Gas   hexutil.Uint64 `json:"gas"`
+			}
+			if err := json.Unmarshal(scanner.Bytes(), &step); err != nil || step.Op != "SSTORE" || step.Depth != 2 {
+				continue
+			}
+			// The step failing on the sentry is only reported as a fault,
+			// other faults are reported twice.
+			key := fmt.Sprint(step)
+			if key == prev {
+				continue
+			}
+			prev = key
+			if step.Gas < 2250 || step.Gas > 2350 {
+				t.Fatalf("gas before SSTORE not near the sentry: %d", step.Gas)
+			}
+			if step.Gas <= 2300 {
+				below++
+			} else {
+				above++
+			}
+		}
+	}
+	if below == 0 || above == 0 {
+		t.Errorf("expected gas on both sides of the sentry: %d, %d", below, above)
+	}
+}
+
+func TestMstore8Factory(t *testing.T) {
+	var (
+		overlapping int
+		alignments  = make(map[uint64]bool) // the offsets of the written bytes, mod 32
+	)
+	for i := 0; i < 20; i++ {
+		gst := Factory("mstore8", "Cancun")()
+		trace := new(bytes.Buffer)
+		if err := gst.Fill(trace); err != nil {
+			t.Fatal(err)
+		}
+		var (
+			scanner = bufio.NewScanner(trace)
+			written = make(map[uint64]byte) // the bytes written, by offset
+			mload   = int64(-1)             // offset of the word just read
+		)
+		for scanner.Scan() {
+			var step struct {
+				Op    string   `json:"opName"`
+				Depth int      `json:"depth"`
+				Stack []string `json:"stack"`
+				Error string   `json:"error"`
+			}
+			if err := json.Unmarshal(scanner.Bytes(), &step); err != nil || step.Op == "" || step.Depth != 1 || step.Error != "" {
+				continue
+			}
+			if mload >= 0 {
+				// The word read must hold the bytes written
+				word := math.MustParseBig256(step.Stack[len(step.Stack)-1])
+				data := common.BigToHash(word)
+				for j := uint64(0); j < 32; j++ {
+					if b, ok := written[uint64(mload)+j]; ok {
+						if data[j] != b {
+							t.Fatalf("byte %d of word at %d: have %#x, want %#x", j, mload, data[j], b)
+						}
+						overlapping++
+					}
+				}
+				mload = -1
+			}
+			switch step.Op {
+			case "MSTORE8":
+				offset, err := strconv.ParseUint(step.Stack[len(step.Stack)-1], 0, 64)
+				if err != nil {
+					continue // Out of bounds
+				}
+				value := math.MustParseBig256(step.Stack[len(step.Stack)-2])
+				written[offset] = byte(value.Uint64())
+				alignments[offset%32] = true
+			case "MLOAD":
+				offset, err := strconv.ParseUint(step.Stack[len(step.Stack)-1], 0, 64)
+				if err != nil {
+					t.Fatal(err)
+				}
+				mload = int64(offset)
+			}
+		}
+	}
+	if overlapping == 0 {
+		t.Error("no reads overlapping the bytes written")
+	}
+	if len(alignments) < 16 {
+		t.Errorf("too few distinct offsets written: %d", len(alignments))
+	}
+}
+
+func TestFactoriesDeterministic(t *testing.T) {
+	names := FactoryNames()
+	sort.Strings(names)
+	for _, name := range names {
+		var tests [2][]byte
+		for i := range tests {
+			rand.Seed(42)
+			gst := Factory(name, "Cancun")()
+			if err := gst.Fill(nil); err != nil {
+				t.Fatalf("%v: %v", name, err)
+			}
+			data, err := json.Marshal(gst.ToGeneralStateTest(name))
+			if err != nil {
+				t.Fatalf("%v: %v", name, err)
+			}
+			tests[i] = data
+		}
+		if !bytes.Equal(tests[0], tests[1]) {
+			t.Errorf("%v: different tests from the same seed", name)
+		}
+	}
+}
+
+// TestFactoriesUnknownFork checks that the generators either make tests for
+// forks not defined in ops, or refuse the fork up front, instead of panicking.
+func TestFactoriesUnknownFork(t *testing.T) {
+	names := FactoryNames()
+	sort.Strings(names)
+	for _, fork := range []string{"Byzantium", "Prague"} {
+		for _, name := range names {
+			factory, err := LookupFactory(name, fork)
+			if err != nil {
+				if !forkedFillers[name] {
+					t.Errorf("%v: fork %v refused: %v", name, fork, err)
+				}
+				continue
+			}
+			func() {
+				defer func() {
+					if r := recover(); r != nil {
+						t.Errorf("%v: panic on fork %v: %v", name, fork, r)
+					}
+				}()
+				for i := 0; i < 5; i++ {
+					factory()
+				}
+			}()
+		}
+	}
+	if _, err := LookupFactory("nonexistent", "Cancun"); err == nil {
+		t.Error("unknown generator accepted")
+	}
+}
+
+func TestChainIDFactory(t *testing.T) {
+	var valid, invalid int
+	for i := 0; i < 60; i++ {
+		gst := Factory("chainid", "Berlin")()
+		if gst.forks[0] != "London" {
+			t.Fatalf("expected fork London, have %v", gst.forks)
+		}
+		if i < 10 {
+			if err := gst.Fill(nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// Converting it also runs it through the blocktest runner
+		bt, err := gst.ToBlockchainTest("test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var (
+			btBlock = (*bt)["test"].Blocks[0]
+			block   = new(types.Block)
+		)
+		if err := rlp.DecodeBytes(btBlock.Rlp, block); err != nil {
+			t.Fatal(err)
+		}
+		var (
+			tx       = block.Transactions()[0]
+			v, _, _  = tx.RawSignatureValues()
+			isLegacy = tx.Type() == types.LegacyTxType
+			want     = big.NewInt(1)
+		)
+		if gst.chainID != nil {
+			want = gst.chainID
+		}
+		unprotected := isLegacy && want.Sign() == 0
+		// The signature must match the chain id it was signed for
+		switch {
+		case unprotected:
+			if tx.Protected() || (v.Uint64() != 27 && v.Uint64() != 28) {
+				t.Fatalf("unprotected tx has v %v", v)
+			}
+		case tx.ChainId().Cmp(want) != 0:
+			t.Fatalf("tx chain id %v, signed for %v", tx.ChainId(), want)
+		case isLegacy:
+			// EIP-155: v = chainid * 2 + 35 + {0,1}
+			recID := new(big.Int).Sub(v, new(big.Int).Add(new(big.Int).Lsh(want, 1), big.NewInt(35)))
+			if recID.Sign() < 0 || recID.Cmp(common.Big1) > 0 {
+				t.Fatalf("legacy tx for chain %v has v %v", want, v)
+			}
+		default:
+			if v.Cmp(common.Big1) > 0 {
+				t.Fatalf("typed tx has v %v", v)
+			}
+		}
+		// Only signatures for chain 1 (or unprotected ones) are valid
+		if unprotected || want.Cmp(common.Big1) == 0 {
+			if btBlock.BlockHeader == nil {
+				t.Fatalf("valid block marked as invalid: %v", btBlock.ExpectException)
+			}
+			valid++
+			continue
+		}
+		if btBlock.BlockHeader != nil || btBlock.ExpectException == "" {
+			t.Fatalf("invalid block (chain id %v) not marked as invalid", want)
+		}
+		invalid++
+	}
+	if valid == 0 || invalid == 0 {
+		t.Fatalf("missing cases: %d valid, %d invalid", valid, invalid)
+	}
+}
+
+func TestMemExpansionFactory(t *testing.T) {
+	for i := 0; i < 10; i++ {
+		gst := Factory("memexpansion", "Cancun")()
+		if err := gst.Fill(nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Count the memory ops which are executed with an offset near the
+	// quadratic boundary, and with a huge offset (running out of gas).
+	memOps := make(map[vm.OpCode]bool)
+	for _, op := range memExpansionOps {
+		memOps[vm.OpCode(op)] = true
+	}
+	var boundary, huge int
+	for i := 0; i < 100; i++ {
+		tracer := logger.NewStructLogger(nil)
+		_, _, _ = runtime.Execute(RandMemExpansion("Cancun"), nil, &runtime.Config{
+			ChainConfig: params.MergedTestChainConfig,
+			Random:      &common.Hash{},
+			GasLimit:    1_000_000,
+			EVMConfig:   vm.Config{Tracer: tracer},
+		})
+		for _, step := range tracer.StructLogs() {
+			if !memOps[step.Op] {
+				continue
+			}
+			// The destination offset is on top of the stack, except for
+			// EXTCODECOPY, where the address is.
+			offset := step.Stack[len(step.Stack)-1]
+			if step.Op == vm.EXTCODECOPY {
+				offset = step.Stack[len(step.Stack)-2]
+			}
+			switch {
+			case !offset.IsUint64() || offset.Uint64() > 0x400000:
+				huge++
+			case offset.Uint64() >= memQuadBoundary-128 && offset.Uint64() < memQuadBoundary+128:
+				boundary++
+			}
+		}
+	}
+	if boundary == 0 || huge == 0 {
+		t.Fatalf("missing cases: %d at the boundary, %d huge", boundary, huge)
+	}
+}
+
+func TestMemBoundaryFactory(t *testing.T) {
+	for i := 0; i < 10; i++ {
+		gst := Factory("memboundary", "Cancun")()
+		if err := gst.Fill(nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Count the accesses by their offset relative to the memory size: within
+	// the allocated memory, expanding it by a word or two, or by a lot.
+	var within, boundary, far int
+	for i := 0; i < 50; i++ {
+		tracer := logger.NewStructLogger(nil)
+		_, _, _ = runtime.Execute(RandMemBoundary(), nil, &runtime.Config{
+			ChainConfig: params.MergedTestChainConfig,
+			Random:      &common.Hash{},
+			GasLimit:    1_000_000,
+			EVMConfig:   vm.Config{Tracer: tracer},
+		})
+		for _, step := range tracer.StructLogs() {
+			if step.Op != vm.MLOAD && step.Op != vm.MSTORE && step.Op != vm.MSTORE8 {
+				continue
+			}
+			var (
+				offset = step.Stack[len(step.Stack)-1]
+				size   = uint64(step.MemorySize)
+			)
+			switch {
+			case !offset.IsUint64() || offset.Uint64() >= size+0x10000:
+				far++
+			case offset.Uint64()+32 <= size:
+				within++
+			case offset.Uint64() < size+64:
+				boundary++
+			}
+		}
+	}
+	if within == 0 || boundary == 0 || far == 0 {
+		t.Fatalf("missing cases: %d within, %d at the boundary, %d far", within, boundary, far)
+	}
+}
+
+func TestHashPrecompilesFactory(t *testing.T) {
+	for _, fork := range []string{"Homestead", "Cancun"} {
+		for i := 0; i < 5; i++ {
+			gst := Factory("hashprecompiles", fork)()
+			if err := gst.Fill(nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// Collect the input sizes used per precompile
+	sizes := make(map[uint64]map[uint64]bool)
+	for i := 0; i < 200; i++ {
+		for _, step := range traceCode(t, RandHashPrecompileCalls("Cancun")) {
+			var (
+				stack = step.Stack
+				n     = len(stack)
+			)
+			if step.Op != vm.CALL && step.Op != vm.STATICCALL {
+				continue
+			}
+			// gas, address, [value], inOffset, inSize
+			addr, inSize := stack[n-2].Uint64(), stack[n-4].Uint64()
+			if step.Op == vm.CALL {
+				inSize = stack[n-5].Uint64()
+			}
+			if sizes[addr] == nil {
+				sizes[addr] = make(map[uint64]bool)
+			}
+			sizes[addr][inSize] = true
+		}
+	}
+	for _, addr := range []uint64{2, 3, 4} {
+		for _, size := range []uint64{0, 32, 33} {
+			if !sizes[addr][size] {
+				t.Errorf("no call to %d with input size %d", addr, size)
+			}
+		}
+	}
+}
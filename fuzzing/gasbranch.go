@@ -0,0 +1,112 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"math/big"
+	"math/rand"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/holiman/goevmlab/ops"
+	"github.com/holiman/goevmlab/program"
+)
+
+func fillGasBranch(gst *GstMaker, fork string) {
+	dest := common.HexToAddress("0x00000000000000000000000000000000000ca500")
+	gst.AddAccount(dest, GenesisAccount{
+		Code:    RandGasBranch(),
+		Balance: new(big.Int),
+		Storage: make(map[common.Hash]common.Hash),
+	})
+	// The transaction
+	gst.SetTx(&StTransaction{
+		// 8M gaslimit
+		GasLimit:   []uint64{8000000},
+		Nonce:      0,
+		Value:      []string{randHex(4)},
+		Data:       []string{randHex(100)},
+		GasPrice:   big.NewInt(0x10),
+		To:         dest.Hex(),
+		Sender:     sender,
+		PrivateKey: pKey,
+	})
+}
+
+// RandGasBranch creates code which executes a series of gas-consuming ops,
+// each followed by a branch on the low bits of the gas left (GAS, AND, JUMPI).
+// A single mispriced op thus makes a client take a different path, which
+// shows up in the trace and in the storage: the branch not taken is recorded
+// in storage, and now and then the gas left itself is stored.
+func RandGasBranch() []byte {
+	var (
+		p      = program.NewProgram()
+		blocks = 1 + rand.Intn(20)
+	)
+	for i := 0; i < blocks; i++ {
+		gasConsumer(p)
+		// The code executed when not jumping
+		notTaken := program.NewProgram()
+		notTaken.Sstore(2*i, 1)
+		// GAS, mask, AND, PUSH2 target, JUMPI
+		p.Op(ops.GAS)
+		p.Push(oneOf(1, 3, 7, 0xff).(int))
+		p.Op(ops.AND)
+		target := p.Size() + 4 + len(notTaken.Bytecode())
+		p.Op(ops.PUSH2)
+		p.AddAll([]byte{byte(target >> 8), byte(target)})
+		p.Op(ops.JUMPI)
+		p.AddAll(notTaken.Bytecode())
+		p.Op(ops.JUMPDEST)
+		if rand.Intn(3) == 0 {
+			p.Op(ops.GAS)
+			p.Push(2*i + 1)
+			p.Op(ops.SSTORE)
+		}
+	}
+	return p.Bytecode()
+}
+
+// gasConsumer adds an op whose gas cost depends on the state, such as memory
+// expansion or cold/warm access.
+func gasConsumer(p *program.Program) {
+	switch rand.Intn(6) {
+	case 0: // Memory expansion
+		p.Push(rand.Intn(0x2000))
+		p.Op(ops.MLOAD)
+	case 1: // Cold or warm slot
+		p.Push(rand.Intn(4))
+		p.Op(ops.SLOAD)
+	case 2: // Cold or warm account
+		p.Push(common.BigToAddress(big.NewInt(int64(rand.Intn(4)))))
+		p.Op(oneOf(ops.BALANCE, ops.EXTCODESIZE).(ops.OpCode))
+	case 3: // Hashing, which also expands memory
+		p.Push(rand.Intn(0x200))
+		p.Push(rand.Intn(0x200))
+		p.Op(ops.KECCAK256)
+	case 4: // Dynamic exponent cost
+		p.Push(new(big.Int).Lsh(big.NewInt(1), uint(rand.Intn(256))))
+		p.Push(rand.Intn(256))
+		p.Op(ops.EXP)
+	default: // Copying, which also expands memory
+		p.Push(rand.Intn(0x100))
+		p.Push(rand.Intn(0x100))
+		p.Push(rand.Intn(0x1000))
+		p.Op(ops.CALLDATACOPY)
+		return
+	}
+	p.Op(ops.POP)
+}
@@ -0,0 +1,171 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"math/big"
+	"math/rand"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/tests"
+	"github.com/holiman/goevmlab/ops"
+	"github.com/holiman/goevmlab/program"
+)
+
+var (
+	gasPriceAddr      = common.HexToAddress("0x000000000000000000000000000000000009a500")
+	gasPriceChildAddr = common.HexToAddress("0x000000000000000000000000000000000009a501")
+)
+
+// legacyGasPrices are the gas prices used before London: zero, tiny ones, one
+// gwei, and one which does not fit in 64 bits.
+var legacyGasPrices = []string{"0x0", "0x1", "0x10", "0x3b9aca00", "0x10000000000000000"}
+
+func fillGasPrice(gst *GstMaker, fork string) {
+	// The sender needs to afford the largest fees
+	gst.AddAccount(sender, GenesisAccount{
+		Balance: new(big.Int).Lsh(big.NewInt(1), 128),
+		Storage: make(map[common.Hash]common.Hash),
+		Code:    []byte{},
+	})
+	gst.AddAccount(gasPriceChildAddr, GenesisAccount{
+		Code:    gasPriceChildCode(),
+		Balance: new(big.Int),
+		Storage: make(map[common.Hash]common.Hash),
+	})
+	gst.AddAccount(gasPriceAddr, GenesisAccount{
+		Code:    RandGasPriceCode(fork, gasPriceChildAddr),
+		Balance: new(big.Int),
+		Storage: make(map[common.Hash]common.Hash),
+	})
+	tx := &StTransaction{
+		GasLimit:   []uint64{200_000},
+		Nonce:      0,
+		Value:      []string{randHex(4)},
+		Data:       []string{randHex(100)},
+		To:         gasPriceAddr.Hex(),
+		Sender:     sender,
+		PrivateKey: pKey,
+	}
+	if config, ok := tests.Forks[fork]; ok && config.IsLondon(common.Big0) {
+		// The effective gas price depends on the base fee and the fee caps
+		baseFee := asBig(baseFees[rand.Intn(len(baseFees))])
+		gst.SetBaseFee(baseFee)
+		if rand.Intn(4) == 0 {
+			tx.GasPrice = RandFeeAround(baseFee)
+			gst.AddTag("legacy")
+		} else {
+			tx.MaxFeePerGas, tx.MaxPriorityFeePerGas = RandFeeCaps(baseFee)
+		}
+	} else {
+		tx.GasPrice = asBig(legacyGasPrices[rand.Intn(len(legacyGasPrices))])
+	}
+	gst.SetTx(tx)
+	if rand.Intn(3) == 0 {
+		// Another sender, and thus origin
+		key := make([]byte, 32)
+		rand.Read(key)
+		_ = gst.SetSenderKey(key)
+	}
+}
+
+// gasPriceChildCode returns code which returns the GASPRICE, ORIGIN and
+// CALLER, as three words.
+func gasPriceChildCode() []byte {
+	p := program.NewProgram()
+	p.Op(ops.GASPRICE)
+	p.Push(0)
+	p.Op(ops.MSTORE)
+	p.Op(ops.ORIGIN)
+	p.Push(32)
+	p.Op(ops.MSTORE)
+	p.Op(ops.CALLER)
+	p.Push(64)
+	p.Op(ops.MSTORE)
+	p.Return(0, 96)
+	return p.Bytecode()
+}
+
+// RandGasPriceCode creates code which reads GASPRICE and ORIGIN, which are the
+// same throughout the transaction, at the top level and in nested contexts:
+// calls of the various kinds into the child (which returns them), and the
+// initcode of created contracts (which stores them). The values read are
+// stored.
+func RandGasPriceCode(fork string, child common.Address) []byte {
+	var (
+		p      = program.NewProgram()
+		forkOp = ops.LookupFork(fork)
+		slot   = 0
+		store  = func() {
+			p.Push(slot)
+			p.Op(ops.SSTORE)
+			slot++
+		}
+	)
+	p.Op(ops.GASPRICE)
+	store()
+	p.Op(ops.ORIGIN)
+	store()
+	// Whether the origin is the caller, which it is at the top level
+	p.Op(ops.CALLER)
+	p.Op(ops.ORIGIN)
+	p.Op(ops.EQ)
+	store()
+	for n := 1 + rand.Intn(4); n > 0; n-- {
+		op := oneOf(ops.CALL, ops.CALLCODE, ops.DELEGATECALL, ops.STATICCALL, ops.CREATE).(ops.OpCode)
+		if forkOp != nil && !forkOp.IsValid(op) {
+			op = ops.CALL
+		}
+		gas := big.NewInt(50_000)
+		switch op {
+		case ops.CALL:
+			p.Call(gas, child, 0, 0, 0, 0, 96)
+		case ops.CALLCODE:
+			p.CallCode(gas, child, 0, 0, 0, 0, 96)
+		case ops.DELEGATECALL:
+			p.DelegateCall(gas, child, 0, 0, 0, 96)
+		case ops.STATICCALL:
+			p.StaticCall(gas, child, 0, 0, 0, 96)
+		case ops.CREATE:
+			initcode := program.NewProgram()
+			initcode.Op(ops.GASPRICE)
+			initcode.Push(0)
+			initcode.Op(ops.SSTORE)
+			initcode.Op(ops.ORIGIN)
+			initcode.Push(1)
+			initcode.Op(ops.SSTORE)
+			code := initcode.Bytecode()
+			p.Mstore(code, 0)
+			p.Push(len(code))
+			p.Push(0)
+			p.Push(0)
+			p.Op(ops.CREATE)
+		}
+		store()
+		if op != ops.CREATE {
+			// The returned GASPRICE, ORIGIN and CALLER
+			for offset := 0; offset < 96; offset += 32 {
+				p.Push(offset)
+				p.Op(ops.MLOAD)
+				store()
+			}
+		}
+		// Clear the memory, so a failed call does not show stale values
+		p.Mstore(make([]byte, 96), 0)
+	}
+	return p.Bytecode()
+}
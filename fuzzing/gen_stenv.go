@@ -16,14 +16,15 @@ var _ = (*stEnvMarshaling)(nil)
 // MarshalJSON marshals as JSON.
 func (s stEnv) MarshalJSON() ([]byte, error) {
 	type stEnv struct {
-		Coinbase     common.UnprefixedAddress `json:"currentCoinbase"   gencodec:"required"`
-		Difficulty   *math.HexOrDecimal256    `json:"currentDifficulty" gencodec:"optional"`
-		Random       *common.Hash             `json:"currentRandom,omitempty"     gencodec:"optional"`
-		GasLimit     math.HexOrDecimal64      `json:"currentGasLimit"   gencodec:"required"`
-		Number       math.HexOrDecimal64      `json:"currentNumber"     gencodec:"required"`
-		Timestamp    math.HexOrDecimal64      `json:"currentTimestamp"  gencodec:"required"`
-		PreviousHash common.Hash              `json:"previousHash"`
-		BaseFee      *math.HexOrDecimal256    `json:"currentBaseFee"`
+		Coinbase      common.UnprefixedAddress `json:"currentCoinbase"   gencodec:"required"`
+		Difficulty    *math.HexOrDecimal256    `json:"currentDifficulty" gencodec:"optional"`
+		Random        *common.Hash             `json:"currentRandom,omitempty"     gencodec:"optional"`
+		GasLimit      math.HexOrDecimal64      `json:"currentGasLimit"   gencodec:"required"`
+		Number        math.HexOrDecimal64      `json:"currentNumber"     gencodec:"required"`
+		Timestamp     math.HexOrDecimal64      `json:"currentTimestamp"  gencodec:"required"`
+		PreviousHash  common.Hash              `json:"previousHash"`
+		BaseFee       *math.HexOrDecimal256    `json:"currentBaseFee"`
+		ExcessBlobGas *math.HexOrDecimal64     `json:"currentExcessBlobGas,omitempty"`
 	}
 	var enc stEnv
 	enc.Coinbase = common.UnprefixedAddress(s.Coinbase)
@@ -34,20 +35,22 @@ func (s stEnv) MarshalJSON() ([]byte, error) {
 	enc.Timestamp = math.HexOrDecimal64(s.Timestamp)
 	enc.PreviousHash = s.PreviousHash
 	enc.BaseFee = (*math.HexOrDecimal256)(s.BaseFee)
+	enc.ExcessBlobGas = (*math.HexOrDecimal64)(s.ExcessBlobGas)
 	return json.Marshal(&enc)
 }
 
 // UnmarshalJSON unmarshals from JSON.
 func (s *stEnv) UnmarshalJSON(input []byte) error {
 	type stEnv struct {
-		Coinbase     *common.UnprefixedAddress `json:"currentCoinbase"   gencodec:"required"`
-		Difficulty   *math.HexOrDecimal256     `json:"currentDifficulty" gencodec:"optional"`
-		Random       *common.Hash              `json:"currentRandom,omitempty"     gencodec:"optional"`
-		GasLimit     *math.HexOrDecimal64      `json:"currentGasLimit"   gencodec:"required"`
-		Number       *math.HexOrDecimal64      `json:"currentNumber"     gencodec:"required"`
-		Timestamp    *math.HexOrDecimal64      `json:"currentTimestamp"  gencodec:"required"`
-		PreviousHash *common.Hash              `json:"previousHash"`
-		BaseFee      *math.HexOrDecimal256     `json:"currentBaseFee"`
+		Coinbase      *common.UnprefixedAddress `json:"currentCoinbase"   gencodec:"required"`
+		Difficulty    *math.HexOrDecimal256     `json:"currentDifficulty" gencodec:"optional"`
+		Random        *common.Hash              `json:"currentRandom,omitempty"     gencodec:"optional"`
+		GasLimit      *math.HexOrDecimal64      `json:"currentGasLimit"   gencodec:"required"`
+		Number        *math.HexOrDecimal64      `json:"currentNumber"     gencodec:"required"`
+		Timestamp     *math.HexOrDecimal64      `json:"currentTimestamp"  gencodec:"required"`
+		PreviousHash  *common.Hash              `json:"previousHash"`
+		BaseFee       *math.HexOrDecimal256     `json:"currentBaseFee"`
+		ExcessBlobGas *math.HexOrDecimal64      `json:"currentExcessBlobGas,omitempty"`
 	}
 	var dec stEnv
 	if err := json.Unmarshal(input, &dec); err != nil {
@@ -81,5 +84,8 @@ func (s *stEnv) UnmarshalJSON(input []byte) error {
 	if dec.BaseFee != nil {
 		s.BaseFee = (*big.Int)(dec.BaseFee)
 	}
+	if dec.ExcessBlobGas != nil {
+		s.ExcessBlobGas = (*uint64)(dec.ExcessBlobGas)
+	}
 	return nil
 }
@@ -0,0 +1,140 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"math/big"
+	"math/rand"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/holiman/goevmlab/ops"
+	"github.com/holiman/goevmlab/program"
+)
+
+// wordGasPrecompile is a precompile whose gas cost is base + perWord * words
+// of input.
+type wordGasPrecompile struct {
+	addr    int
+	base    int
+	perWord int
+}
+
+var wordGasPrecompiles = []wordGasPrecompile{
+	{2, 60, 12},   // sha256
+	{3, 600, 120}, // ripemd160
+	{4, 15, 3},    // identity
+}
+
+// wordBoundarySizes are the input sizes: zero, and around word boundaries.
+var wordBoundarySizes = []int{0, 1, 31, 32, 33, 63, 64, 65, 95, 96, 97, 256}
+
+// hashPrecompileMem is the size of the memory area which is filled with
+// random data, and used as input.
+const hashPrecompileMem = 512
+
+func fillHashPrecompiles(gst *GstMaker, fork string) {
+	dest := common.HexToAddress("0x0000000000000000000000000000000000ca1234")
+	gst.AddAccount(dest, GenesisAccount{
+		Code:    RandHashPrecompileCalls(fork),
+		Balance: new(big.Int),
+		Storage: make(map[common.Hash]common.Hash),
+	})
+	// The transaction
+	gst.SetTx(&StTransaction{
+		// 8M gaslimit
+		GasLimit:   []uint64{8000000},
+		Nonce:      0,
+		Value:      []string{randHex(4)},
+		Data:       []string{randHex(100)},
+		GasPrice:   big.NewInt(0x10),
+		To:         dest.Hex(),
+		Sender:     sender,
+		PrivateKey: pKey,
+	})
+}
+
+// RandHashPrecompileCalls creates code which calls the sha256, ripemd160 and
+// identity precompiles, with input sizes around word boundaries, and with
+// exactly the gas required, one less, or more. For identity, the output area
+// is smaller, larger or overlapping with the input. After each call, the
+// result, the returndata size, the first output word and the remaining gas
+// are stored. STATICCALL is used too, if available in the fork.
+func RandHashPrecompileCalls(fork string) []byte {
+	var (
+		p      = program.NewProgram()
+		calls  = 1 + rand.Intn(10)
+		forkOp = ops.LookupFork(fork)
+		static = forkOp == nil || forkOp.IsValid(ops.STATICCALL)
+	)
+	data := make([]byte, hashPrecompileMem)
+	_, _ = rand.Read(data)
+	p.Mstore(data, 0)
+	for i := 0; i < calls; i++ {
+		var (
+			pc       = wordGasPrecompiles[rand.Intn(len(wordGasPrecompiles))]
+			inSize   = wordBoundarySizes[rand.Intn(len(wordBoundarySizes))]
+			inOffset = rand.Intn(hashPrecompileMem - inSize + 1)
+			gas      = pc.base + pc.perWord*((inSize+31)/32)
+			outSize  = 32
+			outOff   = hashPrecompileMem + 32*i
+		)
+		switch rand.Intn(4) {
+		case 0: // exact
+		case 1:
+			gas--
+		case 2:
+			gas++
+		default:
+			gas += rand.Intn(10_000)
+		}
+		if pc.addr == 4 {
+			outSize = oneOf(0, inSize, inSize+32, inSize/2).(int)
+			if rand.Intn(3) == 0 {
+				// Overlapping with the input
+				outOff = inOffset + oneOf(0, 1, 16, 32).(int)
+			}
+		}
+		p.Push(outSize)
+		p.Push(outOff)
+		p.Push(inSize)
+		p.Push(inOffset)
+		if static && rand.Intn(2) == 0 {
+			p.Push(pc.addr)
+			p.Push(gas)
+			p.Op(ops.STATICCALL)
+		} else {
+			p.Push(0) // value
+			p.Push(pc.addr)
+			p.Push(gas)
+			p.Op(ops.CALL)
+		}
+		slot := 4 * i
+		p.Push(slot)
+		p.Op(ops.SSTORE)
+		p.Op(ops.RETURNDATASIZE)
+		p.Push(slot + 1)
+		p.Op(ops.SSTORE)
+		p.Push(outOff)
+		p.Op(ops.MLOAD)
+		p.Push(slot + 2)
+		p.Op(ops.SSTORE)
+		p.Op(ops.GAS)
+		p.Push(slot + 3)
+		p.Op(ops.SSTORE)
+	}
+	return p.Bytecode()
+}
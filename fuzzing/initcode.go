@@ -0,0 +1,98 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"math/big"
+	"math/rand"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/holiman/goevmlab/ops"
+	"github.com/holiman/goevmlab/program"
+)
+
+// initcodeSizes are the initcode sizes used: small ones, and the word
+// boundaries around the limit (EIP-3860).
+var initcodeSizes = []int{
+	0, 1, 31, 32, 33,
+	params.MaxInitCodeSize - 33, params.MaxInitCodeSize - 32, params.MaxInitCodeSize - 31,
+	params.MaxInitCodeSize - 1, params.MaxInitCodeSize, params.MaxInitCodeSize + 1,
+	params.MaxInitCodeSize + 31, params.MaxInitCodeSize + 32,
+}
+
+func fillInitcode(gst *GstMaker, fork string) {
+	// The initcode limit exists from Shanghai on
+	if !ops.LookupRules(fork).IsShanghai {
+		fork = "Shanghai"
+		gst.SetFork(fork)
+	}
+	dest := common.HexToAddress("0x00000000000000000000000000000000000c0de0")
+	gst.AddAccount(dest, GenesisAccount{
+		Code:    RandInitcodeCreates(),
+		Balance: big.NewInt(0xffff),
+		Storage: make(map[common.Hash]common.Hash),
+	})
+	// The transaction
+	gst.SetTx(&StTransaction{
+		// 8M gaslimit
+		GasLimit:   []uint64{8000000},
+		Nonce:      0,
+		Value:      []string{randHex(4)},
+		Data:       []string{randHex(100)},
+		GasPrice:   big.NewInt(0x10),
+		To:         dest.Hex(),
+		Sender:     sender,
+		PrivateKey: pKey,
+	})
+}
+
+// RandInitcodeCreates creates code which does a few CREATE/CREATE2 with
+// initcode sizes around the limit. The initcode is built in memory: a short
+// prefix which deploys a bit of code, followed by zeroes (STOP) up to the
+// size. The created address and the gas left are stored.
+func RandInitcodeCreates() []byte {
+	var (
+		p       = program.NewProgram()
+		creates = 1 + rand.Intn(4)
+	)
+	// The prefix, which returns 1 byte of code (0x00)
+	prefix := program.NewProgram()
+	prefix.Return(0, 1)
+	p.Mstore(prefix.Bytecode(), 0)
+	for i := 0; i < creates; i++ {
+		size := initcodeSizes[rand.Intn(len(initcodeSizes))]
+		if rand.Intn(2) == 0 {
+			p.Push(i) // salt
+			p.Push(size)
+			p.Push(0)
+			p.Push(rand.Intn(2)) // value
+			p.Op(ops.CREATE2)
+		} else {
+			p.Push(size)
+			p.Push(0)
+			p.Push(rand.Intn(2)) // value
+			p.Op(ops.CREATE)
+		}
+		p.Push(2 * i)
+		p.Op(ops.SSTORE)
+		p.Op(ops.GAS)
+		p.Push(2*i + 1)
+		p.Op(ops.SSTORE)
+	}
+	return p.Bytecode()
+}
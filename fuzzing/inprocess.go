@@ -0,0 +1,126 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/eth/tracers/logger"
+)
+
+// fuzzForks are the forks which can be selected by fuzzer-provided input.
+var fuzzForks = []string{"Berlin", "London", "Merge", "Shanghai", "Cancun"}
+
+// FromFuzzInput decodes fuzzer-provided bytes into a state test. The layout is:
+//
+//	byte 0:      fork selector
+//	byte 1:      calldata length
+//	bytes 2..:   calldata, followed by the code of the called contract
+//
+// Missing bytes are treated as zero, so any input yields a valid test.
+func FromFuzzInput(data []byte) *GstMaker {
+	var fork, dataLen int
+	if len(data) > 0 {
+		fork = int(data[0]) % len(fuzzForks)
+	}
+	if len(data) > 1 {
+		dataLen = int(data[1])
+	}
+	if len(data) > 2 {
+		data = data[2:]
+	} else {
+		data = nil
+	}
+	if dataLen > len(data) {
+		dataLen = len(data)
+	}
+	var (
+		callData = data[:dataLen]
+		code     = common.CopyBytes(data[dataLen:])
+		dest     = common.HexToAddress("0x00000000000000000000000000000000000f0220")
+		gst      = BasicStateTest(fuzzForks[fork])
+	)
+	gst.AddAccount(dest, GenesisAccount{
+		Code:    code,
+		Balance: new(big.Int),
+		Storage: make(map[common.Hash]common.Hash),
+	})
+	gst.SetTx(&StTransaction{
+		GasLimit:   []uint64{1_000_000},
+		Nonce:      0,
+		Value:      []string{"0x01"},
+		Data:       []string{hexutil.Encode(callData)},
+		GasPrice:   big.NewInt(0x10),
+		To:         dest.Hex(),
+		Sender:     sender,
+		PrivateKey: pKey,
+	})
+	return gst
+}
+
+// execute runs the test in-process using go-ethereum, with the given state
+// configuration, and returns the resulting state root and logs hash.
+func (g *GstMaker) execute(traceOutput io.Writer, snapshotter bool, scheme string) (root, logs common.Hash, err error) {
+	test, err := g.ToStateTest()
+	if err != nil {
+		return root, logs, err
+	}
+	subtest := test.Subtests()[0]
+	cfg := vm.Config{}
+	if traceOutput != nil {
+		cfg.Tracer = logger.NewJSONLogger(&logger.Config{}, traceOutput)
+	}
+	state, root, err := test.RunNoVerify(subtest, cfg, snapshotter, scheme)
+	if state.StateDB != nil {
+		defer state.Close()
+		logs = rlpHash(state.StateDB.Logs())
+	}
+	return root, logs, err
+}
+
+// CompareStateSchemes checks the consistency of the go-ethereum state backends.
+// It executes the test twice in-process: once with the hash-based trie
+// database and no tracing, and once with the path-based database, the
+// snapshot layer and a tracer attached. The two executions are expected to
+// agree on the outcome; an error is returned if they do not.
+//
+// This is NOT a cross-client EVM comparison. Go-ethereum is the only EVM
+// implementation available in-process, so both executions share its
+// interpreter, and a bug in its EVM semantics yields the same wrong result
+// twice. What it does detect is discrepancies between the state schemes, and
+// tracing altering the execution. Comparing EVM implementations takes the
+// external clients, as the generic-fuzzer runs them.
+func (g *GstMaker) CompareStateSchemes() error {
+	rootA, logsA, errA := g.execute(nil, false, rawdb.HashScheme)
+	rootB, logsB, errB := g.execute(io.Discard, true, rawdb.PathScheme)
+	if (errA == nil) != (errB == nil) {
+		return fmt.Errorf("error mismatch: %v != %v", errA, errB)
+	}
+	if rootA != rootB {
+		return fmt.Errorf("root mismatch: %x != %x", rootA, rootB)
+	}
+	if logsA != logsB {
+		return fmt.Errorf("logs mismatch: %x != %x", logsA, logsB)
+	}
+	return nil
+}
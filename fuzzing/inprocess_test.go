@@ -0,0 +1,86 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// FuzzStateTest decodes the fuzzer input into a state test, and checks that
+// go-ethereum executes it alike with the hash- and path-based state schemes.
+// It is not a cross-client EVM comparison: both executions are go-ethereum's,
+// see CompareStateSchemes.
+func FuzzStateTest(f *testing.F) {
+	// Seed the corpus with the code from the collected test cases
+	files, _ := filepath.Glob(filepath.Join("..", "evms", "testdata", "cases", "*.json"))
+	for _, file := range files {
+		gst, err := FromGeneralStateTest(file)
+		if err != nil {
+			continue
+		}
+		for _, test := range *gst {
+			if len(test.Tx.Data) == 0 {
+				continue
+			}
+			var (
+				code     = test.Pre[common.HexToAddress(test.Tx.To)].Code
+				callData = common.FromHex(test.Tx.Data[0])
+			)
+			if len(callData) > 255 {
+				callData = callData[:255]
+			}
+			// Cancun, followed by calldata and code
+			seed := append([]byte{4, byte(len(callData))}, callData...)
+			f.Add(append(seed, code...))
+		}
+	}
+	f.Add([]byte{})
+	f.Add([]byte{4, 0, 0x60, 0x01, 0x60, 0x00, 0x55}) // sstore(0, 1)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if err := FromFuzzInput(data).CompareStateSchemes(); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestFromFuzzInput(t *testing.T) {
+	for i, tc := range []struct {
+		input    []byte
+		fork     string
+		callData string
+		code     []byte
+	}{
+		{nil, "Berlin", "0x", []byte{}},
+		{[]byte{4}, "Cancun", "0x", []byte{}},
+		{[]byte{6, 2, 0xaa}, "London", "0xaa", []byte{}},
+		{[]byte{3, 1, 0xaa, 0x00}, "Shanghai", "0xaa", []byte{0x00}},
+	} {
+		gst := FromFuzzInput(tc.input)
+		if have := gst.forks[0]; have != tc.fork {
+			t.Errorf("test %d: wrong fork: have %v want %v", i, have, tc.fork)
+		}
+		if have := gst.tx.Data[0]; have != tc.callData {
+			t.Errorf("test %d: wrong calldata: have %v want %v", i, have, tc.callData)
+		}
+		if have := (*gst.pre)[gst.GetDestination()].Code; string(have) != string(tc.code) {
+			t.Errorf("test %d: wrong code: have %x want %x", i, have, tc.code)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"math/big"
+	"math/rand"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/holiman/goevmlab/ops"
+	"github.com/holiman/goevmlab/program"
+)
+
+func fillIntrinsicGas(gst *GstMaker, fork string) {
+	var (
+		dest     = common.HexToAddress("0x00000000000000000000000000000000000c0021")
+		rules    = ops.LookupRules(fork)
+		creation = rand.Intn(4) == 0
+		data     = randTxData()
+		acl      types.AccessList
+	)
+	// Code which only runs if there is gas left after the intrinsic cost
+	p := program.NewProgram()
+	p.Op(ops.GAS)
+	p.Push(0)
+	p.Op(ops.SSTORE)
+	gst.AddAccount(dest, GenesisAccount{
+		Code:    p.Bytecode(),
+		Balance: new(big.Int),
+		Storage: make(map[common.Hash]common.Hash),
+	})
+	tx := &StTransaction{
+		Nonce:      0,
+		Value:      []string{randHex(4)},
+		Data:       []string{hexutil.Encode(data)},
+		GasPrice:   big.NewInt(0x10),
+		To:         dest.Hex(),
+		Sender:     sender,
+		PrivateKey: pKey,
+	}
+	if creation {
+		tx.To = ""
+	}
+	// Access lists only exist from Berlin and onwards
+	if rules.IsBerlin && rand.Intn(2) == 0 {
+		acl = randAccessList([]common.Address{dest, gst.SenderAddress(), gst.env.Coinbase,
+			common.HexToAddress("0x00000000000000000000000000000000000c0022")})
+		tx.AccessLists = []*types.AccessList{&acl}
+	}
+	intrinsic, err := core.IntrinsicGas(data, acl, creation, rules.IsHomestead, rules.IsIstanbul, rules.IsShanghai)
+	if err != nil {
+		panic(err)
+	}
+	// Just below, at, and just above the intrinsic gas
+	tx.GasLimit = []uint64{intrinsic - 1 + uint64(rand.Intn(3))}
+	gst.SetTx(tx)
+}
+
+// randTxData returns transaction data of a random size, with a random mix of
+// zero and non-zero bytes, which contribute differently to the intrinsic gas.
+func randTxData() []byte {
+	data := make([]byte, oneOf(0, 1, 31, 32, 33, rand.Intn(1024)).(int))
+	_, _ = rand.Read(data)
+	zeroes := rand.Intn(3) // none, some, or all
+	for i := range data {
+		switch {
+		case zeroes == 2, zeroes == 1 && rand.Intn(2) == 0:
+			data[i] = 0
+		case data[i] == 0:
+			data[i] = 1
+		}
+	}
+	return data
+}
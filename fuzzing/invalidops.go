@@ -0,0 +1,138 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"math/big"
+	"math/rand"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/holiman/goevmlab/ops"
+	"github.com/holiman/goevmlab/program"
+)
+
+var invalidOpsInner = common.HexToAddress("0x00000000000000000000000000000000000bad01")
+
+func fillInvalidOps(gst *GstMaker, fork string) {
+	dest := common.HexToAddress("0x00000000000000000000000000000000000bad00")
+	op, fork := randInvalidOp(fork)
+	// The opcode might be defined in the requested fork, but not in the one
+	// we flip to.
+	gst.SetFork(fork)
+	gst.AddTag(op.String())
+	gst.AddTag(fork)
+	// The inner contract executes the opcode
+	gst.AddAccount(invalidOpsInner, GenesisAccount{
+		Code:    InvalidOpCode(op),
+		Balance: new(big.Int),
+		Storage: make(map[common.Hash]common.Hash),
+	})
+	// The outer contract calls it, and records the outcome
+	gst.AddAccount(dest, GenesisAccount{
+		Code:    callInvalidOp(invalidOpsInner),
+		Balance: new(big.Int),
+		Storage: make(map[common.Hash]common.Hash),
+	})
+	// The transaction goes to either of them
+	to := dest
+	if rand.Intn(4) == 0 {
+		to = invalidOpsInner
+	}
+	gst.SetTx(&StTransaction{
+		// 8M gaslimit
+		GasLimit:   []uint64{8000000},
+		Nonce:      0,
+		Value:      []string{randHex(4)},
+		Data:       []string{randHex(100)},
+		GasPrice:   big.NewInt(0x10),
+		To:         to.Hex(),
+		Sender:     sender,
+		PrivateKey: pKey,
+	})
+}
+
+// randInvalidOp returns an opcode and a fork in which it is undefined. It is
+// either an opcode which is undefined in the given fork, or one which was
+// added in some later fork. In the latter case, the returned fork is the one
+// preceding the activation, if the given fork already has it.
+func randInvalidOp(fork string) (ops.OpCode, string) {
+	var (
+		names = ops.ForkNames()
+		first = ops.LookupFork(names[0])
+		last  = ops.LookupFork(names[len(names)-1])
+		added []ops.OpCode
+		never []ops.OpCode
+	)
+	for i := 0; i < 256; i++ {
+		op := ops.OpCode(i)
+		switch {
+		case !last.IsValid(op):
+			never = append(never, op)
+		case !first.IsValid(op):
+			added = append(added, op)
+		}
+	}
+	if rand.Intn(2) == 0 {
+		return never[rand.Intn(len(never))], fork
+	}
+	op := added[rand.Intn(len(added))]
+	if f := ops.LookupFork(fork); f != nil && !f.IsValid(op) {
+		return op, fork
+	}
+	// Flip to the fork just before the activation
+	for i := len(names) - 1; i >= 0; i-- {
+		if !ops.LookupFork(names[i]).IsValid(op) {
+			return op, names[i]
+		}
+	}
+	return op, names[0]
+}
+
+// InvalidOpCode returns code which changes some storage, and then executes
+// the given opcode, with some items on the stack in case the opcode is defined
+// after all. The storage change, and the one after the opcode, should be
+// reverted.
+func InvalidOpCode(op ops.OpCode) []byte {
+	p := program.NewProgram()
+	p.Sstore(1, 1)
+	for i := rand.Intn(4); i > 0; i-- {
+		p.Push(rand.Intn(64))
+	}
+	p.Op(op)
+	p.Sstore(2, 2)
+	return p.Bytecode()
+}
+
+// callInvalidOp returns code which calls the given address with various
+// amounts of gas, and stores the success flag and the gas left afterwards.
+// All gas given to the call should be consumed.
+func callInvalidOp(addr common.Address) []byte {
+	p := program.NewProgram()
+	for i := 0; i < 1+rand.Intn(3); i++ {
+		gas := big.NewInt(int64(oneOf(0, 100, 30_000, 100_000).(int)))
+		if rand.Intn(4) == 0 {
+			gas = nil
+		}
+		p.Call(gas, addr, 0, 0, 0, 0, 0)
+		p.Push(i)
+		p.Op(ops.SSTORE)
+		p.Op(ops.GAS)
+		p.Push(0x10 + i)
+		p.Op(ops.SSTORE)
+	}
+	return p.Bytecode()
+}
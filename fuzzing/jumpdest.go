@@ -0,0 +1,196 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"math/big"
+	"math/rand"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/holiman/goevmlab/ops"
+	"github.com/holiman/goevmlab/program"
+)
+
+var (
+	jumpAddr  = common.HexToAddress("0x00000000000000000000000000000000000d5b01")
+	jumpiAddr = common.HexToAddress("0x00000000000000000000000000000000000d5b02")
+)
+
+func fillJumpdest(gst *GstMaker, fork string) {
+	dest := common.HexToAddress("0x00000000000000000000000000000000000d5b00")
+	// The inner contracts, which jump to the target given in calldata
+	var (
+		codes = map[common.Address][]byte{
+			jumpAddr:  JumpdestCode(ops.JUMP),
+			jumpiAddr: JumpdestCode(ops.JUMPI),
+		}
+		addrs = []common.Address{jumpAddr, jumpiAddr}
+	)
+	for _, addr := range addrs {
+		gst.AddAccount(addr, GenesisAccount{
+			Code:    codes[addr],
+			Balance: new(big.Int),
+			Storage: make(map[common.Hash]common.Hash),
+		})
+	}
+	// The outer contract, which calls them with various targets
+	var (
+		p     = program.NewProgram()
+		calls = 1 + rand.Intn(8)
+	)
+	for i := 0; i < calls; i++ {
+		addr := addrs[rand.Intn(len(addrs))]
+		p.Mstore(common.BigToHash(RandJumpTarget(codes[addr])).Bytes(), 0)
+		p.Mstore(common.BigToHash(big.NewInt(int64(oneOf(0, 1, 1, 2).(int)))).Bytes(), 32)
+		p.Call(big.NewInt(100_000), addr, 0, 0, 64, 0, 0)
+		p.Push(i)
+		p.Op(ops.SSTORE)
+	}
+	gst.AddAccount(dest, GenesisAccount{
+		Code:    p.Bytecode(),
+		Balance: new(big.Int),
+		Storage: make(map[common.Hash]common.Hash),
+	})
+	// The transaction
+	gst.SetTx(&StTransaction{
+		// 8M gaslimit
+		GasLimit:   []uint64{8000000},
+		Nonce:      0,
+		Value:      []string{randHex(4)},
+		Data:       []string{randHex(100)},
+		GasPrice:   big.NewInt(0x10),
+		To:         dest.Hex(),
+		Sender:     sender,
+		PrivateKey: pKey,
+	})
+}
+
+// jumpdestMarker adds a JUMPDEST, followed by code which records in storage
+// that it was reached, and stops.
+func jumpdestMarker(p *program.Program) {
+	p.Op(ops.JUMPDEST)
+	p.Op(ops.PC)
+	p.Op(ops.DUP1)
+	p.Op(ops.SSTORE)
+	p.Op(ops.STOP)
+}
+
+// JumpdestCode creates code which jumps, using the given op (JUMP or JUMPI),
+// to the target given in the first word of calldata. For JUMPI, the second
+// word is the condition. The rest of the code is a random mix of JUMPDESTs
+// and push instructions whose immediate data contain 0x5b (JUMPDEST) bytes.
+// The code may end with a JUMPDEST, or with a truncated push.
+func JumpdestCode(op ops.OpCode) []byte {
+	p := program.NewProgram()
+	p.Push(32)
+	p.Op(ops.CALLDATALOAD) // condition
+	p.Push(0)
+	p.Op(ops.CALLDATALOAD) // target
+	p.Op(op)
+	// Not jumping (JUMPI) ends up here
+	p.Op(ops.PC)
+	p.Op(ops.DUP1)
+	p.Op(ops.SSTORE)
+	p.Op(ops.STOP)
+	segments := 2 + rand.Intn(8)
+	for i := 0; i < segments; i++ {
+		switch rand.Intn(3) {
+		case 0:
+			jumpdestMarker(p)
+		case 1:
+			p.AddAll(pushWithJumpdests(1 + rand.Intn(32)))
+			p.Op(ops.POP)
+		default:
+			p.Op(ops.CALLVALUE)
+			p.Op(ops.POP)
+		}
+	}
+	switch rand.Intn(3) {
+	case 0: // A JUMPDEST as the very last byte
+		p.Op(ops.JUMPDEST)
+	case 1: // A push, whose data is cut short by the end of the code
+		data := pushWithJumpdests(2 + rand.Intn(31))
+		p.AddAll(data[:1+rand.Intn(len(data)-1)])
+	}
+	return p.Bytecode()
+}
+
+// pushWithJumpdests returns a push instruction with size bytes of immediate
+// data, some of which are 0x5b.
+func pushWithJumpdests(size int) []byte {
+	code := make([]byte, 1+size)
+	code[0] = byte(ops.PUSH1) + byte(size-1)
+	rand.Read(code[1:])
+	for i := 1; i < len(code); i++ {
+		if rand.Intn(2) == 0 {
+			code[i] = byte(ops.JUMPDEST)
+		}
+	}
+	return code
+}
+
+// jumpdestAnalysis returns the valid jump destinations in the code, and the
+// offsets of the 0x5b bytes in push data (which are not valid destinations).
+func jumpdestAnalysis(code []byte) (valid, inPush []uint64) {
+	for pc := uint64(0); pc < uint64(len(code)); pc++ {
+		op := ops.OpCode(code[pc])
+		if op == ops.JUMPDEST {
+			valid = append(valid, pc)
+			continue
+		}
+		if !op.IsPush() {
+			continue
+		}
+		end := pc + uint64(op-ops.PUSH1) + 1
+		for pc < end && pc+1 < uint64(len(code)) {
+			pc++
+			if code[pc] == byte(ops.JUMPDEST) {
+				inPush = append(inPush, pc)
+			}
+		}
+	}
+	return valid, inPush
+}
+
+// RandJumpTarget returns a jump target for the given code: a valid JUMPDEST,
+// a 0x5b byte in push data, some other offset, the code boundaries, or an
+// offset which is out of bounds (possibly only when truncated to 64 bits).
+func RandJumpTarget(code []byte) *big.Int {
+	valid, inPush := jumpdestAnalysis(code)
+	switch rand.Intn(6) {
+	case 0, 1:
+		if len(valid) > 0 {
+			return new(big.Int).SetUint64(valid[rand.Intn(len(valid))])
+		}
+	case 2:
+		if len(inPush) > 0 {
+			return new(big.Int).SetUint64(inPush[rand.Intn(len(inPush))])
+		}
+	case 3:
+		return big.NewInt(int64(oneOf(len(code)-1, len(code), len(code)+1).(int)))
+	case 4:
+		target := asBig(oneOf("0x100000000", "0xffffffffffffffff", "0x10000000000000000",
+			"0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff").(string))
+		if len(valid) > 0 && rand.Intn(2) == 0 {
+			// A valid destination in the lower 64 bits
+			target.Lsh(big.NewInt(1), 64)
+			target.Add(target, new(big.Int).SetUint64(valid[rand.Intn(len(valid))]))
+		}
+		return target
+	}
+	return big.NewInt(int64(rand.Intn(len(code))))
+}
@@ -0,0 +1,100 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"math/big"
+	"math/rand"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/holiman/goevmlab/ops"
+	"github.com/holiman/goevmlab/program"
+)
+
+// keccakSizes are the sizes hashed by KECCAK256: around the word size, and
+// large sizes which cause expensive memory expansion or run out of gas.
+var keccakSizes = []string{
+	"0x0", "0x1", "0x1f", "0x20", "0x21", "0x40", "0x400",
+	"0x10000", "0x100000", "0xffffffff", "0xffffffffffffffff",
+}
+
+// keccakOffsets are the offsets of the hashed region: inside the current
+// memory, just past it, and far away.
+var keccakOffsets = []string{
+	"0x0", "0x1", "0x1f", "0x20", "0x60", "0x1000",
+	"0xffffffff", "0xffffffffffffffff",
+	"0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff",
+}
+
+func fillKeccak(gst *GstMaker, fork string) {
+	dest := common.HexToAddress("0x00000000000000000000000000000000000ec000")
+	gst.AddAccount(dest, GenesisAccount{
+		Code:    RandKeccak(),
+		Balance: new(big.Int),
+		Storage: make(map[common.Hash]common.Hash),
+	})
+	// The transaction
+	gst.SetTx(&StTransaction{
+		// 8M gaslimit
+		GasLimit:   []uint64{8000000},
+		Nonce:      0,
+		Value:      []string{randHex(4)},
+		Data:       []string{randHex(100)},
+		GasPrice:   big.NewInt(0x10),
+		To:         dest.Hex(),
+		Sender:     sender,
+		PrivateKey: pKey,
+	})
+}
+
+// RandKeccak creates code which puts some data in memory, and then hashes
+// a few regions of memory, storing the hash, the memory size and the gas left
+// after each. The regions are often zero-sized, past the current memory, or
+// large enough to run out of gas.
+func RandKeccak() []byte {
+	var (
+		p      = program.NewProgram()
+		hashes = 1 + rand.Intn(5)
+	)
+	if rand.Intn(2) == 0 {
+		p.Mstore(common.FromHex(randHex(96)), 0)
+	}
+	for i := 0; i < hashes; i++ {
+		var (
+			size   = asBig(keccakSizes[rand.Intn(len(keccakSizes))])
+			offset = asBig(keccakOffsets[rand.Intn(len(keccakOffsets))])
+		)
+		if rand.Intn(4) == 0 {
+			// Hash right at the end of the current memory
+			p.Push(size)
+			p.Op(ops.MSIZE)
+		} else {
+			p.Push(size)
+			p.Push(offset)
+		}
+		p.Op(ops.KECCAK256)
+		p.Push(3 * i)
+		p.Op(ops.SSTORE)
+		p.Op(ops.MSIZE)
+		p.Push(3*i + 1)
+		p.Op(ops.SSTORE)
+		p.Op(ops.GAS)
+		p.Push(3*i + 2)
+		p.Op(ops.SSTORE)
+	}
+	return p.Bytecode()
+}
@@ -0,0 +1,95 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"math/big"
+	"math/rand"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/holiman/goevmlab/ops"
+	"github.com/holiman/goevmlab/program"
+)
+
+func fillLogs(gst *GstMaker, fork string) {
+	dest := common.HexToAddress("0x0000000000000000000000000000000000010600")
+	gst.AddAccount(dest, GenesisAccount{
+		Code:    RandLogs(),
+		Balance: new(big.Int),
+		Storage: make(map[common.Hash]common.Hash),
+	})
+	// The transaction
+	gst.SetTx(&StTransaction{
+		// 8M gaslimit
+		GasLimit:   []uint64{8000000},
+		Nonce:      0,
+		Value:      []string{randHex(4)},
+		Data:       []string{randHex(100)},
+		GasPrice:   big.NewInt(0x10),
+		To:         dest.Hex(),
+		Sender:     sender,
+		PrivateKey: pKey,
+	})
+}
+
+// RandLogs creates code which emits logs, LOG0 through LOG4, with random
+// topics, and data of varying size, from empty to large enough to expand
+// the memory considerably. Now and then the gas left is stored, so that gas
+// differences show up in the state.
+func RandLogs() []byte {
+	var (
+		p    = program.NewProgram()
+		logs = 1 + rand.Intn(20)
+		data = make([]byte, 64+rand.Intn(64))
+	)
+	_, _ = rand.Read(data)
+	p.Mstore(data, 0)
+	for i := 0; i < logs; i++ {
+		var (
+			topics = rand.Intn(5)
+			offset = oneOf(0, rand.Intn(len(data)), rand.Intn(0x1000), rand.Intn(0x10000)).(int)
+			size   = oneOf(0, 32, rand.Intn(len(data)), rand.Intn(0x1000), rand.Intn(0x10000)).(int)
+		)
+		for j := 0; j < topics; j++ {
+			p.Push(randLogTopic())
+		}
+		p.Push(size)
+		p.Push(offset)
+		p.Op(ops.LOG0 + ops.OpCode(topics))
+		if rand.Intn(3) == 0 {
+			p.Op(ops.GAS)
+			p.Push(i)
+			p.Op(ops.SSTORE)
+		}
+	}
+	return p.Bytecode()
+}
+
+// randLogTopic returns a random topic, which may also be all zeroes or ones.
+func randLogTopic() []byte {
+	topic := make([]byte, 32)
+	switch rand.Intn(4) {
+	case 0:
+	case 1:
+		for i := range topic {
+			topic[i] = 0xff
+		}
+	default:
+		_, _ = rand.Read(topic)
+	}
+	return topic
+}
@@ -0,0 +1,153 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"math/big"
+	"math/rand"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/holiman/goevmlab/ops"
+	"github.com/holiman/goevmlab/program"
+)
+
+// mcopySizes are the sizes copied: word boundaries, and zero.
+var mcopySizes = []int{0, 1, 2, 31, 32, 33, 63, 64, 65, 96, 256}
+
+// mcopyPattern is the size of the memory area which is initialized with a
+// pattern of distinct bytes, so that the effect of the copies is visible.
+const mcopyPattern = 256
+
+func fillMcopy(gst *GstMaker, fork string) {
+	// MCOPY exists from Cancun on
+	if !ops.LookupRules(fork).IsCancun {
+		fork = "Cancun"
+		gst.SetFork(fork)
+	}
+	dest := common.HexToAddress("0x00000000000000000000000000000000000c0be0")
+	gst.AddAccount(dest, GenesisAccount{
+		Code:    RandMcopy(),
+		Balance: new(big.Int),
+		Storage: make(map[common.Hash]common.Hash),
+	})
+	// The transaction
+	gst.SetTx(&StTransaction{
+		// 8M gaslimit
+		GasLimit:   []uint64{8000000},
+		Nonce:      0,
+		Value:      []string{randHex(4)},
+		Data:       []string{randHex(100)},
+		GasPrice:   big.NewInt(0x10),
+		To:         dest.Hex(),
+		Sender:     sender,
+		PrivateKey: pKey,
+	})
+}
+
+// pushArg pushes the value, using PUSH0 for zero most of the time.
+func pushArg(p *program.Program, v interface{}) {
+	if n, ok := v.(int); ok && n == 0 && rand.Intn(4) != 0 {
+		p.Push0()
+		return
+	}
+	p.Push(v)
+}
+
+// RandMcopy creates code which fills memory with a pattern, and then does a
+// number of MCOPY with overlapping (in either direction), identical, and
+// adjacent source and destination ranges, of various sizes. After each copy,
+// a hash of the memory is stored. PUSH0 is used for the zero arguments, and
+// now and then in other stack contexts.
+func RandMcopy() []byte {
+	var (
+		p      = program.NewProgram()
+		copies = 1 + rand.Intn(8)
+	)
+	pattern := make([]byte, mcopyPattern)
+	for i := range pattern {
+		pattern[i] = byte(i + 1)
+	}
+	p.Mstore(pattern, 0)
+	for i := 0; i < copies; i++ {
+		var (
+			size  = mcopySizes[rand.Intn(len(mcopySizes))]
+			src   = oneOf(0, 0, 1, 31, 32, 100).(int)
+			dst   int
+			delta = oneOf(1, 2, 31, 32, 33).(int)
+		)
+		var srcArg, dstArg interface{}
+		switch rand.Intn(7) {
+		case 0: // Overlapping, destination after source
+			dst = src + delta
+		case 1: // Overlapping, destination before source
+			src += delta
+			dst = src - delta
+		case 2: // Identical
+			dst = src
+		case 3: // Adjacent
+			dst = src + size
+		case 4: // Adjacent, destination before source
+			dst = src
+			src += size
+		case 5: // Far away, expanding memory
+			dst = 1024 + rand.Intn(64)
+		default: // Zero size, huge offsets do not expand memory
+			size = 0
+			dstArg = asBig(oneOf("0xffffffff", "0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff").(string))
+			srcArg = asBig(oneOf("0xffffffff", "0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff").(string))
+		}
+		if dstArg == nil {
+			dstArg, srcArg = dst, src
+		}
+		pushArg(p, size)
+		pushArg(p, srcArg)
+		pushArg(p, dstArg)
+		p.Op(ops.MCOPY)
+		// Store a hash of the memory, and its size
+		p.Op(ops.MSIZE)
+		pushArg(p, 0)
+		p.Op(ops.KECCAK256)
+		p.Push(2 * i)
+		p.Op(ops.SSTORE)
+		p.Op(ops.MSIZE)
+		p.Push(2*i + 1)
+		p.Op(ops.SSTORE)
+	}
+	// PUSH0 in a few other contexts: arithmetic, dup/swap, and as a stack filler
+	for i := 0; i < rand.Intn(4); i++ {
+		switch rand.Intn(3) {
+		case 0:
+			p.Push0()
+			p.Push(oneOf(0, 1, 7).(int))
+			p.Op(oneOf(ops.ADD, ops.SUB, ops.DIV, ops.EXP, ops.ISZERO).(ops.OpCode))
+		case 1:
+			p.Push0()
+			p.Op(ops.DUP1)
+			p.Op(ops.SWAP1)
+			p.Op(ops.EQ)
+		default:
+			n := 1 + rand.Intn(16)
+			for j := 0; j < n; j++ {
+				p.Push0()
+			}
+			p.Op(ops.OpCode(byte(ops.DUP1) + byte(n-1)))
+		}
+		p.Push(0x100 + i)
+		p.Op(ops.SSTORE)
+	}
+	return p.Bytecode()
+}
@@ -0,0 +1,137 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"math/big"
+	"math/rand"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/holiman/goevmlab/ops"
+	"github.com/holiman/goevmlab/program"
+)
+
+func fillMemBoundary(gst *GstMaker, fork string) {
+	var (
+		dest     = common.HexToAddress("0x00000000000000000000000000000000003e4000")
+		p        = program.NewProgram()
+		children = 1 + rand.Intn(4)
+	)
+	// The children probe the memory boundary, and may run out of gas doing
+	// so. The outer contract calls them with various amounts of gas, and
+	// stores the outcome and the remaining gas.
+	for i := 0; i < children; i++ {
+		child := common.BigToAddress(new(big.Int).Add(dest.Big(), big.NewInt(int64(i+1))))
+		gst.AddAccount(child, GenesisAccount{
+			Code:    RandMemBoundary(),
+			Balance: new(big.Int),
+			Storage: make(map[common.Hash]common.Hash),
+		})
+		gas := big.NewInt(int64(oneOf(10_000, 50_000, 500_000, 3_000_000).(int)))
+		p.Call(gas, child, 0, 0, 0, 0, 0)
+		p.Push(2 * i)
+		p.Op(ops.SSTORE)
+		p.Op(ops.GAS)
+		p.Push(2*i + 1)
+		p.Op(ops.SSTORE)
+	}
+	gst.AddAccount(dest, GenesisAccount{
+		Code:    p.Bytecode(),
+		Balance: new(big.Int),
+		Storage: make(map[common.Hash]common.Hash),
+	})
+	// The transaction
+	gst.SetTx(&StTransaction{
+		// 8M gaslimit
+		GasLimit:   []uint64{8000000},
+		Nonce:      0,
+		Value:      []string{randHex(4)},
+		Data:       []string{randHex(100)},
+		GasPrice:   big.NewInt(0x10),
+		To:         dest.Hex(),
+		Sender:     sender,
+		PrivateKey: pKey,
+	})
+}
+
+// pushMemBoundaryOffset adds code which pushes an offset relative to the
+// current memory size: within the allocated memory, straddling its end, just
+// past it, or far past it.
+func pushMemBoundaryOffset(p *program.Program) {
+	if rand.Intn(5) == 0 {
+		// Far past the allocation, forcing a large expansion
+		p.Push(asBig(oneOf("0x10000", "0x100000", "0x1000000", "0xffffffe0", "0xffffffffffffffff").(string)))
+		p.Op(ops.MSIZE)
+		p.Op(ops.ADD)
+		return
+	}
+	delta := oneOf(-64, -33, -32, -31, -1, 0, 0, 1, 31, 32, 33).(int)
+	if delta < 0 {
+		p.Push(-delta)
+		p.Op(ops.MSIZE)
+		p.Op(ops.SUB)
+		return
+	}
+	p.Op(ops.MSIZE)
+	if delta > 0 {
+		p.Push(delta)
+		p.Op(ops.ADD)
+	}
+}
+
+// RandMemBoundary creates code which interleaves MLOAD, MSTORE and MSTORE8 at
+// offsets around the end of the allocated memory (as given by MSIZE), so that
+// some accesses are within the allocation, and others expand it by a word or
+// two, or by a lot. The values read, which are zero for memory never written
+// to, the memory size and the remaining gas are stored after each access.
+func RandMemBoundary() []byte {
+	var (
+		p    = program.NewProgram()
+		n    = 4 + rand.Intn(13)
+		slot = 0
+	)
+	// Allocate some memory to begin with
+	p.Mstore(common.BigToHash(big.NewInt(int64(1+rand.Intn(0xff)))).Bytes(), uint32(32*rand.Intn(8)))
+	for i := 0; i < n; i++ {
+		switch rand.Intn(3) {
+		case 0:
+			pushMemBoundaryOffset(p)
+			p.Op(ops.MLOAD)
+			p.Push(slot)
+			p.Op(ops.SSTORE)
+			slot++
+		case 1:
+			p.Push(rand.Intn(256))
+			pushMemBoundaryOffset(p)
+			p.Op(ops.MSTORE8)
+		default:
+			value := make([]byte, 1+rand.Intn(32))
+			rand.Read(value)
+			p.Push(value)
+			pushMemBoundaryOffset(p)
+			p.Op(ops.MSTORE)
+		}
+		p.Op(ops.MSIZE)
+		p.Push(slot)
+		p.Op(ops.SSTORE)
+		p.Op(ops.GAS)
+		p.Push(slot + 1)
+		p.Op(ops.SSTORE)
+		slot += 2
+	}
+	return p.Bytecode()
+}
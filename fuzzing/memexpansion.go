@@ -0,0 +1,167 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"math/big"
+	"math/rand"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/holiman/goevmlab/ops"
+	"github.com/holiman/goevmlab/program"
+)
+
+// memQuadBoundary is the memory size, in bytes, where the quadratic part of
+// the expansion cost (words^2 / 512) overtakes the linear part (3 * words).
+const memQuadBoundary = 1536 * 32
+
+// memExpansionOps are the ops which expand memory, and are used by the
+// memory expansion generator.
+var memExpansionOps = []ops.OpCode{
+	ops.MLOAD, ops.MSTORE, ops.MSTORE8, ops.CALLDATACOPY, ops.CODECOPY,
+	ops.EXTCODECOPY, ops.RETURNDATACOPY, ops.KECCAK256, ops.MCOPY,
+}
+
+func fillMemExpansion(gst *GstMaker, fork string) {
+	var (
+		dest     = common.HexToAddress("0x00000000000000000000000000000000003e3000")
+		p        = program.NewProgram()
+		children = 1 + rand.Intn(6)
+	)
+	// The children each expand memory, and may run out of gas doing so. The
+	// outer contract calls them with various amounts of gas, and stores the
+	// outcome and the remaining gas.
+	for i := 0; i < children; i++ {
+		child := common.BigToAddress(new(big.Int).Add(dest.Big(), big.NewInt(int64(i+1))))
+		gst.AddAccount(child, GenesisAccount{
+			Code:    RandMemExpansion(fork),
+			Balance: new(big.Int),
+			Storage: make(map[common.Hash]common.Hash),
+		})
+		gas := big.NewInt(int64(oneOf(30_000, 200_000, 1_000_000, 3_000_000).(int)))
+		p.Call(gas, child, 0, 0, 0, 0, 0)
+		p.Push(2 * i)
+		p.Op(ops.SSTORE)
+		p.Op(ops.GAS)
+		p.Push(2*i + 1)
+		p.Op(ops.SSTORE)
+	}
+	gst.AddAccount(dest, GenesisAccount{
+		Code:    p.Bytecode(),
+		Balance: new(big.Int),
+		Storage: make(map[common.Hash]common.Hash),
+	})
+	// The transaction
+	gst.SetTx(&StTransaction{
+		// 8M gaslimit
+		GasLimit:   []uint64{8000000},
+		Nonce:      0,
+		Value:      []string{randHex(4)},
+		Data:       []string{randHex(100)},
+		GasPrice:   big.NewInt(0x10),
+		To:         dest.Hex(),
+		Sender:     sender,
+		PrivateKey: pKey,
+	})
+}
+
+// randMemOffset returns a memory offset: small, around the quadratic boundary,
+// large but possibly affordable, or so large that expansion must run out of
+// gas (including values which overflow 32 and 64 bits).
+func randMemOffset() *big.Int {
+	switch rand.Intn(5) {
+	case 0:
+		return big.NewInt(int64(rand.Intn(1024)))
+	case 1, 2:
+		return big.NewInt(int64(memQuadBoundary + 32*(rand.Intn(9)-4) + oneOf(0, 0, 1, 31).(int)))
+	case 3:
+		return big.NewInt(int64(32 * rand.Intn(40_000)))
+	}
+	return asBig(oneOf("0x400000", "0xffffffe0", "0xffffffff", "0x1fffffffe0", "0xffffffffffffffff",
+		"0x10000000000000000", "0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff").(string))
+}
+
+// randMemSize returns the size of a memory area. Areas of size zero do not
+// expand memory, regardless of the offset.
+func randMemSize() *big.Int {
+	if rand.Intn(3) == 0 {
+		return randMemOffset()
+	}
+	return big.NewInt(int64(oneOf(0, 0, 1, 31, 32, 33, 1024).(int)))
+}
+
+// RandMemExpansion creates code which expands memory a few times, using the
+// ops which touch memory, with offsets spanning the boundary where the cost
+// becomes quadratic, and beyond. After each op, the memory size and the
+// remaining gas are stored.
+func RandMemExpansion(fork string) []byte {
+	var (
+		p      = program.NewProgram()
+		n      = 1 + rand.Intn(4)
+		forkOp = ops.LookupFork(fork)
+	)
+	for i := 0; i < n; i++ {
+		op := memExpansionOps[rand.Intn(len(memExpansionOps))]
+		if forkOp != nil && !forkOp.IsValid(op) {
+			op = ops.MSTORE
+		}
+		switch op {
+		case ops.MLOAD:
+			p.Push(randMemOffset())
+			p.Op(op)
+			p.Op(ops.POP)
+		case ops.MSTORE, ops.MSTORE8:
+			p.Push(rand.Intn(256))
+			p.Push(randMemOffset())
+			p.Op(op)
+		case ops.CALLDATACOPY, ops.CODECOPY:
+			p.Push(randMemSize())
+			p.Push(rand.Intn(64))
+			p.Push(randMemOffset())
+			p.Op(op)
+		case ops.EXTCODECOPY:
+			p.Push(randMemSize())
+			p.Push(rand.Intn(64))
+			p.Push(randMemOffset())
+			p.Op(ops.ADDRESS)
+			p.Op(op)
+		case ops.RETURNDATACOPY:
+			// The returndata is empty, anything but size zero fails
+			p.Push(0)
+			p.Push(0)
+			p.Push(randMemOffset())
+			p.Op(op)
+		case ops.KECCAK256:
+			p.Push(randMemSize())
+			p.Push(randMemOffset())
+			p.Op(op)
+			p.Op(ops.POP)
+		case ops.MCOPY:
+			p.Push(randMemSize())
+			p.Push(randMemOffset())
+			p.Push(randMemOffset())
+			p.Op(op)
+		}
+		p.Op(ops.MSIZE)
+		p.Push(2 * i)
+		p.Op(ops.SSTORE)
+		p.Op(ops.GAS)
+		p.Push(2*i + 1)
+		p.Op(ops.SSTORE)
+	}
+	return p.Bytecode()
+}
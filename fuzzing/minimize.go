@@ -0,0 +1,207 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// An Oracle executes the test at the given path, and reports whether the
+// clients agree on it.
+type Oracle func(path string) (bool, error)
+
+// ErrNoDivergence is returned by Minimize if the clients agree on the input test.
+var ErrNoDivergence = errors.New("no consensus failure -- the input statetest needs to be a test which produces a difference")
+
+// Minimize tries to shrink the state test at the given path, while keeping
+// the clients in disagreement: it lowers the gas, removes accounts, cuts code
+// and removes storage slots. Each change is kept only if the oracle still
+// reports a disagreement. The smallest failing test found so far is written
+// to '<path>.min', which is returned. If the context is cancelled, e.g. due
+// to a time budget, the minimization stops early. If no change could be made,
+// the returned path is the input path.
+func Minimize(ctx context.Context, testPath string, oracle Oracle) (string, error) {
+	if agree, err := oracle(testPath); err != nil {
+		return "", err
+	} else if agree {
+		return "", ErrNoDivergence
+	}
+	var (
+		gst      GeneralStateTest
+		testname string
+		good     = fmt.Sprintf("%v.min", testPath)
+		out      = fmt.Sprintf("%v.%v", testPath, "tmp")
+		improved bool
+		failure  error
+	)
+	defer os.Remove(out)
+	if gstPtr, err := FromGeneralStateTest(testPath); err != nil {
+		return "", err
+	} else {
+		gst = (*gstPtr)
+		for t := range gst {
+			testname = t
+			break
+		}
+	}
+	// inConsensus returns true if the clients agree on the current test, or
+	// if the test could not be executed, in which case the change is reverted.
+	var inConsensus = func() bool {
+		if failure != nil || ctx.Err() != nil {
+			return true
+		}
+		data, _ := json.MarshalIndent(gst, "", "  ")
+		if err := os.WriteFile(out, data, 0777); err != nil {
+			failure = err
+			return true
+		}
+		allAgree, err := oracle(out)
+		if err != nil {
+			failure = err
+			return true
+		}
+		if !allAgree {
+			log.Info("Change ok")
+			if err := os.WriteFile(good, data, 0777); err != nil {
+				failure = err
+				return true
+			}
+			improved = true
+		} else {
+			log.Info("Bad change, clients in consensus - reverting")
+		}
+		return allAgree
+	}
+
+	// Try decreasing gas
+	gas := sort.Search(int(gst[testname].Tx.GasLimit[0]), func(i int) bool {
+		gst[testname].Tx.GasLimit[0] = uint64(i)
+		log.Info("Mutating gas", "value", i)
+		return !inConsensus()
+	})
+	// And restore the gas again
+	gst[testname].Tx.GasLimit[0] = uint64(gas)
+
+	// Try removing accounts
+	for target, acc := range gst[testname].Pre {
+		delete(gst[testname].Pre, target)
+		log.Info("Removing account", "target", target)
+		if !inConsensus() {
+			continue
+		}
+		log.Info("Restoring", "target", target)
+		gst[testname].Pre[target] = acc
+	}
+	// Try reducing code the naive way
+	for target, acc := range gst[testname].Pre {
+		if len(acc.Code) == 0 {
+			continue
+		}
+		log.Info("Reducing code #1", "target", target)
+		code := acc.Code
+		m := naiveCodeMutator{current: code, lastGood: code}
+		// Alright, we're in business
+		fails := 0
+		for {
+			if exhausted := m.proceed(); exhausted {
+				break
+			}
+			acc := gst[testname].Pre[target]
+			acc.Code = m.current
+			gst[testname].Pre[target] = acc
+			if !inConsensus() {
+				fails = 0
+				continue
+			} else {
+				log.Info("Restoring change")
+				fails++
+				m.undo()
+				// restore it
+				acc.Code = m.current
+				gst[testname].Pre[target] = acc
+				if fails > 5 {
+					break
+				}
+			}
+		}
+	}
+
+	// Try reducing code
+	for target, acc := range gst[testname].Pre {
+		if len(acc.Code) == 0 {
+			continue
+		}
+		log.Info("Reducing code", "target", target)
+		code := acc.Code
+		m := codeMutator{current: code, lastGood: code}
+		// Alright, we're in business
+		fails := 0
+		for {
+			if exhausted := m.proceed(); exhausted {
+				break
+			}
+			acc := gst[testname].Pre[target]
+			acc.Code = m.current
+			gst[testname].Pre[target] = acc
+			if !inConsensus() {
+				fails = 0
+				continue
+			} else {
+				log.Info("Restoring change")
+				fails++
+				m.undo()
+				// restore it
+				acc.Code = m.current
+				gst[testname].Pre[target] = acc
+				if fails > 5 {
+					break
+				}
+			}
+		}
+	}
+	log.Info("Reducing slots")
+	// Try removing storage
+	for target, acc := range gst[testname].Pre {
+		for k, v := range acc.Storage {
+			delete(gst[testname].Pre[target].Storage, k)
+			log.Info("Reducing slot", "target", target, "slot", k)
+			if !inConsensus() {
+				continue
+			}
+			log.Info("Restoring change")
+			gst[testname].Pre[target].Storage[k] = v
+		}
+	}
+	if failure != nil {
+		return "", failure
+	}
+	if !improved {
+		return testPath, nil
+	}
+	if err := ctx.Err(); err != nil {
+		log.Info("Minimization stopped", "reason", err, "result", good)
+	}
+	log.Info("Done", "result", good)
+	return good, nil
+}
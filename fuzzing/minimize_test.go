@@ -0,0 +1,113 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/holiman/goevmlab/ops"
+	"github.com/holiman/goevmlab/program"
+)
+
+// writeMinimizeTest writes a test with some junk, and one account whose code
+// contains a 'bug': a CALLCODE.
+func writeMinimizeTest(t *testing.T) string {
+	t.Helper()
+	gst := Factory("naive", "Cancun")()
+	p := program.NewProgram()
+	p.Sstore(1, 2)
+	p.CallCode(nil, common.Address{0x01}, 0, 0, 0, 0, 0)
+	p.Sstore(3, 4)
+	gst.AddAccount(common.Address{0xbb}, GenesisAccount{
+		Code:    p.Bytecode(),
+		Balance: new(big.Int),
+		Storage: map[common.Hash]common.Hash{{1}: {1}},
+	})
+	data, err := json.Marshal(gst.ToGeneralStateTest("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "test.json")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// callcodeOracle reports a disagreement as long as any account has a CALLCODE.
+func callcodeOracle(path string) (bool, error) {
+	gst, err := FromGeneralStateTest(path)
+	if err != nil {
+		return false, err
+	}
+	for _, test := range *gst {
+		for _, acc := range test.Pre {
+			if bytes.Contains(acc.Code, []byte{byte(ops.CALLCODE)}) {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+func TestMinimize(t *testing.T) {
+	path := writeMinimizeTest(t)
+	minimized, err := Minimize(context.Background(), path, callcodeOracle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if minimized == path {
+		t.Fatal("test not minimized")
+	}
+	if agree, _ := callcodeOracle(minimized); agree {
+		t.Fatal("minimized test does not reproduce")
+	}
+	gst, err := FromGeneralStateTest(minimized)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range *gst {
+		if len(test.Pre) != 1 {
+			t.Fatalf("expected a single account left, have %d", len(test.Pre))
+		}
+	}
+	// A test without disagreement can not be minimized
+	if _, err := Minimize(context.Background(), path, func(string) (bool, error) { return true, nil }); !errors.Is(err, ErrNoDivergence) {
+		t.Fatalf("expected ErrNoDivergence, have %v", err)
+	}
+}
+
+func TestMinimizeTimeout(t *testing.T) {
+	path := writeMinimizeTest(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	minimized, err := Minimize(ctx, path, callcodeOracle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if minimized != path {
+		t.Fatalf("expected no minimization, have %v", minimized)
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"math/big"
+	"math/rand"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/holiman/goevmlab/ops"
+	"github.com/holiman/goevmlab/program"
+)
+
+// modexpLengths are the body lengths which sit on the edges of the modexp
+// gas formulas: word boundaries, the 32-byte exponent head, and the
+// 64/1024-byte thresholds of the EIP-198 complexity function.
+var modexpLengths = []int{0, 1, 2, 31, 32, 33, 63, 64, 65, 96, 127, 128, 129, 255, 256, 512, 1023, 1024, 1025}
+
+// modexpHugeLengths are declared (header) lengths which are far too large to
+// ever be backed by actual calldata. They exercise the overflow-handling of
+// the gas calculation.
+var modexpHugeLengths = []string{
+	"0x100000000",
+	"0xffffffffffffffff",
+	"0x10000000000000000",
+	"0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff",
+}
+
+func fillModexp(gst *GstMaker, fork string) {
+	// Add a contract which calls modexp
+	dest := common.HexToAddress("0x00ca11e0e0e0")
+	gst.AddAccount(dest, GenesisAccount{
+		Code:    RandCallModexp(),
+		Balance: new(big.Int),
+		Storage: make(map[common.Hash]common.Hash),
+	})
+	// The transaction
+	gst.SetTx(&StTransaction{
+		// 8M gaslimit
+		GasLimit:   []uint64{8000000},
+		Nonce:      0,
+		Value:      []string{randHex(4)},
+		Data:       []string{randHex(100)},
+		GasPrice:   big.NewInt(0x10),
+		To:         dest.Hex(),
+		Sender:     sender,
+		PrivateKey: pKey,
+	})
+}
+
+// RandCallModexp creates code which performs one or more calls to the modexp
+// precompile, with inputs which hit the edge cases of the gas formula.
+func RandCallModexp() []byte {
+	p := program.NewProgram()
+	slot := 0
+	calls := 1 + rand.Intn(3)
+	for i := 0; i < calls; i++ {
+		data, modLen := randomModexpArgs()
+		p.Mstore(data, 0)
+		// The output is as large as the modulus, but don't bother storing
+		// kilobytes of it.
+		outSize := modLen
+		if outSize > 128 {
+			outSize = 128
+		}
+		inSize := len(data)
+		if rand.Intn(10) == 0 {
+			// Sometimes we cut the input short, or pad it with whatever
+			// happens to be in memory.
+			inSize = rand.Intn(len(data) + 64)
+		}
+		// Don't forward all gas, since a failing call would then leave us
+		// with nothing left to store the results
+		gas := big.NewInt(int64(rand.Intn(100_000)))
+		if rand.Intn(3) != 0 {
+			gas.SetUint64(1_000_000)
+		}
+		p.Call(gas, 5, 0, 0, inSize, 0, outSize)
+		// Store the success flag
+		p.Push(0x1337 + i)
+		p.Op(ops.SSTORE)
+		// Store the output in some slots, to make sure the stateroot changes
+		if outSize > 0 {
+			p.MemToStorage(0, outSize, slot)
+			slot += (outSize + 31) / 32
+		}
+	}
+	return p.Bytecode()
+}
+
+// randomModexpArgs returns modexp input, consisting of the three 32-byte
+// length words (base, exponent, modulus) followed by the bodies. It also
+// returns the actual size of the modulus body.
+func randomModexpArgs() ([]byte, int) {
+	var (
+		baseLen = randModexpLength()
+		expLen  = randModexpLength()
+		modLen  = randModexpLength()
+		base    = randModexpBytes(baseLen)
+		exp     = randModexpExponent(expLen)
+		mod     = randModexpBytes(modLen)
+	)
+	header := make([]byte, 96)
+	new(big.Int).SetUint64(uint64(baseLen)).FillBytes(header[0:32])
+	new(big.Int).SetUint64(uint64(expLen)).FillBytes(header[32:64])
+	new(big.Int).SetUint64(uint64(modLen)).FillBytes(header[64:96])
+	// Now and then, declare a length which is way larger than what we
+	// actually provide.
+	if rand.Intn(10) == 0 {
+		huge := asBig(modexpHugeLengths[rand.Intn(len(modexpHugeLengths))])
+		field := rand.Intn(3)
+		huge.FillBytes(header[32*field : 32*field+32])
+	}
+	data := append(header, base...)
+	data = append(data, exp...)
+	data = append(data, mod...)
+	return data, modLen
+}
+
+func randModexpLength() int {
+	if rand.Intn(4) == 0 {
+		return rand.Intn(300)
+	}
+	return modexpLengths[rand.Intn(len(modexpLengths))]
+}
+
+// randModexpBytes returns random bytes, but with a fair chance of the value
+// being zero or one, or having leading zeroes.
+func randModexpBytes(size int) []byte {
+	b := make([]byte, size)
+	if size == 0 {
+		return b
+	}
+	switch rand.Intn(8) {
+	case 0: // zero
+	case 1: // one
+		b[size-1] = 1
+	case 2: // leading zeroes
+		_, _ = rand.Read(b[rand.Intn(size):])
+	default:
+		_, _ = rand.Read(b)
+	}
+	return b
+}
+
+// randModexpExponent returns an exponent of the given size, with extra care
+// taken to hit the edges of the 'adjusted exponent length' calculation.
+func randModexpExponent(size int) []byte {
+	b := make([]byte, size)
+	if size == 0 {
+		return b
+	}
+	switch rand.Intn(6) {
+	case 0:
+		// A non-zero exponent whose first 32 bytes are all zero.
+		if size > 32 {
+			_, _ = rand.Read(b[32:])
+			break
+		}
+		fallthrough
+	case 1:
+		// Only the highest bit set.
+		b[0] = 0x80
+	case 2:
+		// Only the lowest bit set.
+		b[size-1] = 1
+	default:
+		return randModexpBytes(size)
+	}
+	return b
+}
@@ -0,0 +1,105 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"math/big"
+	"math/rand"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/holiman/goevmlab/ops"
+	"github.com/holiman/goevmlab/program"
+)
+
+var mstore8Addr = common.HexToAddress("0x00000000000000000000000000000000000e5708")
+
+func fillMstore8(gst *GstMaker, fork string) {
+	gst.AddAccount(mstore8Addr, GenesisAccount{
+		Code:    RandMstore8Code(),
+		Balance: new(big.Int),
+		Storage: make(map[common.Hash]common.Hash),
+	})
+	// The transaction
+	gst.SetTx(&StTransaction{
+		// 8M gaslimit
+		GasLimit:   []uint64{8000000},
+		Nonce:      0,
+		Value:      []string{randHex(4)},
+		Data:       []string{randHex(100)},
+		GasPrice:   big.NewInt(0x10),
+		To:         mstore8Addr.Hex(),
+		Sender:     sender,
+		PrivateKey: pKey,
+	})
+}
+
+// mstore8Offset returns an offset to write a byte at: close to the base, and
+// now and then one which is too large to expand memory to.
+func mstore8Offset(base int) *big.Int {
+	if rand.Intn(40) == 0 {
+		return asBig(oneOf("0xffffffff", "0x100000000", "0xffffffffffffffff").(string))
+	}
+	return big.NewInt(int64(base + rand.Intn(96)))
+}
+
+// RandMstore8Code creates code which writes single bytes (MSTORE8) at offsets
+// around a base, interleaved with word reads (MLOAD) overlapping the bytes
+// written, which may also be the first to touch (and expand) the memory.
+// The words read, and now and then the memory size and the gas left, are
+// stored, so the byte layout and the expansion cost show in the state.
+func RandMstore8Code() []byte {
+	var (
+		p    = program.NewProgram()
+		n    = 1 + rand.Intn(30)
+		base = oneOf(0, 1, 31, 32, 33, 1000+rand.Intn(64), 0x10000-rand.Intn(64)).(int)
+		slot = 0
+	)
+	for i := 0; i < n; i++ {
+		offset := mstore8Offset(base)
+		// A value wider than a byte: only the lowest byte is written
+		value := new(big.Int).Lsh(big.NewInt(int64(rand.Intn(256))), uint(8*rand.Intn(2)))
+		value.Or(value, big.NewInt(int64(rand.Intn(256))))
+		p.Push(value)
+		p.Push(offset)
+		p.Op(ops.MSTORE8)
+		for reads := rand.Intn(3); reads > 0; reads-- {
+			// A word containing the byte, or just past it
+			at := new(big.Int).Sub(offset, big.NewInt(int64(rand.Intn(32))))
+			if rand.Intn(8) == 0 {
+				at.Add(offset, big.NewInt(int64(1+rand.Intn(32))))
+			}
+			if at.Sign() < 0 {
+				at.SetInt64(0)
+			}
+			p.Push(at)
+			p.Op(ops.MLOAD)
+			p.Push(slot)
+			p.Op(ops.SSTORE)
+			slot++
+		}
+		if rand.Intn(4) == 0 {
+			p.Op(oneOf(ops.MSIZE, ops.GAS).(ops.OpCode))
+			p.Push(slot)
+			p.Op(ops.SSTORE)
+			slot++
+		}
+	}
+	p.Op(ops.MSIZE)
+	p.Push(slot)
+	p.Op(ops.SSTORE)
+	return p.Bytecode()
+}
@@ -0,0 +1,253 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"os"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/holiman/goevmlab/ops"
+)
+
+// seedCorpus holds the tests which the mutation generator starts from, e.g.
+// previously found crashers. Without it, the generator mutates naive tests.
+var seedCorpus []*stJSON
+
+// LoadSeedCorpus reads the state tests in the given files into the corpus of
+// the mutation generator. Files which are not state tests are skipped. It must
+// be called before generation starts, and returns the number of tests loaded.
+func LoadSeedCorpus(paths []string) (int, error) {
+	var corpus []*stJSON
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return 0, err
+		}
+		var gst GeneralStateTest
+		if err := json.Unmarshal(data, &gst); err != nil {
+			log.Warn("Skipping seed", "file", path, "err", err)
+			continue
+		}
+		for _, test := range gst {
+			if test == nil || len(test.Pre) == 0 {
+				continue
+			}
+			corpus = append(corpus, test)
+		}
+	}
+	if len(corpus) == 0 {
+		return 0, fmt.Errorf("no state tests in the %d seed files", len(paths))
+	}
+	seedCorpus = corpus
+	return len(corpus), nil
+}
+
+func fillMutate(gst *GstMaker, fork string) {
+	forkDef := ops.LookupFork(fork) // known, the factory checks it
+	if len(seedCorpus) == 0 {
+		fillNaive(gst, fork)
+	} else {
+		seed := seedCorpus[rand.Intn(len(seedCorpus))]
+		pre := make(GenesisAlloc)
+		for addr, acc := range seed.Pre {
+			pre[addr] = copyAccount(acc)
+		}
+		env := seed.Env
+		gst.SetPre(&pre)
+		gst.env = &env
+		gst.SetTx(seedTransaction(seed))
+	}
+	for n := 1 + rand.Intn(3); n > 0; n-- {
+		mutateTest(gst, forkDef)
+	}
+}
+
+// copyAccount returns a deep copy of the account, which may be mutated.
+func copyAccount(acc GenesisAccount) GenesisAccount {
+	cpy := GenesisAccount{
+		Code:       common.CopyBytes(acc.Code),
+		Storage:    make(map[common.Hash]common.Hash),
+		Balance:    new(big.Int),
+		Nonce:      acc.Nonce,
+		PrivateKey: acc.PrivateKey,
+	}
+	if acc.Balance != nil {
+		cpy.Balance.Set(acc.Balance)
+	}
+	for k, v := range acc.Storage {
+		cpy.Storage[k] = v
+	}
+	return cpy
+}
+
+// seedTransaction returns a copy of the transaction of the seed, reduced to
+// the data, gas and value selected by its first post state.
+func seedTransaction(seed *stJSON) *StTransaction {
+	var idx stIndex
+	for _, posts := range seed.Post {
+		if len(posts) > 0 {
+			idx = posts[0].Indexes
+			break
+		}
+	}
+	tx := seed.Tx
+	tx.Data = pickIndex(tx.Data, idx.Data)
+	tx.Value = pickIndex(tx.Value, idx.Value)
+	if idx.Gas < len(tx.GasLimit) {
+		tx.GasLimit = []uint64{tx.GasLimit[idx.Gas]}
+	} else {
+		tx.GasLimit = []uint64{8000000}
+	}
+	if idx.Data < len(tx.AccessLists) {
+		tx.AccessLists = tx.AccessLists[idx.Data : idx.Data+1]
+	} else {
+		tx.AccessLists = nil
+	}
+	return &tx
+}
+
+// pickIndex returns a list holding the element at the index, or the empty
+// value if there is none.
+func pickIndex(list []string, i int) []string {
+	if i < len(list) {
+		return []string{list[i]}
+	}
+	return []string{"0x"}
+}
+
+// mutateTest makes a random change to the test: to the code, storage or
+// balance of one of the accounts, or to the transaction.
+func mutateTest(gst *GstMaker, f *ops.Fork) {
+	var (
+		alloc = *gst.pre
+		addrs []common.Address
+	)
+	for addr, acc := range alloc {
+		if len(acc.Code) > 0 {
+			addrs = append(addrs, addr)
+		}
+	}
+	switch rand.Intn(10) {
+	case 0, 1, 2, 3, 4:
+		if len(addrs) == 0 {
+			break
+		}
+		addr := addrs[rand.Intn(len(addrs))]
+		acc := alloc[addr]
+		acc.Code = mutateCode(acc.Code, f)
+		gst.AddAccount(addr, acc)
+		return
+	case 5, 6:
+		if len(addrs) == 0 {
+			break
+		}
+		acc := alloc[addrs[rand.Intn(len(addrs))]]
+		slot := common.BigToHash(big.NewInt(int64(rand.Intn(16))))
+		if v := randInt(64, 64)().(*big.Int); v.Sign() == 0 {
+			delete(acc.Storage, slot)
+		} else {
+			acc.Storage[slot] = common.BigToHash(v)
+		}
+		return
+	case 7:
+		if len(addrs) == 0 {
+			break
+		}
+		acc := alloc[addrs[rand.Intn(len(addrs))]]
+		acc.Balance.Set(randInt(64, 64)().(*big.Int))
+		return
+	}
+	// Mutate the transaction
+	tx := gst.tx
+	switch rand.Intn(3) {
+	case 0:
+		gas := tx.GasLimit[0]
+		gas = oneOf(gas/2, gas-gas/8, gas+gas/8, gas*2, gas+1).(uint64)
+		if gas > 0 && rand.Intn(4) == 0 {
+			gas = tx.GasLimit[0] - 1
+		}
+		tx.GasLimit = []uint64{gas}
+	case 1:
+		tx.Value = []string{randHex(4)}
+	default:
+		data, err := hexutil.Decode(tx.Data[0])
+		if err != nil || len(data) == 0 {
+			tx.Data = []string{randHex(100)}
+			break
+		}
+		data = common.CopyBytes(data)
+		data[rand.Intn(len(data))] = byte(rand.Intn(256))
+		tx.Data = []string{hexutil.Encode(data)}
+	}
+	gst.SetTx(&tx)
+}
+
+// mutateCode returns a mutated copy of the code: an instruction is replaced,
+// removed, or duplicated, a push of an interesting value is inserted, or a
+// byte is overwritten. Push data is kept intact, except by the latter.
+func mutateCode(code []byte, f *ops.Fork) []byte {
+	var (
+		starts []int
+		it     = ops.NewInstructionIterator(code)
+	)
+	for it.Next() {
+		starts = append(starts, int(it.PC()))
+	}
+	if len(starts) == 0 {
+		return code
+	}
+	var (
+		i     = rand.Intn(len(starts))
+		start = starts[i]
+		end   = len(code)
+		out   []byte
+	)
+	if i+1 < len(starts) {
+		end = starts[i+1]
+	}
+	switch rand.Intn(5) {
+	case 0: // Replace the instruction
+		out = append(out, code[:start]...)
+		out = append(out, byte(f.RandomOp(byte(rand.Intn(256)))))
+		out = append(out, code[end:]...)
+	case 1: // Remove the instruction
+		out = append(out, code[:start]...)
+		out = append(out, code[end:]...)
+	case 2: // Duplicate the instruction
+		out = append(out, code[:end]...)
+		out = append(out, code[start:]...)
+	case 3: // Insert a push
+		v := randInt(32, 128)().(*big.Int).Bytes()
+		if len(v) == 0 {
+			v = []byte{0}
+		}
+		out = append(out, code[:start]...)
+		out = append(out, byte(ops.PUSH1)+byte(len(v)-1))
+		out = append(out, v...)
+		out = append(out, code[start:]...)
+	default: // Overwrite a byte, which may be push data
+		out = common.CopyBytes(code)
+		out[rand.Intn(len(out))] = byte(rand.Intn(256))
+	}
+	return out
+}
@@ -0,0 +1,77 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSeedCorpus(t *testing.T) {
+	dir := t.TempDir()
+	seed := Factory("calloog", "Cancun")()
+	if err := seed.Fill(nil); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(seed.ToGeneralStateTest("crasher"))
+	if err := os.WriteFile(filepath.Join(dir, "crasher.json"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "other.json"), []byte(`[1, 2]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadSeedCorpus([]string{filepath.Join(dir, "other.json")}); err == nil {
+		t.Fatal("expected error for a corpus without state tests")
+	}
+	n, err := LoadSeedCorpus([]string{filepath.Join(dir, "crasher.json"), filepath.Join(dir, "other.json")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { seedCorpus = nil }()
+	if n != 1 {
+		t.Fatalf("expected 1 test in the corpus, have %d", n)
+	}
+	var (
+		callee  = (*seed.pre)[callOOGCalleeAddr].Code
+		changed int
+	)
+	for i := 0; i < 50; i++ {
+		gst := Factory("mutate", "Cancun")()
+		if err := gst.Fill(nil); err != nil {
+			t.Fatal(err)
+		}
+		if gst.GetDestination() != callOOGAddr {
+			t.Fatalf("expected mutations of the seed, have destination %v", gst.GetDestination())
+		}
+		if _, ok := (*gst.pre)[callOOGCalleeAddr]; !ok {
+			t.Fatal("expected mutations of the seed, callee missing")
+		}
+		if gst.tx.Data[0] != seed.tx.Data[0] || gst.tx.GasLimit[0] != seed.tx.GasLimit[0] {
+			changed++
+		}
+	}
+	if changed == 0 {
+		t.Error("the transaction was never mutated")
+	}
+	// The seed itself must be left intact
+	if !bytes.Equal(seedCorpus[0].Pre[callOOGCalleeAddr].Code, callee) {
+		t.Error("seed modified by mutations")
+	}
+}
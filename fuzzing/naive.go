@@ -1,8 +1,8 @@
 package fuzzing
 
 import (
-	"crypto/rand"
 	"math/big"
+	"math/rand"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/holiman/goevmlab/ops"
@@ -62,8 +62,17 @@ func randomBytecode(f *ops.Fork) []byte {
 	p.Push(next())
 	p.Push(next())
 	p.Push(next())
+	allowed := allowedOps(f)
 	for p.Size() < 1024 {
-		p.Op(f.RandomOp(next()))
+		if v := fromDictionary(); v != nil {
+			p.Push(v)
+			continue
+		}
+		if opcodeAllowlist != nil {
+			p.Op(allowedOp(allowed, next()))
+		} else {
+			p.Op(f.RandomOp(next()))
+		}
 	}
 	return p.Bytecode()
 }
@@ -0,0 +1,161 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"math/big"
+	"math/rand"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/holiman/goevmlab/ops"
+	"github.com/holiman/goevmlab/program"
+)
+
+var (
+	// nestedRevertBase is the address of the root of the contract tree, the
+	// other contracts follow it.
+	nestedRevertBase = common.HexToAddress("0x00000000000000000000000000000000004e5e00")
+	// nestedRevertSink receives the value transfers.
+	nestedRevertSink = common.HexToAddress("0x00000000000000000000000000000000004e5eff")
+)
+
+func fillNestedRevert(gst *GstMaker, fork string) {
+	var (
+		next   int
+		levels = 2 + rand.Intn(3)
+	)
+	// build adds the contract at the given level, along with the subtree
+	// below it, and returns its address.
+	var build func(level int) common.Address
+	build = func(level int) common.Address {
+		addr := common.BigToAddress(new(big.Int).Add(nestedRevertBase.Big(), big.NewInt(int64(next))))
+		next++
+		var children []common.Address
+		if level < levels {
+			for n := 1 + rand.Intn(2); n > 0; n-- {
+				children = append(children, build(level+1))
+			}
+		}
+		// Slots with values, which may be cleared for a refund
+		storage := make(map[common.Hash]common.Hash)
+		for i := 0; i < 4; i++ {
+			if rand.Intn(2) == 0 {
+				storage[common.BigToHash(big.NewInt(int64(i)))] = common.BigToHash(big.NewInt(1))
+			}
+		}
+		gst.AddAccount(addr, GenesisAccount{
+			Code:    RandNestedRevertCode(fork, children, nestedRevertSink),
+			Balance: big.NewInt(0xffff),
+			Storage: storage,
+		})
+		return addr
+	}
+	root := build(1)
+	gst.SetTx(&StTransaction{
+		// 8M gaslimit
+		GasLimit:   []uint64{8000000},
+		Nonce:      0,
+		Value:      []string{randHex(4)},
+		Data:       []string{randHex(100)},
+		GasPrice:   big.NewInt(0x10),
+		To:         root.Hex(),
+		Sender:     sender,
+		PrivateKey: pKey,
+	})
+}
+
+// RandNestedRevertCode creates the code of a frame in a call tree: it makes
+// state changes (storage writes and clears, value transfers, logs, created
+// contracts and transient storage), calls the children, storing the outcome
+// of each call, and makes more changes. It then ends in one of various ways,
+// and in most cases reverts all of its changes, and those of the successful
+// children: with REVERT, or an exceptional halt.
+func RandNestedRevertCode(fork string, children []common.Address, sink common.Address) []byte {
+	var (
+		p      = program.NewProgram()
+		forkOp = ops.LookupFork(fork)
+		valid  = func(op ops.OpCode) bool {
+			return forkOp == nil || forkOp.IsValid(op)
+		}
+		changes = func() {
+			for n := 1 + rand.Intn(4); n > 0; n-- {
+				switch rand.Intn(6) {
+				case 0, 1: // A write, or a clear
+					p.Sstore(rand.Intn(4), rand.Intn(3))
+				case 2:
+					p.Call(big.NewInt(0), sink, 1, 0, 0, 0, 0)
+					p.Op(ops.POP)
+				case 3:
+					p.Push(0xc0de)
+					p.Push(32)
+					p.Push(0)
+					p.Op(ops.LOG1)
+				case 4:
+					// A contract, with the code 0x00
+					p.Mstore([]byte{0x60, 0x01, 0x60, 0x00, 0xf3}, 0)
+					p.Push(5)
+					p.Push(0)
+					p.Push(oneOf(0, 1).(int))
+					p.Op(ops.CREATE)
+					p.Op(ops.POP)
+				default:
+					if valid(ops.TSTORE) {
+						p.Tstore(rand.Intn(4), rand.Intn(3))
+					} else {
+						p.Sstore(rand.Intn(4), rand.Intn(3))
+					}
+				}
+			}
+		}
+	)
+	changes()
+	for i, child := range children {
+		op := oneOf(ops.CALL, ops.CALL, ops.CALLCODE, ops.DELEGATECALL).(ops.OpCode)
+		if !valid(op) {
+			op = ops.CALL
+		}
+		switch op {
+		case ops.CALL:
+			p.Call(nil, child, oneOf(0, 1).(int), 0, 0, 0, 0)
+		case ops.CALLCODE:
+			p.CallCode(nil, child, oneOf(0, 1).(int), 0, 0, 0, 0)
+		default:
+			p.DelegateCall(nil, child, 0, 0, 0, 0)
+		}
+		p.Push(0x100 + i)
+		p.Op(ops.SSTORE)
+		changes()
+	}
+	switch r := rand.Intn(10); {
+	case r < 6 && valid(ops.REVERT):
+		p.Push(0xdead)
+		p.Push(0)
+		p.Op(ops.MSTORE)
+		p.Push(32)
+		p.Push(0)
+		p.Op(ops.REVERT)
+	case r < 7:
+		p.Op(ops.INVALID)
+	case r < 8:
+		// Out of bounds jump
+		p.Push(0xffff)
+		p.Op(ops.JUMP)
+	default:
+		p.Op(ops.STOP)
+	}
+	return p.Bytecode()
+}
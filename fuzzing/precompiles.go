@@ -1,7 +1,6 @@
 package fuzzing
 
 import (
-	crand "crypto/rand"
 	"math/big"
 	"math/rand"
 
@@ -36,7 +35,7 @@ func randCallPrecompile() []byte {
 	// fill the memory
 	p := program.NewProgram()
 	data := make([]byte, 1024)
-	_, _ = crand.Read(data)
+	_, _ = rand.Read(data)
 	p.Mstore(data, 0)
 	memInFn := func() (offset, size interface{}) {
 		offset, size = 0, rand.Uint32()%uint32(len(data))
@@ -17,7 +17,7 @@
 package fuzzing
 
 import (
-	crand "crypto/rand"
+	"crypto/ecdsa"
 	"encoding/binary"
 	"math"
 	"math/big"
@@ -25,6 +25,7 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/holiman/goevmlab/ops"
 	"github.com/holiman/goevmlab/program"
 )
@@ -36,17 +37,40 @@ type valFunc func() interface{}
 func randHex(maxSize int) string {
 	size := rand.Intn(maxSize)
 	b := make([]byte, size)
-	_, _ = crand.Read(b)
+	_, _ = rand.Read(b)
 	return hexutil.Encode(b)
 }
 
+// randBigInt returns a random value in [0, max). Like all the randomness of
+// the generators, it is drawn from math/rand, so that a seed reproduces the
+// tests.
+func randBigInt(max *big.Int) *big.Int {
+	b := make([]byte, len(max.Bytes())+8)
+	_, _ = rand.Read(b)
+	return new(big.Int).Mod(new(big.Int).SetBytes(b), max)
+}
+
+// randKey returns a random private key.
+func randKey() *ecdsa.PrivateKey {
+	for {
+		b := make([]byte, 32)
+		_, _ = rand.Read(b)
+		if key, err := crypto.ToECDSA(b); err == nil {
+			return key
+		}
+	}
+}
+
 // randInt returns a valFunc which spits out bigints,
 // - Chance of zero, expressed as N out of 255.
 // - Chance of small value (< 255 ), expressed as N out of 255.
 func randInt(chanceOfZero, chanceOfSmall byte) valFunc {
 	return func() interface{} {
+		if v := fromDictionary(); v != nil {
+			return v
+		}
 		b := make([]byte, 4)
-		_, _ = crand.Read(b)
+		_, _ = rand.Read(b)
 		// Zero or not?
 		if b[0] < chanceOfZero {
 			return big.NewInt(0)
@@ -55,7 +79,7 @@ func randInt(chanceOfZero, chanceOfSmall byte) valFunc {
 			return (new(big.Int)).SetBytes(b[2:3])
 		}
 		val := make([]byte, 32)
-		_, _ = crand.Read(val)
+		_, _ = rand.Read(val)
 		return (new(big.Int)).SetBytes(val)
 	}
 }
@@ -137,7 +161,7 @@ func randomBlakeArgs() []byte {
 	//params are
 	var rounds uint32
 	data := make([]byte, 214)
-	_, _ = crand.Read(data)
+	_, _ = rand.Read(data)
 	// Now, modify the rounds, and the 'f'
 	// rounds should be below 1024 for the most part
 	rounds = uint32(math.Abs(1024 * rand.ExpFloat64()))
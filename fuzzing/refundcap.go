@@ -0,0 +1,132 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"math/big"
+	"math/rand"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/holiman/goevmlab/ops"
+	"github.com/holiman/goevmlab/program"
+)
+
+// refundCapGasLimit is the gas limit of the refund cap transactions.
+const refundCapGasLimit = 8_000_000
+
+func fillRefundCap(gst *GstMaker, fork string) {
+	// The refund cap of EIP-3529 exists from London on
+	if !ops.LookupRules(fork).IsLondon {
+		fork = "London"
+		gst.SetFork(fork)
+	}
+	var (
+		dest    = common.HexToAddress("0x0000000000000000000000000000000000003529")
+		storage = make(map[common.Hash]common.Hash)
+		clears  = 2 + rand.Intn(40)
+	)
+	// The slots to clear, and to restore, hold a value to begin with
+	for i := 0; i < clears; i++ {
+		storage[common.BigToHash(big.NewInt(int64(i)))] = common.BigToHash(big.NewInt(int64(1 + rand.Intn(0xff))))
+	}
+	gst.AddAccount(dest, GenesisAccount{
+		Code:    RandRefundCapCode(clears),
+		Balance: new(big.Int),
+		Storage: storage,
+	})
+	// The transaction, without data, so the intrinsic gas is known
+	gst.SetTx(&StTransaction{
+		GasLimit:   []uint64{refundCapGasLimit},
+		Nonce:      0,
+		Value:      []string{randHex(4)},
+		Data:       []string{""},
+		GasPrice:   big.NewInt(0x10),
+		To:         dest.Hex(),
+		Sender:     sender,
+		PrivateKey: pKey,
+	})
+}
+
+// RandRefundCapCode creates code which accrues refunds (EIP-3529 rules), by
+// clearing some of the given number of initially non-zero slots, setting
+// fresh slots and clearing them again, and changing and restoring slots.
+// It then burns gas until the gas used is around five times the refund, so
+// that the refund is just within or just over the cap of gasUsed/5.
+func RandRefundCapCode(slots int) []byte {
+	var (
+		p       = program.NewProgram()
+		refund  uint64
+		cleared = rand.Perm(slots)[:1+rand.Intn(slots)]
+	)
+	for _, slot := range cleared {
+		switch rand.Intn(4) {
+		case 0: // Change, and restore the original value: x -> y -> x
+			p.Push(slot)
+			p.Op(ops.SLOAD)
+			p.Sstore(slot, 0x100+rand.Intn(0x100))
+			p.Push(slot)
+			p.Op(ops.SSTORE)
+			refund += params.SstoreResetGasEIP2200 - params.ColdSloadCostEIP2929 - params.WarmStorageReadCostEIP2929
+		default: // Clear: x -> 0
+			p.Sstore(slot, 0)
+			refund += params.SstoreClearsScheduleRefundEIP3529
+		}
+	}
+	// Set fresh slots, and clear them again: 0 -> y -> 0
+	for i := rand.Intn(4); i > 0; i-- {
+		slot := 0x1000 + i
+		p.Sstore(slot, 1+rand.Intn(0xff))
+		p.Sstore(slot, 0)
+		refund += params.SstoreSetGasEIP2200 - params.WarmStorageReadCostEIP2929
+	}
+	// Burn gas while the gas used (gas limit minus gas left) is below the
+	// target: around the point where the cap kicks in. Large chunks are burnt
+	// by hashing memory first, to keep the traces short.
+	var (
+		delta  = int64(oneOf(0, 1, -1, 5, -5, 50, -50, 1000, -1000, rand.Intn(20_000)-10_000).(int))
+		target = int64(refund*params.RefundQuotientEIP3529) + delta
+		left   = big.NewInt(refundCapGasLimit - target)
+		// Upper bound of a keccak chunk, including the memory expansion
+		margin = big.NewInt(12_000)
+	)
+	coarse := p.Jumpdest()
+	// The chunk, executed while the gas left is well above the target
+	chunk := program.NewProgram()
+	chunk.Push(0x8000).Push(0)
+	chunk.Op(ops.KECCAK256)
+	chunk.Op(ops.POP)
+	chunk.Push(coarse)
+	chunk.Op(ops.JUMP)
+	// GAS, GT, ISZERO, PUSH2 target, JUMPI
+	p.Push(new(big.Int).Add(left, margin))
+	p.Op(ops.GAS)
+	p.Op(ops.GT)
+	p.Op(ops.ISZERO)
+	fine := p.Size() + 4 + len(chunk.Bytecode())
+	p.Op(ops.PUSH2)
+	p.AddAll([]byte{byte(fine >> 8), byte(fine)})
+	p.Op(ops.JUMPI)
+	p.AddAll(chunk.Bytecode())
+	loop := p.Jumpdest()
+	p.Push(left)
+	p.Op(ops.GAS)
+	p.Op(ops.GT)
+	p.Push(loop)
+	p.Op(ops.JUMPI)
+	return p.Bytecode()
+}
@@ -0,0 +1,156 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"math/big"
+	"math/rand"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/holiman/goevmlab/ops"
+	"github.com/holiman/goevmlab/program"
+)
+
+// returnDataSizes are the sizes of return data the inner contracts are asked
+// to produce: word boundaries, and the sizes around the max code size.
+var returnDataSizes = []int{0, 1, 31, 32, 33, 64, 256, 1024, 24576, 24577, 1 << 17}
+
+var (
+	returnAddr = common.HexToAddress("0x00000000000000000000000000000000000e0001")
+	revertAddr = common.HexToAddress("0x00000000000000000000000000000000000e0002")
+)
+
+func fillReturnData(gst *GstMaker, fork string) {
+	dest := common.HexToAddress("0x00000000000000000000000000000000000e0000")
+	// The inner contracts, which return or revert with data
+	gst.AddAccount(returnAddr, GenesisAccount{
+		Code:    returnDataInner(ops.RETURN),
+		Balance: new(big.Int),
+		Storage: make(map[common.Hash]common.Hash),
+	})
+	gst.AddAccount(revertAddr, GenesisAccount{
+		Code:    returnDataInner(ops.REVERT),
+		Balance: new(big.Int),
+		Storage: make(map[common.Hash]common.Hash),
+	})
+	// The outer contract, which calls them and inspects the return data
+	gst.AddAccount(dest, GenesisAccount{
+		Code:    RandCallReturnData([]common.Address{returnAddr, revertAddr}),
+		Balance: new(big.Int),
+		Storage: make(map[common.Hash]common.Hash),
+	})
+	// The transaction
+	gst.SetTx(&StTransaction{
+		// 8M gaslimit
+		GasLimit:   []uint64{8000000},
+		Nonce:      0,
+		Value:      []string{randHex(4)},
+		Data:       []string{randHex(100)},
+		GasPrice:   big.NewInt(0x10),
+		To:         dest.Hex(),
+		Sender:     sender,
+		PrivateKey: pKey,
+	})
+}
+
+// returnDataInner returns code which fills some memory, and then returns or
+// reverts (depending on op) with the memory range given in calldata: the
+// size in the first word, the offset in the second.
+func returnDataInner(op ops.OpCode) []byte {
+	p := program.NewProgram()
+	p.Mstore(common.FromHex("0x0102030405060708091011121314151617181920212223242526272829303132333435"), 0)
+	p.Push(0)
+	p.Op(ops.CALLDATALOAD) // size
+	p.Push(32)
+	p.Op(ops.CALLDATALOAD) // offset
+	p.Op(op)
+	return p.Bytecode()
+}
+
+// RandCallReturnData creates code which calls the given contracts, asking
+// for return data of various sizes, and then inspects the return data via
+// RETURNDATASIZE and RETURNDATACOPY. Now and then, the copy is out of bounds,
+// which causes an exceptional halt.
+func RandCallReturnData(addrs []common.Address) []byte {
+	var (
+		p     = program.NewProgram()
+		slot  = 0
+		calls = 1 + rand.Intn(5)
+	)
+	for i := 0; i < calls; i++ {
+		size := returnDataSizes[rand.Intn(len(returnDataSizes))]
+		offset := new(big.Int).SetUint64(uint64(oneOf(0, 1, 31, 1<<16).(int)))
+		if size == 0 && rand.Intn(3) == 0 {
+			// Huge offsets are fine, as long as the size is zero
+			offset = asBig(oneOf("0xffffffffffffffff", "0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff").(string))
+		}
+		// Arguments to the inner contract
+		p.Mstore(common.BigToHash(big.NewInt(int64(size))).Bytes(), 0)
+		p.Mstore(common.BigToHash(offset).Bytes(), 32)
+		// Receive some of the return data in memory directly
+		outSize := oneOf(0, 1, 32, 64).(int)
+		gas := big.NewInt(int64(oneOf(50_000, 1_000_000, 3_000_000).(int)))
+		addr := addrs[rand.Intn(len(addrs))]
+		switch rand.Intn(3) {
+		case 0:
+			p.Call(gas, addr, 0, 0, 64, 0x40, outSize)
+		case 1:
+			p.StaticCall(gas, addr, 0, 64, 0x40, outSize)
+		default:
+			p.DelegateCall(gas, addr, 0, 64, 0x40, outSize)
+		}
+		// Store the success flag and the return data size
+		p.Push(slot)
+		p.Op(ops.SSTORE)
+		p.Op(ops.RETURNDATASIZE)
+		p.Push(slot + 1)
+		p.Op(ops.SSTORE)
+		slot += 2
+		// Copy some range of the return data
+		var copyOffset, copyLen interface{}
+		switch rand.Intn(8) {
+		case 0: // out of bounds: one byte too many
+			copyOffset, copyLen = 0, size+1
+		case 1: // out of bounds: starts at the end
+			copyOffset, copyLen = size, 1
+		case 2: // out of bounds: offset overflow
+			copyOffset, copyLen = asBig("0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"), 1
+		case 3: // empty copy at the end
+			copyOffset, copyLen = size, 0
+		case 4: // the last byte
+			copyOffset, copyLen = 0, 0
+			if size > 0 {
+				copyOffset, copyLen = size-1, 1
+			}
+		default: // the first few bytes
+			copyOffset, copyLen = 0, size
+			if size > 64 {
+				copyLen = 64
+			}
+		}
+		p.Push(copyLen)
+		p.Push(copyOffset)
+		p.Push(0x80)
+		p.Op(ops.RETURNDATACOPY)
+		p.Push(0x80)
+		p.Op(ops.MLOAD)
+		p.Push(slot)
+		p.Op(ops.SSTORE)
+		slot++
+	}
+	return p.Bytecode()
+}
@@ -0,0 +1,166 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"math/big"
+	"math/rand"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/holiman/goevmlab/ops"
+	"github.com/holiman/goevmlab/program"
+)
+
+var selfCallAddr = common.HexToAddress("0x00000000000000000000000000000000005e1f00")
+
+// Storage slots written by the frames of the self-calling contract: the
+// counter, and per depth n, the counter seen before the call (0x100+n), the
+// call result (0x200+n) and the counter seen after the call (0x300+n).
+const (
+	selfCallCounter = 0
+	selfCallBefore  = 0x100
+	selfCallResult  = 0x200
+	selfCallAfter   = 0x300
+)
+
+func fillSelfCall(gst *GstMaker, fork string) {
+	storage := make(map[common.Hash]common.Hash)
+	for i := 0; i < 4; i++ {
+		if rand.Intn(2) == 0 {
+			storage[common.BigToHash(big.NewInt(int64(i)))] = common.BigToHash(big.NewInt(int64(rand.Intn(3))))
+		}
+	}
+	gst.AddAccount(selfCallAddr, GenesisAccount{
+		Code:    RandSelfCallCode(fork, selfCallAddr),
+		Balance: big.NewInt(0xffff),
+		Storage: storage,
+	})
+	// The calldata is the number of nested self-calls. Deep recursion is
+	// eventually limited by the gas (63/64 rule) rather than the call depth.
+	depth := oneOf(1, 2, 3, 1+rand.Intn(16), 1+rand.Intn(16), 1100).(int)
+	gst.SetTx(&StTransaction{
+		// 8M gaslimit
+		GasLimit:   []uint64{8000000},
+		Nonce:      0,
+		Value:      []string{randHex(4)},
+		Data:       []string{hexutil.Encode(common.BigToHash(big.NewInt(int64(depth))).Bytes())},
+		GasPrice:   big.NewInt(0x10),
+		To:         selfCallAddr.Hex(),
+		Sender:     sender,
+		PrivateKey: pKey,
+	})
+}
+
+// RandSelfCallCode creates the code of a contract (at the given address) which
+// calls itself: it reads the remaining depth n from calldata, and while n is
+// non-zero, it increments a counter in storage, records the counter, calls
+// itself with n-1 (by ADDRESS, or its address pushed), and records the call
+// result and the counter again. The child frames thus change the storage read
+// by their parent. Random storage reads and writes are added around the call.
+func RandSelfCallCode(fork string, self common.Address) []byte {
+	var (
+		forkOp = ops.LookupFork(fork)
+		body   = program.NewProgram()
+		// record stores the counter at the given base slot + n
+		record = func(base int) {
+			body.Push(selfCallCounter)
+			body.Op(ops.SLOAD)
+			body.Op(ops.DUP2)
+			body.Push(base)
+			body.Op(ops.ADD)
+			body.Op(ops.SSTORE)
+		}
+		storageOps = func() {
+			for n := rand.Intn(3); n > 0; n-- {
+				slot := 1 + rand.Intn(3)
+				if rand.Intn(2) == 0 {
+					body.Sstore(slot, rand.Intn(3))
+				} else {
+					// Copy the slot to a slot depending on n
+					body.Push(slot)
+					body.Op(ops.SLOAD)
+					body.Op(ops.DUP2)
+					body.Push(0x400 + 0x10*slot)
+					body.Op(ops.ADD)
+					body.Op(ops.SSTORE)
+				}
+			}
+		}
+	)
+	// The stack holds n throughout. Increment the counter.
+	body.Push(1)
+	body.Push(selfCallCounter)
+	body.Op(ops.SLOAD)
+	body.Op(ops.ADD)
+	body.Push(selfCallCounter)
+	body.Op(ops.SSTORE)
+	storageOps()
+	record(selfCallBefore)
+	// The calldata for the child: n-1
+	body.Push(1)
+	body.Op(ops.DUP2)
+	body.Op(ops.SUB)
+	body.Push(0)
+	body.Op(ops.MSTORE)
+	// CALL(gas, self, value, 0, 32, 0, 0)
+	body.Push(0)
+	body.Push(0)
+	body.Push(32)
+	body.Push(0)
+	body.Push(oneOf(0, 0, 1).(int))
+	if rand.Intn(4) == 0 {
+		body.Push(self)
+	} else {
+		body.Op(ops.ADDRESS)
+	}
+	switch r := rand.Intn(3); {
+	case r == 1 && (forkOp == nil || forkOp.IsValid(ops.SHR)):
+		// Half of the gas left
+		body.Push(1)
+		body.Op(ops.GAS)
+		body.Op(ops.SHR)
+	case r < 2:
+		body.Op(ops.GAS)
+	default:
+		body.Push(rand.Intn(200_000))
+	}
+	body.Op(ops.CALL)
+	body.Op(ops.DUP2)
+	body.Push(selfCallResult)
+	body.Op(ops.ADD)
+	body.Op(ops.SSTORE)
+	record(selfCallAfter)
+	storageOps()
+
+	// PUSH1 0, CALLDATALOAD, DUP1, ISZERO, PUSH2 end, JUMPI
+	var (
+		p   = program.NewProgram()
+		end = 9 + body.Size()
+	)
+	p.Push(0)
+	p.Op(ops.CALLDATALOAD)
+	p.Op(ops.DUP1)
+	p.Op(ops.ISZERO)
+	p.Op(ops.PUSH2)
+	p.AddAll([]byte{byte(end >> 8), byte(end)})
+	p.Op(ops.JUMPI)
+	p.AddAll(body.Bytecode())
+	p.Op(ops.JUMPDEST)
+	p.Op(ops.STOP)
+	return p.Bytecode()
+}
@@ -0,0 +1,174 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"math/big"
+	"math/rand"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/tests"
+	"github.com/holiman/goevmlab/ops"
+	"github.com/holiman/goevmlab/program"
+)
+
+var (
+	selfdestructAddr         = common.HexToAddress("0x00000000000000000000000000000000000ff000")
+	selfdestructExistingAddr = common.HexToAddress("0x00000000000000000000000000000000000ff001")
+)
+
+func fillSelfdestructSelf(gst *GstMaker, fork string) {
+	// EIP-6780 changes what happens to the balance, so now and then the test
+	// is moved to the last fork before it.
+	if config, ok := tests.Forks[fork]; ok && config.IsCancun(common.Big0, 0) && rand.Intn(3) == 0 {
+		fork = "Shanghai"
+		gst.SetFork(fork)
+	}
+	gst.AddAccount(selfdestructExistingAddr, GenesisAccount{
+		Code:    SelfdestructSelfCode(selfdestructExistingAddr),
+		Balance: asBig(oneOf("0x0", "0x1", "0xffff").(string)),
+		Storage: RandStorage(4, 2),
+	})
+	gst.AddAccount(selfdestructAddr, GenesisAccount{
+		Code:    RandSelfdestructSelfCode(fork, selfdestructExistingAddr),
+		Balance: big.NewInt(0xffffff),
+		Storage: make(map[common.Hash]common.Hash),
+	})
+	to := selfdestructAddr
+	if rand.Intn(5) == 0 {
+		// The pre-existing contract destructs at the top level
+		to = selfdestructExistingAddr
+	}
+	gst.SetTx(&StTransaction{
+		// 8M gaslimit
+		GasLimit:   []uint64{8000000},
+		Nonce:      0,
+		Value:      []string{oneOf("0x", "0x01", randHex(4)).(string)},
+		Data:       []string{randHex(100)},
+		GasPrice:   big.NewInt(0x10),
+		To:         to.Hex(),
+		Sender:     sender,
+		PrivateKey: pKey,
+	})
+}
+
+// SelfdestructSelfCode returns code which writes to storage, and then
+// selfdestructs with itself as the beneficiary. If self is non-zero, the
+// beneficiary is (sometimes) pushed as a constant, otherwise it is taken from
+// ADDRESS.
+func SelfdestructSelfCode(self common.Address) []byte {
+	p := program.NewProgram()
+	p.Sstore(0x10, 1)
+	if self != (common.Address{}) && rand.Intn(2) == 0 {
+		p.Push(self)
+	} else {
+		p.Op(ops.ADDRESS)
+	}
+	p.Op(ops.SELFDESTRUCT)
+	return p.Bytecode()
+}
+
+// RandSelfdestructSelfCode creates code with contracts selfdestructing to
+// themselves: the given pre-existing one, and contracts created in the same
+// transaction, either during initcode or when called after creation. After
+// each selfdestruct, the balance, code size and code hash of the contract are
+// stored, and sometimes more value is sent to it.
+func RandSelfdestructSelfCode(fork string, existing common.Address) []byte {
+	var (
+		p      = program.NewProgram()
+		forkOp = ops.LookupFork(fork)
+		slot   = 0
+		store  = func() {
+			p.Push(slot)
+			p.Op(ops.SSTORE)
+			slot++
+		}
+		valid = func(op ops.OpCode) bool {
+			return forkOp == nil || forkOp.IsValid(op)
+		}
+		// The destructing runtime code, and initcode which deploys it
+		runtime  = SelfdestructSelfCode(common.Address{})
+		deployer = program.NewProgram()
+	)
+	deployer.ReturnData(runtime)
+	for n := 1 + rand.Intn(4); n > 0; n-- {
+		target := slot // where the address of the contract is stored
+		switch rand.Intn(3) {
+		case 0: // The pre-existing contract
+			p.Push(existing)
+			store()
+			callStored(p, target, oneOf(0, 0, 1).(int))
+			store()
+		default: // A contract created in this transaction
+			var (
+				code      = SelfdestructSelfCode(common.Address{})
+				callAfter = rand.Intn(2) == 0
+				createOp  = ops.CREATE
+				endowment = oneOf(0, 1, 0xff).(int)
+			)
+			if callAfter {
+				code = deployer.Bytecode()
+			}
+			if rand.Intn(2) == 0 && valid(ops.CREATE2) {
+				createOp = ops.CREATE2
+			}
+			p.Mstore(code, 0)
+			if createOp == ops.CREATE2 {
+				p.Push(slot) // salt
+			}
+			p.Push(len(code))
+			p.Push(0)
+			p.Push(endowment)
+			p.Op(createOp)
+			store()
+			if callAfter {
+				callStored(p, target, oneOf(0, 0, 1).(int))
+				store()
+			}
+		}
+		if rand.Intn(3) == 0 {
+			// More value to the destructed contract
+			callStored(p, target, 1)
+			store()
+		}
+		// The balance, code size and code hash of the contract
+		inspect := []ops.OpCode{ops.BALANCE, ops.EXTCODESIZE}
+		if valid(ops.EXTCODEHASH) {
+			inspect = append(inspect, ops.EXTCODEHASH)
+		}
+		for _, op := range inspect {
+			p.Push(target)
+			p.Op(ops.SLOAD)
+			p.Op(op)
+			store()
+		}
+	}
+	return p.Bytecode()
+}
+
+// callStored calls, with the given value, the address stored at the slot.
+func callStored(p *program.Program, slot, value int) {
+	p.Push(0) // outSize
+	p.Push(0) // outOffset
+	p.Push(0) // inSize
+	p.Push(0) // inOffset
+	p.Push(value)
+	p.Push(slot)
+	p.Op(ops.SLOAD)
+	p.Push(100_000)
+	p.Op(ops.CALL)
+}
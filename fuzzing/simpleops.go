@@ -114,6 +114,9 @@ func generateSimpleOpsProgram(forkDef *ops.Fork) []byte {
 			for i := 0; i < len(op.Pops()); i++ {
 				idx := rand.Intn(len(integers))
 				a, _ := big.NewInt(0).SetString(integers[idx], 16)
+				if v := fromDictionary(); v != nil {
+					a = v
+				}
 				p.Push(a)
 				stackdepth++
 			}
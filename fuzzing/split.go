@@ -0,0 +1,110 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// indexedTxFields are the transaction fields which are indexed by the post
+// state 'indexes'. The access lists go along with the data.
+var indexedTxFields = map[string]string{
+	"data":        "data",
+	"accessLists": "data",
+	"gasLimit":    "gas",
+	"value":       "value",
+}
+
+// SplitStateTest splits a filled state test, which may contain several tests,
+// each with expectations for several forks and (data, gas, value) index
+// combinations, into single-subtest tests. Each returned test has one fork,
+// one post-state and single-element transaction fields, so that all clients
+// execute exactly that combination. The tests are keyed by a descriptive
+// name, and the fields not involved in the split are passed through as-is.
+func SplitStateTest(data []byte) (map[string][]byte, error) {
+	var tests map[string]map[string]json.RawMessage
+	if err := json.Unmarshal(data, &tests); err != nil {
+		return nil, err
+	}
+	var out = make(map[string][]byte)
+	for name, test := range tests {
+		var (
+			tx   map[string]json.RawMessage
+			post map[string][]map[string]json.RawMessage
+		)
+		if err := json.Unmarshal(test["transaction"], &tx); err != nil {
+			return nil, fmt.Errorf("test %v: invalid transaction: %w", name, err)
+		}
+		if err := json.Unmarshal(test["post"], &post); err != nil {
+			return nil, fmt.Errorf("test %v: invalid post: %w", name, err)
+		}
+		for fork, posts := range post {
+			for _, ps := range posts {
+				var idx map[string]int
+				if err := json.Unmarshal(ps["indexes"], &idx); err != nil {
+					return nil, fmt.Errorf("test %v: invalid indexes: %w", name, err)
+				}
+				subName := fmt.Sprintf("%v-%v-d%dg%dv%d", name, fork, idx["data"], idx["gas"], idx["value"])
+				subTx, err := selectTxFields(tx, idx)
+				if err != nil {
+					return nil, fmt.Errorf("test %v: %w", subName, err)
+				}
+				ps["indexes"] = json.RawMessage(`{"data":0,"gas":0,"value":0}`)
+				sub := make(map[string]json.RawMessage)
+				for k, v := range test {
+					sub[k] = v
+				}
+				if sub["transaction"], err = json.Marshal(subTx); err != nil {
+					return nil, err
+				}
+				if sub["post"], err = json.Marshal(map[string][]map[string]json.RawMessage{fork: {ps}}); err != nil {
+					return nil, err
+				}
+				if out[subName], err = json.MarshalIndent(map[string]any{subName: sub}, "", "  "); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return out, nil
+}
+
+// selectTxFields returns a copy of the transaction, where the indexed fields
+// only contain the element selected by the indexes.
+func selectTxFields(tx map[string]json.RawMessage, idx map[string]int) (map[string]json.RawMessage, error) {
+	out := make(map[string]json.RawMessage)
+	for k, v := range tx {
+		out[k] = v
+	}
+	for field, index := range indexedTxFields {
+		raw, ok := tx[field]
+		if !ok {
+			continue
+		}
+		var elems []json.RawMessage
+		if err := json.Unmarshal(raw, &elems); err != nil {
+			return nil, fmt.Errorf("invalid transaction field %v: %w", field, err)
+		}
+		i := idx[index]
+		if i < 0 || i >= len(elems) {
+			return nil, fmt.Errorf("index %v=%d out of range for %v", index, i, field)
+		}
+		out[field], _ = json.Marshal([]json.RawMessage{elems[i]})
+	}
+	return out, nil
+}
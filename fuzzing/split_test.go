@@ -0,0 +1,90 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/tests"
+)
+
+func TestSplitStateTest(t *testing.T) {
+	gst := BasicStateTest("Cancun")
+	gst.EnableFork("Shanghai")
+	gst.SetTx(&StTransaction{
+		GasLimit:   []uint64{100000, 200000},
+		Value:      []string{"0x01"},
+		Data:       []string{"0x01", "0x02"},
+		GasPrice:   big.NewInt(0x10),
+		To:         sender.Hex(),
+		Sender:     sender,
+		PrivateKey: pKey,
+	})
+	st := gst.ToSubTest()
+	st.Post = map[string][]stPostState{
+		"Cancun": {
+			{Indexes: stIndex{Data: 0, Gas: 1}},
+			{Indexes: stIndex{Data: 1, Gas: 0}},
+		},
+		"Shanghai": {
+			{Indexes: stIndex{Data: 1, Gas: 1}},
+		},
+	}
+	data, err := json.Marshal(map[string]*stJSON{"test": st})
+	if err != nil {
+		t.Fatal(err)
+	}
+	split, err := SplitStateTest(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type fields struct {
+		data string
+		gas  uint64
+	}
+	want := map[string]fields{
+		"test-Cancun-d0g1v0":   {"0x01", 200000},
+		"test-Cancun-d1g0v0":   {"0x02", 100000},
+		"test-Shanghai-d1g1v0": {"0x02", 200000},
+	}
+	if len(split) != len(want) {
+		t.Fatalf("have %d tests, want %d", len(split), len(want))
+	}
+	for name, want := range want {
+		var test map[string]*tests.StateTest
+		if err := json.Unmarshal(split[name], &test); err != nil {
+			t.Fatalf("%v: %v", name, err)
+		}
+		subtests := test[name].Subtests()
+		if len(subtests) != 1 {
+			t.Fatalf("%v: have %d subtests, want 1", name, len(subtests))
+		}
+		var sub map[string]stJSON
+		if err := json.Unmarshal(split[name], &sub); err != nil {
+			t.Fatal(err)
+		}
+		tx := sub[name].Tx
+		if len(tx.Data) != 1 || tx.Data[0] != want.data {
+			t.Errorf("%v: wrong data %v", name, tx.Data)
+		}
+		if len(tx.GasLimit) != 1 || tx.GasLimit[0] != want.gas {
+			t.Errorf("%v: wrong gas %v", name, tx.GasLimit)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"math/big"
+	"math/rand"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/holiman/goevmlab/ops"
+	"github.com/holiman/goevmlab/program"
+)
+
+var (
+	sstoreSentryAddr       = common.HexToAddress("0x0000000000000000000000000000000000055e00")
+	sstoreSentryCalleeAddr = common.HexToAddress("0x0000000000000000000000000000000000055e01")
+)
+
+// fillSstoreSentry creates tests where SSTORE is executed with the gas left
+// right around the EIP-1706 sentry (2300). The sentry applies from Istanbul
+// (EIP-2200); in Constantinople (EIP-1283, without the sentry) and earlier,
+// only the plain SSTORE cost applies.
+func fillSstoreSentry(gst *GstMaker, fork string) {
+	burn := rand.Intn(20)
+	// Slots with values, so the SSTOREs are no-ops, modifications or clears
+	storage := make(map[common.Hash]common.Hash)
+	for i := 0; i < 4; i++ {
+		if rand.Intn(2) == 0 {
+			storage[common.BigToHash(big.NewInt(int64(i)))] = common.BigToHash(big.NewInt(int64(1 + rand.Intn(2))))
+		}
+	}
+	gst.AddAccount(sstoreSentryCalleeAddr, GenesisAccount{
+		Code:    SstoreSentryCalleeCode(burn),
+		Balance: new(big.Int),
+		Storage: storage,
+	})
+	gst.AddAccount(sstoreSentryAddr, GenesisAccount{
+		Code:    RandSstoreSentryCode(sstoreSentryCalleeAddr, SstoreSentryCalleeCost(burn)),
+		Balance: big.NewInt(1_000_000),
+		Storage: make(map[common.Hash]common.Hash),
+	})
+	gst.SetTx(&StTransaction{
+		// 8M gaslimit
+		GasLimit:   []uint64{8000000},
+		Nonce:      0,
+		Value:      []string{randHex(4)},
+		Data:       []string{randHex(100)},
+		GasPrice:   big.NewInt(0x10),
+		To:         sstoreSentryAddr.Hex(),
+		Sender:     sender,
+		PrivateKey: pKey,
+	})
+}
+
+// SstoreSentryCalleeCode returns code which burns some gas (with burn PUSH1,
+// POP pairs), and stores the second word of calldata in the slot given by the
+// first word. It only uses ops with a static cost before the SSTORE: see
+// SstoreSentryCalleeCost.
+func SstoreSentryCalleeCode(burn int) []byte {
+	p := program.NewProgram()
+	for i := 0; i < burn; i++ {
+		p.Push(i)
+		p.Op(ops.POP)
+	}
+	p.Push(32)
+	p.Op(ops.CALLDATALOAD)
+	p.Push(0)
+	p.Op(ops.CALLDATALOAD)
+	p.Op(ops.SSTORE)
+	return p.Bytecode()
+}
+
+// SstoreSentryCalleeCost returns the gas the callee uses before the SSTORE.
+func SstoreSentryCalleeCost(burn int) int {
+	return 5*burn + 12
+}
+
+// RandSstoreSentryCode creates code which calls the callee a few times with a
+// slot and a value, giving it just enough gas to arrive at the SSTORE with the
+// gas left at, or a few units around, the sentry. Value transfers add the
+// stipend to the gas given. The results of the calls are stored.
+func RandSstoreSentryCode(callee common.Address, cost int) []byte {
+	var (
+		p     = program.NewProgram()
+		calls = 1 + rand.Intn(8)
+	)
+	for i := 0; i < calls; i++ {
+		left := int(params.SstoreSentryGasEIP2200) + oneOf(-2, -1, 0, 0, 1, 1, 2, rand.Intn(101)-50).(int)
+		var (
+			gas   = cost + left
+			value = 0
+		)
+		if gas >= int(params.CallStipend) && rand.Intn(3) == 0 {
+			gas -= int(params.CallStipend)
+			value = 1
+		}
+		p.Mstore(common.BigToHash(big.NewInt(int64(rand.Intn(4)))).Bytes(), 0)
+		p.Mstore(common.BigToHash(big.NewInt(int64(rand.Intn(3)))).Bytes(), 32)
+		p.Call(big.NewInt(int64(gas)), callee, value, 0, 64, 0, 0)
+		p.Push(0x100 + i)
+		p.Op(ops.SSTORE)
+	}
+	return p.Bytecode()
+}
@@ -0,0 +1,114 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"math/big"
+	"math/rand"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/holiman/goevmlab/ops"
+	"github.com/holiman/goevmlab/program"
+)
+
+// stackLimit is the maximum number of items on the stack.
+const stackLimit = 1024
+
+var stackLimitInner = common.HexToAddress("0x00000000000000000000000000000000005ac001")
+
+// stackBoundaryOps are executed when the stack is close to the limit. Some of
+// them pop before pushing, and are fine on a full stack; others overflow it.
+var stackBoundaryOps = []ops.OpCode{
+	ops.ADD, ops.ADDMOD, ops.ISZERO, ops.CALLDATALOAD, ops.BALANCE, ops.MLOAD,
+	ops.DUP1, ops.DUP16, ops.SWAP1, ops.SWAP16, ops.POP,
+	ops.PC, ops.GAS, ops.MSIZE, ops.CALLER, ops.ADDRESS,
+}
+
+func fillStackLimit(gst *GstMaker, fork string) {
+	dest := common.HexToAddress("0x00000000000000000000000000000000005ac000")
+	// The inner contract fills the stack
+	gst.AddAccount(stackLimitInner, GenesisAccount{
+		Code:    RandStackLimitCode(fork),
+		Balance: new(big.Int),
+		Storage: make(map[common.Hash]common.Hash),
+	})
+	// The outer contract calls it, and records the outcome
+	p := program.NewProgram()
+	for i := 0; i < 1+rand.Intn(3); i++ {
+		p.Call(nil, stackLimitInner, 0, 0, 0, 0, 0)
+		p.Push(i)
+		p.Op(ops.SSTORE)
+	}
+	gst.AddAccount(dest, GenesisAccount{
+		Code:    p.Bytecode(),
+		Balance: new(big.Int),
+		Storage: make(map[common.Hash]common.Hash),
+	})
+	// The transaction goes to either of them
+	to := dest
+	if rand.Intn(4) == 0 {
+		to = stackLimitInner
+	}
+	gst.SetTx(&StTransaction{
+		// 8M gaslimit
+		GasLimit:   []uint64{8000000},
+		Nonce:      0,
+		Value:      []string{randHex(4)},
+		Data:       []string{randHex(100)},
+		GasPrice:   big.NewInt(0x10),
+		To:         to.Hex(),
+		Sender:     sender,
+		PrivateKey: pKey,
+	})
+}
+
+// RandStackLimitCode creates code which grows the stack to just below the
+// limit, using PUSH and DUP, and then executes a few ops which may or may not
+// overflow it. Finally, it writes to storage (if it got that far).
+func RandStackLimitCode(fork string) []byte {
+	var (
+		p      = program.NewProgram()
+		depth  = 0
+		target = stackLimit - 4 + rand.Intn(5) // 1020 - 1024
+		push0  = false
+	)
+	if f := ops.LookupFork(fork); f != nil {
+		push0 = f.IsValid(ops.PUSH0)
+	}
+	for depth < target {
+		switch n := rand.Intn(4); {
+		case n == 0 && push0:
+			p.Op(ops.PUSH0)
+		case n == 1 && depth > 0:
+			// DUP1 - DUP16
+			dup := 1 + rand.Intn(16)
+			if dup > depth {
+				dup = depth
+			}
+			p.Op(ops.DUP1 + ops.OpCode(dup-1))
+		default:
+			p.Push(rand.Intn(256))
+		}
+		depth++
+	}
+	for i := 0; i < 1+rand.Intn(4); i++ {
+		op := stackBoundaryOps[rand.Intn(len(stackBoundaryOps))]
+		p.Op(op)
+	}
+	p.Sstore(0, 1)
+	return p.Bytecode()
+}
@@ -18,15 +18,18 @@ package fuzzing
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
 	"math/big"
 	"os"
+	"strings"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/rawdb"
-	"github.com/ethereum/go-ethereum/core/vm"
-	"github.com/ethereum/go-ethereum/eth/tracers/logger"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/tests"
 )
 
@@ -47,6 +50,25 @@ type GstMaker struct {
 	forks []string
 	root  common.Hash
 	logs  common.Hash
+	// expectException is set if the transaction is invalid
+	expectException string
+
+	senderKey []byte   // senderKey, if set, overrides the default sender key
+	tags      []string // tags describing how the test was generated
+
+	// generator and generatorFork are the name of the factory which made the
+	// test, and the fork it was made for. Along with the seed, they are what
+	// it takes to make the test again.
+	generator     string
+	generatorFork string
+
+	// chainID, if set, is the chain id the transaction is signed with in
+	// blockchain tests. State tests have no signature, clients sign the
+	// transaction themselves.
+	chainID *big.Int
+	// withdrawals are included in the block of blockchain tests (EIP-4895).
+	// State tests cannot express them, and leave them out.
+	withdrawals []*types.Withdrawal
 }
 
 func NewGstMaker() *GstMaker {
@@ -116,13 +138,162 @@ func (g *GstMaker) SetCode(address common.Address, code []byte) {
 	alloc[address] = account
 }
 
+// SetCoinbase sets the coinbase of the block environment.
+func (g *GstMaker) SetCoinbase(coinbase common.Address) {
+	g.env.Coinbase = coinbase
+}
+
+// SetNumber sets the number of the block environment.
+func (g *GstMaker) SetNumber(number uint64) {
+	g.env.Number = number
+}
+
+// SetTimestamp sets the timestamp of the block environment.
+func (g *GstMaker) SetTimestamp(timestamp uint64) {
+	g.env.Timestamp = timestamp
+}
+
+// SetGasLimit sets the gas limit of the block environment.
+func (g *GstMaker) SetGasLimit(gasLimit uint64) {
+	g.env.GasLimit = gasLimit
+}
+
+// SetDifficulty sets the difficulty of the block environment.
+func (g *GstMaker) SetDifficulty(difficulty *big.Int) {
+	g.env.Difficulty = difficulty
+}
+
+// SetRandom sets the prevrandao value of the block environment. Setting it to
+// nil makes the environment a pre-merge one.
+func (g *GstMaker) SetRandom(random *common.Hash) {
+	g.env.Random = random
+}
+
+// SetBaseFee sets the base fee of the block environment.
+func (g *GstMaker) SetBaseFee(baseFee *big.Int) {
+	g.env.BaseFee = baseFee
+}
+
+// SetExcessBlobGas sets the excess blob gas of the block environment, which
+// determines the blob base fee.
+func (g *GstMaker) SetExcessBlobGas(excessBlobGas *uint64) {
+	g.env.ExcessBlobGas = excessBlobGas
+}
+
 func (g *GstMaker) SetResult(root, logs common.Hash) {
 	g.root = root
 	g.logs = logs
 }
 
+// CorruptPost makes the expected post-state (root and logs hash) wrong, so
+// that every client fails the embedded post-state check. This is used to
+// verify that the fuzzer does not mistake such failures for consensus flaws.
+func (g *GstMaker) CorruptPost() {
+	g.root[0] ^= 0xff
+	g.logs[0] ^= 0xff
+}
+
+// SetTx sets the transaction. If a sender key has been configured via
+// SetSenderKey, the transaction is signed by that key.
 func (g *GstMaker) SetTx(tx *StTransaction) {
 	g.tx = *tx
+	if g.senderKey != nil {
+		g.tx.Sender = g.SenderAddress()
+		g.tx.PrivateKey = g.senderKey
+	}
+}
+
+// SetSenderKey configures the private key used to sign the transaction. The
+// sender account, if already present in the pre-state, is moved to the new
+// sender address. Note that the sender must not have code (EIP-3607).
+func (g *GstMaker) SetSenderKey(key []byte) error {
+	if _, err := crypto.ToECDSA(key); err != nil {
+		return err
+	}
+	var (
+		oldAddr = g.SenderAddress()
+		alloc   = *g.pre
+	)
+	g.senderKey = common.CopyBytes(key)
+	newAddr := g.SenderAddress()
+	if acc, ok := alloc[oldAddr]; ok && oldAddr != newAddr {
+		delete(alloc, oldAddr)
+		alloc[newAddr] = acc
+	}
+	if g.tx.PrivateKey != nil {
+		g.tx.Sender = newAddr
+		g.tx.PrivateKey = g.senderKey
+	}
+	return nil
+}
+
+// SetChainID sets the chain id to sign the transaction with, when converted
+// into a blockchain test. A zero chain id means a legacy transaction without
+// replay protection (pre EIP-155). If the chain id differs from the one of
+// the fork, the transaction (and the block) is invalid.
+func (g *GstMaker) SetChainID(chainID *big.Int) {
+	g.chainID = chainID
+}
+
+// SenderKey returns the private key used to sign the transaction.
+func (g *GstMaker) SenderKey() []byte {
+	if g.senderKey != nil {
+		return g.senderKey
+	}
+	return pKey
+}
+
+// SenderAddress returns the address of the transaction sender, which can
+// be referenced by generated code.
+func (g *GstMaker) SenderAddress() common.Address {
+	if g.senderKey == nil {
+		return sender
+	}
+	key, _ := crypto.ToECDSA(g.senderKey)
+	return crypto.PubkeyToAddress(key.PublicKey)
+}
+
+// AddWithdrawal adds a withdrawal to the block of blockchain tests. The index
+// is assigned when the block is generated.
+func (g *GstMaker) AddWithdrawal(w *types.Withdrawal) {
+	g.withdrawals = append(g.withdrawals, w)
+}
+
+// CreateAddress returns the address of the next contract created by the
+// given account, by CREATE or by a creation transaction, derived from its
+// nonce in the pre-state.
+func (g *GstMaker) CreateAddress(creator common.Address) common.Address {
+	return crypto.CreateAddress(creator, (*g.pre)[creator].Nonce)
+}
+
+// AddTag adds a tag describing the test, e.g. the generator strategy or
+// some key parameter. The tags are used to name the test.
+func (g *GstMaker) AddTag(tag string) {
+	g.tags = append(g.tags, tag)
+}
+
+// Describe returns a filename-safe description of the test, made up from
+// the tags. It returns the empty string if the test has no tags.
+func (g *GstMaker) Describe() string {
+	var parts []string
+	for _, tag := range g.tags {
+		tag = strings.Map(func(r rune) rune {
+			if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+				return r
+			}
+			return '_'
+		}, tag)
+		if len(tag) > 0 {
+			parts = append(parts, tag)
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+// Generator returns the name of the factory which made the test, and the fork
+// it was made for. Both are empty if the test was not made by a factory.
+func (g *GstMaker) Generator() (name, fork string) {
+	return g.generator, g.generatorFork
 }
 
 func (g *GstMaker) ToSubTest() *stJSON {
@@ -134,9 +305,10 @@ func (g *GstMaker) ToSubTest() *stJSON {
 		postState := make(map[string][]stPostState)
 		postState[fork] = []stPostState{
 			stPostState{
-				Logs:    g.logs,
-				Root:    g.root,
-				Indexes: stIndex{Gas: 0, Value: 0, Data: 0},
+				Logs:            g.logs,
+				Root:            g.root,
+				Indexes:         stIndex{Gas: 0, Value: 0, Data: 0},
+				ExpectException: g.expectException,
 			},
 		}
 		st.Post = postState
@@ -178,25 +350,44 @@ func (g *GstMaker) EnableFork(fork string) {
 	g.forks = append(g.forks, fork)
 }
 
+// SetFork replaces the enabled forks with the given fork.
+func (g *GstMaker) SetFork(fork string) {
+	g.forks = []string{fork}
+}
+
+// expectedExceptions maps the transaction validation errors which generators
+// may deliberately provoke to the exception names used in state tests.
+var expectedExceptions = []struct {
+	err  error
+	name string
+}{
+	{core.ErrInsufficientFunds, "TransactionException.INSUFFICIENT_ACCOUNT_FUNDS"},
+	// Before London, the value is not part of the upfront balance check, and
+	// a balance short of it fails the transfer instead.
+	{core.ErrInsufficientFundsForTransfer, "TransactionException.INSUFFICIENT_ACCOUNT_FUNDS"},
+	{core.ErrFeeCapTooLow, "TransactionException.INSUFFICIENT_MAX_FEE_PER_GAS"},
+	{core.ErrTipAboveFeeCap, "TransactionException.PRIORITY_GREATER_THAN_MAX_FEE_PER_GAS"},
+	{core.ErrIntrinsicGas, "TransactionException.INTRINSIC_GAS_TOO_LOW"},
+}
+
 // FillTest uses go-ethereum internally to determine the state root and logs, and optionally
 // outputs the trace to the given writer (if non-nil)
+// If the transaction is invalid for one of the expectedExceptions, the test is
+// marked as expecting that exception.
 func (g *GstMaker) Fill(traceOutput io.Writer) error {
-
-	test, err := g.ToStateTest()
-	if err != nil {
-		return err
-	}
-	subtest := test.Subtests()[0]
-	cfg := vm.Config{}
-	if traceOutput != nil {
-		cfg.Tracer = logger.NewJSONLogger(&logger.Config{}, traceOutput)
+	root, logs, err := g.execute(traceOutput, false, rawdb.HashScheme)
+	g.expectException = ""
+	for _, e := range expectedExceptions {
+		if errors.Is(err, e.err) {
+			// The transaction is invalid, and the state unchanged.
+			g.expectException = e.name
+			err = nil
+			break
+		}
 	}
-	state, root, err := test.RunNoVerify(subtest, cfg, false, rawdb.HashScheme)
 	if err != nil {
 		return err
 	}
-	defer state.Close()
-	logs := rlpHash(state.StateDB.Logs())
 	g.SetResult(root, logs)
 	return nil
 }
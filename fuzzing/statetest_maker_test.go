@@ -0,0 +1,113 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/tests"
+)
+
+func TestSenderKey(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	want := crypto.PubkeyToAddress(key.PublicKey)
+
+	gst := BasicStateTest("Cancun")
+	if err := gst.SetSenderKey(crypto.FromECDSA(key)); err != nil {
+		t.Fatal(err)
+	}
+	fillModexp(gst, "Cancun")
+	if have := gst.SenderAddress(); have != want {
+		t.Fatalf("wrong sender address: have %v want %v", have, want)
+	}
+	if _, ok := (*gst.pre)[want]; !ok {
+		t.Fatal("sender missing from pre-state")
+	}
+	if _, ok := (*gst.pre)[sender]; ok {
+		t.Fatal("default sender still in pre-state")
+	}
+	config := tests.Forks["Cancun"]
+	tx, err := gst.signedTx(config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	from, err := types.Sender(types.LatestSigner(config), tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if from != want {
+		t.Fatalf("wrong recovered sender: have %v want %v", from, want)
+	}
+	// The test must be executable with the new sender
+	if err := gst.Fill(nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gst.ToBlockchainTest("test"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDefaultSenderKey(t *testing.T) {
+	gst := BasicStateTest("Cancun")
+	key, err := crypto.ToECDSA(gst.SenderKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have := crypto.PubkeyToAddress(key.PublicKey); have != gst.SenderAddress() {
+		t.Fatalf("default key does not match address: have %v want %v", have, gst.SenderAddress())
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	gst := NewGstMaker()
+	if have := gst.Describe(); have != "" {
+		t.Fatalf("expected empty description, have %q", have)
+	}
+	gst.AddTag("modexp")
+	gst.AddTag("")
+	gst.AddTag("explen 0/1")
+	if have, want := gst.Describe(), "modexp-explen_0_1"; have != want {
+		t.Fatalf("have %q, want %q", have, want)
+	}
+	if have, want := Factory("trie_prefix", "Cancun")().Describe(), "trie_prefix-sharedprefix"; have != want {
+		t.Fatalf("have %q, want %q", have, want)
+	}
+}
+
+func TestCorruptPost(t *testing.T) {
+	gst := Factory("simpleops", "Cancun")()
+	if err := gst.Fill(nil); err != nil {
+		t.Fatal(err)
+	}
+	root, logs := gst.root, gst.logs
+	gst.CorruptPost()
+	if gst.root == root || gst.logs == logs {
+		t.Fatal("post-state not changed")
+	}
+	// The embedded check must now fail
+	test, err := gst.ToStateTest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := test.Run(test.Subtests()[0], vm.Config{}, false, rawdb.HashScheme, func(error, *tests.StateTestState) {}); err == nil {
+		t.Fatal("expected post-state check to fail")
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"math/big"
+	"math/rand"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/holiman/goevmlab/ops"
+	"github.com/holiman/goevmlab/program"
+)
+
+var (
+	// staticRelays recurse into themselves, using CALL, STATICCALL and
+	// DELEGATECALL respectively, before calling the target.
+	staticRelays = []common.Address{
+		common.HexToAddress("0x00000000000000000000000000000000005a7101"),
+		common.HexToAddress("0x00000000000000000000000000000000005a7102"),
+		common.HexToAddress("0x00000000000000000000000000000000005a7103"),
+	}
+	staticRelayOps = []ops.OpCode{ops.CALL, ops.STATICCALL, ops.DELEGATECALL}
+	// staticTargetBase is the address of the first target, each of which does
+	// one (possibly) state-modifying operation.
+	staticTargetBase = 0x5a7200
+)
+
+func fillStaticCall(gst *GstMaker, fork string) {
+	// STATICCALL exists from Byzantium on
+	if !ops.LookupRules(fork).IsByzantium {
+		fork = "Byzantium"
+		gst.SetFork(fork)
+	}
+	dest := common.HexToAddress("0x00000000000000000000000000000000005a7100")
+	for i, addr := range staticRelays {
+		gst.AddAccount(addr, GenesisAccount{
+			Code:    StaticRelayCode(staticRelayOps[i]),
+			Balance: new(big.Int),
+			Storage: make(map[common.Hash]common.Hash),
+		})
+	}
+	targets := staticTargetCodes(fork)
+	for i, code := range targets {
+		gst.AddAccount(common.BigToAddress(big.NewInt(int64(staticTargetBase+i))), GenesisAccount{
+			Code:    code,
+			Balance: big.NewInt(1),
+			Storage: make(map[common.Hash]common.Hash),
+		})
+	}
+	// The entry point, which calls the targets via the relays
+	var (
+		p     = program.NewProgram()
+		calls = 1 + rand.Intn(8)
+	)
+	for i := 0; i < calls; i++ {
+		target := common.BigToAddress(big.NewInt(int64(staticTargetBase + rand.Intn(len(targets)))))
+		p.Mstore(common.BigToHash(big.NewInt(int64(rand.Intn(5)))).Bytes(), 0) // depth
+		p.Mstore(common.LeftPadBytes(target.Bytes(), 32), 32)
+		relay := staticRelays[rand.Intn(len(staticRelays))]
+		if rand.Intn(5) == 0 {
+			// Not static, as a reference
+			p.Call(big.NewInt(200_000), relay, 0, 0, 64, 0, 32)
+		} else {
+			p.StaticCall(big.NewInt(200_000), relay, 0, 64, 0, 32)
+		}
+		p.Push(2 * i)
+		p.Op(ops.SSTORE)
+		p.Push(0)
+		p.Op(ops.MLOAD)
+		p.Push(2*i + 1)
+		p.Op(ops.SSTORE)
+	}
+	gst.AddAccount(dest, GenesisAccount{
+		Code:    p.Bytecode(),
+		Balance: new(big.Int),
+		Storage: make(map[common.Hash]common.Hash),
+	})
+	// The transaction
+	gst.SetTx(&StTransaction{
+		// 8M gaslimit
+		GasLimit:   []uint64{8000000},
+		Nonce:      0,
+		Value:      []string{randHex(4)},
+		Data:       []string{randHex(100)},
+		GasPrice:   big.NewInt(0x10),
+		To:         dest.Hex(),
+		Sender:     sender,
+		PrivateKey: pKey,
+	})
+}
+
+// StaticRelayCode creates code which reads a depth and a target address from
+// calldata. While the depth is non-zero, it calls itself (using the given op)
+// with the depth decremented, otherwise it calls the target. It returns
+// whether the call succeeded.
+func StaticRelayCode(op ops.OpCode) []byte {
+	// The code calling the target
+	leaf := program.NewProgram()
+	leaf.Op(ops.POP)
+	leaf.Push(0).Push(0).Push(0).Push(0) // mem in, mem out
+	leaf.Push(0)                         // value
+	leaf.Push(32)
+	leaf.Op(ops.CALLDATALOAD)
+	leaf.Op(ops.GAS)
+	leaf.Op(ops.CALL)
+	leaf.Push(0)
+	leaf.Op(ops.MSTORE)
+	leaf.Return(0, 32)
+
+	p := program.NewProgram()
+	p.Push(0)
+	p.Op(ops.CALLDATALOAD) // depth
+	p.Op(ops.DUP1)
+	target := p.Size() + 4 + len(leaf.Bytecode())
+	p.Op(ops.PUSH2)
+	p.AddAll([]byte{byte(target >> 8), byte(target)})
+	p.Op(ops.JUMPI)
+	p.AddAll(leaf.Bytecode())
+	// Recurse, with depth-1
+	p.Op(ops.JUMPDEST)
+	p.Push(64).Push(0).Push(0)
+	p.Op(ops.CALLDATACOPY)
+	p.Push(1)
+	p.Op(ops.SWAP1)
+	p.Op(ops.SUB)
+	p.Push(0)
+	p.Op(ops.MSTORE)
+	p.Push(0).Push(0)  // mem out
+	p.Push(64).Push(0) // mem in
+	if op == ops.CALL {
+		p.Push(0) // value
+	}
+	p.Op(ops.ADDRESS)
+	p.Op(ops.GAS)
+	p.Op(op)
+	p.Push(0)
+	p.Op(ops.MSTORE)
+	p.Return(0, 32)
+	return p.Bytecode()
+}
+
+// staticTargetCodes returns the codes of the targets. Each does one operation,
+// most of which modify the state and thus fail in a static context, and then
+// returns 1.
+func staticTargetCodes(fork string) [][]byte {
+	var (
+		forkOp = ops.LookupFork(fork)
+		codes  [][]byte
+	)
+	add := func(op ops.OpCode, fn func(p *program.Program)) {
+		if forkOp != nil && !forkOp.IsValid(op) {
+			return
+		}
+		p := program.NewProgram()
+		fn(p)
+		p.Push(1)
+		p.Push(0)
+		p.Op(ops.MSTORE)
+		p.Return(0, 32)
+		codes = append(codes, p.Bytecode())
+	}
+	add(ops.SSTORE, func(p *program.Program) { p.Sstore(0, 1) })
+	add(ops.TSTORE, func(p *program.Program) { p.Tstore(0, []byte{1}) })
+	for n := 0; n <= 4; n++ {
+		op := ops.LOG0 + ops.OpCode(n)
+		add(op, func(p *program.Program) {
+			for i := 0; i < n; i++ {
+				p.Push(i)
+			}
+			p.Push(0).Push(0).Op(op)
+		})
+	}
+	add(ops.CREATE, func(p *program.Program) {
+		p.Push(0).Push(0).Push(0).Op(ops.CREATE)
+		p.Op(ops.POP)
+	})
+	add(ops.CREATE2, func(p *program.Program) {
+		p.Push(0).Push(0).Push(0).Push(0).Op(ops.CREATE2)
+		p.Op(ops.POP)
+	})
+	add(ops.SELFDESTRUCT, func(p *program.Program) {
+		p.Push(common.HexToAddress("0xdead"))
+		p.Op(ops.SELFDESTRUCT)
+	})
+	// Calls with value are forbidden, but not those without
+	add(ops.CALL, func(p *program.Program) {
+		p.Call(nil, common.HexToAddress("0xdead"), 1, 0, 0, 0, 0)
+		p.Op(ops.POP)
+	})
+	add(ops.CALL, func(p *program.Program) {
+		p.Call(nil, common.HexToAddress("0xdead"), 0, 0, 0, 0, 0)
+		p.Op(ops.POP)
+	})
+	// Reading is allowed
+	add(ops.SLOAD, func(p *program.Program) {
+		p.Push(0)
+		p.Op(ops.SLOAD)
+		p.Op(ops.POP)
+	})
+	return codes
+}
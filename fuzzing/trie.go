@@ -0,0 +1,176 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"math/big"
+	"math/rand"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/holiman/goevmlab/ops"
+	"github.com/holiman/goevmlab/program"
+)
+
+// The storage key patterns used by the trie generators.
+const (
+	// TrieSequential uses the lowest slots, 0, 1, 2...
+	TrieSequential = "sequential"
+	// TrieSparse uses random slots, which yields a shallow and wide trie.
+	TrieSparse = "sparse"
+	// TrieSharedPrefix uses slots whose hashes (the trie paths) share long
+	// prefixes, which yields a deep trie.
+	TrieSharedPrefix = "sharedprefix"
+)
+
+// TriePatterns are the available storage key patterns.
+var TriePatterns = []string{TrieSequential, TrieSparse, TrieSharedPrefix}
+
+func fillTrie(gst *GstMaker, fork string) {
+	fillTriePattern(gst, TriePatterns[rand.Intn(len(TriePatterns))])
+}
+
+// TrieFiller returns a filler which uses the given storage key pattern.
+func TrieFiller(pattern string) func(*GstMaker, string) {
+	return func(gst *GstMaker, fork string) {
+		fillTriePattern(gst, pattern)
+	}
+}
+
+func fillTriePattern(gst *GstMaker, pattern string) {
+	gst.AddTag(pattern)
+	dest := common.HexToAddress("0x00000000000000000000000000000000007e1e00")
+	slots := trieSlots(pattern, 16+rand.Intn(200))
+	storage := make(map[common.Hash]common.Hash)
+	for _, slot := range slots {
+		storage[slot] = randTrieValue()
+	}
+	gst.AddAccount(dest, GenesisAccount{
+		Code:    RandTrieMutations(pattern, slots),
+		Balance: new(big.Int),
+		Storage: storage,
+	})
+	// The transaction
+	gst.SetTx(&StTransaction{
+		// 8M gaslimit
+		GasLimit:   []uint64{8000000},
+		Nonce:      0,
+		Value:      []string{randHex(4)},
+		Data:       []string{randHex(100)},
+		GasPrice:   big.NewInt(0x10),
+		To:         dest.Hex(),
+		Sender:     sender,
+		PrivateKey: pKey,
+	})
+}
+
+// trieSlots returns n storage slots following the given pattern.
+func trieSlots(pattern string, n int) []common.Hash {
+	var slots []common.Hash
+	switch pattern {
+	case TrieSequential:
+		for i := 0; i < n; i++ {
+			slots = append(slots, common.BigToHash(big.NewInt(int64(i))))
+		}
+	case TrieSharedPrefix:
+		// Build a few groups, each one sharing a prefix of 1-3 nibbles.
+		for len(slots) < n {
+			var (
+				base     = randHash()
+				nibbles  = 1 + rand.Intn(3)
+				size     = 2 + rand.Intn(6)
+				baseHash = crypto.Keccak256Hash(base[:])
+			)
+			slots = append(slots, base)
+			slots = append(slots, slotsWithHashPrefix(baseHash, nibbles, size)...)
+		}
+		slots = slots[:n]
+	default:
+		for i := 0; i < n; i++ {
+			slots = append(slots, randHash())
+		}
+	}
+	return slots
+}
+
+// slotsWithHashPrefix returns count slots whose hashes share the first
+// nibbles with the given hash.
+func slotsWithHashPrefix(hash common.Hash, nibbles, count int) []common.Hash {
+	var slots []common.Hash
+	for len(slots) < count {
+		slot := randHash()
+		if sharedNibbles(hash, crypto.Keccak256Hash(slot[:])) >= nibbles {
+			slots = append(slots, slot)
+		}
+	}
+	return slots
+}
+
+func sharedNibbles(a, b common.Hash) int {
+	for i := 0; i < 2*len(a); i++ {
+		na, nb := a[i/2], b[i/2]
+		if i%2 == 0 {
+			na, nb = na>>4, nb>>4
+		}
+		if na&0xf != nb&0xf {
+			return i
+		}
+	}
+	return 2 * len(a)
+}
+
+func randHash() common.Hash {
+	var h common.Hash
+	_, _ = rand.Read(h[:])
+	return h
+}
+
+// randTrieValue returns a non-zero storage value. Short values result in trie
+// nodes which are embedded in their parents, long values in hashed nodes.
+func randTrieValue() common.Hash {
+	if rand.Intn(2) == 0 {
+		return common.BigToHash(big.NewInt(int64(1 + rand.Intn(255))))
+	}
+	h := randHash()
+	h[0] |= 1
+	return h
+}
+
+// RandTrieMutations creates code which modifies a few of the given slots:
+// clearing them (which collapses trie nodes), changing the value, or writing
+// new slots following the same pattern (which splits nodes).
+func RandTrieMutations(pattern string, slots []common.Hash) []byte {
+	p := program.NewProgram()
+	for n := 1 + rand.Intn(10); n > 0; n-- {
+		slot := slots[rand.Intn(len(slots))]
+		switch rand.Intn(4) {
+		case 0, 1: // Delete
+			p.Sstore(slot.Big(), 0)
+		case 2: // Modify
+			p.Sstore(slot.Big(), randTrieValue().Big())
+		default: // New slot
+			p.Sstore(trieSlots(pattern, 1)[0].Big(), randTrieValue().Big())
+		}
+		if rand.Intn(4) == 0 {
+			// Read it back, now and then
+			p.Push(slot.Big())
+			p.Op(ops.SLOAD)
+			p.Op(ops.POP)
+		}
+	}
+	return p.Bytecode()
+}
@@ -0,0 +1,142 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"math/big"
+	"math/rand"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/tests"
+	"github.com/holiman/goevmlab/ops"
+	"github.com/holiman/goevmlab/program"
+)
+
+var (
+	warmCoinbaseAddr     = common.HexToAddress("0x0000000000000000000000000000000000003651")
+	warmCoinbaseContract = common.HexToAddress("0x00000000000000000000000000000000000c0b00")
+)
+
+func fillWarmCoinbase(gst *GstMaker, fork string) {
+	// EIP-3651 pre-warms the coinbase from Shanghai on, so now and then the
+	// test is moved to the last fork before it.
+	config, ok := tests.Forks[fork]
+	if ok && config.IsShanghai(common.Big0, 0) && rand.Intn(3) == 0 {
+		fork = "Merge"
+		gst.SetFork(fork)
+		config = tests.Forks[fork]
+	}
+	// The coinbase is a fresh account, or one with code
+	coinbase := common.HexToAddress(oneOf(
+		"0x00000000000000000000000000000000000c0b01",
+		warmCoinbaseContract.Hex(),
+	).(string))
+	gst.SetCoinbase(coinbase)
+	if coinbase == warmCoinbaseContract {
+		gst.AddAccount(warmCoinbaseContract, GenesisAccount{
+			Code:    RandStorageOps().Bytecode(),
+			Balance: big.NewInt(1),
+			Storage: RandStorage(4, 2),
+		})
+	}
+	gst.AddAccount(warmCoinbaseAddr, GenesisAccount{
+		Code:    RandWarmCoinbaseCode(fork, coinbase),
+		Balance: big.NewInt(0xffff),
+		Storage: make(map[common.Hash]common.Hash),
+	})
+	tx := &StTransaction{
+		// 8M gaslimit
+		GasLimit:   []uint64{8000000},
+		Nonce:      0,
+		Value:      []string{randHex(4)},
+		Data:       []string{randHex(100)},
+		GasPrice:   big.NewInt(0x10),
+		To:         warmCoinbaseAddr.Hex(),
+		Sender:     sender,
+		PrivateKey: pKey,
+	}
+	// Now and then the coinbase is (also) warmed by the access list
+	if ok && config.IsBerlin(common.Big0) && rand.Intn(4) == 0 {
+		tx.AccessLists = []*types.AccessList{{{Address: coinbase, StorageKeys: []common.Hash{}}}}
+		gst.AddTag("acl")
+	}
+	gst.SetTx(tx)
+}
+
+// RandWarmCoinbaseCode creates code which, right at the start, accesses the
+// coinbase: with BALANCE, EXTCODESIZE, EXTCODEHASH, EXTCODECOPY or a call.
+// The address is taken from COINBASE, or pushed as a constant. The gas spent
+// by each access is stored, so the state depends on whether the coinbase was
+// warm to begin with.
+func RandWarmCoinbaseCode(fork string, coinbase common.Address) []byte {
+	var (
+		p      = program.NewProgram()
+		forkOp = ops.LookupFork(fork)
+		slot   = 0
+		access = []ops.OpCode{ops.BALANCE, ops.EXTCODESIZE, ops.EXTCODECOPY, ops.CALL, ops.STATICCALL}
+	)
+	if forkOp == nil || forkOp.IsValid(ops.EXTCODEHASH) {
+		access = append(access, ops.EXTCODEHASH)
+	}
+	pushCoinbase := func() {
+		if rand.Intn(2) == 0 {
+			p.Op(ops.COINBASE)
+		} else {
+			p.Push(coinbase)
+		}
+	}
+	for n := 1 + rand.Intn(3); n > 0; n-- {
+		op := access[rand.Intn(len(access))]
+		if forkOp != nil && !forkOp.IsValid(op) {
+			op = ops.BALANCE
+		}
+		// The gas before the access stays on the stack
+		p.Op(ops.GAS)
+		switch op {
+		case ops.EXTCODECOPY:
+			p.Push(32)
+			p.Push(0)
+			p.Push(0)
+			pushCoinbase()
+			p.Op(op)
+		case ops.CALL, ops.STATICCALL:
+			p.Push(0) // outSize
+			p.Push(0) // outOffset
+			p.Push(0) // inSize
+			p.Push(0) // inOffset
+			if op == ops.CALL {
+				p.Push(oneOf(0, 0, 1).(int))
+			}
+			pushCoinbase()
+			p.Push(10_000)
+			p.Op(op)
+			p.Op(ops.POP)
+		default:
+			pushCoinbase()
+			p.Op(op)
+			p.Op(ops.POP)
+		}
+		p.Op(ops.GAS)
+		p.Op(ops.SWAP1)
+		p.Op(ops.SUB)
+		p.Push(slot)
+		p.Op(ops.SSTORE)
+		slot++
+	}
+	return p.Bytecode()
+}
@@ -0,0 +1,132 @@
+// Copyright 2024 Martin Holst Swende
+// This file is part of the goevmlab library.
+//
+// The library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the goevmlab library. If not, see <http://www.gnu.org/licenses/>.
+
+package fuzzing
+
+import (
+	"math"
+	"math/big"
+	"math/rand"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/holiman/goevmlab/ops"
+	"github.com/holiman/goevmlab/program"
+)
+
+var (
+	withdrawalsAddr = common.HexToAddress("0x0000000000000000000000000000000000489500")
+	// withdrawalsCode is an account with code, receiving withdrawals, which is
+	// not executed by them
+	withdrawalsCode = common.HexToAddress("0x0000000000000000000000000000000000489501")
+	// withdrawalsEmpty is an empty account (EIP-161), in the pre-state
+	withdrawalsEmpty = common.HexToAddress("0x0000000000000000000000000000000000489502")
+	// withdrawalsMissing does not exist
+	withdrawalsMissing = common.HexToAddress("0x0000000000000000000000000000000000489503")
+)
+
+// fillWithdrawals creates a test whose block contains withdrawals (EIP-4895),
+// crediting various kinds of accounts. It is meant for blockchain tests: state
+// tests cannot express withdrawals, so they only contain the transaction.
+func fillWithdrawals(gst *GstMaker, fork string) {
+	// Withdrawals exist from Shanghai on
+	if !ops.LookupRules(fork).IsShanghai {
+		fork = "Shanghai"
+		gst.SetFork(fork)
+	}
+	gst.AddAccount(withdrawalsCode, GenesisAccount{
+		Code:    []byte{byte(ops.CALLER), byte(ops.SELFDESTRUCT)},
+		Balance: big.NewInt(1),
+		Nonce:   1,
+		Storage: map[common.Hash]common.Hash{{}: common.BigToHash(big.NewInt(1))},
+	})
+	gst.AddAccount(withdrawalsEmpty, GenesisAccount{
+		Balance: new(big.Int),
+		Storage: make(map[common.Hash]common.Hash),
+	})
+	recipients := []common.Address{
+		withdrawalsAddr, withdrawalsCode, withdrawalsEmpty, withdrawalsMissing,
+		gst.SenderAddress(), gst.env.Coinbase, params.BeaconRootsStorageAddress,
+		common.BytesToAddress([]byte{byte(1 + rand.Intn(10))}), // a precompile
+	}
+	gst.AddAccount(withdrawalsAddr, GenesisAccount{
+		Code:    RandWithdrawalsTxCode(recipients),
+		Balance: big.NewInt(1_000_000),
+		Storage: make(map[common.Hash]common.Hash),
+	})
+	for n := rand.Intn(17); n > 0; n-- {
+		gst.AddWithdrawal(&types.Withdrawal{
+			Validator: uint64(oneOf(0, 1, rand.Intn(1_000_000), math.MaxInt64).(int)),
+			Address:   recipients[rand.Intn(len(recipients))],
+			Amount:    randWithdrawalAmount(),
+		})
+	}
+	gst.SetTx(&StTransaction{
+		// 8M gaslimit
+		GasLimit:   []uint64{8000000},
+		Nonce:      0,
+		Value:      []string{randHex(4)},
+		Data:       []string{randHex(100)},
+		GasPrice:   big.NewInt(0x10),
+		To:         withdrawalsAddr.Hex(),
+		Sender:     sender,
+		PrivateKey: pKey,
+	})
+}
+
+// randWithdrawalAmount returns an amount, in Gwei, to withdraw: zero, which
+// only touches the account, a small or random amount, or the maximum, which
+// is credited as more than 2^64 wei.
+func randWithdrawalAmount() uint64 {
+	switch rand.Intn(5) {
+	case 0:
+		return 0
+	case 1:
+		return uint64(1 + rand.Intn(3))
+	case 2:
+		return math.MaxUint64
+	}
+	return rand.Uint64() >> rand.Intn(64)
+}
+
+// RandWithdrawalsTxCode creates code for the transaction of the block, which
+// modifies the recipients of the withdrawals before they are credited: it
+// stores their balances, sends value to them, and may self-destruct to one.
+func RandWithdrawalsTxCode(recipients []common.Address) []byte {
+	var (
+		p    = program.NewProgram()
+		slot = 0
+	)
+	for _, addr := range recipients {
+		switch rand.Intn(3) {
+		case 0:
+			p.Push(addr)
+			p.Op(ops.BALANCE)
+			p.Push(slot)
+			p.Op(ops.SSTORE)
+			slot++
+		case 1:
+			p.Call(big.NewInt(50_000), addr, rand.Intn(2), 0, 0, 0, 0)
+			p.Op(ops.POP)
+		}
+	}
+	if rand.Intn(4) == 0 {
+		p.Push(recipients[rand.Intn(len(recipients))])
+		p.Op(ops.SELFDESTRUCT)
+	}
+	return p.Bytecode()
+}
@@ -168,6 +168,25 @@ func ValidOpcodesInFork(fork string) ([]OpCode, error) {
 	return nil, fmt.Errorf("fork %v not defined", fork)
 }
 
+// ForkNames returns the names of the defined forks, in activation order.
+func ForkNames() []string {
+	var names []string
+	for _, f := range forks {
+		names = append(names, f.Name)
+	}
+	return names
+}
+
+// IsValid returns true if the opcode is defined in the fork.
+func (f Fork) IsValid(op OpCode) bool {
+	for _, valid := range f.ValidOpcodes {
+		if valid == op {
+			return true
+		}
+	}
+	return false
+}
+
 // RandomOp returns a random (valid) opcode
 func (f Fork) RandomOp(rnd byte) OpCode {
 	return f.ValidOpcodes[int(rnd)%len(f.ValidOpcodes)]
@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+// TokenBucket is a rate limiter, which allows events to happen at a given
+// rate, with occasional bursts.
+type TokenBucket struct {
+	mu     sync.Mutex
+	rate   float64 // tokens added per second
+	burst  float64 // max number of tokens held
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket creates a bucket which fills up with rate tokens per second,
+// holding at most burst tokens. The bucket starts out full.
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	return &TokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Wait takes a token from the bucket, blocking until one is available.
+func (b *TokenBucket) Wait() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	b.tokens--
+	if b.tokens < 0 {
+		// We're in debt, wait until it has been paid off. Other callers
+		// queue up on the lock meanwhile.
+		time.Sleep(time.Duration(-b.tokens / b.rate * float64(time.Second)))
+	}
+}
@@ -0,0 +1,18 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	b := NewTokenBucket(100, 5)
+	start := time.Now()
+	// The first five are allowed immediately, the next 20 need 200ms
+	for i := 0; i < 25; i++ {
+		b.Wait()
+	}
+	if elapsed := time.Since(start); elapsed < 190*time.Millisecond {
+		t.Fatalf("rate not limited, elapsed %v", elapsed)
+	}
+}